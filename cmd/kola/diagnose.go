@@ -0,0 +1,225 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/system/exec"
+)
+
+const (
+	minFreeDisk  = 10 << 30
+	minOpenFiles = 4096
+)
+
+var cmdDiagnose = &cobra.Command{
+	Run:    runDiagnose,
+	PreRun: preRun,
+	Use:    "diagnose",
+	Short:  "Check the host can run kola tests",
+	Long: `Check the host meets the requirements for running kola tests on the
+selected platform and suggest how to fix any problems found.
+
+Exits non-zero if a requirement is not met. Warnings do not
+prevent tests from running but may cause failures or slowness.
+`}
+
+// diagnosis is the outcome of a single host check. An empty problem means
+// the check passed.
+type diagnosis struct {
+	name    string
+	problem string
+	remedy  string
+	warning bool // the problem is not fatal
+}
+
+func init() {
+	root.AddCommand(cmdDiagnose)
+}
+
+func runDiagnose(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "No args accepted\n")
+		os.Exit(2)
+	}
+
+	var results []diagnosis
+	results = append(results, checkOpenFiles())
+	results = append(results, checkFreeDisk("output directory", outputDir))
+	if kolaPlatform == "qemu" {
+		results = append(results, checkRoot())
+		results = append(results, checkKVM())
+		results = append(results, checkNestedVirt())
+		results = append(results, checkFreeDisk("temporary directory", os.TempDir()))
+		results = append(results, checkFile("disk image", kola.QEMUOptions.DiskImage,
+			"build an image with ./build_image or pass --qemu-image"))
+		results = append(results, checkBinaries(qemuBinaries()...)...)
+	}
+
+	failed := false
+	for _, d := range results {
+		switch {
+		case d.problem == "":
+			fmt.Printf("ok    %s\n", d.name)
+		case d.warning:
+			fmt.Printf("WARN  %s: %s\n", d.name, d.problem)
+		default:
+			fmt.Printf("FAIL  %s: %s\n", d.name, d.problem)
+			failed = true
+		}
+		if d.problem != "" && d.remedy != "" {
+			fmt.Printf("      %s\n", d.remedy)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// qemuBinaries lists the programs the QEMU platform runs.
+func qemuBinaries() []string {
+	bins := []string{"cp", "dnsmasq"}
+	switch kola.QEMUOptions.Board {
+	case "amd64-usr":
+		bins = append(bins, "qemu-system-x86_64")
+	case "arm64-usr":
+		bins = append(bins, "qemu-system-aarch64")
+	}
+	if kola.QEMUOptions.TPM {
+		bins = append(bins, "swtpm")
+	}
+	return bins
+}
+
+func checkBinaries(names ...string) []diagnosis {
+	var results []diagnosis
+	for _, name := range names {
+		d := diagnosis{name: "program " + name}
+		if _, err := exec.LookPath(name); err != nil {
+			d.problem = "not found in $PATH"
+			d.remedy = fmt.Sprintf("install the package providing %s", name)
+		}
+		results = append(results, d)
+	}
+	return results
+}
+
+func checkRoot() diagnosis {
+	d := diagnosis{name: "root privileges"}
+	if os.Geteuid() != 0 {
+		d.problem = "the qemu platform creates network namespaces and bridges"
+		d.remedy = "run kola as root, for example with sudo"
+	}
+	return d
+}
+
+func checkKVM() diagnosis {
+	d := diagnosis{name: "KVM"}
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		d.problem = "/dev/kvm does not exist"
+		d.remedy = "enable virtualization in the firmware and load the kvm_intel or kvm_amd module"
+	} else if err != nil {
+		d.problem = err.Error()
+		d.remedy = "add the user to the kvm group or run kola as root"
+	} else {
+		f.Close()
+	}
+	return d
+}
+
+// checkNestedVirt warns if nested virtualization is disabled, since some
+// tests run VMs or containers needing hardware virtualization in guests.
+func checkNestedVirt() diagnosis {
+	d := diagnosis{name: "nested virtualization", warning: true}
+	for _, module := range []string{"kvm_intel", "kvm_amd"} {
+		data, err := ioutil.ReadFile(filepath.Join("/sys/module", module, "parameters/nested"))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(data)) {
+		case "Y", "1":
+			return d
+		}
+		d.problem = "disabled"
+		d.remedy = fmt.Sprintf("reload the module with: modprobe -r %s && modprobe %s nested=1", module, module)
+		return d
+	}
+	d.problem = "unknown, no KVM module is loaded"
+	return d
+}
+
+func checkOpenFiles() diagnosis {
+	d := diagnosis{name: "open file limit", warning: true}
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		d.problem = err.Error()
+		return d
+	}
+	if rlim.Cur < minOpenFiles {
+		d.problem = fmt.Sprintf("%d is low for parallel tests", rlim.Cur)
+		d.remedy = fmt.Sprintf("raise it with: ulimit -n %d", minOpenFiles)
+	}
+	return d
+}
+
+// checkFreeDisk checks the filesystem containing path, or its closest
+// existing parent, has space for disk images and logs.
+func checkFreeDisk(what, path string) diagnosis {
+	d := diagnosis{name: "free space in " + what, warning: true}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		d.problem = err.Error()
+		return d
+	}
+	for {
+		if _, err := os.Stat(path); err == nil || path == filepath.Dir(path) {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		d.problem = err.Error()
+		return d
+	}
+	free := uint64(st.Bavail) * uint64(st.Bsize)
+	if free < minFreeDisk {
+		d.problem = fmt.Sprintf("only %d MiB free in %s", free>>20, path)
+		d.remedy = fmt.Sprintf("free at least %d GiB or use a different directory", minFreeDisk>>30)
+	}
+	return d
+}
+
+func checkFile(what, path, remedy string) diagnosis {
+	d := diagnosis{name: what}
+	if _, err := os.Stat(path); err != nil {
+		d.problem = err.Error()
+		d.remedy = remedy
+	}
+	return d
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/coreos/mantle/cli"
 	"github.com/coreos/mantle/kola"
@@ -53,11 +54,18 @@ var (
 		Short: "List kola test names",
 		Run:   runList,
 	}
+
+	cmdResultsSchema = &cobra.Command{
+		Use:   "results-schema",
+		Short: "Print the BigQuery schema for --results-file",
+		Run:   runResultsSchema,
+	}
 )
 
 func init() {
 	root.AddCommand(cmdRun)
 	root.AddCommand(cmdList)
+	root.AddCommand(cmdResultsSchema)
 }
 
 func main() {
@@ -84,6 +92,11 @@ func runRun(cmd *cobra.Command, args []string) {
 		pattern = "*" // run all tests by default
 	}
 
+	kola.Flags = make(map[string]string)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		kola.Flags[f.Name] = f.Value.String()
+	})
+
 	err := kola.RunTests(pattern, kolaPlatform, outputDir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -112,6 +125,10 @@ func runList(cmd *cobra.Command, args []string) {
 	w.Flush()
 }
 
+func runResultsSchema(cmd *cobra.Command, args []string) {
+	fmt.Print(kola.ResultsSchema)
+}
+
 type item struct {
 	Name          string
 	Platforms     []string
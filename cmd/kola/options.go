@@ -16,13 +16,20 @@ package main
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/cli"
 	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/cache"
 	"github.com/coreos/mantle/sdk"
 )
 
 var (
 	outputDir          string
+	manifests          []string
+	policies           []string
 	kolaPlatform       string
 	defaultTargetBoard = sdk.DefaultBoard()
 	kolaDefaultImages  = map[string]string{
@@ -39,34 +46,124 @@ var (
 func init() {
 	sv := root.PersistentFlags().StringVar
 	bv := root.PersistentFlags().BoolVar
+	ssv := root.PersistentFlags().StringSliceVar
+
+	cli.WrapPreRun(root, loadManifests)
 
 	// general options
 	sv(&outputDir, "output-dir", "_kola_temp", "Temporary output directory for test data and logs")
 	sv(&kolaPlatform, "platform", "qemu", "VM platform: qemu, gce, aws")
-	root.PersistentFlags().IntVar(&kola.TestParallelism, "parallel", 1, "number of tests to run in parallel")
+	root.PersistentFlags().IntVar(&kola.TestParallelism, "parallel", 1, "number of tests to run in parallel, counting a test once for each machine")
 	sv(&kola.TAPFile, "tapfile", "", "file to write TAP results to")
+	sv(&kola.JUnitFile, "junit-file", "", "file to write a JUnit XML report to")
+	sv(&kola.JSONFile, "json", "", "file to write go test -json events to, or - for stdout instead of the usual output")
+	sv(&kola.ResultsFile, "results-file", "", "file to append newline-delimited JSON results to")
+	bv(&kola.CollapseLogs, "collapse-logs", false, "collapse repeated test log messages")
+	root.PersistentFlags().IntVar(&kola.MaxProcs, "max-procs", 0, "run at most n QEMU and helper processes at once across all tests (0 means unlimited)")
+	root.PersistentFlags().DurationVar(&kola.TestTimeout, "test-timeout", 0, "fail each test that runs longer than this, instead of hanging the run (0 means unlimited)")
+	root.PersistentFlags().DurationVar(&kola.Watchdog, "watchdog", 0, "save goroutine stacks to the output directory of tests which log nothing for this long (0 means disabled)")
+	bv(&kola.WatchdogKill, "watchdog-kill", false, "fail tests found stalled by --watchdog")
+	root.PersistentFlags().DurationVar(&kola.Progress, "progress", 0, "print how many tests are running, finished, and queued, and how long the running ones have taken, this often (0 means disabled)")
+	root.PersistentFlags().IntVar(&kola.Slowest, "slowest", 0, "list this many of the slowest tests, and how long all tests took compared to the whole run, once it finishes")
+	bv(&kola.ProfileTests, "profile-tests", false, "write CPU and heap profiles of each test to its output directory")
+	sv(&kola.SecretsEnvPrefix, "secrets-env-prefix", "KOLA_SECRET_", "look up secrets for tests in environment variables with this prefix, e.g. $KOLA_SECRET_AWS_TOKEN for aws-token")
+	sv(&kola.SecretsDir, "secrets-dir", "", "look up secrets for tests in files named after them in this directory")
+	sv(&kola.SecretsGCPProject, "secrets-gcp-project", "", "look up secrets for tests in this project's Google Cloud Secret Manager, with --gce-service-auth or --gce-json-key")
+	root.PersistentFlags().DurationVar(&kola.GracePeriod, "grace-period", 2*time.Minute, "on SIGINT or SIGTERM, wait this long for running tests to destroy their machines before reporting them as interrupted")
+	root.PersistentFlags().Var(&kola.FailBudget, "failure-budget", "only fail the run if more than N, or N%, of the tests fail, optionally only counting tests whose tags match N:expr")
+	root.PersistentFlags().Var(&kola.Quarantine, "quarantine", "comma-separated tests which still run but whose failures don't fail the run")
+	root.PersistentFlags().Var(&kola.FailSeverity, "fail-severity", "only fail the run for failed tests of at least this severity: critical, major, or minor")
+	sv(&kola.Shuffle, "shuffle", "off", "start tests in random order: off, on, or the seed printed by an earlier shuffled run")
+	root.PersistentFlags().Var(&kola.Shard, "shard", "run only shard N/M of the tests, for splitting a run between M machines")
+	sv(&kola.DataDir, "data-dir", "", "directory of test data files such as golden files (default \"testdata\")")
+	bv(&kola.UpdateGolden, "update-golden", false, "replace golden files with the output of the tests instead of comparing with them")
+	root.PersistentFlags().IntVar(&kola.Retries, "retries", 0, "run failed tests again up to n times, reporting tests which then pass as flaky")
+	root.PersistentFlags().IntVar(&kola.Count, "count", 1, "run each test n times, listing how often each passed and how long it took")
+	bv(&kola.CountParallel, "count-parallel", false, "run the repeats of each test from --count in parallel")
+	sv(&kola.FlakeHistory, "flake-history", "", "file of past results from --results-file; allow one retry only to tests which flaked in more than --flake-rate of their runs")
+	sv(&kola.DurHistory, "duration-history", "", "file of past results from --results-file; estimate how long the run has left from how long tests took in them in --progress lines")
+	bv(&kola.RerunFailed, "rerun-failed", false, "run only the tests which failed or didn't run in the last run with the same --output-dir")
+	root.PersistentFlags().Float64Var(&kola.FlakeRate, "flake-rate", 0.05, "fraction of past runs a test must have flaked in to be retried under --flake-history")
+	root.PersistentFlags().IntVar(&kola.MaxFailures, "max-failures", 0, "stop starting tests after n have failed, e.g. when the image is broken (0 means unlimited)")
+	bv(&kola.FailFast, "fail-fast", false, "stop the run at the first failed test, cancelling tests still running")
+	sv(&kola.OnFailureCmd, "on-failure", "", "shell command to run on the host when a test fails, before its machines are destroyed")
+	bv(&kola.InfraServer, "infra-server", false, "on gce and aws, start a server providing NTP, DNS, and an HTTP proxy to machines without internet access")
+	root.PersistentFlags().IntVar(&kola.LogRate, "log-rate", 0, "log at most n messages per second for each test (0 means unlimited)")
+	root.PersistentFlags().Var(&kola.LogLevel, "log-level", "drop leveled test log messages below this level: debug, info, or warn")
+	sv(&kola.LogTimestamps, "log-timestamps", "off", "prefix test log lines with timestamps: off, rfc3339, or relative to the test's start")
 	sv(&kola.Options.BaseName, "basename", "kola", "Cluster name prefix")
+	ssv(&manifests, "manifest", nil, "YAML manifest of additional tests to load")
+	ssv(&policies, "compliance-policy", nil, "YAML policy of hardening checks to load as a test")
+	ssv(&kola.Tags, "tag", nil, "only run tests with one of these tags, and matching --tag-match if given")
+	sv(&kola.TagMatch, "tag-match", "", "only run tests whose tags match an expression, such as 'reboot || network && !slow'")
+	sv(&kola.ListTests, "list-tests", "", "list the tests matching a regexp which would run, with their tags, without running them")
+	sv(&kola.Cgroup, "cgroup", "", "cgroup v2 directory to create a cgroup for each test's QEMU processes under")
+	root.PersistentFlags().Float64Var(&kola.CPUQuota, "cpu-quota", 0, "limit each test's QEMU processes to n CPUs, requires --cgroup (0 means unlimited)")
+	sv(&kola.CPUSet, "cpuset", "", "restrict each test's QEMU processes to these CPUs, requires --cgroup")
+	sv(&kola.GatingFile, "gating-policy", "", "YAML file marking tests as blocking or informational")
+	sv(&kola.BaselineFile, "baseline", "", "YAML file of known failing tests, only other failures fail the run")
+	sv(&kola.Stream, "stream", "", "release stream under test, used by --gating-policy")
+	sv(&kola.QuotaCheck, "quota-check", kola.QuotaCheckWarn, "when platform quota is too small for the run: warn, abort, or off")
+	bv(&kola.Chaos, "chaos", false, "randomly reboot or pause machines of tests tagged \""+kola.ChaosTag+"\"")
+	root.PersistentFlags().Int64Var(&kola.ChaosSeed, "chaos-seed", 0, "seed for --chaos, to reproduce a run (0 means random)")
+	root.PersistentFlags().DurationVar(&kola.ChaosInterval, "chaos-interval", time.Minute, "mean time between --chaos disruptions")
+	sv(&kola.DebugAddr, "debug-addr", "", "serve live test output and status over HTTP on this address, e.g. localhost:8080")
+	sv(&kola.AssetCacheDir, "asset-cache", cache.DefaultDir(), "directory to cache downloaded test assets in")
+	bv(&kola.Options.IPv6Only, "ipv6-only", false, "give cloud machines only IPv6 addresses; needs --aws-subnet or --gce-subnetwork")
+	bv(&kola.Options.SSHCertificates, "ssh-certificates", false, "log in to machines with short-lived certificates from a per-cluster SSH CA instead of authorized keys")
+	sv(&kola.Options.Bastion, "ssh-bastion", "", "reach machines through this SSH host, as [user@]host[:port], authenticating with ssh-agent")
+	root.PersistentFlags().Int64Var(&kola.Options.MaxLogSize, "max-log-size", 64<<20, "maximum bytes of console and journal output to keep per machine (0 means unlimited)")
 
 	// QEMU-specific options
 	sv(&kola.QEMUOptions.Board, "board", defaultTargetBoard, "target board")
 	sv(&kola.QEMUOptions.DiskImage, "qemu-image", "", "path to CoreOS disk image")
 	sv(&kola.QEMUOptions.BIOSImage, "qemu-bios", "", "BIOS to use for QEMU vm")
+	sv(&kola.QEMUOptions.UEFIVars, "qemu-uefi-vars", "", "OVMF variable store template, boots --qemu-bios as UEFI firmware")
+	bv(&kola.QEMUOptions.TPM, "qemu-tpm", false, "attach a swtpm emulated TPM 2.0 to QEMU vms")
+	sv(&kola.TPMPCRFile, "tpm-pcrs", "", "JSON file of expected TPM PCR values")
 
 	// gce-specific options
 	sv(&kola.GCEOptions.Image, "gce-image", "latest", "GCE image, full api endpoints names are accepted if resource is in a different project")
 	sv(&kola.GCEOptions.Project, "gce-project", "coreos-gce-testing", "GCE project name")
 	sv(&kola.GCEOptions.Zone, "gce-zone", "us-central1-a", "GCE zone name")
+	ssv(&kola.GCEOptions.Zones, "gce-zones", nil, "GCE zones to spread machines across, overrides --gce-zone")
+	ssv(&kola.GCEOptions.FallbackZones, "gce-fallback-zones", nil, "GCE zones to try in order when a zone is out of capacity")
 	sv(&kola.GCEOptions.MachineType, "gce-machinetype", "n1-standard-1", "GCE machine type")
 	sv(&kola.GCEOptions.DiskType, "gce-disktype", "pd-ssd", "GCE disk type")
 	sv(&kola.GCEOptions.Network, "gce-network", "default", "GCE network")
+	sv(&kola.GCEOptions.Subnetwork, "gce-subnetwork", "", "GCE subnetwork, which must be IPv6-only for --ipv6-only")
 	bv(&kola.GCEOptions.ServiceAuth, "gce-service-auth", false, "for non-interactive auth when running within GCE")
+	sv(&kola.GCEOptions.InfraImage, "gce-infra-image", "", "image for the --infra-server, defaults to the latest Debian")
 	sv(&kola.GCEOptions.JSONKeyFile, "gce-json-key", "", "use a service account's JSON key for authentication")
 
 	// aws-specific options
 	// CoreOS-alpha-845.0.0 on us-west-1
 	sv(&kola.AWSOptions.AMI, "aws-ami", "ami-55438011", "AWS AMI ID")
+	sv(&kola.AWSOptions.InfraAMI, "aws-infra-ami", "", "Debian AMI ID for the --infra-server")
 	sv(&kola.AWSOptions.InstanceType, "aws-type", "t1.micro", "AWS instance type")
+	sv(&kola.AWSOptions.BootMode, "aws-boot-mode", "", "boot mode the AMI was registered with; uefi requires a Nitro --aws-type")
+	bv(&kola.AWSOptions.TPM, "aws-tpm", false, "the AMI has NitroTPM support; requires a Nitro --aws-type")
 	sv(&kola.AWSOptions.SecurityGroup, "aws-sg", "kola", "AWS security group name")
+	ssv(&kola.AWSOptions.Zones, "aws-zones", nil, "AWS availability zones to spread machines across")
+	ssv(&kola.AWSOptions.FallbackZones, "aws-fallback-zones", nil, "AWS availability zones to try in order when a zone is out of capacity")
+	sv(&kola.AWSOptions.PlacementGroup, "aws-placement-group", "", "AWS placement group to launch machines in")
+	sv(&kola.AWSOptions.Subnet, "aws-subnet", "", "AWS VPC subnet ID to launch machines in, which must be IPv6-only for --ipv6-only")
+}
+
+// loadManifests registers the tests declared in any --manifest and
+// --compliance-policy files.
+func loadManifests(cmd *cobra.Command, args []string) error {
+	for _, path := range manifests {
+		if err := kola.LoadManifest(path); err != nil {
+			return err
+		}
+	}
+	for _, path := range policies {
+		if err := kola.LoadCompliancePolicy(path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Sync up the command line options if there is dependency
@@ -0,0 +1,113 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/kola"
+)
+
+var (
+	cmdReport = &cobra.Command{
+		Run:   runReport,
+		Use:   "report [results file]",
+		Short: "Report the flakiest and slowest tests",
+		Long: `Summarize the history of tests recorded across runs with
+--results-file, listing the tests which flake or fail intermittently
+and the tests which take longest.
+
+The results file defaults to --results-file.
+`}
+
+	reportTop int
+)
+
+func init() {
+	cmdReport.Flags().IntVar(&reportTop, "top", 10, "number of tests to list in each table (0 means all)")
+	root.AddCommand(cmdReport)
+}
+
+func runReport(cmd *cobra.Command, args []string) {
+	path := kola.ResultsFile
+	if len(args) == 1 {
+		path = args[0]
+	} else if len(args) > 1 || path == "" {
+		fmt.Fprintf(os.Stderr, "Usage: 'kola report [results file]'\n")
+		os.Exit(2)
+	}
+
+	history, err := kola.LoadHistory(path, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// Tests which always fail are broken rather than flaky.
+	var flaky []*kola.TestHistory
+	for _, h := range history {
+		if h.Flakes > 0 || (h.Failures > 0 && h.Failures < h.Runs) {
+			flaky = append(flaky, h)
+		}
+	}
+	sort.Stable(byUnreliability(flaky))
+
+	slow := append([]*kola.TestHistory(nil), history...)
+	sort.Stable(byMeanDuration(slow))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Flakiest tests\n\n")
+	fmt.Fprintf(w, "TEST\tPLATFORM\tRUNS\tFLAKY\tFAILED\tLAST RUN\n")
+	for _, h := range topHistory(flaky) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.1f%%\t%.1f%%\t%s\n", h.Test, h.Platform, h.Runs,
+			100*h.FlakeRate(), 100*h.FailRate(), h.Last.Format("2006-01-02"))
+	}
+	fmt.Fprintf(w, "\nSlowest tests\n\n")
+	fmt.Fprintf(w, "TEST\tPLATFORM\tRUNS\tMEAN\tMAX\n")
+	for _, h := range topHistory(slow) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.0fs\t%.0fs\n", h.Test, h.Platform, h.Runs,
+			h.Mean().Seconds(), h.Max.Seconds())
+	}
+	w.Flush()
+}
+
+// byUnreliability sorts tests by the fraction of runs in which they
+// flaked or failed, highest first.
+type byUnreliability []*kola.TestHistory
+
+func (h byUnreliability) Len() int      { return len(h) }
+func (h byUnreliability) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h byUnreliability) Less(i, j int) bool {
+	return h[i].FlakeRate()+h[i].FailRate() > h[j].FlakeRate()+h[j].FailRate()
+}
+
+// byMeanDuration sorts tests by their mean duration, longest first.
+type byMeanDuration []*kola.TestHistory
+
+func (h byMeanDuration) Len() int           { return len(h) }
+func (h byMeanDuration) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h byMeanDuration) Less(i, j int) bool { return h[i].Mean() > h[j].Mean() }
+
+func topHistory(history []*kola.TestHistory) []*kola.TestHistory {
+	if reportTop > 0 && len(history) > reportTop {
+		return history[:reportTop]
+	}
+	return history
+}
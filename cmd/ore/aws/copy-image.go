@@ -28,7 +28,10 @@ var (
 		Short: "Copy AWS image between regions",
 		Long: `Copy an AWS image to one or more regions.
 
-After a successful run, the final line of output will be a line of JSON describing the resources created.
+Regions are copied to concurrently, and regions that fail are retried. The
+final line of output will be a line of JSON describing the resources created,
+even if some regions failed. Running the command again only copies the image
+to the regions that are missing it.
 `,
 		RunE: runCopyImage,
 	}
@@ -47,16 +50,18 @@ func runCopyImage(cmd *cobra.Command, args []string) error {
 		os.Exit(2)
 	}
 
-	amis, err := API.CopyImage(sourceImageID, args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Couldn't copy images: %v\n", err)
-		os.Exit(1)
-	}
+	// the images that were copied are printed even on partial
+	// failure; rerunning only copies to the regions that failed
+	amis, copyErr := API.CopyImage(sourceImageID, args, os.Stderr)
 
-	err = json.NewEncoder(os.Stdout).Encode(amis)
+	err := json.NewEncoder(os.Stdout).Encode(amis)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Couldn't encode result: %v\n", err)
 		os.Exit(1)
 	}
+	if copyErr != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't copy images: %v\n", copyErr)
+		os.Exit(1)
+	}
 	return nil
 }
@@ -21,7 +21,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/platform/api/aws"
 	"github.com/coreos/mantle/sdk"
 	"github.com/spf13/cobra"
@@ -57,6 +59,12 @@ After a successful run, the final line of output will be a line of JSON describi
 	uploadAMIDescription string
 	uploadGrantUsers     []string
 	uploadCreatePV       bool
+	uploadBootMode       string
+	uploadTPMSupport     string
+	uploadENA            bool
+	uploadSriovNet       bool
+	uploadExpireAfter    time.Duration
+	uploadRetention      string
 )
 
 func init() {
@@ -76,6 +84,12 @@ func init() {
 	cmdUpload.Flags().StringVar(&uploadAMIDescription, "ami-description", "", "description of the AMI to create (default: empty)")
 	cmdUpload.Flags().StringSliceVar(&uploadGrantUsers, "grant-user", []string{}, "grant launch permission to this AWS user ID")
 	cmdUpload.Flags().BoolVar(&uploadCreatePV, "create-pv", true, "create a PV AMI in addition to the HVM AMI")
+	cmdUpload.Flags().StringVar(&uploadBootMode, "boot-mode", "", fmt.Sprintf("HVM AMI boot mode: %s, %s, or %s (default: EC2 default)", aws.BootModeLegacyBIOS, aws.BootModeUEFI, aws.BootModeUEFIPreferred))
+	cmdUpload.Flags().StringVar(&uploadTPMSupport, "tpm-support", "", fmt.Sprintf("enable NitroTPM on the HVM AMI with %q; requires a UEFI boot mode", aws.TPMSupportV2))
+	cmdUpload.Flags().BoolVar(&uploadENA, "ena", true, "enable ENA networking on the HVM AMI")
+	cmdUpload.Flags().BoolVar(&uploadSriovNet, "sriov", true, "enable SR-IOV networking on the HVM AMI")
+	cmdUpload.Flags().DurationVar(&uploadExpireAfter, "expire-after", 0, "tag the object, snapshot and AMIs to expire after this long (default: never)")
+	cmdUpload.Flags().StringVar(&uploadRetention, "retention", "", "tag the object, snapshot and AMIs with this retention label for lifecycle rules")
 }
 
 func defaultBucketNameForRegion(region string) string {
@@ -130,6 +144,25 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "At most one of --source-object and --source-snapshot may be specified.\n")
 		os.Exit(2)
 	}
+	hvmOpts := aws.HVMImageOptions{
+		BootMode:   uploadBootMode,
+		TPMSupport: uploadTPMSupport,
+		ENA:        uploadENA,
+		SriovNet:   uploadSriovNet,
+	}
+	if err := hvmOpts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if uploadBootMode == aws.BootModeUEFI && uploadCreatePV {
+		fmt.Fprintf(os.Stderr, "PV AMIs cannot boot with UEFI; pass --create-pv=false.\n")
+		os.Exit(2)
+	}
+	lifecycle, err := platform.NewLifecycle(uploadExpireAfter, uploadRetention)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
 
 	// if an image name is unspecified try to use version.txt
 	imageName := uploadImageName
@@ -154,7 +187,6 @@ func runUpload(cmd *cobra.Command, args []string) error {
 	}
 
 	var s3URL *url.URL
-	var err error
 	if uploadSourceObject != "" {
 		s3URL, err = url.Parse(uploadSourceObject)
 		if err != nil {
@@ -201,6 +233,13 @@ func runUpload(cmd *cobra.Command, args []string) error {
 			fmt.Fprintf(os.Stderr, "Error uploading: %v\n", err)
 			os.Exit(1)
 		}
+
+		if !lifecycle.Empty() && !uploadDeleteObject {
+			if err := API.TagObject(s3BucketName, s3ObjectPath, lifecycle.Tags()); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		}
 	}
 
 	// if we don't already have a snapshot, make one
@@ -224,7 +263,7 @@ func runUpload(cmd *cobra.Command, args []string) error {
 	}
 
 	// create AMIs and grant permissions
-	hvmID, err := API.CreateHVMImage(sourceSnapshot, amiName+"-hvm", uploadAMIDescription)
+	hvmID, err := API.CreateHVMImage(sourceSnapshot, amiName+"-hvm", uploadAMIDescription, hvmOpts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "unable to create HVM image: %v\n", err)
 		os.Exit(1)
@@ -256,6 +295,22 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// tag what this run created; a --source-snapshot may be in use
+	// by other images.
+	if !lifecycle.Empty() {
+		resources := []string{hvmID}
+		if pvID != "" {
+			resources = append(resources, pvID)
+		}
+		if uploadSourceSnapshot == "" {
+			resources = append(resources, sourceSnapshot)
+		}
+		if err := API.CreateTags(resources, lifecycle.Tags()); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	err = json.NewEncoder(os.Stdout).Encode(&struct {
 		HVM        string
 		PV         string `json:",omitempty"`
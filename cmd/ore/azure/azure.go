@@ -57,6 +57,7 @@ func preauth(cmd *cobra.Command, args []string) error {
 	if opt == nil {
 		plog.Fatalf("Azure subscription named %q doesn't exist in %q", azureSubscription, azureProfile)
 	}
+	opt.UploadParallelism = ubo.parallelism
 
 	a, err := azure.New(opt)
 	if err != nil {
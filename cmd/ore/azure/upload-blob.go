@@ -37,6 +37,7 @@ var (
 		vhd         string
 		overwrite   bool
 		validate    bool
+		parallelism int
 	}
 )
 
@@ -45,6 +46,7 @@ func init() {
 
 	bv(&ubo.overwrite, "overwrite", false, "overwrite blob")
 	bv(&ubo.validate, "validate", true, "validate blob as VHD file")
+	cmdUploadBlob.Flags().IntVar(&ubo.parallelism, "parallelism", 8, "number of pages to upload concurrently")
 
 	Azure.AddCommand(cmdUploadBlob)
 }
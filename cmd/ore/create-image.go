@@ -20,9 +20,12 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"google.golang.org/api/storage/v1"
+
+	"github.com/coreos/mantle/platform"
 )
 
 var (
@@ -39,6 +42,7 @@ var (
 	createImageRoot    string
 	createImageName    string
 	createImageForce   bool
+	createImageExpire  time.Duration
 )
 
 func init() {
@@ -57,6 +61,8 @@ func init() {
 		"Storage image name")
 	cmdCreateImage.Flags().BoolVar(&createImageForce, "force",
 		false, "overwrite existing GCE images without prompt")
+	cmdCreateImage.Flags().DurationVar(&createImageExpire, "expire-after",
+		0, "mark the GCE image to expire after this long (default: never)")
 	root.AddCommand(cmdCreateImage)
 }
 
@@ -71,6 +77,12 @@ func runCreateImage(cmd *cobra.Command, args []string) {
 		os.Exit(2)
 	}
 
+	lifecycle, err := platform.NewLifecycle(createImageExpire, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
 	gsURL, err := url.Parse(createImageRoot)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -115,4 +127,9 @@ func runCreateImage(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(os.Stderr, "Creating GCE image failed: %v\n", err)
 		os.Exit(1)
 	}
+
+	if err := setImageLifecycle(imageNameGCE, lifecycle); err != nil {
+		fmt.Fprintf(os.Stderr, "Setting GCE image expiry failed: %v\n", err)
+		os.Exit(1)
+	}
 }
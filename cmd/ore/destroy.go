@@ -19,6 +19,8 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/platform/api/gcloud"
 )
 
 var (
@@ -54,7 +56,7 @@ func runDestroy(cmd *cobra.Command, args []string) {
 
 	var count int
 	for _, vm := range vms {
-		if err := api.TerminateInstance(vm.Name); err != nil {
+		if err := api.TerminateZoneInstance(gcloud.InstanceZone(vm), vm.Name); err != nil {
 			fmt.Fprintf(os.Stderr, "Failed destroying vm: %v\n", err)
 			os.Exit(1)
 		}
@@ -0,0 +1,121 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/api/storage/v1"
+
+	"github.com/coreos/mantle/platform/api/gcloud"
+)
+
+var (
+	cmdExportImage = &cobra.Command{
+		Use:   "export-image",
+		Short: "Export GCE image",
+		Long: `Export a GCE image to a tarball in Google Storage.
+
+The tarball holds the image as disk.raw, so create-image can turn it
+back into an image, possibly in another project.`,
+		Run: runExportImage,
+	}
+
+	exportImageDest   string
+	exportImageWorker string
+	exportImageForce  bool
+)
+
+func init() {
+	cmdExportImage.Flags().StringVar(&exportImageDest, "destination",
+		"", "Storage URL of the tarball, e.g. gs://bucket/image.tar.gz")
+	cmdExportImage.Flags().StringVar(&exportImageWorker, "worker-image",
+		gcloud.DefaultExportWorkerImage, "image of the instance that copies the image")
+	cmdExportImage.Flags().BoolVar(&exportImageForce, "force",
+		false, "overwrite an existing tarball")
+	root.AddCommand(cmdExportImage)
+}
+
+func runExportImage(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args: %v\n", args)
+		os.Exit(2)
+	}
+
+	if opts.Image == "" {
+		fmt.Fprintln(os.Stderr, "--image is required")
+		os.Exit(2)
+	}
+	if exportImageDest == "" {
+		fmt.Fprintln(os.Stderr, "--destination is required")
+		os.Exit(2)
+	}
+
+	gsURL, err := url.Parse(exportImageDest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if gsURL.Scheme != "gs" {
+		fmt.Fprintf(os.Stderr, "URL missing gs:// scheme: %v\n", exportImageDest)
+		os.Exit(1)
+	}
+	if gsURL.Host == "" {
+		fmt.Fprintf(os.Stderr, "URL missing bucket name %v\n", exportImageDest)
+		os.Exit(1)
+	}
+	bucket := gsURL.Host
+	object := strings.TrimPrefix(gsURL.Path, "/")
+	if object == "" {
+		fmt.Fprintf(os.Stderr, "URL missing object name %v\n", exportImageDest)
+		os.Exit(1)
+	}
+
+	storageAPI, err := storage.New(api.Client())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Storage client failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if ok, err := fileQuery(storageAPI, bucket, object); err != nil {
+		fmt.Fprintf(os.Stderr, "Checking destination %s failed: %v\n", gsURL, err)
+		os.Exit(1)
+	} else if ok && !exportImageForce {
+		fmt.Fprintf(os.Stderr, "Destination %s already exists\n", gsURL)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exporting %s to %s...\n", opts.Image, gsURL)
+	sum, err := api.ExportImage(opts.Image, exportImageWorker, bucket, object, func(progress string) {
+		fmt.Printf("Exported %s\n", progress)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Exporting GCE image failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	obj, err := storageAPI.Objects.Get(bucket, object).Do()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reading exported image %s failed: %v\n", gsURL, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %s (%d bytes)\n", gsURL, obj.Size)
+	fmt.Printf("SHA256: %s\n", sum)
+	fmt.Printf("MD5 (base64): %s\n", obj.Md5Hash)
+}
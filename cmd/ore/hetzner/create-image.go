@@ -0,0 +1,74 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCreateImage = &cobra.Command{
+		Use:   "create-image URL",
+		Short: "Create a Hetzner Cloud image from a disk image",
+		Long: `Create a Hetzner Cloud image from a raw disk image, optionally
+compressed with bzip2, gzip, or xz, which is downloaded from URL.
+The URL must be reachable from the internet.
+
+Hetzner Cloud cannot import images, so a temporary server is booted into
+its rescue system to write the image to its disk, which is then saved as
+a snapshot. After a successful create the image ID is printed.`,
+		RunE: runCreateImage,
+	}
+
+	imageDescription string
+	imageLabels      []string
+)
+
+func init() {
+	Hetzner.AddCommand(cmdCreateImage)
+	cmdCreateImage.Flags().StringVar(&imageDescription, "description", "", "image description")
+	cmdCreateImage.Flags().StringSliceVar(&imageLabels, "label", nil, "image label as KEY=VALUE, may be repeated")
+}
+
+func runCreateImage(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Expecting an image URL\n")
+		os.Exit(2)
+	}
+
+	labels := make(map[string]string)
+	for _, label := range imageLabels {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 {
+			fmt.Fprintf(os.Stderr, "Label %q is not KEY=VALUE\n", label)
+			os.Exit(2)
+		}
+		labels[kv[0]] = kv[1]
+	}
+
+	image, err := API.CreateImage(args[0], imageDescription, labels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Creating image failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	plog.Infof("Created image %d", image.ID)
+	fmt.Println(image.ID)
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCreateServer = &cobra.Command{
+		Use:   "create-server IMAGE",
+		Short: "Create a Hetzner Cloud server from an image",
+		Long: `Create a server from an image and wait for it to be running.
+
+After a successful create the server ID and IP address are printed.`,
+		RunE: runCreateServer,
+	}
+
+	serverName     string
+	serverUserData string
+)
+
+func init() {
+	Hetzner.AddCommand(cmdCreateServer)
+	cmdCreateServer.Flags().StringVar(&serverName, "name", "mantle", "server name")
+	cmdCreateServer.Flags().StringVar(&serverUserData, "userdata", "", "path to a user data file, such as an Ignition config")
+}
+
+func runCreateServer(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Expecting an image ID\n")
+		os.Exit(2)
+	}
+
+	var userdata []byte
+	if serverUserData != "" {
+		var err error
+		userdata, err = ioutil.ReadFile(serverUserData)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read user data: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	server, err := API.CreateServer(serverName, args[0], string(userdata), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Creating server failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d %s\n", server.ID, server.IP())
+	return nil
+}
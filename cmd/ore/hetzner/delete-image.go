@@ -0,0 +1,55 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdDeleteImage = &cobra.Command{
+		Use:   "delete-image IMAGE...",
+		Short: "Delete Hetzner Cloud images",
+		RunE:  runDeleteImage,
+	}
+)
+
+func init() {
+	Hetzner.AddCommand(cmdDeleteImage)
+}
+
+func runDeleteImage(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Expecting image IDs\n")
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, id := range parseIDs(args) {
+		if err := API.DeleteImage(id); err != nil {
+			fmt.Fprintf(os.Stderr, "Deleting image %d failed: %v\n", id, err)
+			failed = true
+			continue
+		}
+		plog.Infof("Deleted image %d", id)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
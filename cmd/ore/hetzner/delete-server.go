@@ -0,0 +1,55 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdDeleteServer = &cobra.Command{
+		Use:   "delete-server SERVER...",
+		Short: "Delete Hetzner Cloud servers",
+		RunE:  runDeleteServer,
+	}
+)
+
+func init() {
+	Hetzner.AddCommand(cmdDeleteServer)
+}
+
+func runDeleteServer(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Expecting server IDs\n")
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, id := range parseIDs(args) {
+		if err := API.DeleteServer(id); err != nil {
+			fmt.Fprintf(os.Stderr, "Deleting server %d failed: %v\n", id, err)
+			failed = true
+			continue
+		}
+		plog.Infof("Deleted server %d", id)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
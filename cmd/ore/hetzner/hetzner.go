@@ -0,0 +1,76 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/cli"
+	"github.com/coreos/mantle/platform/api/hetzner"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "ore/hetzner")
+
+	Hetzner = &cobra.Command{
+		Use:   "hetzner [command]",
+		Short: "hetzner cloud image and server utilities",
+	}
+
+	API     *hetzner.API
+	options hetzner.Options
+)
+
+func init() {
+	sv := Hetzner.PersistentFlags().StringVar
+	sv(&options.Token, "token", "", "Hetzner Cloud API token (default $HCLOUD_TOKEN)")
+	sv(&options.Location, "location", "fsn1", "location to create servers in")
+	sv(&options.ServerType, "server-type", "cx22", "type of servers")
+	cli.WrapPreRun(Hetzner, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	if options.Token == "" {
+		options.Token = os.Getenv("HCLOUD_TOKEN")
+	}
+
+	api, err := hetzner.New(&options)
+	if err != nil {
+		return fmt.Errorf("could not create Hetzner Cloud client: %v", err)
+	}
+
+	API = api
+	return nil
+}
+
+// parseIDs parses the numeric IDs of images or servers, exiting if one
+// isn't a number.
+func parseIDs(args []string) []int64 {
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid ID %q\n", arg)
+			os.Exit(2)
+		}
+		ids[i] = id
+	}
+	return ids
+}
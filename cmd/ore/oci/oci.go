@@ -0,0 +1,59 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/cli"
+	"github.com/coreos/mantle/platform/api/oci"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "ore/oci")
+
+	OCI = &cobra.Command{
+		Use:   "oci [command]",
+		Short: "push and pull images as OCI artifacts",
+	}
+
+	API     *oci.API
+	options oci.Options
+)
+
+func init() {
+	OCI.PersistentFlags().StringVar(&options.Username, "username", os.Getenv("REGISTRY_USERNAME"), "registry username (default $REGISTRY_USERNAME)")
+	OCI.PersistentFlags().StringVar(&options.Password, "password", "", "registry password (default $REGISTRY_PASSWORD)")
+	OCI.PersistentFlags().BoolVar(&options.Insecure, "insecure", false, "use plain HTTP to talk to the registry")
+	cli.WrapPreRun(OCI, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	if options.Password == "" {
+		options.Password = os.Getenv("REGISTRY_PASSWORD")
+	}
+
+	api, err := oci.New(&options)
+	if err != nil {
+		return fmt.Errorf("could not create registry client: %v", err)
+	}
+
+	API = api
+	return nil
+}
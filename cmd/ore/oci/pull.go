@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/platform/api/oci"
+)
+
+var (
+	cmdPull = &cobra.Command{
+		Use:   "pull REGISTRY/REPOSITORY[:TAG|@DIGEST]",
+		Short: "Pull a disk image from an OCI artifact",
+		Long: `Download the disk image layer of an OCI artifact, verifying its digest.
+
+The file is named after the layer's title annotation. After a successful
+pull the path of the downloaded file is printed.`,
+		Example: `  ore oci pull --dir=images quay.io/coreos/images:1576.1.0`,
+		RunE:    runPull,
+	}
+
+	pullDir       string
+	pullMediaType string
+)
+
+func init() {
+	OCI.AddCommand(cmdPull)
+	cmdPull.Flags().StringVar(&pullDir, "dir", ".", "directory to download the image to")
+	cmdPull.Flags().StringVar(&pullMediaType, "media-type", "", "pull the layer with this media type (default first layer)")
+}
+
+func runPull(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Expecting a single reference\n")
+		os.Exit(2)
+	}
+
+	ref, err := oci.ParseReference(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	path, err := API.PullImage(ref, pullDir, pullMediaType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Pulling %s failed: %v\n", ref, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(path)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/platform/api/oci"
+)
+
+var (
+	cmdPush = &cobra.Command{
+		Use:   "push REGISTRY/REPOSITORY:TAG FILE",
+		Short: "Push a disk image as an OCI artifact",
+		Long: `Upload a disk image to a container registry as a single layer OCI artifact.
+
+The layer media type is derived from the file extension unless --media-type
+is given. After a successful push the manifest digest is printed.`,
+		Example: `  ore oci push quay.io/coreos/images:1576.1.0 coreos_production_image.bin.bz2`,
+		RunE:    runPush,
+	}
+
+	pushMediaType string
+)
+
+func init() {
+	OCI.AddCommand(cmdPush)
+	cmdPush.Flags().StringVar(&pushMediaType, "media-type", "", "layer media type (default derived from file name)")
+}
+
+func runPush(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Expecting a reference and a file\n")
+		os.Exit(2)
+	}
+
+	ref, err := oci.ParseReference(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	mediaType := pushMediaType
+	if mediaType == "" {
+		mediaType = oci.ImageMediaType(args[1])
+	}
+
+	digest, err := API.PushImage(ref, args[1], mediaType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Pushing %s failed: %v\n", ref, err)
+		os.Exit(1)
+	}
+
+	plog.Infof("Pushed %s", ref)
+	fmt.Println(digest)
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdQuota = &cobra.Command{
+		Use:   "quota [--machines=<n>]",
+		Short: "Show GCE quotas and check room for new machines",
+		Long: `Show the instance, CPU, and IP quotas of the region containing the
+configured zones. With --machines, exit with status 1 if there is not
+enough quota to create that many machines of the configured type.`,
+		Run: runQuota,
+	}
+
+	quotaMachines int
+)
+
+func init() {
+	cmdQuota.Flags().IntVar(&quotaMachines, "machines", 0, "number of machines to check quota for")
+	root.AddCommand(cmdQuota)
+}
+
+func runQuota(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in ore quota cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	quotas, err := api.Quotas()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed getting quotas: %v\n", err)
+		os.Exit(1)
+	}
+	for _, q := range quotas {
+		fmt.Println(q)
+	}
+
+	if quotaMachines > 0 {
+		if err := api.CheckQuota(quotaMachines); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -20,11 +20,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/storage/v1"
 
+	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/sdk"
 )
 
@@ -41,6 +43,8 @@ var (
 	uploadBoard     string
 	uploadFile      string
 	uploadForce     bool
+	uploadExpire    time.Duration
+	uploadRetention string
 )
 
 func init() {
@@ -52,6 +56,8 @@ func init() {
 		build+"/images/amd64-usr/latest/coreos_production_gce.tar.gz",
 		"path_to_coreos_image (build with: ./image_to_vm.sh --format=gce ...)")
 	cmdUpload.Flags().BoolVar(&uploadForce, "force", false, "overwrite existing GS and GCE images without prompt")
+	cmdUpload.Flags().DurationVar(&uploadExpire, "expire-after", 0, "mark the GS and GCE images to expire after this long (default: never)")
+	cmdUpload.Flags().StringVar(&uploadRetention, "retention", "", "label the GS image with this retention class")
 	root.AddCommand(cmdUpload)
 }
 
@@ -60,6 +66,11 @@ func runUpload(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(os.Stderr, "Unrecognized args in plume upload cmd: %v\n", args)
 		os.Exit(2)
 	}
+	lifecycle, err := platform.NewLifecycle(uploadExpire, uploadRetention)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
 
 	// if an image name is unspecified try to use version.txt
 	if uploadImageName == "" {
@@ -121,12 +132,12 @@ func runUpload(cmd *cobra.Command, args []string) {
 		switch ans {
 		case "y", "Y", "yes":
 			fmt.Println("Overriding existing file...")
-			err = writeFile(storageAPI, uploadBucket, uploadFile, imageNameGS)
+			err = writeFile(storageAPI, uploadBucket, uploadFile, imageNameGS, lifecycle)
 		default:
 			fmt.Println("Skipped file upload")
 		}
 	} else {
-		err = writeFile(storageAPI, uploadBucket, uploadFile, imageNameGS)
+		err = writeFile(storageAPI, uploadBucket, uploadFile, imageNameGS, lifecycle)
 	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Uploading image failed: %v\n", err)
@@ -166,6 +177,21 @@ func runUpload(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(os.Stderr, "Creating GCE image failed: %v\n", err)
 		os.Exit(1)
 	}
+
+	if err := setImageLifecycle(imageNameGCE, lifecycle); err != nil {
+		fmt.Fprintf(os.Stderr, "Setting GCE image expiry failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// setImageLifecycle records the expiry of a GCE image. Images can't be
+// labelled with this compute API, so the retention class is only kept
+// on the GS image.
+func setImageLifecycle(name string, lifecycle platform.Lifecycle) error {
+	if lifecycle.Expires.IsZero() {
+		return nil
+	}
+	return api.SetImageExpiry(name, lifecycle.Expires)
 }
 
 // Converts an image name from Google Storage to an equivalent GCE image
@@ -195,8 +221,9 @@ func gceSanitize(name string) string {
 	return "v" + name
 }
 
-// Write file to Google Storage
-func writeFile(api *storage.Service, bucket, filename, destname string) error {
+// Write file to Google Storage, recording its lifecycle in the object
+// metadata.
+func writeFile(api *storage.Service, bucket, filename, destname string, lifecycle platform.Lifecycle) error {
 	fmt.Printf("Writing %v to gs://%v ...\n", filename, bucket)
 	fmt.Printf("(Sometimes this takes a few minutes)\n")
 
@@ -209,6 +236,7 @@ func writeFile(api *storage.Service, bucket, filename, destname string) error {
 	req := api.Objects.Insert(bucket, &storage.Object{
 		Name:        destname,
 		ContentType: "application/x-gzip",
+		Metadata:    lifecycle.Tags(),
 	})
 	req.PredefinedAcl("authenticatedRead")
 	req.Media(file)
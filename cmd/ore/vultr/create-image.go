@@ -0,0 +1,59 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vultr
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCreateImage = &cobra.Command{
+		Use:   "create-image URL",
+		Short: "Create a Vultr snapshot from an image",
+		Long: `Create a Vultr snapshot from a raw disk image, such as
+coreos_production_vultr_image.bin, which Vultr downloads from URL.
+The URL must be reachable from the internet.
+
+After a successful create the snapshot ID is printed.`,
+		RunE: runCreateImage,
+	}
+
+	imageDescription string
+)
+
+func init() {
+	Vultr.AddCommand(cmdCreateImage)
+	cmdCreateImage.Flags().StringVar(&imageDescription, "description", "", "snapshot description")
+}
+
+func runCreateImage(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Expecting an image URL\n")
+		os.Exit(2)
+	}
+
+	snap, err := API.CreateSnapshotFromURL(args[0], imageDescription)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Creating snapshot failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	plog.Infof("Created snapshot %s", snap.ID)
+	fmt.Println(snap.ID)
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vultr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCreateInstance = &cobra.Command{
+		Use:   "create-instance SNAPSHOT",
+		Short: "Create a Vultr instance from a snapshot",
+		Long: `Create an instance from a snapshot and wait for it to be running.
+
+After a successful create the instance ID and IP address are printed.`,
+		RunE: runCreateInstance,
+	}
+
+	instanceLabel    string
+	instanceUserData string
+)
+
+func init() {
+	Vultr.AddCommand(cmdCreateInstance)
+	cmdCreateInstance.Flags().StringVar(&instanceLabel, "label", "mantle", "instance label")
+	cmdCreateInstance.Flags().StringVar(&instanceUserData, "userdata", "", "path to a user data file, such as an Ignition config")
+}
+
+func runCreateInstance(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Expecting a snapshot ID\n")
+		os.Exit(2)
+	}
+
+	var userdata []byte
+	if instanceUserData != "" {
+		var err error
+		userdata, err = ioutil.ReadFile(instanceUserData)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read user data: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	inst, err := API.CreateInstance(instanceLabel, args[0], string(userdata))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Creating instance failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s %s\n", inst.ID, inst.MainIP)
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vultr
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdDeleteImage = &cobra.Command{
+		Use:   "delete-image SNAPSHOT...",
+		Short: "Delete Vultr snapshots",
+		RunE:  runDeleteImage,
+	}
+)
+
+func init() {
+	Vultr.AddCommand(cmdDeleteImage)
+}
+
+func runDeleteImage(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Expecting snapshot IDs\n")
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, id := range args {
+		if err := API.DeleteSnapshot(id); err != nil {
+			fmt.Fprintf(os.Stderr, "Deleting snapshot %s failed: %v\n", id, err)
+			failed = true
+			continue
+		}
+		plog.Infof("Deleted snapshot %s", id)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vultr
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/cli"
+	"github.com/coreos/mantle/platform/api/vultr"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "ore/vultr")
+
+	Vultr = &cobra.Command{
+		Use:   "vultr [command]",
+		Short: "vultr image and instance utilities",
+	}
+
+	API     *vultr.API
+	options vultr.Options
+)
+
+func init() {
+	sv := Vultr.PersistentFlags().StringVar
+	sv(&options.APIKey, "api-key", "", "Vultr API key (default $VULTR_API_KEY)")
+	sv(&options.Region, "region", "ewr", "region to create instances in")
+	sv(&options.Plan, "plan", "vc2-1c-2gb", "plan of instances")
+	cli.WrapPreRun(Vultr, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	if options.APIKey == "" {
+		options.APIKey = os.Getenv("VULTR_API_KEY")
+	}
+
+	api, err := vultr.New(&options)
+	if err != nil {
+		return fmt.Errorf("could not create Vultr client: %v", err)
+	}
+
+	API = api
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"github.com/coreos/mantle/auth"
+	"github.com/coreos/mantle/storage"
+)
+
+const channelMetadataName = "channel.json"
+
+var (
+	channelDryRun  bool
+	rolloutPercent float64
+	metadataSet    []string
+	metadataUnset  []string
+
+	cmdRollout = &cobra.Command{
+		Use:   "rollout [options]",
+		Short: "Set the rollout percentage of a release.",
+		Run:   runRollout,
+		Long: `Set the percentage of machines a release is offered to.
+
+The channel metadata file is updated with compare-and-swap so
+concurrent updates are never lost.
+
+    plume rollout --channel=beta --board=amd64-usr --version=1576.1.0 --percent=25`,
+	}
+
+	cmdChannelMetadata = &cobra.Command{
+		Use:   "channel-metadata [options]",
+		Short: "Show or edit channel metadata.",
+		Run:   runChannelMetadata,
+		Long: `Print the channel metadata file, optionally after setting or
+removing keys. Updates use compare-and-swap so concurrent updates
+are never lost.
+
+    plume channel-metadata --channel=beta --board=amd64-usr --set=paused=true`,
+	}
+)
+
+func init() {
+	cmdRollout.Flags().BoolVarP(&channelDryRun, "dry-run", "n", false,
+		"perform a trial run, do not make changes")
+	cmdRollout.Flags().Float64Var(&rolloutPercent, "percent", -1,
+		"percentage of machines to offer the release to, 0-100")
+	AddSpecFlags(cmdRollout.Flags())
+	root.AddCommand(cmdRollout)
+
+	cmdChannelMetadata.Flags().BoolVarP(&channelDryRun, "dry-run", "n", false,
+		"perform a trial run, do not make changes")
+	cmdChannelMetadata.Flags().StringSliceVar(&metadataSet, "set", nil,
+		"set key=value in the metadata")
+	cmdChannelMetadata.Flags().StringSliceVar(&metadataUnset, "unset", nil,
+		"remove key from the metadata")
+	AddSpecFlags(cmdChannelMetadata.Flags())
+	root.AddCommand(cmdChannelMetadata)
+}
+
+// channelMetadataBucket returns the bucket of the channel's primary
+// download site and the name and URL of the board's channel metadata
+// document in it.
+func channelMetadataBucket(spec channelSpec) (*storage.Bucket, string, string) {
+	client, err := auth.GoogleClient()
+	if err != nil {
+		plog.Fatalf("Authentication failed: %v", err)
+	}
+
+	bkt, err := storage.NewBucket(client, spec.Destinations[0].BaseURL)
+	if err != nil {
+		plog.Fatal(err)
+	}
+	bkt.WriteDryRun(channelDryRun)
+
+	objName := bkt.Prefix() + specBoard + "/" + channelMetadataName
+	objURL := bkt.URL()
+	objURL.Path = objName
+	return bkt, objName, objURL.String()
+}
+
+// updateChannelMetadata applies fn to the board's channel metadata
+// document in the channel's primary download site, preserving any keys
+// fn does not touch, and prints the result.
+func updateChannelMetadata(spec channelSpec, fn func(md map[string]interface{}) error) {
+	ctx := context.Background()
+	bkt, objName, objURL := channelMetadataBucket(spec)
+
+	var result []byte
+	update := func(data []byte) ([]byte, error) {
+		md := make(map[string]interface{})
+		if data != nil {
+			if err := json.Unmarshal(data, &md); err != nil {
+				return nil, fmt.Errorf("parsing %s: %v", objURL, err)
+			}
+		}
+
+		if err := fn(md); err != nil {
+			return nil, err
+		}
+		md["channel"] = specChannel
+		md["board"] = specBoard
+		md["updated"] = time.Now().UTC().Format(time.RFC3339)
+
+		var err error
+		result, err = json.MarshalIndent(md, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, '\n')
+		return result, nil
+	}
+
+	if err := bkt.Update(ctx, objName, "application/json", update); err != nil {
+		plog.Fatal(err)
+	}
+
+	os.Stdout.Write(result)
+}
+
+func runRollout(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		plog.Fatal("No args accepted")
+	}
+	if rolloutPercent < 0 || rolloutPercent > 100 {
+		plog.Fatal("--percent must be between 0 and 100")
+	}
+
+	spec := ChannelSpec()
+	updateChannelMetadata(spec, func(md map[string]interface{}) error {
+		if md["version"] != specVersion {
+			plog.Noticef("Starting rollout of %s, previously %v", specVersion, md["version"])
+		}
+		md["version"] = specVersion
+		md["rollout_percentage"] = rolloutPercent
+		return nil
+	})
+}
+
+func runChannelMetadata(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		plog.Fatal("No args accepted")
+	}
+
+	spec := ChannelSpec()
+	if len(metadataSet) == 0 && len(metadataUnset) == 0 {
+		// only show it, leaving the updated time alone
+		bkt, objName, objURL := channelMetadataBucket(spec)
+		data, err := bkt.Download(context.Background(), objName)
+		if err != nil {
+			plog.Fatal(err)
+		}
+		if data == nil {
+			plog.Fatalf("%s does not exist", objURL)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
+	updateChannelMetadata(spec, func(md map[string]interface{}) error {
+		for _, kv := range metadataSet {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("invalid --set %q, expected key=value", kv)
+			}
+			md[parts[0]] = parts[1]
+		}
+		for _, key := range metadataUnset {
+			delete(md, key)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+
+	"github.com/coreos/mantle/auth"
+	"github.com/coreos/mantle/storage"
+)
+
+// With --content-store, release files are copied into a content store,
+// where each is kept once under its digest however many channels
+// publish it, and each destination directory gets only a manifest
+// mapping the files' names to their digests.
+var (
+	cmdAuditStore = &cobra.Command{
+		Use:   "audit-store gs://bucket/prefix/",
+		Short: "Check the files in a content store match their digests.",
+		Run:   runAuditStore,
+	}
+)
+
+func init() {
+	root.AddCommand(cmdAuditStore)
+}
+
+// storeContent copies the release files in src to --content-store and
+// returns their manifest.
+func storeContent(ctx context.Context, client *http.Client, src *storage.Bucket) *storage.ContentManifest {
+	storeURL := releaseContentStore
+	if stagingBucket != "" {
+		storeURL = stagingURL(storeURL)
+	}
+	store, err := storage.NewBucket(client, storeURL)
+	if err != nil {
+		plog.Fatal(err)
+	}
+	store.WriteDryRun(releaseDryRun)
+	if err := store.Fetch(ctx); err != nil {
+		plog.Fatal(err)
+	}
+
+	content, err := storage.StoreContent(ctx, src, src.Prefix(), store)
+	if err != nil {
+		plog.Fatal(err)
+	}
+	for _, entry := range content.Objects {
+		recordArtifact("object", productionURL(content.Store+entry.Content),
+			fmt.Sprintf("%d %s", entry.Size, entry.Crc32c))
+	}
+	return content
+}
+
+// publishContent replaces the files under prefix in dst with the
+// manifest of a release's content.
+func publishContent(ctx context.Context, dst *storage.Bucket, prefix string, content *storage.ContentManifest) {
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		plog.Fatal(err)
+	}
+	obj := gs.Object{
+		Name:        prefix + storage.ContentManifestName,
+		ContentType: "application/json",
+	}
+	if err := dst.Upload(ctx, &obj, bytes.NewReader(data)); err != nil {
+		plog.Fatal(err)
+	}
+
+	for _, old := range dst.Objects() {
+		if strings.HasPrefix(old.Name, prefix) && old.Name != obj.Name {
+			if err := dst.Delete(ctx, old.Name); err != nil {
+				plog.Fatal(err)
+			}
+		}
+	}
+}
+
+func runAuditStore(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		plog.Fatal("A content store URL is required")
+	}
+
+	ctx := context.Background()
+	client, err := auth.GoogleClient()
+	if err != nil {
+		plog.Fatalf("Authentication failed: %v", err)
+	}
+
+	store, err := storage.NewBucket(client, args[0])
+	if err != nil {
+		plog.Fatal(err)
+	}
+	if err := store.Fetch(ctx); err != nil {
+		plog.Fatal(err)
+	}
+
+	problems := storage.AuditContent(store)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	plog.Noticef("Checked %d files in %s", store.Len(), store.URL())
+}
@@ -102,6 +102,9 @@ func runPreRelease(cmd *cobra.Command, args []string) error {
 		plog.Fatal(err)
 	}
 
+	recordObjects(src, src.Prefix(), false)
+	writeManifest()
+
 	plog.Printf("Pre-release complete, run `plume release` to finish.")
 
 	return nil
@@ -326,7 +329,7 @@ func awsUploadToCloud(spec *channelSpec, cloud *awsCloudSpec, imageName, imageDe
 	}
 
 	plog.Printf("Creating AMIs from %v...", snapshot.SnapshotID)
-	hvmImageID, err := api.CreateHVMImage(snapshot.SnapshotID, imageName+"-hvm", imageDescription+" (HVM)")
+	hvmImageID, err := api.CreateHVMImage(snapshot.SnapshotID, imageName+"-hvm", imageDescription+" (HVM)", aws.DefaultHVMImageOptions)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to create HVM image: %v", err)
 	}
@@ -369,10 +372,13 @@ func awsUploadToCloud(spec *channelSpec, cloud *awsCloudSpec, imageName, imageDe
 		var amis map[string]string
 		if len(destRegions) > 0 {
 			plog.Printf("Replicating AMI %v...", imageID)
-			amis, err = api.CopyImage(imageID, destRegions)
+			amis, err = api.CopyImage(imageID, destRegions, os.Stderr)
 			if err != nil {
+				// images already copied are found again on rerun
 				return nil, fmt.Errorf("couldn't copy image: %v", err)
 			}
+		} else {
+			amis = make(map[string]string)
 		}
 		amis[cloud.BucketRegion] = imageID
 
@@ -518,6 +524,8 @@ func awsPreRelease(ctx context.Context, client *http.Client, src *storage.Bucket
 		}
 
 		for region := range hvmAmis {
+			recordArtifact("ami", imageName+"-hvm", region)
+			recordArtifact("ami", imageName, region)
 			amis.Entries = append(amis.Entries, amiListEntry{
 				Region: region,
 				PvAmi:  pvAmis[region],
@@ -17,6 +17,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -30,11 +31,13 @@ import (
 	"github.com/coreos/mantle/platform/api/aws"
 	"github.com/coreos/mantle/storage"
 	"github.com/coreos/mantle/storage/index"
+	"github.com/coreos/mantle/util"
 )
 
 var (
-	releaseDryRun bool
-	cmdRelease    = &cobra.Command{
+	releaseDryRun       bool
+	releaseContentStore string
+	cmdRelease          = &cobra.Command{
 		Use:   "release [options]",
 		Short: "Publish a new CoreOS release.",
 		Run:   runRelease,
@@ -47,6 +50,8 @@ TODO`,
 func init() {
 	cmdRelease.Flags().BoolVarP(&releaseDryRun, "dry-run", "n", false,
 		"perform a trial run, do not make changes")
+	cmdRelease.Flags().StringVar(&releaseContentStore, "content-store", "",
+		"keep release files once in this gs:// content store, publishing only a manifest of them")
 	AddSpecFlags(cmdRelease.Flags())
 	root.AddCommand(cmdRelease)
 }
@@ -85,6 +90,11 @@ func runRelease(cmd *cobra.Command, args []string) {
 	// Make AWS images public.
 	doAWS(ctx, client, src, &spec)
 
+	var content *storage.ContentManifest
+	if releaseContentStore != "" {
+		content = storeContent(ctx, client, src)
+	}
+
 	for _, dSpec := range spec.Destinations {
 		dst, err := storage.NewBucket(client, dSpec.BaseURL)
 		if err != nil {
@@ -105,6 +115,12 @@ func runRelease(cmd *cobra.Command, args []string) {
 				plog.Fatal(err)
 			}
 
+			if content != nil {
+				publishContent(ctx, dst, storage.FixPrefix(prefix), content)
+				recordObjects(dst, storage.FixPrefix(prefix), true)
+				continue
+			}
+
 			sync := index.NewSyncIndexJob(src, dst)
 			sync.DestinationPrefix(prefix)
 			sync.DirectoryHTML(dSpec.DirectoryHTML)
@@ -116,6 +132,7 @@ func runRelease(cmd *cobra.Command, args []string) {
 			if err := sync.Do(ctx); err != nil {
 				plog.Fatal(err)
 			}
+			recordObjects(dst, storage.FixPrefix(prefix), true)
 		}
 
 		// Now refresh the parent directory indexes.
@@ -132,8 +149,12 @@ func runRelease(cmd *cobra.Command, args []string) {
 			if err := parent.Do(ctx); err != nil {
 				plog.Fatal(err)
 			}
+			recordObjects(dst, storage.FixPrefix(prefix), false)
 		}
 	}
+
+	recordObjects(src, src.Prefix(), false)
+	writeManifest()
 }
 
 func sanitizeVersion() string {
@@ -197,6 +218,7 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 		plog.Fatalf("Duplicate GCE images found: %v", conflicting)
 	} else if len(conflicting) == 1 {
 		plog.Noticef("GCE image already exists: %s", conflicting[0])
+		recordArtifact("gce-image", conflicting[0], spec.GCE.Family)
 		publishImage(conflicting[0])
 		return
 	}
@@ -211,9 +233,13 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 		plog.Fatalf("GCE image not found %s%s", src.URL(), spec.GCE.Image)
 	}
 
+	licenseProject := spec.GCE.LicenseProject
+	if licenseProject == "" {
+		licenseProject = spec.GCE.Project
+	}
 	licenses := make([]string, len(spec.GCE.Licenses))
 	for i, l := range spec.GCE.Licenses {
-		req := api.Licenses.Get(spec.GCE.Project, l)
+		req := api.Licenses.Get(licenseProject, l)
 		req.Context(ctx)
 		license, err := req.Do()
 		if err != nil {
@@ -236,6 +262,7 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 
 	if releaseDryRun {
 		plog.Noticef("Would create GCE image %s", name)
+		recordArtifact("gce-image", name, spec.GCE.Family)
 		return
 	}
 
@@ -279,6 +306,7 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 
 	plog.Info("Success!")
 
+	recordArtifact("gce-image", name, spec.GCE.Family)
 	publishImage(name)
 
 	var pending map[string]*compute.Operation
@@ -329,7 +357,7 @@ func doGCE(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 
 	failures = 0
 	for len(pending) > 0 {
-		plog.Infof("Waiting on %s operations.", len(pending))
+		plog.Infof("Waiting on %d operations.", len(pending))
 		time.Sleep(1 * time.Second)
 		opReq := api.GlobalOperations.List(spec.GCE.Project)
 		if err := opReq.Pages(ctx, updatePending); err != nil {
@@ -351,37 +379,52 @@ func doAWS(ctx context.Context, client *http.Client, src *storage.Bucket, spec *
 	imageName := fmt.Sprintf("CoreOS-%v-%v", specChannel, specVersion)
 	imageName = regexp.MustCompile(`[^A-Za-z0-9()\\./_-]`).ReplaceAllLiteralString(imageName, "_")
 
+	failed := false
 	for _, cloud := range spec.AWS.Clouds {
-		for _, region := range cloud.Regions {
-			if releaseDryRun {
-				plog.Printf("Checking for images in %v %v...", cloud.Name, region)
-			} else {
-				plog.Printf("Publishing images in %v %v...", cloud.Name, region)
-			}
+		if releaseDryRun {
+			plog.Printf("Checking for images in %v...", cloud.Name)
+		} else {
+			plog.Printf("Publishing images in %v...", cloud.Name)
+		}
 
+		err := util.ForEachRegion(os.Stderr, cloud.Regions, 3, 10*time.Second, func(region string) error {
 			api, err := aws.New(&aws.Options{
 				Profile: cloud.Profile,
 				Region:  region,
 			})
 			if err != nil {
-				plog.Fatalf("creating client for %v %v: %v", cloud.Name, region, err)
+				return fmt.Errorf("creating client: %v", err)
 			}
 
-			publish := func(imageName string) {
+			publish := func(imageName string) error {
 				imageID, err := api.FindImage(imageName)
 				if err != nil {
-					plog.Fatalf("couldn't find image %q in %v %v: %v", imageName, cloud.Name, region, err)
+					return fmt.Errorf("couldn't find image %q: %v", imageName, err)
 				}
 
-				if !releaseDryRun {
-					err := api.PublishImage(imageID)
-					if err != nil {
-						plog.Fatalf("couldn't publish image in %v %v: %v", cloud.Name, region, err)
+				recordArtifact("ami-public", imageName, region)
+
+				if stagingBucket != "" {
+					plog.Noticef("Not publishing staged image %v in %v", imageID, region)
+				} else if !releaseDryRun {
+					if err := api.PublishImage(imageID); err != nil {
+						return fmt.Errorf("couldn't publish image %v: %v", imageID, err)
 					}
 				}
+				return nil
 			}
-			publish(imageName)
-			publish(imageName + "-hvm")
+			if err := publish(imageName); err != nil {
+				return err
+			}
+			return publish(imageName + "-hvm")
+		})
+		if err != nil {
+			// keep going so one run reports every failed region
+			plog.Errorf("%v: %v", cloud.Name, err)
+			failed = true
 		}
 	}
+	if failed {
+		plog.Fatalf("Publishing AWS images failed; rerun to retry the failed regions")
+	}
 }
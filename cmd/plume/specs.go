@@ -35,13 +35,14 @@ type storageSpec struct {
 }
 
 type gceSpec struct {
-	Project     string   // GCE project name
-	Family      string   // A group name, also used as name prefix
-	Description string   // Human readable-ish description
-	Licenses    []string // Identifiers for tracking usage
-	Image       string   // File name of image source
-	Publish     string   // Write published image name to given file
-	Limit       int      // Limit on # of old images to keep
+	Project        string   // GCE project name
+	Family         string   // A group name, also used as name prefix
+	Description    string   // Human readable-ish description
+	Licenses       []string // Identifiers for tracking usage
+	LicenseProject string   // Project owning Licenses, defaults to Project
+	Image          string   // File name of image source
+	Publish        string   // Write published image name to given file
+	Limit          int      // Limit on # of old images to keep
 }
 
 type azureSpec struct {
@@ -283,6 +284,7 @@ func AddSpecFlags(flags *pflag.FlagSet) {
 		"alpha", "channels: "+channels)
 	flags.StringVarP(&specVersion, "version", "V",
 		versions.VersionID, "release version")
+	addStagingFlags(flags)
 }
 
 func ChannelSpec() channelSpec {
@@ -345,6 +347,10 @@ func ChannelSpec() channelSpec {
 		spec.AWS = awsSpec{}
 	}
 
+	if stagingBucket != "" {
+		spec = stagingSpec(spec)
+	}
+
 	return spec
 }
 
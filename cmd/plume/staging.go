@@ -0,0 +1,189 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+
+	"github.com/coreos/mantle/storage"
+)
+
+// Staging runs the release pipeline against a staging bucket and
+// accounts, keeping production names for everything it creates. Each
+// production gs:// URL is rewritten to $StagingBucket/$ProductionBucket/,
+// so the build must be copied to the staging source first, e.g.
+//
+//     gsutil -m cp -r gs://builds.release.core-os.net/alpha/boards/amd64-usr/1409.0.0 \
+//         gs://staging/builds.release.core-os.net/alpha/boards/amd64-usr/
+var (
+	stagingBucket     string
+	stagingGCEProject string
+	stagingAWSProfile string
+	stagingAWSBucket  string
+	manifestFile      string
+
+	artifactsMu sync.Mutex
+	artifacts   = map[string]string{}
+)
+
+func addStagingFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&stagingBucket, "staging-bucket", "",
+		"rehearse the release in this gs:// bucket and prefix instead of production")
+	flags.StringVar(&stagingGCEProject, "staging-gce-project", "",
+		"GCE project to create images in with --staging-bucket, GCE is skipped if unset")
+	flags.StringVar(&stagingAWSProfile, "staging-aws-profile", "",
+		"AWS profile to create AMIs in with --staging-bucket, AWS is skipped if unset")
+	flags.StringVar(&stagingAWSBucket, "staging-aws-bucket", "",
+		"S3 bucket to import AMIs from with --staging-bucket")
+	flags.StringVar(&manifestFile, "manifest", "",
+		"write a sorted list of the artifacts created to this file")
+}
+
+// stagingSpec returns a copy of the channel spec which writes to the
+// staging bucket and accounts.
+func stagingSpec(spec channelSpec) channelSpec {
+	spec.BaseURL = stagingURL(spec.BaseURL)
+	dests := make([]storageSpec, len(spec.Destinations))
+	for i, d := range spec.Destinations {
+		d.BaseURL = stagingURL(d.BaseURL)
+		dests[i] = d
+	}
+	spec.Destinations = dests
+
+	if spec.GCE.Project != "" {
+		if stagingGCEProject == "" {
+			plog.Notice("No --staging-gce-project, skipping GCE.")
+			spec.GCE = gceSpec{}
+		} else {
+			// licenses only exist in the production project
+			spec.GCE.LicenseProject = spec.GCE.Project
+			spec.GCE.Project = stagingGCEProject
+		}
+	}
+
+	if spec.AWS.Image != "" {
+		if stagingAWSProfile == "" || stagingAWSBucket == "" {
+			plog.Notice("No --staging-aws-profile and --staging-aws-bucket, skipping AWS.")
+			spec.AWS = awsSpec{}
+		} else {
+			// a single account can't span partitions such as
+			// GovCloud, so only stage the first cloud, and don't
+			// share the AMIs with anyone.
+			cloud := spec.AWS.Clouds[0]
+			spec.AWS.Clouds = []awsCloudSpec{{
+				Name:         "staging",
+				Profile:      stagingAWSProfile,
+				Bucket:       stagingAWSBucket,
+				BucketRegion: cloud.BucketRegion,
+				Regions:      cloud.Regions,
+			}}
+		}
+	}
+
+	// Azure replication publishes images to the public gallery.
+	if spec.Azure.StorageAccount != "" {
+		plog.Notice("Azure has no staging equivalent, skipping Azure.")
+		spec.Azure = azureSpec{}
+	}
+
+	return spec
+}
+
+// stagingURL rewrites a production gs:// URL into the staging bucket.
+func stagingURL(production string) string {
+	u, err := url.Parse(production)
+	if err != nil {
+		plog.Panic(err)
+	}
+	s, err := url.Parse(stagingBucket)
+	if err != nil || s.Scheme != "gs" || s.Host == "" {
+		plog.Fatalf("Invalid --staging-bucket %q", stagingBucket)
+	}
+	s.Path = "/" + path.Join(s.Path, u.Host, u.Path)
+	return s.String()
+}
+
+// productionURL undoes stagingURL, so manifests from staging and
+// production runs can be compared directly.
+func productionURL(staged string) string {
+	if stagingBucket == "" {
+		return staged
+	}
+	prefix := strings.TrimSuffix(stagingBucket, "/") + "/"
+	if !strings.HasPrefix(staged, prefix) {
+		return staged
+	}
+	return "gs://" + strings.TrimPrefix(staged, prefix)
+}
+
+// recordArtifact adds an artifact to the manifest. The detail should
+// not vary between runs, e.g. a checksum or region but not an ID.
+func recordArtifact(kind, name, detail string) {
+	artifactsMu.Lock()
+	defer artifactsMu.Unlock()
+	artifacts[kind+"\t"+name] = detail
+}
+
+// recordObjects adds the objects in the bucket starting with prefix to
+// the manifest. If recursive is false, objects under sub-directories of
+// prefix are left out.
+func recordObjects(b *storage.Bucket, prefix string, recursive bool) {
+	base := b.URL()
+	base.Path = "/"
+	for _, obj := range b.Objects() {
+		if !strings.HasPrefix(obj.Name, prefix) {
+			continue
+		}
+		if !recursive && strings.Contains(strings.TrimPrefix(obj.Name, prefix), "/") {
+			continue
+		}
+		u := base.String() + obj.Name
+		recordArtifact("object", productionURL(u), fmt.Sprintf("%d %s", obj.Size, obj.Crc32c))
+	}
+}
+
+// writeManifest writes the recorded artifacts to --manifest, one per
+// line and sorted so manifests can be diffed.
+func writeManifest() {
+	if manifestFile == "" {
+		return
+	}
+
+	artifactsMu.Lock()
+	defer artifactsMu.Unlock()
+	keys := make([]string, 0, len(artifacts))
+	for k := range artifacts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s\t%s\n", k, artifacts[k])
+	}
+	if err := ioutil.WriteFile(manifestFile, buf.Bytes(), 0644); err != nil {
+		plog.Fatalf("Writing manifest: %v", err)
+	}
+	plog.Noticef("Wrote %d artifacts to %s", len(keys), manifestFile)
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is a file kept with a test's results by H.Attach or
+// H.AttachFile, such as a console log or packet capture.
+type Attachment struct {
+	Name string // as given to Attach
+	Path string // where it was saved, under Options.OutputDir
+}
+
+// Attach saves the contents of r as the named file in the test's output
+// directory and lists it in the test's results, so reports can link to
+// it. The name may include slashes to make subdirectories. Problems
+// saving the file are logged but don't fail the test.
+func (t *H) Attach(name string, r io.Reader) {
+	path, err := t.attachPath(name)
+	if err == nil {
+		err = writeAttachment(path, r)
+	}
+	if err != nil {
+		t.log(fmt.Sprintf("Failed to attach %s: %v", name, err))
+		return
+	}
+	t.addAttachment(name, path)
+}
+
+// AttachFile is like Attach but copies the file at path, or only lists
+// it if it is already in the test's output directory.
+func (t *H) AttachFile(name, path string) {
+	dir, err := t.mkOutputDir()
+	if err != nil {
+		t.log(fmt.Sprintf("Failed to attach %s: %v", name, err))
+		return
+	}
+	if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		t.addAttachment(name, path)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.log(fmt.Sprintf("Failed to attach %s: %v", name, err))
+		return
+	}
+	defer f.Close()
+	t.Attach(name, f)
+}
+
+// Attachments returns the files attached to the test so far.
+func (t *H) Attachments() []Attachment {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]Attachment(nil), t.attachments...)
+}
+
+// attachPath returns where to save the named attachment.
+func (t *H) attachPath(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty attachment name")
+	}
+	dir, err := t.mkOutputDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, sanitizePath(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func writeAttachment(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// addAttachment lists a saved attachment in the test's results and
+// notes it in the log.
+func (t *H) addAttachment(name, path string) {
+	t.mu.Lock()
+	t.attachments = append(t.attachments, Attachment{Name: name, Path: path})
+	t.mu.Unlock()
+	t.log(fmt.Sprintf("attached %s: %s", name, path))
+}
+
+// junitAttachments lists attachments in the form understood by the
+// Jenkins JUnit attachments plugin and GitLab.
+func junitAttachments(attachments []Attachment) string {
+	var lines []string
+	for _, a := range attachments {
+		lines = append(lines, "[[ATTACHMENT|"+a.Path+"]]")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAttach(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	outputDir := filepath.Join(tmp, "_out_temp")
+
+	external := filepath.Join(tmp, "external.log")
+	if err := ioutil.WriteFile(external, []byte("external"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var tap bytes.Buffer
+	suite := NewSuite(Options{OutputDir: outputDir}, Tests{
+		"Test": func(h *H) {
+			h.Attach("console.txt", strings.NewReader("console"))
+			h.Attach("logs/journal.txt", strings.NewReader("journal"))
+			h.AttachFile("external.log", external)
+			inside := filepath.Join(h.OutputDir(), "inside.txt")
+			ioutil.WriteFile(inside, []byte("inside"), 0666)
+			h.AttachFile("inside", inside)
+			h.Attach("", strings.NewReader("nameless"))
+			h.Fail()
+		},
+	})
+	suite.runTests(ioutil.Discard, &tap)
+
+	dir := filepath.Join(outputDir, "Test")
+	want := []Attachment{
+		{"console.txt", filepath.Join(dir, "console.txt")},
+		{"logs/journal.txt", filepath.Join(dir, "logs/journal.txt")},
+		{"external.log", filepath.Join(dir, "external.log")},
+		{"inside", filepath.Join(dir, "inside.txt")},
+	}
+	r := suite.Results()[0]
+	if !reflect.DeepEqual(r.Attachments, want) {
+		t.Fatalf("got attachments %+v, want %+v", r.Attachments, want)
+	}
+	for _, a := range want {
+		data, err := ioutil.ReadFile(a.Path)
+		if err != nil {
+			t.Errorf("reading %s: %v", a.Name, err)
+		} else if name := strings.TrimSuffix(filepath.Base(a.Path), filepath.Ext(a.Path)); string(data) != name {
+			t.Errorf("%s contains %q, want %q", a.Name, data, name)
+		}
+	}
+	if !strings.Contains(r.Output, "Failed to attach : empty attachment name") {
+		t.Errorf("nameless attachment not reported:\n%s", r.Output)
+	}
+	if !strings.Contains(tap.String(), "    - name: \"console.txt\"\n      path: \""+want[0].Path+"\"\n") {
+		t.Errorf("attachment missing from TAP:\n%s", tap.String())
+	}
+
+	junit := filepath.Join(tmp, "junit.xml")
+	config := newConfig(Options{}, r.Start)
+	if err := writeJUnit(junit, "suite", r.Start, config, suite.Results()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "[[ATTACHMENT|"+want[1].Path+"]]") {
+		t.Errorf("attachment missing from JUnit report:\n%s", data)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxBenchmarkN caps the iterations a benchmark is calibrated to.
+const maxBenchmarkN = 1e9
+
+// BenchTime is how long each benchmark runs for, either a duration
+// such as "10s" or a fixed number of iterations written "100x". The
+// zero BenchTime means one second.
+type BenchTime struct {
+	D time.Duration
+	N int
+}
+
+// ParseBenchTime parses a bench time written as a duration or "Nx".
+func ParseBenchTime(s string) (BenchTime, error) {
+	if strings.HasSuffix(s, "x") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "x"))
+		if err != nil || n < 1 {
+			return BenchTime{}, fmt.Errorf("bench time %q is not a positive iteration count", s)
+		}
+		return BenchTime{N: n}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return BenchTime{}, fmt.Errorf("bench time %q is not a duration or Nx", s)
+	}
+	return BenchTime{D: d}, nil
+}
+
+func (t BenchTime) validate() error {
+	if t.D < 0 || t.N < 0 {
+		return fmt.Errorf("bench time %v is negative", t)
+	}
+	return nil
+}
+
+func (t BenchTime) String() string {
+	if t.N > 0 {
+		return fmt.Sprintf("%dx", t.N)
+	}
+	return t.D.String()
+}
+
+// Set implements flag.Value.
+func (t *BenchTime) Set(value string) error {
+	bt, err := ParseBenchTime(value)
+	if err != nil {
+		return err
+	}
+	*t = bt
+	return nil
+}
+
+// Type implements pflag.Value.
+func (t *BenchTime) Type() string {
+	return "benchtime"
+}
+
+// BenchmarkResult records how a benchmark ran.
+type BenchmarkResult struct {
+	N         int           // Iterations run.
+	T         time.Duration // Time taken by all iterations.
+	MemAllocs uint64        // Allocations by all iterations, if reported.
+	MemBytes  uint64        // Bytes allocated by all iterations, if reported.
+
+	// Metrics reported with B.ReportMetric, keyed by unit.
+	Extra map[string]float64 `json:",omitempty"`
+}
+
+// NsPerOp returns the nanoseconds taken by each iteration.
+func (r BenchmarkResult) NsPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return r.T.Nanoseconds() / int64(r.N)
+}
+
+// AllocsPerOp returns the allocations made by each iteration.
+func (r BenchmarkResult) AllocsPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return int64(r.MemAllocs) / int64(r.N)
+}
+
+// AllocedBytesPerOp returns the bytes allocated by each iteration.
+func (r BenchmarkResult) AllocedBytesPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return int64(r.MemBytes) / int64(r.N)
+}
+
+// Metrics returns every figure reported for the benchmark by unit,
+// such as "ns/op", including those from ReportMetric.
+func (r BenchmarkResult) Metrics() map[string]float64 {
+	m := map[string]float64{"ns/op": float64(r.NsPerOp())}
+	if r.MemAllocs > 0 || r.MemBytes > 0 {
+		m["B/op"] = float64(r.AllocedBytesPerOp())
+		m["allocs/op"] = float64(r.AllocsPerOp())
+	}
+	for unit, v := range r.Extra {
+		m[unit] = v
+	}
+	return m
+}
+
+// String formats the result like the go test benchmark output, as in
+// "100  2000 ns/op  64 B/op  2 allocs/op".
+func (r BenchmarkResult) String() string {
+	metrics := r.Metrics()
+	var units, extra []string
+	for _, unit := range []string{"ns/op", "B/op", "allocs/op"} {
+		if _, ok := metrics[unit]; ok {
+			units = append(units, unit)
+		}
+	}
+	for unit := range r.Extra {
+		switch unit {
+		case "ns/op", "B/op", "allocs/op":
+		default:
+			extra = append(extra, unit)
+		}
+	}
+	sort.Strings(extra)
+	units = append(units, extra...)
+
+	s := fmt.Sprintf("%8d", r.N)
+	for _, unit := range units {
+		s += fmt.Sprintf("\t%10s %s", strconv.FormatFloat(metrics[unit], 'g', -1, 64), unit)
+	}
+	return s
+}
+
+// B is passed to benchmark functions, which Benchmark turns into
+// tests. It embeds H, so a benchmark logs, fails and skips like any
+// other test. The benchmark must run its target b.N times; b.N is
+// adjusted until the benchmark runs for Options.BenchTime.
+type B struct {
+	*H
+	N int
+
+	benchTime  BenchTime
+	showAllocs bool
+	extra      map[string]float64
+
+	// Timer state; see StartTimer.
+	timerOn     bool
+	timerStart  time.Time
+	elapsed     time.Duration
+	startAllocs uint64
+	startBytes  uint64
+	netAllocs   uint64
+	netBytes    uint64
+}
+
+// Benchmark returns a test which calibrates and runs f, reporting the
+// result in the test log and TestResult.Benchmark.
+func Benchmark(f func(b *B)) func(h *H) {
+	return func(h *H) {
+		b := &B{
+			H:          h,
+			benchTime:  h.suite.opts.BenchTime,
+			showAllocs: h.suite.opts.BenchMem,
+		}
+		b.launch(f)
+
+		r := b.result()
+		h.mu.Lock()
+		h.bench = &r
+		h.mu.Unlock()
+		h.Logf("%s", r)
+	}
+}
+
+// StartTimer starts timing the benchmark. Timing starts automatically
+// before each run of the benchmark function; StartTimer resumes it
+// after a call to StopTimer.
+func (b *B) StartTimer() {
+	if b.timerOn {
+		return
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	b.startAllocs = ms.Mallocs
+	b.startBytes = ms.TotalAlloc
+	b.timerStart = time.Now()
+	b.timerOn = true
+}
+
+// StopTimer stops timing the benchmark, so setup such as booting a
+// machine isn't counted.
+func (b *B) StopTimer() {
+	if !b.timerOn {
+		return
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	b.elapsed += time.Since(b.timerStart)
+	b.netAllocs += ms.Mallocs - b.startAllocs
+	b.netBytes += ms.TotalAlloc - b.startBytes
+	b.timerOn = false
+}
+
+// ResetTimer zeroes the elapsed time and allocations of the benchmark
+// and any metrics reported with ReportMetric.
+func (b *B) ResetTimer() {
+	if b.timerOn {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		b.startAllocs = ms.Mallocs
+		b.startBytes = ms.TotalAlloc
+		b.timerStart = time.Now()
+	}
+	b.elapsed = 0
+	b.netAllocs = 0
+	b.netBytes = 0
+	b.extra = nil
+}
+
+// ReportAllocs reports the allocations of the benchmark, as if
+// Options.BenchMem were set for it.
+func (b *B) ReportAllocs() {
+	b.showAllocs = true
+}
+
+// ReportMetric adds the figure n to the result in the given unit,
+// such as "boots/s" or "ms/boot", replacing any earlier value for the
+// unit. The unit must not contain spaces. The built-in units "ns/op",
+// "B/op" and "allocs/op" may be overridden.
+func (b *B) ReportMetric(n float64, unit string) {
+	if unit == "" || strings.IndexFunc(unit, unicode.IsSpace) >= 0 {
+		panic(fmt.Sprintf("harness: invalid benchmark metric unit %q", unit))
+	}
+	if b.extra == nil {
+		b.extra = make(map[string]float64)
+	}
+	b.extra[unit] = n
+}
+
+// runN runs the benchmark function for n iterations.
+func (b *B) runN(f func(b *B), n int) {
+	runtime.GC()
+	b.N = n
+	b.ResetTimer()
+	b.StartTimer()
+	f(b)
+	b.StopTimer()
+}
+
+// launch runs the benchmark function with increasing b.N until it
+// runs for the bench time, or once for a fixed number of iterations.
+func (b *B) launch(f func(b *B)) {
+	if b.benchTime.N > 0 {
+		b.runN(f, b.benchTime.N)
+		return
+	}
+
+	d := b.benchTime.D
+	b.runN(f, 1)
+	for !b.Failed() && b.elapsed < d && b.N < maxBenchmarkN {
+		last := int64(b.N)
+		prevns := b.elapsed.Nanoseconds()
+		if prevns <= 0 {
+			prevns = 1
+		}
+		// Aim 20% past the goal so the next run is likely the last,
+		// but grow no more than 100x at a time.
+		n := d.Nanoseconds() * last / prevns
+		n += n / 5
+		if n > 100*last {
+			n = 100 * last
+		}
+		if n <= last {
+			n = last + 1
+		}
+		if n > maxBenchmarkN {
+			n = maxBenchmarkN
+		}
+		b.runN(f, int(n))
+	}
+}
+
+func (b *B) result() BenchmarkResult {
+	r := BenchmarkResult{N: b.N, T: b.elapsed, Extra: b.extra}
+	if b.showAllocs {
+		r.MemAllocs = b.netAllocs
+		r.MemBytes = b.netBytes
+	}
+	return r
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBenchTime(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want BenchTime
+		ok   bool
+	}{
+		{"1s", BenchTime{D: time.Second}, true},
+		{"100ms", BenchTime{D: 100 * time.Millisecond}, true},
+		{"10x", BenchTime{N: 10}, true},
+		{"0x", BenchTime{}, false},
+		{"-1s", BenchTime{}, false},
+		{"x", BenchTime{}, false},
+		{"soon", BenchTime{}, false},
+	} {
+		got, err := ParseBenchTime(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseBenchTime(%q) = %v, %v; want %v, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	var fixed []int
+	var sink []byte
+	tests := Tests{
+		"Fixed": Benchmark(func(b *B) {
+			fixed = append(fixed, b.N)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sink = make([]byte, 64)
+			}
+			b.ReportMetric(2.5, "boots/s")
+		}),
+		"Failed": Benchmark(func(b *B) {
+			b.Fatal("broken")
+		}),
+	}
+
+	suite := NewSuite(Options{BenchTime: BenchTime{N: 7}}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+	_ = sink
+
+	if len(fixed) != 1 || fixed[0] != 7 {
+		t.Errorf("Fixed ran with b.N %v; want [7]", fixed)
+	}
+	for _, r := range suite.Results() {
+		switch r.Name {
+		case "Fixed":
+			if r.Benchmark == nil {
+				t.Fatalf("Fixed has no benchmark result")
+			}
+			if r.Benchmark.N != 7 || r.Benchmark.MemAllocs < 7 || r.Benchmark.Extra["boots/s"] != 2.5 {
+				t.Errorf("Fixed benchmark result %+v", *r.Benchmark)
+			}
+			if !strings.Contains(r.Output, "2.5 boots/s") || !strings.Contains(r.Output, "allocs/op") {
+				t.Errorf("Fixed output lacks its figures: %q", r.Output)
+			}
+		case "Failed":
+			if r.Result != "FAIL" || r.Benchmark != nil {
+				t.Errorf("Failed: got %s with benchmark %v", r.Result, r.Benchmark)
+			}
+		}
+	}
+}
+
+func TestBenchmarkCalibrates(t *testing.T) {
+	var ns []int
+	tests := Tests{
+		"Sleep": Benchmark(func(b *B) {
+			ns = append(ns, b.N)
+			for i := 0; i < b.N; i++ {
+				time.Sleep(time.Millisecond)
+			}
+		}),
+	}
+
+	suite := NewSuite(Options{BenchTime: BenchTime{D: 20 * time.Millisecond}}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ns) < 2 || ns[0] != 1 {
+		t.Fatalf("b.N went %v; want 1 then more", ns)
+	}
+	r := suite.Results()[0]
+	if r.Benchmark == nil || r.Benchmark.N != ns[len(ns)-1] || r.Benchmark.T < 20*time.Millisecond {
+		t.Errorf("got benchmark result %+v after b.N %v", r.Benchmark, ns)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FailureBudget is how many top-level test failures a suite tolerates
+// before failing, for tiers of tests such as canaries where a few
+// unstable tests shouldn't fail the whole run. It is written "N" for a
+// number of failures or "N%" for a percentage of the tests run, either
+// optionally followed by ":" and a tag expression, as for
+// Options.TagMatch, restricting the budget to failures of tests with
+// matching tags; other failures fail the suite as usual. Failures
+// within the budget don't trigger Options.FailFast. The zero
+// FailureBudget tolerates no failures.
+type FailureBudget struct {
+	Count   int     // failures allowed, if Percent is 0
+	Percent float64 // percentage of the tests run allowed to fail
+	Tags    string  // if not "", the tag expression of the tests covered
+}
+
+// ParseFailureBudget parses a failure budget such as "3", "5%", or
+// "10%:canary".
+func ParseFailureBudget(s string) (FailureBudget, error) {
+	var b FailureBudget
+	amount := s
+	if i := strings.Index(s, ":"); i >= 0 {
+		amount, b.Tags = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	amount = strings.TrimSpace(amount)
+	var err error
+	if strings.HasSuffix(amount, "%") {
+		b.Percent, err = strconv.ParseFloat(strings.TrimSuffix(amount, "%"), 64)
+	} else {
+		b.Count, err = strconv.Atoi(amount)
+	}
+	if err != nil {
+		return FailureBudget{}, fmt.Errorf("failure budget %q is not of the form N, N%%, or N:tags", s)
+	}
+	if err := b.validate(); err != nil {
+		return FailureBudget{}, err
+	}
+	return b, nil
+}
+
+func (b FailureBudget) validate() error {
+	if b.Count < 0 || b.Percent < 0 || b.Percent > 100 {
+		return fmt.Errorf("failure budget %s is out of range", b)
+	}
+	if _, err := parseTagExpr(b.Tags); err != nil {
+		return fmt.Errorf("failure budget: %v", err)
+	}
+	return nil
+}
+
+func (b FailureBudget) String() string {
+	if b == (FailureBudget{}) {
+		return ""
+	}
+	s := strconv.Itoa(b.Count)
+	if b.Percent != 0 {
+		s = strconv.FormatFloat(b.Percent, 'g', -1, 64) + "%"
+	}
+	if b.Tags != "" {
+		s += ":" + b.Tags
+	}
+	return s
+}
+
+// Set implements flag.Value.
+func (b *FailureBudget) Set(value string) error {
+	if value == "" {
+		*b = FailureBudget{}
+		return nil
+	}
+	budget, err := ParseFailureBudget(value)
+	if err != nil {
+		return err
+	}
+	*b = budget
+	return nil
+}
+
+// Type implements pflag.Value.
+func (b *FailureBudget) Type() string {
+	return "budget"
+}
+
+// covers reports whether failures of the top-level test with the given
+// tags count against the budget.
+func (b FailureBudget) covers(tags []string) bool {
+	if b.Count == 0 && b.Percent == 0 {
+		return false
+	}
+	expr, err := parseTagExpr(b.Tags)
+	return err == nil && expr.match(tags)
+}
+
+// allows reports whether failed failures out of run tests are within
+// the budget.
+func (b FailureBudget) allows(failed, run int) bool {
+	if b.Percent != 0 {
+		return float64(failed) <= b.Percent/100*float64(run)
+	}
+	return failed <= b.Count
+}
+
+// countBudget tallies a finished top-level test against the failure
+// budget, reporting whether a failure of it is covered. The caller
+// must hold resultsMu.
+func (s *Suite) countBudget(r TestResult) bool {
+	// SuiteSetup and SuiteTeardown must always pass.
+	name := s.baseName(r.Name)
+	if _, ok := s.tests[name]; !ok {
+		return false
+	}
+	if !s.opts.FailureBudget.covers(s.opts.TestTags[name]) {
+		return false
+	}
+	switch r.Result {
+	case "SKIP", "NOT RUN":
+		return false
+	case "FAIL":
+		s.budgeted = append(s.budgeted, r.Name)
+	}
+	s.budgetRun++
+	return true
+}
+
+// withinBudget reports whether the failures covered by the budget are
+// few enough. The caller must hold resultsMu.
+func (s *Suite) withinBudget() bool {
+	return s.opts.FailureBudget.allows(len(s.budgeted), s.budgetRun)
+}
+
+// reportBudget lists the failures covered by the failure budget.
+func (s *Suite) reportBudget(out io.Writer) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	if len(s.budgeted) == 0 {
+		return
+	}
+	verdict := "within"
+	if !s.withinBudget() {
+		verdict = "exceeding"
+	}
+	fmt.Fprintf(out, "harness: %d of %d tests failed, %s the failure budget %s: %s\n",
+		len(s.budgeted), s.budgetRun, verdict, s.opts.FailureBudget, strings.Join(s.budgeted, ", "))
+}
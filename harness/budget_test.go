@@ -0,0 +1,105 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseFailureBudget(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want FailureBudget
+	}{
+		{"3", FailureBudget{Count: 3}},
+		{"5%", FailureBudget{Percent: 5}},
+		{"2.5%:canary", FailureBudget{Percent: 2.5, Tags: "canary"}},
+		{"1: canary && !slow", FailureBudget{Count: 1, Tags: "canary && !slow"}},
+	} {
+		got, err := ParseFailureBudget(tc.s)
+		if err != nil {
+			t.Errorf("%q: %v", tc.s, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %+v; want %+v", tc.s, got, tc.want)
+		}
+		again, err := ParseFailureBudget(got.String())
+		if err != nil || again != got {
+			t.Errorf("%q: %q doesn't parse back: %+v, %v", tc.s, got, again, err)
+		}
+	}
+	for _, s := range []string{"", "x", "-1", "101%", "3:a||", "%"} {
+		if b, err := ParseFailureBudget(s); err == nil {
+			t.Errorf("%q: parsed as %+v", s, b)
+		}
+	}
+}
+
+func TestSuiteFailureBudget(t *testing.T) {
+	tests := Tests{}
+	tags := map[string][]string{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("Canary%d", i)
+		fail := i < 2
+		tests.Add(name, func(h *H) {
+			if fail {
+				h.Fail()
+			}
+		})
+		tags[name] = []string{"canary"}
+	}
+	tests.Add("Stable", func(h *H) {})
+
+	for _, tc := range []struct {
+		budget  string
+		failed  bool
+		verdict string
+	}{
+		{"", true, ""},
+		{"1", true, "2 of 11 tests failed, exceeding"},
+		{"2", false, "2 of 11 tests failed, within"},
+		{"20%", false, "2 of 11 tests failed, within"},
+		{"10%", true, "2 of 11 tests failed, exceeding"},
+		{"2:canary", false, "2 of 10 tests failed, within"},
+		{"2:!canary", true, ""},
+	} {
+		budget, _ := ParseFailureBudget(tc.budget)
+		suite := NewSuite(Options{FailureBudget: budget, TestTags: tags}, tests)
+		var out bytes.Buffer
+		err := suite.runTests(&out, nil)
+		suite.reportBudget(&out)
+		if failed := err == SuiteFailed; failed != tc.failed {
+			t.Errorf("budget %q: got %v; want failed %v", tc.budget, err, tc.failed)
+		}
+		if tc.verdict != "" && !strings.Contains(out.String(), tc.verdict) {
+			t.Errorf("budget %q: report missing %q:\n%s", tc.budget, tc.verdict, out.String())
+		}
+	}
+
+	// Failures within the budget don't stop the suite.
+	suite := NewSuite(Options{FailureBudget: FailureBudget{Count: 2}, FailFast: true}, tests)
+	if err := suite.runTests(&bytes.Buffer{}, nil); err != nil {
+		t.Errorf("FailFast: got %v", err)
+	}
+	for _, r := range suite.Results() {
+		if r.Result == "NOT RUN" {
+			t.Errorf("FailFast: %s not run", r.Name)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coreos/mantle/system/exec"
+)
+
+// cpuPeriod is the cgroup CPU bandwidth period in microseconds.
+const cpuPeriod = 100000
+
+// initCgroup enables the controllers needed to limit test cgroups.
+func (s *Suite) initCgroup() error {
+	var controllers []string
+	if s.opts.CPUQuota > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if s.opts.CPUSet != "" {
+		controllers = append(controllers, "+cpuset")
+	}
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	control := filepath.Join(s.opts.Cgroup, "cgroup.subtree_control")
+	if err := ioutil.WriteFile(control, []byte(strings.Join(controllers, " ")), 0644); err != nil {
+		return fmt.Errorf("harness: enabling cgroup controllers: %v", err)
+	}
+	return nil
+}
+
+// cgroupPath returns the cgroup directory for the named test. Cgroups
+// are not nested since a cgroup with processes cannot delegate
+// controllers to children.
+func (s *Suite) cgroupPath(name string) string {
+	s.testOutputPath(name)
+
+	s.dirsMu.Lock()
+	dir := s.testDirs[name]
+	s.dirsMu.Unlock()
+
+	return filepath.Join(s.opts.Cgroup, strings.Replace(dir, string(filepath.Separator), ".", -1))
+}
+
+func (h *H) mkCgroup() (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cgroup != "" {
+		return h.cgroup, nil
+	}
+
+	opts := &h.suite.opts
+	dir := h.suite.cgroupPath(h.name)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("Failed to create cgroup: %v", err)
+	}
+
+	if opts.CPUQuota > 0 {
+		limit := fmt.Sprintf("%d %d", int64(opts.CPUQuota*cpuPeriod), cpuPeriod)
+		if err := ioutil.WriteFile(filepath.Join(dir, "cpu.max"), []byte(limit), 0644); err != nil {
+			return "", fmt.Errorf("Failed to set cgroup CPU quota: %v", err)
+		}
+	}
+	if opts.CPUSet != "" {
+		if err := ioutil.WriteFile(filepath.Join(dir, "cpuset.cpus"), []byte(opts.CPUSet), 0644); err != nil {
+			return "", fmt.Errorf("Failed to set cgroup cpuset: %v", err)
+		}
+	}
+
+	h.cgroup = dir
+	return dir, nil
+}
+
+// Cgroup returns the path to a cgroup v2 directory, limited according to
+// Options.CPUQuota and Options.CPUSet, which test frameworks should move
+// heavyweight helper processes such as virtual machines into. It returns
+// "" if Options.Cgroup is not set. The cgroup is removed when the test
+// finishes.
+func (h *H) Cgroup() string {
+	if h.suite.opts.Cgroup == "" {
+		return ""
+	}
+	dir, err := h.mkCgroup()
+	if err != nil {
+		h.log(err.Error())
+		h.FailNow()
+	}
+	return dir
+}
+
+// ProcessGroup returns the exec.Group test frameworks should start
+// helper processes in, with exec.ExecCmd.Group, when they aren't moved
+// into the test's Cgroup. The process trees of the helpers are killed
+// when the test finishes.
+func (h *H) ProcessGroup() *exec.Group {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.group == nil {
+		h.group = exec.NewGroup()
+	}
+	return h.group
+}
+
+// killProcesses kills any helper processes left running in the test's
+// cgroup or process group, logging how many there were, so they don't
+// leak into the rest of the run when the test fails or times out
+// without stopping them.
+func (h *H) killProcesses() {
+	h.mu.RLock()
+	dir, group := h.cgroup, h.group
+	h.mu.RUnlock()
+
+	if n := group.Kill(); n > 0 {
+		h.log(fmt.Sprintf("Killed %d stray process groups", n))
+	}
+	if dir == "" {
+		return
+	}
+	n, err := killCgroup(dir)
+	if n > 0 {
+		h.log(fmt.Sprintf("Killed %d stray processes in cgroup", n))
+	}
+	if err != nil {
+		h.log(fmt.Sprintf("Failed to kill processes in cgroup: %v", err))
+	}
+}
+
+// killCgroup kills the processes in a cgroup and waits for them to
+// exit, returning how many there were.
+func killCgroup(dir string) (int, error) {
+	pids, err := cgroupProcs(dir)
+	if err != nil || len(pids) == 0 {
+		return 0, err
+	}
+	// cgroup.kill, from Linux 5.14, also catches processes which fork
+	// while they are being killed.
+	killEach := ioutil.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644) != nil
+	for i := 0; i < 50; i++ {
+		left, err := cgroupProcs(dir)
+		if err != nil || len(left) == 0 {
+			return len(pids), err
+		}
+		if killEach {
+			for _, pid := range left {
+				syscall.Kill(pid, syscall.SIGKILL)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return len(pids), fmt.Errorf("processes still running after 5s")
+}
+
+// cgroupProcs lists the processes in a cgroup.
+func cgroupProcs(dir string) ([]int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(b)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cgroup.procs: %v", err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// removeCgroup removes the test's cgroup, if any, once killProcesses
+// has emptied it.
+func (h *H) removeCgroup() {
+	h.mu.Lock()
+	dir := h.cgroup
+	h.cgroup = ""
+	h.mu.Unlock()
+
+	if dir == "" {
+		return
+	}
+	if err := os.Remove(dir); err != nil {
+		h.log(fmt.Sprintf("Failed to remove cgroup: %v", err))
+	}
+}
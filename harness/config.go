@@ -0,0 +1,126 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config records how a suite was run, so that its reports can still be
+// made sense of long after the run. It is embedded in the TAP and JUnit
+// reports and is available to programs writing their own from
+// Suite.Config.
+type Config struct {
+	// Version of the program running the suite, from Options.Version.
+	Version string `json:"version,omitempty"`
+
+	// Options are the suite's resolved options, by flag name.
+	Options map[string]string `json:"options"`
+
+	// Properties are further settings from Options.Properties.
+	Properties map[string]string `json:"properties,omitempty"`
+
+	// Fingerprint of the host environment.
+	Command   []string `json:"command"`
+	Host      string   `json:"host,omitempty"`
+	Kernel    string   `json:"kernel,omitempty"`
+	GoVersion string   `json:"go_version"`
+	OS        string   `json:"os"`
+	Arch      string   `json:"arch"`
+	CPUs      int      `json:"cpus"`
+
+	Start time.Time `json:"start_time"`
+}
+
+// Property is a single setting from a Config.
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// newConfig snapshots the options and host environment.
+func newConfig(opts Options, start time.Time) Config {
+	c := Config{
+		Version:    opts.Version,
+		Options:    make(map[string]string),
+		Properties: opts.Properties,
+		Command:    os.Args,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		Start:      start,
+	}
+	c.Host, _ = os.Hostname()
+	if release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		c.Kernel = strings.TrimSpace(string(release))
+	}
+
+	// The flags know how to format every option, so use them on a copy.
+	opts.FlagSet("", flag.ContinueOnError).VisitAll(func(f *flag.Flag) {
+		c.Options[f.Name] = f.Value.String()
+	})
+	return c
+}
+
+// Config returns the configuration recorded when the suite started
+// running.
+func (s *Suite) Config() Config {
+	return s.config
+}
+
+// Flatten lists every setting in the config as a property, sorted by
+// name, with options and properties under "option." and "property.".
+func (c Config) Flatten() []Property {
+	values := map[string]string{
+		"version":    c.Version,
+		"command":    strings.Join(c.Command, " "),
+		"host":       c.Host,
+		"kernel":     c.Kernel,
+		"go_version": c.GoVersion,
+		"os":         c.OS,
+		"arch":       c.Arch,
+		"cpus":       strconv.Itoa(c.CPUs),
+	}
+	if !c.Start.IsZero() {
+		values["start_time"] = c.Start.UTC().Format(time.RFC3339)
+	}
+	for name, value := range c.Options {
+		values["option."+name] = value
+	}
+	for name, value := range c.Properties {
+		values["property."+name] = value
+	}
+
+	var names []string
+	for name, value := range values {
+		if value != "" || strings.Contains(name, ".") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	props := make([]Property, len(names))
+	for i, name := range names {
+		props[i] = Property{name, values[name]}
+	}
+	return props
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	opts := Options{
+		Version:     "1.2.3",
+		Match:       "Foo",
+		TestTimeout: time.Minute,
+		Properties:  map[string]string{"platform": "qemu"},
+	}
+	config := newConfig(opts, time.Unix(0, 0))
+
+	for name, want := range map[string]string{
+		"run":         "Foo",
+		"testtimeout": "1m0s",
+		"outputdir":   defaultOutputDir,
+	} {
+		if got := config.Options[name]; got != want {
+			t.Errorf("option %s: got %q; want %q", name, got, want)
+		}
+	}
+	if config.GoVersion != runtime.Version() {
+		t.Errorf("got Go version %q; want %q", config.GoVersion, runtime.Version())
+	}
+
+	props := config.Flatten()
+	for i := 1; i < len(props); i++ {
+		if props[i-1].Name >= props[i].Name {
+			t.Errorf("properties not sorted: %q before %q", props[i-1].Name, props[i].Name)
+		}
+	}
+	want := map[string]string{
+		"version":           "1.2.3",
+		"option.run":        "Foo",
+		"property.platform": "qemu",
+		"start_time":        "1970-01-01T00:00:00Z",
+	}
+	for _, p := range props {
+		if v, ok := want[p.Name]; ok && v == p.Value {
+			delete(want, p.Name)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("missing properties: %v", want)
+	}
+}
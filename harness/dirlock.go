@@ -0,0 +1,98 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// dirLocksMu protects dirLocks, the output directories locked by
+	// this process and how many times.
+	dirLocksMu sync.Mutex
+	dirLocks   = make(map[string]*dirLock)
+)
+
+type dirLock struct {
+	f     *os.File
+	count int
+}
+
+// LockOutputDir takes an advisory lock on an output directory, so that
+// two runs pointed at the same directory can't clobber each other's
+// results. It fails naming the process holding the lock if another run
+// has it. The lock is kept in a file next to the directory, since the
+// directory itself is removed when a suite starts, and is released when
+// unlock is called or the process exits. Suite.Run takes the lock, and
+// programs which use the directory before or after running a suite can
+// take it too; locks taken by the same process nest.
+func LockOutputDir(dir string) (unlock func(), err error) {
+	if filepath.Clean(dir) == "." {
+		return nil, errors.New("harness: no output directory provided")
+	}
+	path := filepath.Clean(dir) + ".lock"
+	dirLocksMu.Lock()
+	defer dirLocksMu.Unlock()
+
+	l := dirLocks[path]
+	if l == nil {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("harness: locking output directory: %v", err)
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+			f.Close()
+			holder, _ := ioutil.ReadFile(path)
+			if len(holder) == 0 {
+				holder = []byte("another process")
+			}
+			return nil, fmt.Errorf("harness: output directory %s is in use by %s", dir, strings.TrimSpace(string(holder)))
+		} else if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("harness: locking output directory: %v", err)
+		}
+		// Name the holder for anyone who finds the directory locked.
+		host, _ := os.Hostname()
+		f.Truncate(0)
+		fmt.Fprintf(f, "pid %d on %s, started %s: %s\n", os.Getpid(), host,
+			time.Now().Format(time.RFC3339), strings.Join(os.Args, " "))
+		l = &dirLock{f: f}
+		dirLocks[path] = l
+	}
+	l.count++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			dirLocksMu.Lock()
+			defer dirLocksMu.Unlock()
+			if l.count--; l.count == 0 {
+				delete(dirLocks, path)
+				// Leave the file for the next run; removing it could
+				// let two runs lock different files.
+				l.f.Truncate(0)
+				l.f.Close()
+			}
+		})
+	}, nil
+}
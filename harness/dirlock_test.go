@@ -0,0 +1,84 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLockOutputDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "_out_temp")
+
+	// Locks nest within a process.
+	unlock1, err := LockOutputDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock2, err := LockOutputDir(dir + "/")
+	if err != nil {
+		t.Fatalf("relocking: %v", err)
+	}
+	unlock2()
+	unlock2()
+	if _, ok := dirLocks[dir+".lock"]; !ok {
+		t.Error("lock released while still held")
+	}
+	holder, err := ioutil.ReadFile(dir + ".lock")
+	if err != nil || !strings.HasPrefix(string(holder), "pid ") {
+		t.Errorf("lock file names %q, %v", holder, err)
+	}
+	unlock1()
+	if _, ok := dirLocks[dir+".lock"]; ok {
+		t.Error("lock not released")
+	}
+
+	// Lock the file as another run would.
+	f, err := os.OpenFile(dir+".lock", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("pid 4242 on otherhost\n")
+
+	if _, err := LockOutputDir(dir); err == nil {
+		t.Fatal("locked a directory in use")
+	} else if !strings.Contains(err.Error(), "in use by pid 4242 on otherhost") {
+		t.Errorf("error doesn't name the holder: %v", err)
+	}
+	suite := NewSuite(Options{OutputDir: dir}, Tests{"Test": func(h *H) {}})
+	if err := suite.Run(); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Run got %v; want the directory in use", err)
+	}
+
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	unlock, err := LockOutputDir(dir)
+	if err != nil {
+		t.Fatalf("locking after release: %v", err)
+	}
+	unlock()
+}
@@ -20,6 +20,118 @@
 // with a test Suite struct which can then be launched via the Run method.
 //
 // Within these functions, use the Error, Fail or related methods to signal failure.
+// Use Warn or Warnf to report findings which should be visible without
+// failing the test; such tests are reported as passing with warnings.
+//
+// A test function which panics fails with the panic and its stack in
+// the test's output, and the suite goes on to run the remaining tests.
+// A panic in another goroutine still stops the whole suite.
+//
+// Debug, Info, and their f variants log at a level, and Debugw, Infow,
+// and Warnw add key/value fields, as in
+//
+//	h.Infow("machine booted", "id", m.ID(), "took", d)
+//
+// Messages below Options.LogLevel, Info by default, are dropped. The
+// level and fields are included in the JSON events as Level and Fields.
+//
+// Options.LogTimestamps prefixes log lines with the time, as RFC 3339 or
+// relative to the start of the test, to line them up with machine logs.
+//
+// Tests can call SetSeverity to mark themselves Critical, Major (the
+// default) or Minor. The suite summary breaks results down by severity,
+// and Options.FailSeverity keeps failures of less severe tests, such as
+// experimental ones, from failing the suite. Options.Quarantine does the
+// same for a list of tests, such as known flakes, whose results are still
+// worth collecting. Options.FailureBudget tolerates a number or
+// percentage of failures, such as among tests tagged as canaries.
+//
+// A test known to be broken can call ExpectFailure rather than being
+// skipped. It still runs, and is reported as XFAIL while it keeps failing
+// and as XPASS, an unexpected pass, once it has been fixed.
+//
+// Attach and AttachFile save files such as console logs and packet
+// captures in the test's output directory and list them in the results,
+// the TAP log, and the JUnit report, so CI systems can link them to the
+// test.
+//
+// The results of every test and subtest are also written to test.tap in
+// Options.OutputDir, in version 13 of the Test Anything Protocol, with
+// YAML diagnostics giving each test's duration, failure message, and
+// attachments.
+//
+// Options.Reporters adds Reporters of its own, which are told as each
+// test starts and finishes, to report results in other formats or to
+// other systems.
+//
+// Options.Retries, or SetRetries for a single test, runs failed
+// top-level tests again. Tests which pass on a later attempt are
+// reported as FLAKY and do not fail the suite.
+//
+// Options.Count runs each top-level test several times over, in
+// parallel with Options.CountParallel, to reproduce flaky failures. The
+// later runs are named "Name#01", "Name#02", and so on, and the pass
+// rate and the mean, median, and longest duration of each test are
+// listed once the suite finishes.
+//
+// Tests get credentials for external services with Secret, from
+// Options.Secrets, which may look them up in environment variables
+// (EnvSecrets), files (FileSecrets), or elsewhere. Tests declare the
+// secrets they need with RequireSecrets, and are skipped if any are
+// missing. The values of secrets are replaced with "[REDACTED]" in the
+// logs of all tests once they have been looked up.
+//
+// Tests of things only found at run time, such as the devices or cloud
+// regions available, are added to the running suite with AddTest. They
+// run in parallel once the sequential tests are done, and are reported
+// like any other top-level test.
+//
+// RunMatrix runs a test over every combination of a set of parameters,
+// such as architectures and configuration variants, as subtests named
+// after them, e.g. "arch=amd64,variant=a". The parameters are recorded
+// in the results and available to the subtests from Params.
+//
+// Options.FailFast stops the suite at the first failed test: tests not
+// yet started are reported as not run, and the contexts of running
+// tests are cancelled so they can abort early.
+//
+// SIGINT and SIGTERM stop the suite the same way, then wait for
+// Options.GracePeriod so the running tests can clean up after
+// themselves. Tests which finish in time are reported as usual, marked
+// as interrupted in their TestResult; those which don't are reported as
+// failed, and Run finishes the report and returns SuiteInterrupted. A
+// second signal stops waiting at once.
+//
+// Options.Watchdog saves the goroutine stacks of tests which have gone
+// quiet for too long to their output directory, to help find where
+// they are stuck, and Options.WatchdogKill fails them as well.
+//
+// Options.Progress prints a line every so often with how many tests are
+// running, finished, and queued, and how long the running ones have
+// taken, for runs in which tests take a long time to finish. Given
+// Options.ExpectedDurations, such as the mean durations of past runs,
+// it also estimates how long the suite has left and points out tests
+// running for longer than expected.
+//
+// Options.Slowest lists the slowest tests once the suite finishes, and
+// how long all tests took compared to the suite itself, to show where
+// running more in parallel or speeding tests up would pay off.
+//
+// Options.TestCpuProfile and TestMemProfile profile each top-level test
+// on its own, writing the profiles to its output directory, to find
+// which tests use the most CPU or let memory grow.
+//
+// Options.SuiteSetup and SuiteTeardown run once before the first test
+// and after the last, and are reported like any other test. The other
+// tests are not run if SuiteSetup fails.
+//
+// Benchmark turns a function of type `func(*harness.B)` into a test
+// which runs its target b.N times, calibrating b.N to Options.BenchTime.
+// The figures it reports, including any from ReportMetric, are logged
+// and recorded in TestResult.Benchmark and the suite's reports.
+//
+// MatchGolden compares output with a golden file kept in the test's
+// DataDir; set Options.UpdateGolden to record new golden files.
 //
 // Tests may be skipped if not applicable with a call to
 // the Skip method of *H:
@@ -30,6 +142,14 @@
 //         ...
 //     }
 //
+// Top-level tests can be given tags such as "slow" or "reboot" in
+// Options.TestTags and selected with an expression in Options.TagMatch,
+// as well as by name with the -harness.run flag described below.
+//
+// To see which tests a run would include without running any of them,
+// set Options.List (the -harness.list flag) to a regexp; Run then
+// prints the name and tags of each selected test matching it.
+//
 // Subtests
 //
 // The Run method of H allow defining subtests,
@@ -89,6 +209,24 @@
 //         // <tear-down code>
 //     }
 //
+// RunParallel does the same for data-driven tests, running a function
+// for each of n items as parallel subtests named by their index, at
+// most a given number at a time:
+//
+//     func AllItems(h *harness.H) {
+//         h.RunParallel("item", len(items), 4, func(i int, h *harness.H) {
+//             check(h, items[i])
+//         })
+//     }
+//
+// A parallel test which uses more than its share of Options.Parallel,
+// such as one booting several machines, can say so with SetWeight
+// before calling Parallel.
+//
+// Parallel tests which share something outside the suite, such as an
+// image or a quota, can call Lock with its name to run only one at a
+// time without holding up unrelated tests, which Exclusive would.
+//
 // Suite
 //
 // Individual tests are grouped into a test suite in order to execute them.
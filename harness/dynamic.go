@@ -0,0 +1,70 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+)
+
+// AddTest adds a top-level test to the suite while it runs, for tests
+// of things found at run time, such as the devices, images, or cloud
+// regions available. The test runs once the sequential tests are done,
+// in parallel with the others as if it had called Parallel, and is
+// reported like any other. It runs once whatever Options.Count, has no
+// tags, and isn't counted in the TAP plan. Tests which Options.Match
+// doesn't select are ignored. Adding a test with the name of another
+// fails t.
+func (t *H) AddTest(name string, fn func(t *H)) {
+	if err := t.suite.addTest(name, fn); err != nil {
+		t.Errorf("Adding test %q: %v", name, err)
+	}
+}
+
+// addTest starts a test added by H.AddTest, which waits its turn.
+func (s *Suite) addTest(name string, fn func(t *H)) error {
+	if _, ok := s.tests[name]; ok {
+		return fmt.Errorf("test already exists")
+	}
+	s.addedMu.Lock()
+	if s.added[name] {
+		s.addedMu.Unlock()
+		return fmt.Errorf("test already added")
+	}
+	if s.added == nil {
+		s.added = make(map[string]bool)
+	}
+	s.added[name] = true
+	s.addedMu.Unlock()
+
+	testName, ok := s.match.fullName(s.root, name)
+	if !ok {
+		return nil
+	}
+	t := s.root.newChild(testName, make(chan bool))
+	t.rerun = true
+	t.added = true
+	s.addedWG.Add(1)
+	go func() {
+		<-t.signal
+		s.addedWG.Done()
+	}()
+	t.announce()
+	go tRunner(t, func(t *H) {
+		t.Parallel()
+		t.repeatParallel = true // ignore the test's own call
+		fn(t)
+	})
+	return nil
+}
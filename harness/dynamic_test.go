@@ -0,0 +1,82 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestAddTest(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	ran := func(name string) {
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+	suite := NewSuite(Options{Parallel: 2, Match: "^(A|B|Found|Par)"}, Tests{
+		"A": func(h *H) {
+			ran("A")
+			h.AddTest("FoundOne", func(h *H) {
+				ran("FoundOne")
+				h.AddTest("FoundNested", func(h *H) { ran("FoundNested") })
+			})
+			h.AddTest("Ignored", func(h *H) { ran("Ignored") })
+		},
+		"B": func(h *H) {
+			ran("B")
+			h.AddTest("A", func(h *H) { ran("A again") })
+		},
+		"Par": func(h *H) {
+			h.Parallel()
+			h.AddTest("FoundTwo", func(h *H) {
+				h.Parallel() // already parallel
+				ran("FoundTwo")
+			})
+			h.AddTest("FoundTwo", func(h *H) { ran("FoundTwo again") })
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Fatalf("got %v, want SuiteFailed from adding tests twice", err)
+	}
+
+	results := make(map[string]string)
+	for _, r := range suite.Results() {
+		results[r.Name] = r.Result
+	}
+	want := map[string]string{
+		"A":           "PASS",
+		"B":           "FAIL",
+		"Par":         "FAIL",
+		"FoundOne":    "PASS",
+		"FoundNested": "PASS",
+		"FoundTwo":    "PASS",
+	}
+	if len(results) != len(want) {
+		t.Errorf("got results %v, want %v", results, want)
+	}
+	for name, result := range want {
+		if results[name] != result {
+			t.Errorf("%s: got %q, want %q", name, results[name], result)
+		}
+	}
+
+	// Added tests wait for the sequential tests.
+	if len(order) < 2 || order[0] != "A" || order[1] != "B" {
+		t.Errorf("ran tests in order %v, want A and B first", order)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+const defaultDataDir = "testdata"
+
+// DataDir returns the directory holding the test's data files, such
+// as golden files: a directory under Options.DataDir named like the
+// test's output directory. It may not exist.
+func (h *H) DataDir() string {
+	return filepath.Join(h.suite.opts.DataDir, sanitizePath(h.name))
+}
+
+// MatchGolden compares got with the golden file name.golden in the
+// test's DataDir, failing the test with a diff if they differ. What
+// the test got is kept as name.got in its OutputDir for inspection.
+// With Options.UpdateGolden set, the golden file is replaced with got
+// instead.
+func (h *H) MatchGolden(name string, got []byte) {
+	h.Helper()
+	path := filepath.Join(h.DataDir(), name+".golden")
+
+	if h.suite.opts.UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			h.Fatalf("Failed to create golden file directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, got, 0666); err != nil {
+			h.Fatalf("Failed to update golden file: %v", err)
+		}
+		h.Logf("Updated golden file %s", path)
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		h.Errorf("Golden file %s does not exist; update golden files to create it", path)
+		return
+	} else if err != nil {
+		h.Errorf("Failed to read golden file: %v", err)
+		return
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+
+	gotPath := filepath.Join(h.OutputDir(), name+".got")
+	if err := os.MkdirAll(filepath.Dir(gotPath), 0777); err != nil {
+		h.Logf("Failed to keep output: %v", err)
+	} else if err := ioutil.WriteFile(gotPath, got, 0666); err != nil {
+		h.Logf("Failed to keep output: %v", err)
+	}
+	h.Errorf("Output does not match golden file %s (-want +got):\n%s", path, diff.Diff(string(want), string(got)))
+}
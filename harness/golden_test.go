@@ -0,0 +1,74 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := "line one\nline two\n"
+	tests := Tests{
+		"Render": func(h *H) {
+			h.MatchGolden("config", []byte(output))
+		},
+	}
+	run := func(update bool) TestResult {
+		opts := Options{
+			OutputDir:    filepath.Join(dir, "_test_temp"),
+			DataDir:      filepath.Join(dir, "testdata"),
+			UpdateGolden: update,
+		}
+		suite := NewSuite(opts, tests)
+		suite.runTests(ioutil.Discard, nil)
+		return suite.Results()[0]
+	}
+
+	if r := run(false); r.Result != "FAIL" || !strings.Contains(r.Output, "does not exist") {
+		t.Errorf("missing golden file: got %s: %q", r.Result, r.Output)
+	}
+
+	if r := run(true); r.Result != "PASS" {
+		t.Errorf("updating golden file: got %s: %q", r.Result, r.Output)
+	}
+	golden := filepath.Join(dir, "testdata", "Render", "config.golden")
+	if data, err := ioutil.ReadFile(golden); err != nil || string(data) != output {
+		t.Errorf("golden file holds %q, %v; want %q", data, err, output)
+	}
+
+	if r := run(false); r.Result != "PASS" {
+		t.Errorf("matching golden file: got %s: %q", r.Result, r.Output)
+	}
+
+	output = "line one\nline 2\n"
+	r := run(false)
+	if r.Result != "FAIL" || !strings.Contains(r.Output, "-line two") || !strings.Contains(r.Output, "+line 2") {
+		t.Errorf("mismatched golden file: got %s: %q", r.Result, r.Output)
+	}
+	got := filepath.Join(dir, "_test_temp", "Render", "config.got")
+	if data, err := ioutil.ReadFile(got); err != nil || string(data) != output {
+		t.Errorf("kept output %q, %v; want %q", data, err, output)
+	}
+}
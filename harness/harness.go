@@ -24,9 +24,12 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/coreos/mantle/system/exec"
 )
 
 // H is a type passed to Test functions to manage test state and support formatted test logs.
@@ -43,14 +46,16 @@ type H struct {
 	mu       sync.RWMutex // guards output, failed, and done.
 	output   bytes.Buffer // Output generated by test.
 	w        io.Writer    // For flushToParent.
-	tap      io.Writer    // Optional TAP log of test results.
 	logger   *log.Logger
 	ctx      context.Context
 	cancel   context.CancelFunc
 	ran      bool // Test (or one of its subtests) was executed.
 	failed   bool // Test has failed.
+	warned   bool // Test has reported warnings.
 	skipped  bool // Test has been skipped.
+	notRun   bool // Test was not started; see Options.MaxFailures.
 	finished bool // Test function has completed.
+	panicked bool // Test function panicked.
 	done     bool // Test is finished and all subtests have completed.
 	hasSub   bool
 
@@ -59,15 +64,72 @@ type H struct {
 	level    int       // Nesting depth of test.
 	name     string    // Name of test.
 	start    time.Time // Time test started
+	logStart time.Time // Time relative log timestamps count from
 	duration time.Duration
 	barrier  chan bool // To signal parallel subtests they may start.
 	signal   chan bool // To signal a test is done.
 	sub      []*H      // Queue of subtests to be run in parallel.
 
 	isParallel bool
+	weight     int  // Share of Options.Parallel; see SetWeight.
+	hooks      bool // Root of SuiteSetup or SuiteTeardown, which always run.
+
+	// Retry state; see SetRetries.
+	attempt    int  // Number of this attempt, starting at 1.
+	retries    int  // Guarded by mu.
+	retriesSet bool // Guarded by mu.
+	rerun      bool // Attempt after the first of a parallel test.
+
+	// Watchdog state of top-level tests; see watchdog.go.
+	lastActive int64 // Unix time of the last progress in ns, atomic.
+	waits      int32 // Number of the test and its subtests waiting to run, atomic.
+	stalledAt  int64 // lastActive when last reported stalled.
+
+	// Exclusion state; see Exclusive and Lock.
+	shared    bool     // Holds suite.exclusive for reading.
+	exclusive bool     // Holds suite.exclusive for writing.
+	locked    []string // Resources held by Lock.
+
+	helpers  map[string]struct{} // Functions marked by Helper, guarded by mu.
+	cgroup   string              // Path to the test's cgroup, guarded by mu.
+	group    *exec.Group         // Helper processes, guarded by mu.
+	cpuProf  *os.File            // Per-test CPU profile, if being taken.
+	severity Severity            // Zero to inherit, guarded by mu; see SetSeverity.
+	xfail    bool                // Expected to fail, guarded by mu; see ExpectFailure.
+	bench    *BenchmarkResult    // Set by Benchmark, guarded by mu.
+
+	xfailReason string // Guarded by mu.
+
+	repeatParallel bool // Made parallel by Options.CountParallel.
+	added          bool // Added by AddTest while the suite runs.
+
+	// Phase timing state, guarded by mu.
+	phase      string        // Name of the current phase, if any.
+	phaseStart time.Time     // Time the current phase started.
+	phases     []PhaseResult // Completed phases.
+
+	attachments []Attachment // Guarded by mu; see Attach.
+	params      []Property   // Guarded by mu; see RunMatrix.
+
+	// Timeout state, guarded by timeoutMu; see SetTimeout.
+	timeoutMu   sync.Mutex
+	timeout     time.Duration
+	deadline    time.Time   // Zero while no timeout is running.
+	timer       *time.Timer // Fires at deadline.
+	timeoutDone bool        // Test has finished.
+
+	// Log suppression state, guarded by mu.
+	lastLog   string    // Most recent message written to the log.
+	repeated  int       // Number of times lastLog was suppressed.
+	rateStart time.Time // Start of the current rate limiting window.
+	rateCount int       // Messages logged in the current window.
+	rateDrop  int       // Messages dropped in the current window.
 }
 
 func (c *H) parentContext() context.Context {
+	if c != nil && c.parent == nil && !c.hooks && c.suite != nil && c.suite.ctx != nil {
+		return c.suite.ctx
+	}
 	if c == nil || c.parent == nil || c.parent.ctx == nil {
 		return context.Background()
 	}
@@ -88,18 +150,6 @@ func (c *H) flushToParent(format string, args ...interface{}) {
 
 	fmt.Fprintf(p.w, format, args...)
 
-	// TODO: include test numbers in TAP output.
-	if p.tap != nil {
-		name := strings.Replace(c.name, "#", "", -1)
-		if c.Failed() {
-			fmt.Fprintf(p.tap, "not ok - %s\n", name)
-		} else if c.Skipped() {
-			fmt.Fprintf(p.tap, "ok - %s # SKIP\n", name)
-		} else {
-			fmt.Fprintf(p.tap, "ok - %s\n", name)
-		}
-	}
-
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	io.Copy(p.w, &c.output)
@@ -133,13 +183,24 @@ func fmtDuration(d time.Duration) string {
 	return fmt.Sprintf("%.2fs", d.Seconds())
 }
 
+// fmtPhases returns a string listing phase durations in the form
+// "setup 1.00s, run 2.00s".
+func fmtPhases(phases []PhaseResult) string {
+	s := make([]string, len(phases))
+	for i, p := range phases {
+		s[i] = p.Name + " " + fmtDuration(p.Duration)
+	}
+	return strings.Join(s, ", ")
+}
+
 // Name returns the name of the running test or benchmark.
 func (c *H) Name() string {
 	return c.name
 }
 
 // Context returns the context for the current test.
-// The context is cancelled when the test finishes.
+// The context is cancelled when the test finishes, or when another test
+// fails under Options.FailFast.
 // A goroutine started during a test can wait for the
 // context's Done channel to become readable as a signal that the
 // test is over, so that the goroutine can exit.
@@ -157,9 +218,28 @@ func (c *H) setRan() {
 }
 
 // Fail marks the function as having failed but continues execution.
+// The first failure of a test runs Options.OnFailure, if set, before
+// Fail returns.
 func (c *H) Fail() {
-	if c.parent != nil {
-		c.parent.Fail()
+	if c.setFailed() && c.suite.opts.OnFailure != nil {
+		if xfail, _ := c.expectedFailure(); xfail {
+			return
+		}
+		dir, err := c.mkOutputDir()
+		if err != nil {
+			c.log(err.Error())
+			dir = ""
+		}
+		c.suite.opts.OnFailure(c.name, dir)
+	}
+}
+
+// setFailed marks the function and its parents as having failed,
+// reporting whether the function had not failed before. Failure of a
+// test expected to fail goes no further.
+func (c *H) setFailed() bool {
+	if c.parent != nil && !c.expectsFailure() {
+		c.parent.setFailed()
 	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -167,7 +247,9 @@ func (c *H) Fail() {
 	if c.done {
 		panic("Fail in goroutine after " + c.name + " has completed")
 	}
+	first := !c.failed
 	c.failed = true
+	return first
 }
 
 // Failed reports whether the function has failed.
@@ -177,6 +259,23 @@ func (c *H) Failed() bool {
 	return c.failed
 }
 
+// warn marks the function as having reported a warning.
+func (c *H) warn() {
+	if c.parent != nil {
+		c.parent.warn()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warned = true
+}
+
+// Warned reports whether the function has reported any warnings.
+func (c *H) Warned() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.warned
+}
+
 // FailNow marks the function as having failed and stops its execution.
 // Execution will continue at the next test.
 // FailNow must be called from the goroutine running the
@@ -211,9 +310,173 @@ func (c *H) FailNow() {
 
 // log generates the output. It's always at the same stack depth.
 func (c *H) log(s string) {
+	c.active()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.write(c.callDepth(), s, nil, false)
+}
+
+// logFailure is log for the reason a test failed, which is never
+// collapsed or rate limited. It's at the same stack depth as log.
+func (c *H) logFailure(s string) {
+	c.active()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.write(c.callDepth(), s, nil, true)
+}
+
+// logAt generates the output for a leveled message, unless it is
+// below Options.LogLevel. It's at the same stack depth as log.
+func (c *H) logAt(e *logEntry) {
+	if e.level < c.suite.opts.LogLevel {
+		return
+	}
+	c.active()
+	c.suite.redactEntry(e)
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.logger.Output(3, s)
+	c.write(c.callDepth(), e.String(), e, false)
+}
+
+// write records a message logged by the caller depth frames up. e is
+// the leveled entry the message was formatted from, if any. A message
+// which must not be suppressed is always written. c.mu must be held.
+func (c *H) write(depth int, s string, e *logEntry, always bool) {
+	s = c.suite.redact(s)
+	if stamp := c.timestamp(time.Now()); stamp != "" {
+		c.logger.SetPrefix(logIndent + stamp)
+	}
+
+	// Notes about suppressed messages are sent without e's level.
+	start := c.output.Len()
+	ok := c.admit(s, always)
+	c.emitOutput(start, nil)
+	if !ok {
+		return
+	}
+
+	start = c.output.Len()
+	c.lastLog = s
+	c.logger.Output(depth+1, s)
+	c.emitOutput(start, e)
+}
+
+// admit reports whether a message should be logged rather than
+// collapsed or rate limited, noting earlier suppressed messages in the
+// log. A message which must always be logged still counts against the
+// rate limit but is never dropped. c.mu must be held.
+func (c *H) admit(s string, always bool) bool {
+	opts := &c.suite.opts
+	if opts.CollapseLogs && s == c.lastLog && !always {
+		c.repeated++
+		return false
+	}
+	c.flushRepeated()
+	if always {
+		c.flushDropped()
+	}
+
+	if opts.LogRate > 0 {
+		now := time.Now()
+		if now.Sub(c.rateStart) >= time.Second {
+			c.flushDropped()
+			c.rateStart = now
+			c.rateCount = 0
+		}
+		if c.rateCount >= opts.LogRate && !always {
+			c.rateDrop++
+			return false
+		}
+		c.rateCount++
+	}
+	return true
+}
+
+// Helper marks the calling function as a test helper function.
+// When printing file and line information, that function will be skipped.
+// Helper may be called simultaneously from multiple goroutines.
+func (c *H) Helper() {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok {
+		return
+	}
+	name := runtime.FuncForPC(pc).Name()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.helpers == nil {
+		c.helpers = make(map[string]struct{})
+	}
+	c.helpers[name] = struct{}{}
+}
+
+// callDepth returns the depth to pass to the logger from log so the
+// message is attributed to the first caller of Log and friends which is
+// not a helper. c.mu must be held.
+func (c *H) callDepth() int {
+	// The logger counts itself, log, and log's caller, such as Logf.
+	const depth = 3
+	if len(c.helpers) == 0 {
+		return depth
+	}
+	pc := make([]uintptr, 50)
+	// Skip runtime.Callers, callDepth, and log.
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	frames.Next() // log's caller
+	for d := depth; ; d++ {
+		frame, more := frames.Next()
+		if _, ok := c.helpers[frame.Function]; !ok {
+			return d
+		}
+		if !more {
+			return depth
+		}
+	}
+}
+
+// flushRepeated notes any suppressed duplicate messages in the log.
+// c.mu must be held.
+func (c *H) flushRepeated() {
+	if c.repeated == 0 {
+		return
+	}
+	if c.repeated == 1 {
+		fmt.Fprintf(&c.output, "%slast message repeated 1 time\n",
+			c.logger.Prefix())
+	} else {
+		fmt.Fprintf(&c.output, "%slast message repeated %d times\n",
+			c.logger.Prefix(), c.repeated)
+	}
+	c.repeated = 0
+}
+
+// flushDropped notes any rate limited messages in the log.
+// c.mu must be held.
+func (c *H) flushDropped() {
+	if c.rateDrop == 0 {
+		return
+	}
+	fmt.Fprintf(&c.output, "%s%d messages suppressed by rate limit\n",
+		c.logger.Prefix(), c.rateDrop)
+	c.rateDrop = 0
+}
+
+// flushLog writes out any pending log suppression notes.
+func (c *H) flushLog() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.emitOutput(c.output.Len(), nil)
+	c.flushRepeated()
+	c.flushDropped()
+}
+
+// emitOutput sends anything logged since the output was start bytes
+// long as JSON events, if enabled, tagged with the level and fields of
+// e if it isn't nil. c.mu must be held.
+func (c *H) emitOutput(start int, e *logEntry) {
+	if c.suite.events != nil && c.output.Len() > start {
+		c.suite.events.logged(c.name, c.output.Bytes()[start:], e)
+	}
 }
 
 // Log formats its arguments using default formatting, analogous to Println,
@@ -228,25 +491,39 @@ func (c *H) Logf(format string, args ...interface{}) { c.log(fmt.Sprintf(format,
 
 // Error is equivalent to Log followed by Fail.
 func (c *H) Error(args ...interface{}) {
-	c.log(fmt.Sprintln(args...))
+	c.logFailure(fmt.Sprintln(args...))
 	c.Fail()
 }
 
 // Errorf is equivalent to Logf followed by Fail.
 func (c *H) Errorf(format string, args ...interface{}) {
-	c.log(fmt.Sprintf(format, args...))
+	c.logFailure(fmt.Sprintf(format, args...))
 	c.Fail()
 }
 
+// Warn is equivalent to Log but also marks the test as having passed with
+// warnings. Warnings are always reported but do not fail the test.
+func (c *H) Warn(args ...interface{}) {
+	c.log(fmt.Sprintln(args...))
+	c.warn()
+}
+
+// Warnf is equivalent to Logf but also marks the test as having passed with
+// warnings. Warnings are always reported but do not fail the test.
+func (c *H) Warnf(format string, args ...interface{}) {
+	c.log(fmt.Sprintf(format, args...))
+	c.warn()
+}
+
 // Fatal is equivalent to Log followed by FailNow.
 func (c *H) Fatal(args ...interface{}) {
-	c.log(fmt.Sprintln(args...))
+	c.logFailure(fmt.Sprintln(args...))
 	c.FailNow()
 }
 
 // Fatalf is equivalent to Logf followed by FailNow.
 func (c *H) Fatalf(format string, args ...interface{}) {
-	c.log(fmt.Sprintf(format, args...))
+	c.logFailure(fmt.Sprintf(format, args...))
 	c.FailNow()
 }
 
@@ -288,8 +565,35 @@ func (c *H) Skipped() bool {
 	return c.skipped
 }
 
+// NotRun reports whether the test was not started because too many
+// tests had already failed.
+func (c *H) NotRun() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.notRun
+}
+
+// stopIfFailing stops a top-level test before it starts if
+// Options.MaxFailures tests have already failed, or one has under
+// Options.FailFast.
+func (t *H) stopIfFailing() {
+	if t.level != 1 || t.parent.hooks {
+		return
+	}
+	if t.suite.setupFailed {
+		t.log("suite setup failed")
+	} else if !t.suite.tooManyFailures() {
+		return
+	}
+	t.mu.Lock()
+	t.notRun = true
+	t.mu.Unlock()
+	t.finished = true
+	runtime.Goexit()
+}
+
 func (h *H) mkOutputDir() (dir string, err error) {
-	dir = h.suite.outputPath(h.name)
+	dir = h.suite.testOutputPath(h.name)
 	if err = os.MkdirAll(dir, 0777); err != nil {
 		err = fmt.Errorf("Failed to create output dir: %v", err)
 	}
@@ -340,26 +644,141 @@ func (h *H) TempFile(prefix string) *os.File {
 	return tmp
 }
 
+// Phase marks the start of a named phase of the test, such as "provision"
+// or "assert", ending the previous phase. The time spent in each phase is
+// included in the test report. Calling Phase with the name of an earlier
+// phase adds to that phase's duration.
+func (c *H) Phase(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endPhase()
+	c.phase = name
+	c.phaseStart = time.Now()
+}
+
+// endPhase records the duration of the current phase, if any, and returns
+// its name. The caller must hold c.mu.
+func (c *H) endPhase() string {
+	name := c.phase
+	if name == "" {
+		return ""
+	}
+	d := time.Since(c.phaseStart)
+	c.phase = ""
+
+	for i := range c.phases {
+		if c.phases[i].Name == name {
+			c.phases[i].Duration += d
+			return name
+		}
+	}
+	c.phases = append(c.phases, PhaseResult{Name: name, Duration: d})
+	return name
+}
+
 // Parallel signals that this test is to be run in parallel with (and only with)
 // other parallel tests.
 func (t *H) Parallel() {
+	if t.repeatParallel {
+		return
+	}
+	if t.rerun {
+		t.waitRerun()
+		return
+	}
 	if t.isParallel {
 		panic("testing: t.Parallel called multiple times")
 	}
+	if t.exclusive {
+		panic("testing: t.Parallel called after t.Exclusive")
+	}
 	t.isParallel = true
 
 	// We don't want to include the time we spend waiting for serial tests
 	// in the test duration. Record the elapsed time thus far and reset the
 	// timer afterwards.
 	t.duration += time.Since(t.start)
+	t.mu.Lock()
+	phase := t.endPhase()
+	t.mu.Unlock()
+	t.pauseTimeout()
+	t.pauseWatchdog()
+	t.pauseProfiles()
 
 	// Add to the list of tests to be released by the parent.
 	t.parent.sub = append(t.parent.sub, t)
 
+	t.releaseShared()
 	t.signal <- true   // Release calling test.
 	<-t.parent.barrier // Wait for the parent test to complete.
-	t.suite.waitParallel()
+	t.suite.waitParallel(t.slots())
+	t.acquireShared()
+	t.start = time.Now()
+	t.stopIfFailing()
+	t.resumeTimeout()
+	t.resumeWatchdog()
+	t.startProfiles()
+	if phase != "" {
+		t.Phase(phase)
+	}
+}
+
+// Exclusive signals that this test is to be run with no other tests in
+// flight, for tests that change state shared by the whole host. It waits
+// for running tests to finish and holds off other tests until this test
+// and its subtests have completed. A parallel test must call Parallel
+// before Exclusive.
+func (t *H) Exclusive() {
+	if t.exclusive || t.underExclusive() {
+		return
+	}
+
+	// As in Parallel, don't count the time spent waiting.
+	t.duration += time.Since(t.start)
+	t.mu.Lock()
+	phase := t.endPhase()
+	t.mu.Unlock()
+	t.pauseTimeout()
+	t.pauseWatchdog()
+
+	t.releaseShared()
+	t.suite.exclusive.Lock()
+	t.exclusive = true
+
 	t.start = time.Now()
+	t.resumeTimeout()
+	t.resumeWatchdog()
+	if phase != "" {
+		t.Phase(phase)
+	}
+}
+
+// underExclusive reports whether an ancestor of t is an exclusive test,
+// which already keeps all other tests out.
+func (t *H) underExclusive() bool {
+	for p := t.parent; p != nil; p = p.parent {
+		if p.exclusive {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireShared waits until no exclusive test is running and keeps
+// exclusive tests from starting until releaseShared is called.
+func (t *H) acquireShared() {
+	if t.parent == nil || t.underExclusive() {
+		return
+	}
+	t.suite.exclusive.RLock()
+	t.shared = true
+}
+
+func (t *H) releaseShared() {
+	if t.shared {
+		t.shared = false
+		t.suite.exclusive.RUnlock()
+	}
 }
 
 func tRunner(t *H, fn func(t *H)) {
@@ -372,21 +791,26 @@ func tRunner(t *H, fn func(t *H)) {
 	// a signal saying that the test is done.
 	defer func() {
 		t.duration += time.Now().Sub(t.start)
-		// If the test panicked, print any test output before dying.
+		t.mu.Lock()
+		t.endPhase()
+		t.mu.Unlock()
+		// The test function is done, so let exclusive tests in while
+		// waiting for subtests.
+		t.releaseShared()
+		// If the test panicked, fail it with the stack and carry on
+		// cleaning up as for FailNow, so the rest of the suite runs.
 		err := recover()
 		if !t.finished && err == nil {
 			err = fmt.Errorf("test executed panic(nil) or runtime.Goexit")
 		}
 		if err != nil {
-			t.Fail()
-			t.report()
-			panic(err)
+			t.recovered(err, debug.Stack())
 		}
 
 		if len(t.sub) > 0 {
 			// Run parallel subtests.
 			// Decrease the running count for this test.
-			t.suite.release()
+			t.suite.release(t.slots())
 			// Release the parallel subtests.
 			close(t.barrier)
 			// Wait for subtests to complete.
@@ -395,12 +819,27 @@ func tRunner(t *H, fn func(t *H)) {
 			}
 			if !t.isParallel {
 				// Reacquire the count for sequential tests. See comment in Run.
-				t.suite.waitParallel()
+				t.suite.waitParallel(t.slots())
 			}
 		} else if t.isParallel {
 			// Only release the count for this test if it was run as a parallel
 			// test. See comment in Run method.
-			t.suite.release()
+			t.suite.release(t.slots())
+		}
+		if t.exclusive {
+			t.exclusive = false
+			t.suite.exclusive.Unlock()
+		}
+		t.stopProfiles()
+		t.unlock()
+		t.killProcesses()
+		t.removeCgroup()
+		t.endTimeout()
+		t.suite.unwatch(t)
+		if t.retry(fn) {
+			// The next attempt signals the parent instead.
+			t.done = true
+			return
 		}
 		t.report() // Report after all subtests have finished.
 
@@ -413,11 +852,30 @@ func tRunner(t *H, fn func(t *H)) {
 		t.signal <- true
 	}()
 
+	t.acquireShared()
 	t.start = time.Now()
+	if t.parent != nil {
+		t.suite.startTest(t.name)
+	}
+	t.stopIfFailing()
+	if t.level == 1 {
+		t.SetTimeout(t.suite.opts.TestTimeout)
+		t.suite.watch(t)
+		t.startProfiles()
+	}
 	fn(t)
 	t.finished = true
 }
 
+// recovered records that the test function panicked with err.
+func (t *H) recovered(err interface{}, stack []byte) {
+	t.logFailure(fmt.Sprintf("panic: %v\n\n%s", err, stack))
+	t.mu.Lock()
+	t.panicked = true
+	t.mu.Unlock()
+	t.Fail()
+}
+
 // Run runs f as a subtest of t called name. It reports whether f succeeded.
 // Run will block until all its parallel subtests have completed.
 func (t *H) Run(name string, f func(t *H)) bool {
@@ -426,44 +884,140 @@ func (t *H) Run(name string, f func(t *H)) bool {
 	if !ok {
 		return true
 	}
-	t = &H{
-		barrier: make(chan bool),
-		signal:  make(chan bool),
-		name:    testName,
-		suite:   t.suite,
-		parent:  t,
-		level:   t.level + 1,
-	}
-	t.w = indenter{t}
-	// Indent logs 8 spaces to distinguish them from sub-test headers.
-	const indent = "        "
-	t.logger = log.New(&t.output, indent, log.Lshortfile)
+	return t.runChild(testName, f)
+}
 
-	if t.suite.opts.Verbose {
-		// Print directly to root's io.Writer so there is no delay.
-		root := t.parent
-		for ; root.parent != nil; root = root.parent {
-		}
-		fmt.Fprintf(root.w, "=== RUN   %s\n", t.name)
-	}
+// runChild runs f as a subtest of t with the full name testName.
+func (t *H) runChild(testName string, f func(t *H)) bool {
+	t = t.newChild(testName, make(chan bool))
+	t.announce()
 	// Instead of reducing the running count of this test before calling the
 	// tRunner and increasing it afterwards, we rely on tRunner keeping the
 	// count correct. This ensures that a sequence of sequential tests runs
 	// without being preempted, even when their parent is a parallel test. This
 	// may especially reduce surprises if *parallel == 1.
+	// Waiting for a sequential subtest must not keep exclusive tests out,
+	// in case the subtest is one.
+	shared := t.parent.shared
+	t.parent.releaseShared()
 	go tRunner(t, f)
 	<-t.signal
+	if shared {
+		t.parent.acquireShared()
+	}
 	return !t.failed
 }
 
+// newChild creates a test named name under t, which sends on signal
+// when it is done.
+func (t *H) newChild(name string, signal chan bool) *H {
+	c := &H{
+		barrier: make(chan bool),
+		signal:  signal,
+		name:    name,
+		suite:   t.suite,
+		parent:  t,
+		level:   t.level + 1,
+		attempt: 1,
+	}
+	c.w = indenter{c}
+	c.logger = log.New(&c.output, logIndent, log.Lshortfile)
+	return c
+}
+
+// Indent logs 8 spaces to distinguish them from sub-test headers.
+const logIndent = "        "
+
+// announce reports that the test is starting.
+func (t *H) announce() {
+	t.logStart = time.Now()
+	t.suite.testStarted(t.info(), t.logStart)
+	if t.suite.opts.Verbose {
+		// Print directly to root's io.Writer so there is no delay.
+		fmt.Fprintf(t.root().w, "=== RUN   %s\n", t.name)
+	}
+}
+
+// root returns the H at the top of the test tree.
+func (t *H) root() *H {
+	root := t
+	for ; root.parent != nil; root = root.parent {
+	}
+	return root
+}
+
+// result summarizes the test for Suite.Results.
+func (t *H) result() TestResult {
+	r := TestResult{
+		Name:     t.name,
+		Result:   "PASS",
+		Severity: t.Severity(),
+		Start:    t.start,
+		Duration: t.duration,
+		Attempts: t.attempt,
+
+		Quarantined: t.suite.opts.Quarantine.Contains(t.suite.baseName(t.name)),
+		Interrupted: t.suite.wasInterrupted(t.name),
+	}
+	t.mu.RLock()
+	r.Panicked = t.panicked
+	r.Phases = append(r.Phases, t.phases...)
+	r.Output = t.output.String()
+	r.Benchmark = t.bench
+	r.Attachments = append(r.Attachments, t.attachments...)
+	t.mu.RUnlock()
+	r.Params = t.paramList()
+	xfail, reason := t.expectedFailure()
+	if xfail {
+		r.ExpectedFailure = reason
+	}
+	if t.NotRun() {
+		r.Result = "NOT RUN"
+	} else if t.Failed() && xfail {
+		r.Result = "XFAIL"
+	} else if t.Failed() {
+		r.Result = "FAIL"
+	} else if t.Skipped() {
+		r.Result = "SKIP"
+	} else if t.expectsFailure() {
+		r.Result = "XPASS"
+	} else if t.attempt > 1 {
+		r.Result = "FLAKY"
+	} else if t.Warned() {
+		r.Result = "WARN"
+	}
+	return r
+}
+
 func (t *H) report() {
-	if t.parent == nil {
+	if t.parent == nil || t.suite.wasAbandoned(t.name) {
 		return
 	}
+	t.flushLog()
+	result := t.result()
+	t.suite.addResult(result)
+	if t.level == 1 {
+		t.suite.countResult(result)
+	}
+	t.suite.testFinished(t.info(), result)
 	dstr := fmtDuration(t.duration)
+	if len(result.Phases) > 0 {
+		dstr += "; " + fmtPhases(result.Phases)
+	}
 	format := "--- %s: %s (%s)\n"
-	if t.Failed() {
+	if result.Result == "XFAIL" || result.Result == "XPASS" {
+		dstr += "; expected failure: " + result.ExpectedFailure
+	}
+	if t.NotRun() {
+		t.flushToParent(format, "NOT RUN", t.name, dstr)
+	} else if result.Result == "XFAIL" || result.Result == "XPASS" {
+		t.flushToParent(format, result.Result, t.name, dstr)
+	} else if t.Failed() {
 		t.flushToParent(format, "FAIL", t.name, dstr)
+	} else if result.Result == "FLAKY" {
+		t.flushToParent(format, "FLAKY", t.name, dstr)
+	} else if t.Warned() && !t.Skipped() {
+		t.flushToParent(format, "WARN", t.name, dstr)
 	} else if t.suite.opts.Verbose {
 		if t.Skipped() {
 			t.flushToParent(format, "SKIP", t.name, dstr)
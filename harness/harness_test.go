@@ -25,9 +25,12 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/coreos/mantle/system/exec"
 )
 
 func TestMain(m *testing.M) {
@@ -158,6 +161,20 @@ func TestSubTests(t *testing.T) {
 	}, {
 		desc: "skipping without message, not chatty",
 		f:    func(t *H) { t.SkipNow() },
+	}, {
+		desc: "warning, not chatty",
+		output: `
+--- WARN: warning, not chatty (N.NNs)
+    --- WARN: warning, not chatty/#00 (N.NNs)
+            harness_test.go:NNN: deprecated`,
+		f: func(t *H) {
+			t.Run("", func(t *H) {
+				t.Warn("deprecated")
+			})
+			if !t.Warned() {
+				realTest.Error("warning did not propagate to parent")
+			}
+		},
 	}, {
 		desc: "skipping after error",
 		err:  SuiteFailed,
@@ -297,13 +314,13 @@ func TestSubTests(t *testing.T) {
 		}, Tests{tc.desc: tc.f})
 		buf := &bytes.Buffer{}
 		err := suite.runTests(buf, nil)
-		suite.release()
+		suite.release(1)
 
 		if err != tc.err {
 			t.Errorf("%s:err: got %v; want %v", tc.desc, err, tc.err)
 		}
-		if suite.running != 0 || suite.waiting != 0 {
-			t.Errorf("%s:running and waiting non-zero: got %d and %d", tc.desc, suite.running, suite.waiting)
+		if suite.running != 0 || len(suite.waiting) != 0 {
+			t.Errorf("%s:running and waiting non-zero: got %d and %d", tc.desc, suite.running, len(suite.waiting))
 		}
 		got := strings.TrimSpace(buf.String())
 		want := strings.TrimSpace(tc.output)
@@ -487,3 +504,334 @@ func TestTempFile(t *testing.T) {
 		t.Errorf("%q missing %q prefix", second, "second")
 	}
 }
+
+func TestCollapseLogs(t *testing.T) {
+	suite := NewSuite(Options{
+		Verbose:      true,
+		CollapseLogs: true,
+	}, Tests{
+		"CollapseLogs": func(h *H) {
+			for i := 0; i < 5; i++ {
+				h.Log("waiting")
+			}
+			h.Log("done")
+			h.Log("done")
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	got := strings.TrimSpace(buf.String())
+	want := strings.TrimSpace(`
+--- PASS: CollapseLogs (N.NNs)
+        harness_test.go:NNN: waiting
+        last message repeated 4 times
+        harness_test.go:NNN: done
+        last message repeated 1 time`)
+	if ok, err := regexp.MatchString(makeRegexp(want), got); !ok || err != nil {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLogRate(t *testing.T) {
+	suite := NewSuite(Options{
+		Verbose: true,
+		LogRate: 2,
+	}, Tests{
+		"LogRate": func(h *H) {
+			for i := 0; i < 5; i++ {
+				h.Logf("message %d", i)
+			}
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	got := strings.TrimSpace(buf.String())
+	want := strings.TrimSpace(`
+--- PASS: LogRate (N.NNs)
+        harness_test.go:NNN: message 0
+        harness_test.go:NNN: message 1
+        3 messages suppressed by rate limit`)
+	if ok, err := regexp.MatchString(makeRegexp(want), got); !ok || err != nil {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLogRateFatal(t *testing.T) {
+	suite := NewSuite(Options{
+		Verbose:      true,
+		CollapseLogs: true,
+		LogRate:      2,
+	}, Tests{
+		"LogRateFatal": func(h *H) {
+			for i := 0; i < 5; i++ {
+				h.Logf("message %d", i)
+			}
+			h.Log("failed")
+			h.Error("failed")
+			h.Fatalf("giving up after %d messages", 5)
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != SuiteFailed {
+		t.Log("\n" + buf.String())
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+
+	got := strings.TrimSpace(buf.String())
+	want := strings.TrimSpace(`
+--- FAIL: LogRateFatal (N.NNs)
+        harness_test.go:NNN: message 0
+        harness_test.go:NNN: message 1
+        4 messages suppressed by rate limit
+        harness_test.go:NNN: failed
+        harness_test.go:NNN: giving up after 5 messages`)
+	if ok, err := regexp.MatchString(makeRegexp(want), got); !ok || err != nil {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func helperLog(h *H, msg string) {
+	h.Helper()
+	h.Log(msg)
+}
+
+func nestedHelperLog(h *H, msg string) {
+	h.Helper()
+	helperLog(h, msg)
+}
+
+func TestHelper(t *testing.T) {
+	var lines []int
+	here := func() {
+		_, _, line, _ := runtime.Caller(1)
+		lines = append(lines, line)
+	}
+	suite := NewSuite(Options{Verbose: true}, Tests{
+		"Helper": func(h *H) {
+			h.Log("direct")
+			here()
+			helperLog(h, "helper")
+			here()
+			nestedHelperLog(h, "nested")
+			here()
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	got := strings.TrimSpace(buf.String())
+	want := strings.TrimSpace(fmt.Sprintf(`
+=== RUN   Helper
+--- PASS: Helper (N.NNs)
+        harness_test.go:%d: direct
+        harness_test.go:%d: helper
+        harness_test.go:%d: nested`, lines[0]-1, lines[1]-1, lines[2]-1))
+	if ok, err := regexp.MatchString("^"+makeRegexp(want)+"$", got); !ok || err != nil {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOutputDirCollision(t *testing.T) {
+	var suitedir string
+	if dir, err := ioutil.TempDir("", ""); err != nil {
+		t.Fatal(err)
+	} else {
+		defer os.RemoveAll(dir)
+		suitedir = filepath.Join(dir, "_test_temp")
+	}
+
+	var testdirs []string
+	adddir := func(h *H) {
+		testdirs = append(testdirs, h.OutputDir())
+	}
+
+	opts := Options{
+		OutputDir: suitedir,
+		Verbose:   true,
+	}
+	suite := NewSuite(opts, Tests{
+		"Collide": func(h *H) {
+			h.Run("a:b", adddir)
+			h.Run("a?b", adddir)
+			h.Run("..", adddir)
+			adddir(h)
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	expect := []string{
+		filepath.Join(suitedir, "Collide", "a_b"),
+		filepath.Join(suitedir, "Collide", "a_b#01"),
+		filepath.Join(suitedir, "Collide", "___"),
+		filepath.Join(suitedir, "Collide"),
+	}
+	if !reflect.DeepEqual(testdirs, expect) {
+		t.Errorf("%v != %v", testdirs, expect)
+	}
+}
+
+func TestCgroup(t *testing.T) {
+	var suitedir, cgroupdir string
+	if dir, err := ioutil.TempDir("", ""); err != nil {
+		t.Fatal(err)
+	} else {
+		defer os.RemoveAll(dir)
+		suitedir = filepath.Join(dir, "_test_temp")
+		cgroupdir = filepath.Join(dir, "cgroup")
+	}
+	if err := os.Mkdir(cgroupdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var cgroups, limits []string
+	addcgroup := func(h *H) {
+		cg := h.Cgroup()
+		cgroups = append(cgroups, cg)
+		limit, err := ioutil.ReadFile(filepath.Join(cg, "cpu.max"))
+		if err != nil {
+			h.Fatal(err)
+		}
+		limits = append(limits, string(limit))
+	}
+
+	opts := Options{
+		OutputDir: suitedir,
+		Verbose:   true,
+		Cgroup:    cgroupdir,
+		CPUQuota:  1.5,
+	}
+	suite := NewSuite(opts, Tests{
+		"Limited": func(h *H) {
+			h.Run("sub", addcgroup)
+			addcgroup(h)
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	expect := []string{
+		filepath.Join(cgroupdir, "Limited.sub"),
+		filepath.Join(cgroupdir, "Limited"),
+	}
+	if !reflect.DeepEqual(cgroups, expect) {
+		t.Errorf("%v != %v", cgroups, expect)
+	}
+	for _, limit := range limits {
+		if limit != "150000 100000" {
+			t.Errorf("unexpected cpu.max %q", limit)
+		}
+	}
+}
+
+func TestProcessGroup(t *testing.T) {
+	var cmd *exec.ExecCmd
+	suite := NewSuite(Options{}, Tests{
+		"Leaky": func(h *H) {
+			cmd = exec.Command("sleep", "3600")
+			cmd.Group = h.ProcessGroup()
+			if err := cmd.Start(); err != nil {
+				h.Fatal(err)
+			}
+		},
+	})
+	suite.runTests(ioutil.Discard, nil)
+
+	done := make(chan error)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("helper process still running after the test finished")
+	}
+	if r := suite.Results()[0]; !strings.Contains(r.Output, "Killed 1 stray process groups") {
+		t.Errorf("killing not logged:\n%s", r.Output)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	ran := make(map[string]bool)
+	var mu sync.Mutex
+	mark := func(name string) {
+		mu.Lock()
+		ran[name] = true
+		mu.Unlock()
+	}
+	suite := NewSuite(Options{Parallel: 2}, Tests{
+		"A": func(h *H) {
+			mark("A")
+			var m map[string]int
+			m["boom"]++
+		},
+		"B": func(h *H) {
+			mark("B")
+			h.Run("panics", func(h *H) {
+				h.Parallel()
+				panic("subtest exploded")
+			})
+			h.Run("passes", func(h *H) {
+				h.Parallel()
+				mark("B/passes")
+			})
+		},
+		"C": func(h *H) {
+			mark("C")
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Fatalf("got %v, want SuiteFailed", err)
+	}
+	for _, name := range []string{"A", "B", "B/passes", "C"} {
+		if !ran[name] {
+			t.Errorf("%s did not run", name)
+		}
+	}
+
+	results := make(map[string]TestResult)
+	for _, r := range suite.Results() {
+		results[r.Name] = r
+	}
+	for _, tc := range []struct {
+		name, result string
+		panicked     bool
+		output       string
+	}{
+		{"A", "FAIL", true, "panic: assignment to entry in nil map"},
+		{"B", "FAIL", false, ""},
+		{"B/panics", "FAIL", true, "panic: subtest exploded"},
+		{"B/passes", "PASS", false, ""},
+		{"C", "PASS", false, ""},
+	} {
+		r := results[tc.name]
+		if r.Result != tc.result || r.Panicked != tc.panicked {
+			t.Errorf("%s: got %s, panicked %v; want %s, panicked %v", tc.name, r.Result, r.Panicked, tc.result, tc.panicked)
+		}
+		if tc.output != "" && (!strings.Contains(r.Output, tc.output) || !strings.Contains(r.Output, "harness_test.go")) {
+			t.Errorf("%s: output %q lacks %q and the stack", tc.name, r.Output, tc.output)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// On SIGINT or SIGTERM the suite stops starting tests, reporting them as
+// not run, and cancels the contexts of the running tests so they can
+// clean up, for instance by destroying their machines. Tests which
+// finish within Options.GracePeriod are reported as usual, marked as
+// interrupted; the rest are reported as failed once it is over, and the
+// suite finishes its report without them.
+
+// handleSignals interrupts the suite on SIGINT or SIGTERM until the
+// returned function is called.
+func (s *Suite) handleSignals(out io.Writer) func() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				s.interrupt(out, sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// interrupt stops the suite after sig. A second signal gives up on the
+// running tests without waiting for the rest of the grace period.
+func (s *Suite) interrupt(out io.Writer, sig os.Signal) {
+	s.resultsMu.Lock()
+	first := s.interrupted == ""
+	if first {
+		s.interrupted = sig.String()
+		s.interruptedTests = make(map[string]bool, len(s.active))
+		for name := range s.active {
+			s.interruptedTests[name] = true
+		}
+		if s.cancel != nil {
+			s.cancel()
+		}
+	}
+	s.resultsMu.Unlock()
+
+	if !first {
+		fmt.Fprintf(out, "harness: caught %v again, not waiting for running tests\n", sig)
+		s.stopWaiting()
+		return
+	}
+	fmt.Fprintf(out, "harness: caught %v, waiting up to %s for running tests to clean up\n",
+		sig, fmtDuration(s.opts.GracePeriod))
+	time.AfterFunc(s.opts.GracePeriod, s.stopWaiting)
+}
+
+// stopWaiting gives up on the tests still running after an interrupt.
+func (s *Suite) stopWaiting() {
+	s.abandonOnce.Do(func() { close(s.abandon) })
+}
+
+// isInterrupted reports whether the suite has been interrupted.
+func (s *Suite) isInterrupted() bool {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	return s.interrupted != ""
+}
+
+// wasInterrupted reports whether the named test was running when the
+// suite was interrupted.
+func (s *Suite) wasInterrupted(name string) bool {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	return s.interruptedTests[name]
+}
+
+// wasAbandoned reports whether the named test was given up on after
+// the grace period, and has already been reported.
+func (s *Suite) wasAbandoned(name string) bool {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	return s.abandoned[name]
+}
+
+// runInterruptible runs the tests, returning early with
+// SuiteInterrupted if they are still running once the suite stops
+// waiting for them after an interrupt.
+func (s *Suite) runInterruptible(out, tap io.Writer) error {
+	done := make(chan error, 1)
+	go func() { done <- s.runTests(out, tap) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-s.abandon:
+		s.abandonTests(out)
+		return SuiteInterrupted
+	}
+	if err != SuiteEmpty && s.isInterrupted() {
+		return SuiteInterrupted
+	}
+	return err
+}
+
+// byDepth sorts results so subtests come before their parents.
+type byDepth []TestResult
+
+func (r byDepth) Len() int      { return len(r) }
+func (r byDepth) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byDepth) Less(i, j int) bool {
+	di, dj := strings.Count(r[i].Name, "/"), strings.Count(r[j].Name, "/")
+	if di != dj {
+		return di > dj
+	}
+	return r[i].Name < r[j].Name
+}
+
+// abandonTests reports the tests still running as failed and
+// interrupted. Their own results are dropped if they finish later.
+func (s *Suite) abandonTests(out io.Writer) {
+	now := time.Now()
+	s.resultsMu.Lock()
+	if s.abandoned == nil {
+		s.abandoned = make(map[string]bool)
+	}
+	var running []TestResult
+	for name, start := range s.active {
+		s.abandoned[name] = true
+		running = append(running, TestResult{
+			Name:        name,
+			Result:      "FAIL",
+			Severity:    Major,
+			Attempts:    1,
+			Start:       start,
+			Duration:    now.Sub(start),
+			Output:      "test still running after the grace period\n",
+			Interrupted: true,
+		})
+	}
+	s.resultsMu.Unlock()
+	if len(running) == 0 {
+		return
+	}
+	sort.Sort(byDepth(running))
+
+	fmt.Fprintf(out, "harness: gave up on %d tests still running after %s\n",
+		len(running), fmtDuration(s.opts.GracePeriod))
+	for _, r := range running {
+		info := TestInfo{Name: r.Name, Level: strings.Count(r.Name, "/") + 1}
+		if i := strings.LastIndex(r.Name, "/"); i >= 0 {
+			info.Parent = r.Name[:i]
+		}
+		s.addResult(r)
+		if info.Level == 1 {
+			s.countResult(r)
+		}
+		s.testFinished(info, r)
+		fmt.Fprintf(out, "--- FAIL: %s (%s; interrupted)\n    %s", r.Name, fmtDuration(r.Duration), r.Output)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterrupt(t *testing.T) {
+	var suite *Suite
+	var out bytes.Buffer
+	suite = NewSuite(Options{}, Tests{
+		"A": func(h *H) {
+			h.Run("Sub", func(h *H) {
+				suite.interrupt(&out, syscall.SIGTERM)
+				<-h.Context().Done()
+			})
+		},
+		"B": func(h *H) {},
+	})
+	if err := suite.runInterruptible(ioutil.Discard, nil); err != SuiteInterrupted {
+		t.Fatalf("got %v, want SuiteInterrupted", err)
+	}
+	if out.String() != "harness: caught terminated, waiting up to 60.00s for running tests to clean up\n" {
+		t.Errorf("got output %q", out.String())
+	}
+
+	results := make(map[string]TestResult)
+	for _, r := range suite.Results() {
+		results[r.Name] = r
+	}
+	for name, want := range map[string]string{"A": "PASS", "A/Sub": "PASS", "B": "NOT RUN"} {
+		r := results[name]
+		if r.Result != want {
+			t.Errorf("%s: got %q, want %q", name, r.Result, want)
+		}
+		if r.Interrupted != (name != "B") {
+			t.Errorf("%s: got Interrupted %v", name, r.Interrupted)
+		}
+	}
+
+	out.Reset()
+	suite.reportNotRun(&out)
+	if got, want := out.String(), "harness: interrupted by terminated, 1 tests not run\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInterruptGracePeriod(t *testing.T) {
+	var suite *Suite
+	release := make(chan bool)
+	finished := make(chan bool)
+	suite = NewSuite(Options{GracePeriod: 10 * time.Millisecond}, Tests{
+		"Stuck": func(h *H) {
+			defer close(finished)
+			suite.interrupt(ioutil.Discard, syscall.SIGINT)
+			<-release
+		},
+	})
+	var out bytes.Buffer
+	if err := suite.runInterruptible(&out, nil); err != SuiteInterrupted {
+		t.Fatalf("got %v, want SuiteInterrupted", err)
+	}
+	if !strings.Contains(out.String(), "harness: gave up on 1 tests still running after 0.01s\n--- FAIL: Stuck (") {
+		t.Errorf("got output %q", out.String())
+	}
+	results := suite.Results()
+	if len(results) != 1 || results[0].Result != "FAIL" || !results[0].Interrupted {
+		t.Fatalf("got results %+v, want Stuck failed and interrupted", results)
+	}
+
+	// The test's own result is dropped once it finishes.
+	close(release)
+	<-finished
+	time.Sleep(10 * time.Millisecond)
+	if n := len(suite.Results()); n != 1 {
+		t.Errorf("got %d results after the test finished, want 1", n)
+	}
+}
+
+func TestInterruptTwice(t *testing.T) {
+	var suite *Suite
+	release := make(chan bool)
+	suite = NewSuite(Options{GracePeriod: time.Hour}, Tests{
+		"Stuck": func(h *H) {
+			suite.interrupt(ioutil.Discard, syscall.SIGINT)
+			suite.interrupt(ioutil.Discard, syscall.SIGINT)
+			<-release
+		},
+	})
+	defer close(release)
+	if err := suite.runInterruptible(ioutil.Discard, nil); err != SuiteInterrupted {
+		t.Fatalf("got %v, want SuiteInterrupted", err)
+	}
+	if results := suite.Results(); len(results) != 1 || results[0].Result != "FAIL" {
+		t.Errorf("got results %+v, want Stuck failed", results)
+	}
+}
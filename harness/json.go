@@ -0,0 +1,146 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// testEvent is a single event in the format of `go test -json`, as
+// described by `go doc cmd/test2json`.
+type testEvent struct {
+	Time    *time.Time `json:",omitempty"`
+	Action  string
+	Package string   `json:",omitempty"`
+	Test    string   `json:",omitempty"`
+	Elapsed *float64 `json:",omitempty"`
+	Output  string   `json:",omitempty"`
+
+	// Level and Fields extend the format for messages logged by
+	// H.Debugw and friends.
+	Level  string                 `json:",omitempty"`
+	Fields map[string]interface{} `json:",omitempty"`
+}
+
+// eventWriter is a Reporter writing test events as JSON lines. Its
+// output and logged methods do nothing on a nil eventWriter, so callers
+// needn't check if events are on.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	pkg string
+}
+
+func newEventWriter(w io.Writer, pkg string) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w), pkg: pkg}
+}
+
+func (e *eventWriter) emit(action, test string, elapsed *time.Duration, output string) {
+	ev := testEvent{
+		Action: action,
+		Test:   test,
+		Output: output,
+	}
+	if elapsed != nil {
+		secs := elapsed.Seconds()
+		ev.Elapsed = &secs
+	}
+	e.emitEvent(ev)
+}
+
+func (e *eventWriter) emitEvent(ev testEvent) {
+	now := time.Now()
+	ev.Time = &now
+	ev.Package = e.pkg
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(&ev)
+}
+
+// TestStarted reports that a test started.
+func (e *eventWriter) TestStarted(t TestInfo, start time.Time) {
+	e.emit("run", t.Name, nil, "")
+	e.emit("output", t.Name, nil, "=== RUN   "+t.Name+"\n")
+}
+
+// output reports lines logged by a test, one event per line.
+func (e *eventWriter) output(test string, b []byte) {
+	e.logged(test, b, nil)
+}
+
+// logged reports the lines of a message logged by a test, one event
+// per line, each with the level and fields of le if it isn't nil.
+func (e *eventWriter) logged(test string, b []byte, le *logEntry) {
+	if e == nil {
+		return
+	}
+	ev := testEvent{Action: "output", Test: test}
+	if le != nil {
+		ev.Level = le.level.String()
+		ev.Fields = le.fields()
+	}
+	for len(b) > 0 {
+		end := bytes.IndexByte(b, '\n') + 1
+		if end == 0 {
+			end = len(b)
+		}
+		ev.Output = string(b[:end])
+		e.emitEvent(ev)
+		b = b[end:]
+	}
+}
+
+// TestFinished reports how a test ended. Tests kept from running by
+// MaxFailures are reported as skipped.
+func (e *eventWriter) TestFinished(t TestInfo, r TestResult) {
+	status := r.Result
+	if status == "NOT RUN" {
+		status = "SKIP"
+	}
+	dstr := fmtDuration(r.Duration)
+	if len(r.Phases) > 0 {
+		dstr += "; " + fmtPhases(r.Phases)
+	}
+	header := strings.Repeat("    ", t.Level-1) + fmt.Sprintf("--- %s: %s (%s)\n", status, t.Name, dstr)
+
+	var action string
+	switch r.Result {
+	case "FAIL":
+		action = "fail"
+	case "SKIP", "XFAIL", "NOT RUN":
+		action = "skip"
+	default:
+		action = "pass"
+	}
+	e.emit("output", t.Name, nil, header)
+	e.emit(action, t.Name, &r.Duration, "")
+}
+
+// SuiteFinished reports the outcome of the whole suite.
+func (e *eventWriter) SuiteFinished(err error, elapsed time.Duration) error {
+	action, output := "pass", "PASS\n"
+	if err != nil {
+		action, output = "fail", "FAIL\n"
+	}
+	e.emit("output", "", nil, output)
+	e.emit(action, "", &elapsed, "")
+	return nil
+}
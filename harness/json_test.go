@@ -0,0 +1,83 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONEvents(t *testing.T) {
+	var buf bytes.Buffer
+	suite := NewSuite(Options{}, Tests{
+		"Parent": func(h *H) {
+			h.Log("hello")
+			h.Run("Sub", func(h *H) { h.Skip("not today") })
+			h.Error("boom")
+		},
+	})
+	suite.events = newEventWriter(&buf, "pkg")
+	err := suite.runTests(ioutil.Discard, nil)
+	suite.events.SuiteFinished(err, 0)
+
+	var got []string
+	dec := json.NewDecoder(&buf)
+	for {
+		var ev testEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Package != "pkg" || ev.Time == nil {
+			t.Errorf("bad event: %+v", ev)
+		}
+		if (ev.Elapsed != nil) != (ev.Action != "output" && ev.Action != "run") {
+			t.Errorf("bad elapsed time in %+v", ev)
+		}
+		output := strings.TrimSpace(ev.Output)
+		if i := strings.Index(output, ": "); i >= 0 && strings.Contains(output[:i], ".go:") {
+			output = output[i+2:]
+		}
+		if i := strings.Index(output, " ("); i >= 0 {
+			output = output[:i] // durations
+		}
+		got = append(got, strings.Join(strings.Fields(ev.Action+" "+ev.Test+" "+output), " "))
+	}
+
+	want := []string{
+		"run Parent",
+		"output Parent === RUN Parent",
+		"output Parent hello",
+		"run Parent/Sub",
+		"output Parent/Sub === RUN Parent/Sub",
+		"output Parent/Sub not today",
+		"output Parent/Sub --- SKIP: Parent/Sub",
+		"skip Parent/Sub",
+		"output Parent boom",
+		"output Parent --- FAIL: Parent",
+		"fail Parent",
+		"output FAIL",
+		"fail",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// junitSuites is the root of a JUnit XML report, in the dialect
+// understood by Jenkins, GitLab and most other CI systems.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitMessage   `xml:"failure,omitempty"`
+	Skipped    *junitMessage   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// junitSeconds formats a duration the way JUnit expects.
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// junitSummary picks the first line of a test's log, which is normally
+// the failure or skip reason, without the source location prefix.
+func junitSummary(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if i := strings.Index(line, ": "); i >= 0 && strings.Contains(line[:i], ".go:") {
+			line = line[i+2:]
+		}
+		return line
+	}
+	return ""
+}
+
+// junitMetrics lists the figures of a benchmark as properties, such as
+// "benchmark.ns/op", sorted by name.
+func junitMetrics(r *BenchmarkResult) []junitProperty {
+	metrics := r.Metrics()
+	units := make([]string, 0, len(metrics))
+	for unit := range metrics {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+
+	props := []junitProperty{{"benchmark.N", strconv.Itoa(r.N)}}
+	for _, unit := range units {
+		props = append(props, junitProperty{"benchmark." + unit, strconv.FormatFloat(metrics[unit], 'g', -1, 64)})
+	}
+	return props
+}
+
+// junitReporter is a Reporter writing a JUnit XML report of the suite's
+// results to Options.JUnitFile once it finishes.
+type junitReporter struct {
+	suite *Suite
+	start time.Time
+}
+
+func (jr *junitReporter) TestStarted(t TestInfo, start time.Time) {}
+
+func (jr *junitReporter) TestFinished(t TestInfo, r TestResult) {}
+
+func (jr *junitReporter) SuiteFinished(err error, elapsed time.Duration) error {
+	s := jr.suite
+	name := filepath.Base(os.Args[0])
+	return writeJUnit(s.opts.JUnitFile, name, jr.start, s.config, s.Results())
+}
+
+// writeJUnit writes the results as a JUnit XML report to path, with the
+// config as properties. Each test and subtest is a test case, classed
+// by its top-level test. Benchmark figures are properties of their
+// test case, and attachments are listed in its output.
+func writeJUnit(path, name string, start time.Time, config Config, results []TestResult) error {
+	suite := junitSuite{
+		Name:      name,
+		Timestamp: start.UTC().Format("2006-01-02T15:04:05"),
+		Time:      junitSeconds(time.Since(start)),
+	}
+	for _, p := range config.Flatten() {
+		suite.Properties = append(suite.Properties, junitProperty{p.Name, p.Value})
+	}
+	for _, r := range results {
+		c := junitCase{
+			Name:      r.Name,
+			ClassName: strings.SplitN(r.Name, "/", 2)[0],
+			Time:      junitSeconds(r.Duration),
+		}
+		for _, p := range r.Params {
+			c.Properties = append(c.Properties, junitProperty{"param." + p.Name, p.Value})
+		}
+		if r.Benchmark != nil {
+			c.Properties = append(c.Properties, junitMetrics(r.Benchmark)...)
+		}
+		switch r.Result {
+		case "FAIL":
+			suite.Failures++
+			c.Failure = &junitMessage{
+				Message: junitSummary(r.Output),
+				Body:    r.Output,
+			}
+		case "SKIP":
+			suite.Skipped++
+			c.Skipped = &junitMessage{Message: junitSummary(r.Output)}
+		case "XFAIL":
+			suite.Skipped++
+			c.Skipped = &junitMessage{Message: "expected failure: " + r.ExpectedFailure}
+			c.SystemOut = r.Output
+		case "NOT RUN":
+			suite.Skipped++
+			reason := junitSummary(r.Output)
+			if reason == "" {
+				reason = "too many failures"
+			}
+			c.Skipped = &junitMessage{Message: "not run: " + reason}
+		default:
+			c.SystemOut = r.Output
+		}
+		if len(r.Attachments) > 0 {
+			if c.SystemOut != "" && !strings.HasSuffix(c.SystemOut, "\n") {
+				c.SystemOut += "\n"
+			}
+			c.SystemOut += junitAttachments(r.Attachments) + "\n"
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Tests = len(suite.Cases)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return fmt.Errorf("harness: writing JUnit report: %v", err)
+	}
+	if _, err := f.WriteString("\n"); err != nil {
+		return err
+	}
+	return f.Close()
+}
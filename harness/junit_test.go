@@ -0,0 +1,88 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJUnit(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "junit.xml")
+	results := []TestResult{
+		{Name: "Pass", Result: "PASS", Duration: 1500 * time.Millisecond},
+		{Name: "Fail", Result: "FAIL", Output: "    foo_test.go:12: boom <&>\n    foo_test.go:13: more\n"},
+		{Name: "Fail/Sub", Result: "SKIP", Output: "    foo_test.go:20: not today\n"},
+		{Name: "Later", Result: "NOT RUN"},
+	}
+	config := newConfig(Options{Version: "1.2.3", Parallel: 4}, time.Now())
+	if err := writeJUnit(path, "suite", time.Now(), config, results); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report junitSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, data)
+	}
+	if len(report.Suites) != 1 {
+		t.Fatalf("got %d suites; want 1", len(report.Suites))
+	}
+
+	suite := report.Suites[0]
+	if suite.Tests != 4 || suite.Failures != 1 || suite.Skipped != 2 {
+		t.Errorf("got %d tests, %d failures, %d skipped; want 4, 1, 2",
+			suite.Tests, suite.Failures, suite.Skipped)
+	}
+
+	props := make(map[string]string)
+	for _, p := range suite.Properties {
+		props[p.Name] = p.Value
+	}
+	if props["version"] != "1.2.3" || props["option.parallel"] != "4" {
+		t.Errorf("bad properties: %v", props)
+	}
+
+	cases := suite.Cases
+	if cases[0].Time != "1.500" || cases[0].Failure != nil || cases[0].Skipped != nil {
+		t.Errorf("bad passing case: %+v", cases[0])
+	}
+	if f := cases[1].Failure; f == nil || f.Message != "boom <&>" || !strings.Contains(f.Body, "more") {
+		t.Errorf("bad failure: %+v", f)
+	}
+	if cases[2].ClassName != "Fail" {
+		t.Errorf("got subtest class %q; want %q", cases[2].ClassName, "Fail")
+	}
+	if s := cases[2].Skipped; s == nil || s.Message != "not today" {
+		t.Errorf("bad skip: %+v", s)
+	}
+	if cases[3].Skipped == nil {
+		t.Errorf("test not run was not skipped")
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Level ranks how interesting a log message is. Messages logged with
+// H.Debug, H.Info, their variants, and H.Warnw are dropped if they are
+// below Options.LogLevel; other messages, such as those from H.Log and
+// H.Error, are always kept.
+type Level int
+
+const (
+	LevelDebug Level = iota + 1
+	LevelInfo
+	LevelWarn
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+}
+
+// ParseLevel parses the name of a level, such as "debug".
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q; use debug, info, or warn", s)
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Set implements flag.Value.
+func (l *Level) Set(value string) error {
+	level, err := ParseLevel(value)
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// Type implements pflag.Value.
+func (l *Level) Type() string {
+	return "level"
+}
+
+// MarshalText records levels by name in reports.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	return l.Set(string(text))
+}
+
+// logEntry is a leveled message with key/value fields.
+type logEntry struct {
+	level  Level
+	msg    string
+	keys   []string
+	values []interface{}
+}
+
+// newLogEntry pairs up alternating keys and values. A key without a
+// value is given "(MISSING)".
+func newLogEntry(level Level, msg string, kv []interface{}) *logEntry {
+	e := &logEntry{level: level, msg: strings.TrimSuffix(msg, "\n")}
+	for i := 0; i < len(kv); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		e.keys = append(e.keys, key)
+		e.values = append(e.values, value)
+	}
+	return e
+}
+
+// String formats the entry for the human readable log, as in
+// "WARN: disk is slow device=vda latency=3s".
+func (e *logEntry) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(strings.ToUpper(e.level.String()))
+	buf.WriteString(": ")
+	buf.WriteString(e.msg)
+	for i, key := range e.keys {
+		fmt.Fprintf(&buf, " %s=%s", key, quoteValue(fmt.Sprint(e.values[i])))
+	}
+	return buf.String()
+}
+
+// quoteValue quotes a field value if it would otherwise be ambiguous.
+func quoteValue(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// fields returns the entry's fields for JSON events. Values which
+// don't encode as JSON by themselves are recorded as text.
+func (e *logEntry) fields() map[string]interface{} {
+	if len(e.keys) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(e.keys))
+	for i, key := range e.keys {
+		switch v := e.values[i].(type) {
+		case nil, bool, string, json.Marshaler,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64,
+			float32, float64:
+			m[key] = v
+		case error:
+			m[key] = v.Error()
+		default:
+			m[key] = fmt.Sprint(v)
+		}
+	}
+	return m
+}
+
+// Debug logs its arguments, formatted as by Log, at LevelDebug.
+func (c *H) Debug(args ...interface{}) {
+	c.logAt(newLogEntry(LevelDebug, fmt.Sprintln(args...), nil))
+}
+
+// Debugf logs its arguments, formatted as by Logf, at LevelDebug.
+func (c *H) Debugf(format string, args ...interface{}) {
+	c.logAt(newLogEntry(LevelDebug, fmt.Sprintf(format, args...), nil))
+}
+
+// Debugw logs a message at LevelDebug with fields given as alternating
+// keys and values, such as "machine", m.ID(), "attempt", 2.
+func (c *H) Debugw(msg string, keysAndValues ...interface{}) {
+	c.logAt(newLogEntry(LevelDebug, msg, keysAndValues))
+}
+
+// Info logs its arguments, formatted as by Log, at LevelInfo.
+func (c *H) Info(args ...interface{}) {
+	c.logAt(newLogEntry(LevelInfo, fmt.Sprintln(args...), nil))
+}
+
+// Infof logs its arguments, formatted as by Logf, at LevelInfo.
+func (c *H) Infof(format string, args ...interface{}) {
+	c.logAt(newLogEntry(LevelInfo, fmt.Sprintf(format, args...), nil))
+}
+
+// Infow logs a message at LevelInfo with fields, as for Debugw.
+func (c *H) Infow(msg string, keysAndValues ...interface{}) {
+	c.logAt(newLogEntry(LevelInfo, msg, keysAndValues))
+}
+
+// Warnw logs a message at LevelWarn with fields, as for Debugw, and
+// marks the test as having passed with warnings, as for Warn.
+func (c *H) Warnw(msg string, keysAndValues ...interface{}) {
+	c.logAt(newLogEntry(LevelWarn, msg, keysAndValues))
+	c.warn()
+}
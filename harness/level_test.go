@@ -0,0 +1,138 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogEntryString(t *testing.T) {
+	for _, tc := range []struct {
+		level Level
+		msg   string
+		kv    []interface{}
+		want  string
+	}{
+		{LevelInfo, "booted\n", nil, "INFO: booted"},
+		{LevelWarn, "slow disk", []interface{}{"device", "vda", "latency", 3 * time.Second},
+			"WARN: slow disk device=vda latency=3s"},
+		{LevelDebug, "ran", []interface{}{"cmd", "ls -l", "out", "", "eq", "a=b"},
+			`DEBUG: ran cmd="ls -l" out="" eq="a=b"`},
+		{LevelInfo, "odd", []interface{}{"n", 1, 2}, "INFO: odd n=1 2=(MISSING)"},
+	} {
+		if got := newLogEntry(tc.level, tc.msg, tc.kv).String(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	for _, tc := range []struct {
+		level Level
+		want  []string
+	}{
+		{0, []string{"INFO: info", "WARN: warn", "plain"}},
+		{LevelDebug, []string{"DEBUG: debug", "INFO: info", "WARN: warn", "plain"}},
+		{LevelWarn, []string{"WARN: warn", "plain"}},
+	} {
+		var out bytes.Buffer
+		suite := NewSuite(Options{Verbose: true, LogLevel: tc.level}, Tests{
+			"Test": func(h *H) {
+				h.Debug("debug")
+				h.Infof("%s", "info")
+				h.Warnw("warn")
+				h.Log("plain")
+			},
+		})
+		if err := suite.runTests(&out, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, line := range strings.Split(out.String(), "\n") {
+			if i := strings.Index(line, ".go:"); i >= 0 {
+				got = append(got, line[strings.Index(line[i:], ": ")+i+2:])
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("level %v: got %q, want %q", tc.level, got, tc.want)
+		}
+		if r := suite.Results()[0]; r.Result != "WARN" {
+			t.Errorf("level %v: Warnw didn't mark the test as warned", tc.level)
+		}
+	}
+}
+
+func TestLogLevelEvents(t *testing.T) {
+	var buf bytes.Buffer
+	suite := NewSuite(Options{}, Tests{
+		"Test": func(h *H) {
+			h.Infow("booted", "machine", "m1", "attempt", 2, "err", errors.New("oops"))
+			h.Log("plain")
+		},
+	})
+	suite.events = newEventWriter(&buf, "pkg")
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries, plain int
+	dec := json.NewDecoder(&buf)
+	for {
+		var ev testEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.Contains(ev.Output, "INFO: booted"):
+			entries++
+			want := map[string]interface{}{"machine": "m1", "attempt": 2.0, "err": "oops"}
+			if ev.Level != "info" || !reflect.DeepEqual(ev.Fields, want) {
+				t.Errorf("bad entry event: %+v", ev)
+			}
+		case strings.Contains(ev.Output, "plain"):
+			plain++
+			if ev.Level != "" || ev.Fields != nil {
+				t.Errorf("plain message has level or fields: %+v", ev)
+			}
+		}
+	}
+	if entries != 1 || plain != 1 {
+		t.Errorf("got %d entry and %d plain events, want 1 each", entries, plain)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	var l Level
+	if err := l.Set("DEBUG"); err != nil || l != LevelDebug {
+		t.Errorf("Set(DEBUG) = %v, %v", l, err)
+	}
+	if err := l.Set("loud"); err == nil {
+		t.Errorf("Set(loud) succeeded")
+	}
+	if err := (&Options{LogLevel: 7}).Validate(); err == nil {
+		t.Errorf("Validate accepted log level 7")
+	}
+}
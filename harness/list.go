@@ -0,0 +1,39 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// list writes the name and tags of each top-level test which would run
+// and matches Options.List, in the order they would start. Tests are
+// filtered by Options.Match, TagMatch, and Shard as for a real run, but
+// nothing is run and the output directory isn't touched.
+func (s *Suite) list(w io.Writer) error {
+	re := regexp.MustCompile(s.opts.List) // checked by Validate
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, name := range s.testOrder() {
+		if !re.MatchString(name) || !s.match.matchTop(name) {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, strings.Join(s.opts.TestTags[name], ","))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harness-list-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ran := false
+	opts := Options{
+		OutputDir: filepath.Join(dir, "out"),
+		Match:     "Test",
+		List:      "A|C",
+		TestTags: map[string][]string{
+			"TestA": {"slow", "network"},
+			"TestC": {"slow"},
+		},
+		TagMatch: "slow",
+	}
+	suite := NewSuite(opts, Tests{
+		"TestA":  func(h *H) { ran = true },
+		"TestB":  func(h *H) { ran = true },
+		"TestC":  func(h *H) { ran = true },
+		"OtherA": func(h *H) { ran = true },
+	})
+	var out bytes.Buffer
+	if err := suite.list(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := "TestA  slow,network\nTestC  slow\n"
+	if out.String() != want {
+		t.Errorf("got list:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if ran {
+		t.Errorf("listing ran a test")
+	}
+	if _, err := os.Stat(opts.OutputDir); !os.IsNotExist(err) {
+		t.Errorf("listing created the output directory: %v", err)
+	}
+}
+
+func TestListInvalid(t *testing.T) {
+	opts := Options{List: "("}
+	if err := opts.Validate(); err == nil {
+		t.Errorf("Validate accepted invalid list regexp")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// resource returns the lock for the named resource.
+func (c *Suite) resource(name string) *sync.Mutex {
+	c.resourcesMu.Lock()
+	defer c.resourcesMu.Unlock()
+	if c.resources == nil {
+		c.resources = make(map[string]*sync.Mutex)
+	}
+	l, ok := c.resources[name]
+	if !ok {
+		l = &sync.Mutex{}
+		c.resources[name] = l
+	}
+	return l
+}
+
+// Lock gives the test exclusive use of the named resources, such as an
+// image, a port, or a quota, until it and its subtests have completed.
+// Unlike Exclusive, it holds off only tests locking the same
+// resources, so other parallel tests keep running. Subtests share the
+// resources their ancestors hold, and Lock does nothing under an
+// exclusive test. Resources locked by different calls may deadlock
+// against tests locking them in another order, so a test should lock
+// everything it needs at once.
+func (t *H) Lock(resources ...string) {
+	if t.exclusive || t.underExclusive() {
+		return
+	}
+	var need []string
+	for _, r := range resources {
+		if !t.holds(r) && !contains(need, r) {
+			need = append(need, r)
+		}
+	}
+	if len(need) == 0 {
+		return
+	}
+	// a consistent order keeps tests locking several resources from
+	// deadlocking against each other
+	sort.Strings(need)
+
+	t.waitAside(func() {
+		for _, r := range need {
+			t.suite.resource(r).Lock()
+		}
+	})
+	t.locked = append(t.locked, need...)
+}
+
+// waitAside calls wait, which blocks until the test may go on, letting
+// exclusive tests and other parallel tests run in the meantime. As in
+// Parallel, the time spent waiting doesn't count.
+func (t *H) waitAside(wait func()) {
+	t.duration += time.Since(t.start)
+	t.mu.Lock()
+	phase := t.endPhase()
+	t.mu.Unlock()
+	t.pauseTimeout()
+	t.pauseWatchdog()
+
+	t.releaseShared()
+	if t.isParallel {
+		t.suite.release(t.slots())
+	}
+	wait()
+	if t.isParallel {
+		t.suite.waitParallel(t.slots())
+	}
+	t.acquireShared()
+
+	t.start = time.Now()
+	t.stopIfFailing()
+	t.resumeTimeout()
+	t.resumeWatchdog()
+	if phase != "" {
+		t.Phase(phase)
+	}
+}
+
+// holds reports whether t or an ancestor has locked the resource.
+func (t *H) holds(resource string) bool {
+	for p := t; p != nil; p = p.parent {
+		if contains(p.locked, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// unlock releases the resources locked by t.
+func (t *H) unlock() {
+	for _, r := range t.locked {
+		t.suite.resource(r).Unlock()
+	}
+	t.locked = nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
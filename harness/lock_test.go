@@ -0,0 +1,77 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSuiteLock(t *testing.T) {
+	var holders [2]int32
+	var overlaps, concurrent, maxConcurrent int32
+	run := func(resources ...int) func(h *H) {
+		return func(h *H) {
+			h.Parallel()
+			var names []string
+			for _, r := range resources {
+				names = append(names, fmt.Sprint("resource", r))
+			}
+			h.Lock(names...)
+			for _, r := range resources {
+				if atomic.AddInt32(&holders[r], 1) != 1 {
+					atomic.AddInt32(&overlaps, 1)
+				}
+				defer atomic.AddInt32(&holders[r], -1)
+			}
+			n := atomic.AddInt32(&concurrent, 1)
+			defer atomic.AddInt32(&concurrent, -1)
+			for {
+				max := atomic.LoadInt32(&maxConcurrent)
+				if n <= max || atomic.CompareAndSwapInt32(&maxConcurrent, max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			// subtests share their parent's resources
+			h.Run("Sub", func(h *H) {
+				h.Lock(names...)
+			})
+		}
+	}
+
+	tests := Tests{}
+	for i := 0; i < 4; i++ {
+		tests.Add(fmt.Sprintf("Zero%d", i), run(0))
+		tests.Add(fmt.Sprintf("One%d", i), run(1))
+	}
+	tests.Add("Both1", run(0, 1))
+	tests.Add("Both2", run(1, 0))
+	tests.Add("Neither", run())
+
+	suite := NewSuite(Options{Parallel: 4}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if overlaps != 0 {
+		t.Errorf("tests locking the same resource overlapped %d times", overlaps)
+	}
+	if maxConcurrent < 2 {
+		t.Errorf("tests locking different resources didn't run in parallel")
+	}
+}
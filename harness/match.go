@@ -97,6 +97,17 @@ func (m *matcher) fullName(c *H, subname string) (name string, ok bool) {
 	return name, true
 }
 
+// matchTop reports whether the top-level test name would be run.
+func (m *matcher) matchTop(name string) bool {
+	if len(m.filter) == 0 {
+		return true
+	}
+	matchMutex.Lock()
+	defer matchMutex.Unlock()
+	ok, _ := matchString(m.filter[0], strings.SplitN(name, "/", 2)[0])
+	return ok
+}
+
 func splitRegexp(s string) []string {
 	a := make([]string, 0, strings.Count(s, "/"))
 	cs := 0
@@ -153,6 +164,18 @@ func (m *matcher) unique(parent, subname string) string {
 	}
 }
 
+// forget drops the names of the subtests of parent, so they keep their
+// names when parent is run again.
+func (m *matcher) forget(parent string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name := range m.subNames {
+		if strings.HasPrefix(name, parent+"/") {
+			delete(m.subNames, name)
+		}
+	}
+}
+
 // rewrite rewrites a subname to having only printable characters and no white
 // space.
 func rewrite(s string) string {
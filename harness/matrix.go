@@ -0,0 +1,107 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"strings"
+)
+
+// Param is a parameter of a test, such as an architecture or a
+// configuration variant, and the values to run the test with.
+type Param struct {
+	Name   string
+	Values []string
+}
+
+// Matrix lists the parameters to run a test over with H.RunMatrix.
+type Matrix []Param
+
+// Params maps the names of a test's parameters to their values.
+type Params map[string]string
+
+// combinations returns every combination of the values of the
+// parameters, in order, varying the last parameter fastest. An empty
+// matrix has no combinations.
+func (m Matrix) combinations() [][]Property {
+	if len(m) == 0 {
+		return nil
+	}
+	combos := [][]Property{nil}
+	for _, p := range m {
+		var next [][]Property
+		for _, c := range combos {
+			for _, v := range p.Values {
+				combo := append(append([]Property(nil), c...), Property{p.Name, v})
+				next = append(next, combo)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// paramsName names the subtest for a combination of parameters, such
+// as "arch=amd64,variant=a".
+func paramsName(params []Property) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name + "=" + p.Value
+	}
+	return strings.Join(parts, ",")
+}
+
+// RunMatrix runs f as a subtest for each combination of the values of
+// the parameters in m, named after it, such as "arch=amd64,variant=a",
+// so values shouldn't contain "/" or ",". The parameters are recorded
+// in the subtests' TestResult.Params, and are available to them and
+// their own subtests from H.Params. RunMatrix reports whether all the
+// subtests succeeded.
+func (t *H) RunMatrix(m Matrix, f func(t *H, p Params)) bool {
+	ok := true
+	for _, params := range m.combinations() {
+		params := params
+		if !t.Run(paramsName(params), func(t *H) {
+			t.mu.Lock()
+			t.params = params
+			t.mu.Unlock()
+			f(t, t.Params())
+		}) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// paramList returns the parameters of the test and its parents, the
+// outermost first.
+func (t *H) paramList() []Property {
+	var params []Property
+	for c := t; c != nil; c = c.parent {
+		c.mu.RLock()
+		params = append(append([]Property(nil), c.params...), params...)
+		c.mu.RUnlock()
+	}
+	return params
+}
+
+// Params returns the parameters given to the test, or one of its
+// parents, by RunMatrix.
+func (t *H) Params() Params {
+	p := make(Params)
+	for _, param := range t.paramList() {
+		p[param.Name] = param.Value
+	}
+	return p
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestRunMatrix(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	suite := NewSuite(Options{}, Tests{
+		"Matrix": func(h *H) {
+			ok := h.RunMatrix(Matrix{
+				{"arch", []string{"amd64", "arm64"}},
+				{"variant", []string{"a", "b"}},
+			}, func(h *H, p Params) {
+				h.Run("Inner", func(h *H) {
+					mu.Lock()
+					ran = append(ran, p["arch"]+"/"+h.Params()["variant"])
+					mu.Unlock()
+				})
+				if p["arch"] == "arm64" && p["variant"] == "b" {
+					h.Fail()
+				}
+			})
+			if ok {
+				h.Error("RunMatrix succeeded despite a failed subtest")
+			}
+		},
+		"Empty": func(h *H) {
+			h.RunMatrix(Matrix{}, func(h *H, p Params) {
+				h.Error("ran a test for an empty matrix")
+			})
+			h.RunMatrix(Matrix{{"arch", nil}}, func(h *H, p Params) {
+				h.Error("ran a test for a parameter without values")
+			})
+		},
+	})
+	suite.runTests(ioutil.Discard, nil)
+
+	want := []string{"amd64/a", "amd64/b", "arm64/a", "arm64/b"}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+
+	results := make(map[string]TestResult)
+	var names []string
+	for _, r := range suite.Results() {
+		results[r.Name] = r
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	wantNames := []string{
+		"Empty",
+		"Matrix",
+		"Matrix/arch=amd64,variant=a",
+		"Matrix/arch=amd64,variant=a/Inner",
+		"Matrix/arch=amd64,variant=b",
+		"Matrix/arch=amd64,variant=b/Inner",
+		"Matrix/arch=arm64,variant=a",
+		"Matrix/arch=arm64,variant=a/Inner",
+		"Matrix/arch=arm64,variant=b",
+		"Matrix/arch=arm64,variant=b/Inner",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("got tests %v, want %v", names, wantNames)
+	}
+	if r := results["Empty"]; r.Result != "PASS" {
+		t.Errorf("Empty: got %s:\n%s", r.Result, r.Output)
+	}
+	if r := results["Matrix"]; r.Result != "FAIL" || r.Params != nil {
+		t.Errorf("Matrix: got %s with params %v, want FAIL without params:\n%s", r.Result, r.Params, r.Output)
+	}
+	wantParams := []Property{{"arch", "arm64"}, {"variant", "b"}}
+	for _, name := range []string{"Matrix/arch=arm64,variant=b", "Matrix/arch=arm64,variant=b/Inner"} {
+		if got := results[name].Params; !reflect.DeepEqual(got, wantParams) {
+			t.Errorf("%s: got params %v, want %v", name, got, wantParams)
+		}
+	}
+}
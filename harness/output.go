@@ -0,0 +1,91 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// output copies suite output to any number of sinks, such as the
+// terminal, the run's log file, and the live stream. Writes are
+// serialized and held back until a line is complete, so sinks are only
+// given whole lines and needn't buffer output themselves. A sink which
+// fails is dropped so the others keep receiving output.
+type output struct {
+	mu      sync.Mutex
+	partial []byte
+	sinks   []io.Writer
+	err     error // First error from a sink.
+}
+
+func newOutput(sinks ...io.Writer) *output {
+	o := &output{}
+	for _, w := range sinks {
+		o.add(w)
+	}
+	return o
+}
+
+// add adds a sink, which is given output written from then on.
+func (o *output) add(w io.Writer) {
+	if w == nil || w == ioutil.Discard {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sinks = append(o.sinks, w)
+}
+
+// Write never fails, so a broken sink can't fail the tests writing.
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.partial = append(o.partial, p...)
+	if i := bytes.LastIndexByte(o.partial, '\n'); i >= 0 {
+		o.emit(o.partial[:i+1])
+		o.partial = append([]byte(nil), o.partial[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// emit writes to every sink. o.mu must be held.
+func (o *output) emit(p []byte) {
+	sinks := o.sinks[:0]
+	for _, w := range o.sinks {
+		if _, err := w.Write(p); err != nil {
+			if o.err == nil {
+				o.err = err
+			}
+			continue
+		}
+		sinks = append(sinks, w)
+	}
+	o.sinks = sinks
+}
+
+// Close writes out any incomplete last line and returns the first
+// error from a sink. The sinks themselves are left open.
+func (o *output) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.partial) > 0 {
+		o.emit(o.partial)
+		o.partial = nil
+	}
+	return o.err
+}
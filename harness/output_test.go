@@ -0,0 +1,59 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// recorder records each write it is given.
+type recorder struct {
+	writes []string
+	err    error
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func TestOutput(t *testing.T) {
+	first, second := &recorder{}, &recorder{}
+	out := newOutput(first, second)
+
+	fmt.Fprint(out, "=== RUN   a\n--- PA")
+	fmt.Fprint(out, "SS: a")
+	fmt.Fprint(out, " (0.00s)\nPASS\nok")
+	second.err = errors.New("disconnected")
+	fmt.Fprint(out, "\n")
+	fmt.Fprint(out, "trailing")
+	if err := out.Close(); err != second.err {
+		t.Errorf("Close returned %v; want %v", err, second.err)
+	}
+
+	want := []string{"=== RUN   a\n", "--- PASS: a (0.00s)\nPASS\n", "ok\n", "trailing"}
+	if !reflect.DeepEqual(first.writes, want) {
+		t.Errorf("got writes %q; want %q", first.writes, want)
+	}
+	if want := want[:2]; !reflect.DeepEqual(second.writes, want) {
+		t.Errorf("failed sink got writes %q; want %q", second.writes, want)
+	}
+}
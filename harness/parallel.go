@@ -0,0 +1,52 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"strconv"
+)
+
+// RunParallel runs f for each i in [0, n) as parallel subtests named
+// name/0 through name/n-1, so every item of a data-driven test is
+// reported, filtered, and timed on its own. At most workers of them run
+// at once, or with workers of 0, as many as the suite's Options.Parallel
+// slots they share with other tests allow. Subtests waiting for a worker
+// don't hold a slot. RunParallel returns once all of them have
+// completed, reporting whether they all succeeded.
+func (t *H) RunParallel(name string, n, workers int, f func(i int, h *H)) bool {
+	if n < 0 {
+		panic("harness: RunParallel called with negative n")
+	}
+	if workers < 0 {
+		panic("harness: RunParallel called with negative workers")
+	}
+	var sem chan struct{}
+	if workers > 0 && workers < n {
+		sem = make(chan struct{}, workers)
+	}
+	return t.Run(name, func(h *H) {
+		for i := 0; i < n; i++ {
+			i := i // capture loop variable
+			h.Run(strconv.Itoa(i), func(h *H) {
+				h.Parallel()
+				if sem != nil {
+					h.waitAside(func() { sem <- struct{}{} })
+					defer func() { <-sem }()
+				}
+				f(i, h)
+			})
+		}
+	})
+}
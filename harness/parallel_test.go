@@ -0,0 +1,121 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunParallel(t *testing.T) {
+	const parallel, items = 3, 10
+	var load, peak, overloads int32
+	var seen [items]int32
+	var ok, finished bool
+	tests := Tests{}
+	tests.Add("Items", func(h *H) {
+		ok = h.RunParallel("item", items, 0, func(i int, h *H) {
+			atomic.AddInt32(&seen[i], 1)
+			n := atomic.AddInt32(&load, 1)
+			defer atomic.AddInt32(&load, -1)
+			if n > parallel {
+				atomic.AddInt32(&overloads, 1)
+			}
+			for {
+				max := atomic.LoadInt32(&peak)
+				if n <= max || atomic.CompareAndSwapInt32(&peak, max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			if i == 7 {
+				h.Error("bad item")
+			}
+		})
+		finished = atomic.LoadInt32(&load) == 0
+	})
+
+	suite := NewSuite(Options{Parallel: parallel}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Fatalf("got error %v, want %v", err, SuiteFailed)
+	}
+	if ok {
+		t.Error("RunParallel reported success despite a failed item")
+	}
+	if !finished {
+		t.Error("RunParallel returned before its items completed")
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Errorf("item %d ran %d times", i, n)
+		}
+	}
+	if overloads != 0 {
+		t.Errorf("items exceeded the parallel budget %d times", overloads)
+	}
+	if peak < 2 {
+		t.Errorf("items didn't run in parallel")
+	}
+
+	results := make(map[string]string)
+	for _, r := range suite.Results() {
+		results[r.Name] = r.Result
+	}
+	if got := results["Items/item/7"]; got != "FAIL" {
+		t.Errorf("Items/item/7: got %q, want FAIL", got)
+	}
+	if got := results["Items/item/3"]; got != "PASS" {
+		t.Errorf("Items/item/3: got %q, want PASS", got)
+	}
+}
+
+func TestRunParallelWorkers(t *testing.T) {
+	const parallel, workers, items = 8, 2, 10
+	var load, peak, overloads, done int32
+	tests := Tests{}
+	tests.Add("Items", func(h *H) {
+		h.RunParallel("item", items, workers, func(i int, h *H) {
+			n := atomic.AddInt32(&load, 1)
+			defer atomic.AddInt32(&load, -1)
+			if n > workers {
+				atomic.AddInt32(&overloads, 1)
+			}
+			for {
+				max := atomic.LoadInt32(&peak)
+				if n <= max || atomic.CompareAndSwapInt32(&peak, max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		})
+	})
+
+	suite := NewSuite(Options{Parallel: parallel}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if done != items {
+		t.Errorf("%d items ran, want %d", done, items)
+	}
+	if overloads != 0 {
+		t.Errorf("items exceeded %d workers %d times", workers, overloads)
+	}
+	if peak != workers {
+		t.Errorf("at most %d items ran at once, want %d", peak, workers)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiles starts the profiles of a top-level test asked for by
+// Options.TestCpuProfile and TestMemProfile, or starts them over once a
+// parallel test gets to run.
+func (t *H) startProfiles() {
+	if t.level != 1 {
+		return
+	}
+	if t.suite.opts.TestMemProfile {
+		t.writeHeapProfile("heap-start.prof")
+	}
+	if t.suite.opts.TestCpuProfile {
+		// Goroutines the test starts, including its subtests, inherit
+		// the label.
+		pprof.SetGoroutineLabels(pprof.WithLabels(t.ctx, pprof.Labels("test", t.name)))
+		t.startCPUProfile()
+	}
+}
+
+// pauseProfiles lets other tests use the CPU profiler while a parallel
+// test waits to run.
+func (t *H) pauseProfiles() {
+	if t.level == 1 {
+		t.stopCPUProfile()
+	}
+}
+
+// stopProfiles finishes the profiles of a top-level test.
+func (t *H) stopProfiles() {
+	if t.level != 1 {
+		return
+	}
+	t.stopCPUProfile()
+	if t.suite.opts.TestMemProfile {
+		t.writeHeapProfile("heap.prof")
+	}
+}
+
+func (t *H) startCPUProfile() {
+	s := t.suite
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	if s.profiled != nil {
+		t.Logf("Not profiling CPU: profiler in use by %s", s.profiled.name)
+		return
+	}
+	dir, err := t.mkOutputDir()
+	if err != nil {
+		t.Logf("Not profiling CPU: %v", err)
+		return
+	}
+	f, err := os.Create(filepath.Join(dir, "cpu.prof"))
+	if err != nil {
+		t.Logf("Not profiling CPU: %v", err)
+		return
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		t.Logf("Not profiling CPU: %v", err)
+		return
+	}
+	s.profiled = t
+	t.cpuProf = f
+}
+
+func (t *H) stopCPUProfile() {
+	s := t.suite
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	if s.profiled != t {
+		return
+	}
+	pprof.StopCPUProfile()
+	if err := t.cpuProf.Close(); err != nil {
+		t.Logf("Failed to write CPU profile: %v", err)
+	}
+	s.profiled = nil
+	t.cpuProf = nil
+}
+
+// writeHeapProfile writes a heap profile, as of the last garbage
+// collection, to name in the test's output directory.
+func (t *H) writeHeapProfile(name string) {
+	dir, err := t.mkOutputDir()
+	if err != nil {
+		t.Logf("Failed to write heap profile: %v", err)
+		return
+	}
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Logf("Failed to write heap profile: %v", err)
+		return
+	}
+	defer f.Close()
+	runtime.GC()
+	if err := pprof.Lookup("heap").WriteTo(f, 0); err != nil {
+		t.Logf("Failed to write heap profile: %v", err)
+	}
+}
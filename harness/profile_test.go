@@ -0,0 +1,97 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTestProfiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	outputDir := filepath.Join(tmp, "_out_temp")
+
+	opts := Options{
+		OutputDir:      outputDir,
+		TestCpuProfile: true,
+		TestMemProfile: true,
+	}
+	suite := NewSuite(opts, Tests{
+		"A": func(h *H) {
+			h.Run("Sub", func(h *H) {})
+		},
+		"B": func(h *H) {},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatalf("suite failed: %v", err)
+	}
+
+	for _, test := range []string{"A", "B"} {
+		for _, name := range []string{"cpu.prof", "heap-start.prof", "heap.prof"} {
+			fi, err := os.Stat(filepath.Join(outputDir, test, name))
+			if err != nil {
+				t.Errorf("%s: %v", test, err)
+			} else if fi.Size() == 0 {
+				t.Errorf("%s: %s is empty", test, name)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "A", "Sub", "cpu.prof")); err == nil {
+		t.Errorf("subtest was profiled on its own")
+	}
+}
+
+func TestTestCpuProfileBusy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	outputDir := filepath.Join(tmp, "_out_temp")
+
+	// Both tests are running before either finishes.
+	var running sync.WaitGroup
+	running.Add(2)
+	test := func(h *H) {
+		h.Parallel()
+		running.Done()
+		running.Wait()
+	}
+	suite := NewSuite(Options{OutputDir: outputDir, TestCpuProfile: true, Parallel: 2}, Tests{
+		"A": test,
+		"B": test,
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatalf("suite failed: %v", err)
+	}
+
+	var busy int
+	for _, r := range suite.Results() {
+		if strings.Contains(r.Output, "Not profiling CPU: profiler in use by") {
+			busy++
+		}
+	}
+	if busy != 1 {
+		t.Errorf("got %d tests reporting the profiler busy, want 1", busy)
+	}
+}
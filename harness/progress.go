@@ -0,0 +1,224 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The progress reporter prints a line every Options.Progress while the
+// suite runs, so there is something to watch during long runs in which
+// results only come out as each test finishes. It counts top-level tests
+// only, estimates how long the rest will take from how long each test is
+// expected to, and lists the running ones longest first, pointing out
+// those running for longer than expected:
+//
+//	harness: progress: 2 running, 5 passed, 1 failed, 0 skipped, 12 queued, about 310.00s left; running: a (62.00s, expected 30.00s), b (5.00s)
+//
+// The estimate assumes the tests left will keep Options.Parallel tests
+// running at a time, and is only given once there is something to base
+// it on: Options.ExpectedDurations, or tests which have finished.
+
+// progress counts the top-level tests in each state.
+type progress struct {
+	passed, failed, skipped, queued int
+	running                         []runningTest
+
+	queuedNames []string        // of the queued tests
+	finished    []time.Duration // durations of the finished tests
+}
+
+func (p *progress) String() string {
+	return fmt.Sprintf("%d running, %d passed, %d failed, %d skipped, %d queued",
+		len(p.running), p.passed, p.failed, p.skipped, p.queued)
+}
+
+// currentProgress returns the progress of the suite so far.
+func (s *Suite) currentProgress() *progress {
+	var p progress
+	finished := make(map[string]bool)
+	s.resultsMu.Lock()
+	for _, r := range s.results {
+		if strings.Contains(r.Name, "/") {
+			continue
+		}
+		finished[r.Name] = true
+		if r.Result != "NOT RUN" && r.Result != "SKIP" {
+			p.finished = append(p.finished, r.Duration)
+		}
+		switch r.Result {
+		case "FAIL", "XPASS":
+			p.failed++
+		case "SKIP", "NOT RUN":
+			p.skipped++
+		default:
+			p.passed++
+		}
+	}
+	for name, start := range s.active {
+		if !strings.Contains(name, "/") {
+			p.running = append(p.running, runningTest{name, start})
+		}
+	}
+	for name := range s.tests {
+		if _, running := s.active[name]; !running && !finished[name] && s.match.matchTop(name) {
+			p.queued++
+			p.queuedNames = append(p.queuedNames, name)
+		}
+	}
+	for name, base := range s.repeats {
+		if _, running := s.active[name]; !running && !finished[name] && s.match.matchTop(base) {
+			p.queued++
+			p.queuedNames = append(p.queuedNames, name)
+		}
+	}
+	s.resultsMu.Unlock()
+
+	sort.Sort(byStart(p.running))
+	return &p
+}
+
+// byStart sorts running tests by when they started, then by name.
+type byStart []runningTest
+
+func (b byStart) Len() int      { return len(b) }
+func (b byStart) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byStart) Less(i, j int) bool {
+	if !b[i].Start.Equal(b[j].Start) {
+		return b[i].Start.Before(b[j].Start)
+	}
+	return b[i].Name < b[j].Name
+}
+
+// reportProgress writes the progress of the suite at now to out and, as
+// a package-level output event, to the JSON event stream.
+func (s *Suite) reportProgress(out io.Writer, now time.Time) {
+	line := s.progressLine(s.currentProgress(), now)
+	io.WriteString(out, line)
+	s.events.output("", []byte(line))
+}
+
+// progressLine describes the progress p at now.
+func (s *Suite) progressLine(p *progress, now time.Time) string {
+	line := "harness: progress: " + p.String()
+	if left, ok := s.timeLeft(p, now); ok {
+		line += fmt.Sprintf(", about %s left", fmtDuration(left))
+	}
+	if len(p.running) > 0 {
+		running := make([]string, len(p.running))
+		for i, r := range p.running {
+			elapsed := now.Sub(r.Start)
+			if expected, ok := s.expectedDuration(r.Name, p); ok && elapsed > expected {
+				running[i] = fmt.Sprintf("%s (%s, expected %s)", r.Name, fmtDuration(elapsed), fmtDuration(expected))
+			} else {
+				running[i] = fmt.Sprintf("%s (%s)", r.Name, fmtDuration(elapsed))
+			}
+		}
+		line += "; running: " + strings.Join(running, ", ")
+	}
+	return line + "\n"
+}
+
+// expectedDuration returns how long a top-level test is expected to
+// take: its duration in Options.ExpectedDurations or else the mean
+// duration of the tests finished so far.
+func (s *Suite) expectedDuration(name string, p *progress) (time.Duration, bool) {
+	if d, ok := s.opts.ExpectedDurations[s.baseName(name)]; ok {
+		return d, true
+	}
+	if len(p.finished) == 0 {
+		return 0, false
+	}
+	var total time.Duration
+	for _, d := range p.finished {
+		total += d
+	}
+	return total / time.Duration(len(p.finished)), true
+}
+
+// timeLeft estimates how long the suite will take to finish at now: the
+// expected time left of the running and queued tests shared out over
+// Options.Parallel, but no less than the longest of them.
+func (s *Suite) timeLeft(p *progress, now time.Time) (time.Duration, bool) {
+	var total, longest time.Duration
+	add := func(d time.Duration) {
+		if d < 0 {
+			// It should be finishing any time now.
+			d = 0
+		}
+		total += d
+		if d > longest {
+			longest = d
+		}
+	}
+	for _, r := range p.running {
+		expected, ok := s.expectedDuration(r.Name, p)
+		if !ok {
+			return 0, false
+		}
+		add(expected - now.Sub(r.Start))
+	}
+	for _, name := range p.queuedNames {
+		expected, ok := s.expectedDuration(name, p)
+		if !ok {
+			return 0, false
+		}
+		add(expected)
+	}
+
+	parallel := s.opts.Parallel
+	if left := len(p.running) + len(p.queuedNames); left < parallel {
+		parallel = left
+	}
+	if parallel < 1 {
+		return 0, false
+	}
+	left := total / time.Duration(parallel)
+	if left < longest {
+		left = longest
+	}
+	return left, true
+}
+
+// startProgress reports the progress of the suite to out every
+// Options.Progress until the returned function is called.
+func (s *Suite) startProgress(out io.Writer) func() {
+	if s.opts.Progress <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(s.opts.Progress)
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case now := <-ticker.C:
+				s.reportProgress(out, now)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
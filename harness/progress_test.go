@@ -0,0 +1,151 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var suite *Suite
+	var got *progress
+	var line bytes.Buffer
+	tests := Tests{
+		"Fail": func(h *H) { h.Fail() },
+		"Pass": func(h *H) {
+			h.Run("Sub", func(h *H) {})
+		},
+		"Skip":      func(h *H) { h.Skip("skipped") },
+		"Unmatched": func(h *H) {},
+		"Zcheck": func(h *H) {
+			got = suite.currentProgress()
+			suite.reportProgress(&line, time.Now())
+		},
+		"Zlast": func(h *H) {},
+	}
+	opts := Options{
+		OutputDir: filepath.Join(dir, "out"),
+		Match:     "Fail|Pass|Skip|Z",
+	}
+	suite = NewSuite(opts, tests)
+	suite.runTests(ioutil.Discard, nil)
+
+	want := "1 running, 1 passed, 1 failed, 1 skipped, 1 queued"
+	if got == nil || got.String() != want {
+		t.Fatalf("progress: got %v, want %q", got, want)
+	}
+	if len(got.running) != 1 || got.running[0].Name != "Zcheck" {
+		t.Errorf("running: got %v, want Zcheck", got.running)
+	}
+	// The tests which finished also give an estimate of the time left.
+	re := regexp.MustCompile(`^harness: progress: ` + want + `, about [0-9.]+s left; running: Zcheck \(`)
+	if s := line.String(); !re.MatchString(s) {
+		t.Errorf("unexpected progress line %q", s)
+	}
+}
+
+func TestProgressReported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := Tests{
+		"Slow": func(h *H) { time.Sleep(100 * time.Millisecond) },
+	}
+	opts := Options{
+		OutputDir: dir,
+		Progress:  10 * time.Millisecond,
+	}
+	suite := NewSuite(opts, tests)
+	var out lockedBuffer
+	stop := suite.startProgress(&out)
+	suite.runTests(ioutil.Discard, nil)
+	stop()
+
+	if !strings.Contains(out.String(), "harness: progress: 1 running, 0 passed, 0 failed, 0 skipped, 0 queued; running: Slow (") {
+		t.Errorf("progress not reported while Slow ran: %q", out.String())
+	}
+}
+
+func TestProgressTimeLeft(t *testing.T) {
+	opts := Options{
+		Parallel: 2,
+		ExpectedDurations: map[string]time.Duration{
+			"A": 10 * time.Second,
+			"B": 30 * time.Second,
+			"C": 40 * time.Second,
+		},
+	}
+	suite := NewSuite(opts, Tests{})
+	now := time.Now()
+	p := &progress{
+		running: []runningTest{
+			{"A", now.Add(-20 * time.Second)}, // overdue
+			{"B", now.Add(-10 * time.Second)},
+		},
+		queuedNames: []string{"C", "D"},
+		finished:    []time.Duration{10 * time.Second},
+	}
+	// A: 0s, B: 20s, C: 40s, D: 10s from the mean of those finished;
+	// 70s over 2 at a time is 35s, but C alone takes 40s.
+	if left, ok := suite.timeLeft(p, now); !ok || left != 40*time.Second {
+		t.Errorf("got %v, %v; want 40s", left, ok)
+	}
+
+	line := suite.progressLine(p, now)
+	if !strings.Contains(line, ", about 40.00s left; running: A (20.00s, expected 10.00s), B (10.00s)") {
+		t.Errorf("overdue test not pointed out: %q", line)
+	}
+
+	// Nothing to go on for D.
+	p.finished = nil
+	if _, ok := suite.timeLeft(p, now); ok {
+		t.Errorf("got an estimate without durations for every test")
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe to write from several goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Quarantine is a list of top-level tests, such as known flakes, which
+// run and report their results as usual but whose failures don't fail
+// the suite or count towards Options.MaxFailures or Options.FailFast.
+type Quarantine []string
+
+func (q Quarantine) String() string {
+	return strings.Join(q, ",")
+}
+
+// Set implements flag.Value, adding a comma-separated list of tests.
+func (q *Quarantine) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*q = append(*q, name)
+		}
+	}
+	return nil
+}
+
+// Type implements pflag.Value.
+func (q *Quarantine) Type() string {
+	return "tests"
+}
+
+// Contains reports whether the named test or the top-level test it
+// belongs to is quarantined.
+func (q Quarantine) Contains(name string) bool {
+	top := strings.SplitN(name, "/", 2)[0]
+	for _, n := range q {
+		if n == top {
+			return true
+		}
+	}
+	return false
+}
+
+// reportQuarantine lists the quarantined tests which failed, since
+// they didn't fail the suite.
+func (s *Suite) reportQuarantine(out io.Writer) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	if len(s.quarantined) > 0 {
+		fmt.Fprintf(out, "harness: %d quarantined tests failed, not failing the suite: %s\n",
+			len(s.quarantined), strings.Join(s.quarantined, ", "))
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuarantineSet(t *testing.T) {
+	var q Quarantine
+	for _, v := range []string{"A,B", " C ,", ""} {
+		if err := q.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := (Quarantine{"A", "B", "C"}); !reflect.DeepEqual(q, want) {
+		t.Errorf("got %q; want %q", q, want)
+	}
+	if s := q.String(); s != "A,B,C" {
+		t.Errorf("got %q; want %q", s, "A,B,C")
+	}
+	for name, want := range map[string]bool{
+		"A":     true,
+		"B/Sub": true,
+		"AB":    false,
+		"D/A":   false,
+	} {
+		if got := q.Contains(name); got != want {
+			t.Errorf("Contains(%q): got %v; want %v", name, got, want)
+		}
+	}
+}
+
+func TestSuiteQuarantine(t *testing.T) {
+	tests := Tests{
+		"Flaky": func(h *H) {
+			h.Run("Sub", func(h *H) {
+				h.Fail()
+			})
+		},
+		"Broken": func(h *H) {
+			h.Fail()
+		},
+		"Good": func(h *H) {},
+	}
+
+	for _, tc := range []struct {
+		quarantine Quarantine
+		want       error
+	}{
+		{nil, SuiteFailed},
+		{Quarantine{"Flaky"}, SuiteFailed},
+		{Quarantine{"Flaky", "Broken"}, nil},
+	} {
+		// MaxFailures would stop the suite if quarantined failures
+		// counted.
+		suite := NewSuite(Options{Quarantine: tc.quarantine, MaxFailures: 1}, tests)
+		var out bytes.Buffer
+		err := suite.runTests(ioutil.Discard, nil)
+		suite.reportQuarantine(&out)
+		if err != tc.want {
+			t.Errorf("Quarantine %q: got %v; want %v", tc.quarantine, err, tc.want)
+		}
+		for _, r := range suite.Results() {
+			if r.Quarantined != tc.quarantine.Contains(r.Name) {
+				t.Errorf("Quarantine %q: %s has Quarantined %v", tc.quarantine, r.Name, r.Quarantined)
+			}
+			if r.Result == "NOT RUN" && tc.want == nil {
+				t.Errorf("Quarantine %q: %s not run", tc.quarantine, r.Name)
+			}
+		}
+		if tc.want == nil && !strings.Contains(out.String(), "quarantined tests failed") {
+			t.Errorf("Quarantine %q: failures not reported: %q", tc.quarantine, out.String())
+		}
+	}
+}
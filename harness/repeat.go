@@ -0,0 +1,180 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Options.Count runs each top-level test more than once. Every run is a
+// test of its own, named like the duplicate subtests of Go's testing
+// package: the first run keeps the test's name and later ones are
+// "Name#01", "Name#02", and so on. Their results are summed up per test
+// once the suite finishes.
+
+// repeatName returns the name of run i of a test, counting from 0.
+func repeatName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s#%02d", name, i)
+}
+
+// repeatNames maps the names of the later runs of each test to the name
+// of the test.
+func repeatNames(tests Tests, count int) map[string]string {
+	repeats := make(map[string]string)
+	for name := range tests {
+		for i := 1; i < count; i++ {
+			repeats[repeatName(name, i)] = name
+		}
+	}
+	return repeats
+}
+
+// baseName returns the name a test would have if its top-level test
+// weren't repeated.
+func (s *Suite) baseName(name string) string {
+	parts := strings.SplitN(name, "/", 2)
+	if base, ok := s.repeats[parts[0]]; ok {
+		parts[0] = base
+	}
+	return strings.Join(parts, "/")
+}
+
+// runRepeats runs the top-level tests which Match selects under t,
+// Options.Count times over.
+func (s *Suite) runRepeats(t *H) {
+	t.hasSub = true
+	for i := 0; i < s.opts.Count; i++ {
+		for _, name := range s.testOrder() {
+			if _, ok := s.match.fullName(t, name); !ok {
+				continue
+			}
+			fn := s.tests[name]
+			if s.opts.Count > 1 && s.opts.CountParallel {
+				fn = repeatParallel(fn)
+			}
+			t.runChild(repeatName(name, i), fn)
+		}
+	}
+}
+
+// repeatParallel makes a test parallel for Options.CountParallel. The
+// test may still call Parallel itself.
+func repeatParallel(fn func(h *H)) func(h *H) {
+	return func(h *H) {
+		h.Parallel()
+		h.repeatParallel = true
+		fn(h)
+	}
+}
+
+// repeatStats sums up the runs of a repeated test.
+type repeatStats struct {
+	name      string
+	runs      int // which weren't skipped
+	failed    int
+	durations []time.Duration
+}
+
+func (r *repeatStats) mean() time.Duration {
+	var total time.Duration
+	for _, d := range r.durations {
+		total += d
+	}
+	return total / time.Duration(len(r.durations))
+}
+
+// median and max expect the durations to be sorted.
+func (r *repeatStats) median() time.Duration {
+	n := len(r.durations)
+	if n%2 == 0 {
+		return (r.durations[n/2-1] + r.durations[n/2]) / 2
+	}
+	return r.durations[n/2]
+}
+
+func (r *repeatStats) max() time.Duration {
+	return r.durations[len(r.durations)-1]
+}
+
+// repeatStats returns the stats of each repeated test which ran, sorted
+// by name.
+func (s *Suite) repeatStats() []*repeatStats {
+	byName := make(map[string]*repeatStats)
+	var stats []*repeatStats
+	for _, r := range s.Results() {
+		name := s.baseName(r.Name)
+		if _, ok := s.tests[name]; !ok || r.Result == "SKIP" || r.Result == "NOT RUN" {
+			continue
+		}
+		st := byName[name]
+		if st == nil {
+			st = &repeatStats{name: name}
+			byName[name] = st
+			stats = append(stats, st)
+		}
+		st.runs++
+		if r.Result == "FAIL" {
+			st.failed++
+		}
+		st.durations = append(st.durations, r.Duration)
+	}
+	for _, st := range stats {
+		sort.Sort(byDuration(st.durations))
+	}
+	sort.Sort(byRepeatName(stats))
+	return stats
+}
+
+type byDuration []time.Duration
+
+func (b byDuration) Len() int           { return len(b) }
+func (b byDuration) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byDuration) Less(i, j int) bool { return b[i] < b[j] }
+
+type byRepeatName []*repeatStats
+
+func (b byRepeatName) Len() int           { return len(b) }
+func (b byRepeatName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byRepeatName) Less(i, j int) bool { return b[i].name < b[j].name }
+
+// reportRepeats lists how often each repeated test passed and how long
+// its runs took.
+func (s *Suite) reportRepeats(out io.Writer) {
+	if s.opts.Count <= 1 {
+		return
+	}
+	stats := s.repeatStats()
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "harness: ran each test %d times:\n", s.opts.Count)
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "    TEST\tPASSED\tRATE\tMEAN\tMEDIAN\tMAX\n")
+	for _, st := range stats {
+		passed := st.runs - st.failed
+		fmt.Fprintf(tw, "    %s\t%d/%d\t%.0f%%\t%s\t%s\t%s\n", st.name, passed, st.runs,
+			100*float64(passed)/float64(st.runs), fmtDuration(st.mean()),
+			fmtDuration(st.median()), fmtDuration(st.max()))
+	}
+	tw.Flush()
+}
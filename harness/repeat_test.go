@@ -0,0 +1,106 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCount(t *testing.T) {
+	suite := NewSuite(Options{Count: 3}, Tests{
+		"Flaky": func(h *H) {
+			if h.Name() == "Flaky#01" {
+				h.Fail()
+			}
+		},
+		"Pass": func(h *H) {
+			h.Run("Sub", func(h *H) {})
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Fatalf("got %v, want %v", err, SuiteFailed)
+	}
+
+	var names []string
+	for _, r := range suite.Results() {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	want := []string{
+		"Flaky", "Flaky#01", "Flaky#02",
+		"Pass", "Pass#01", "Pass#01/Sub", "Pass#02", "Pass#02/Sub", "Pass/Sub",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got results %q, want %q", names, want)
+	}
+
+	var out bytes.Buffer
+	suite.reportRepeats(&out)
+	for _, re := range []string{
+		`harness: ran each test 3 times:`,
+		`Flaky +2/3 +67% `,
+		`Pass +3/3 +100% `,
+	} {
+		if !regexp.MustCompile(re).Match(out.Bytes()) {
+			t.Errorf("report doesn't match %q:\n%s", re, out.String())
+		}
+	}
+}
+
+func TestCountParallel(t *testing.T) {
+	// Each run only finishes once all of them are running.
+	var started sync.WaitGroup
+	started.Add(3)
+	all := make(chan bool)
+	go func() {
+		started.Wait()
+		close(all)
+	}()
+	opts := Options{Count: 3, CountParallel: true, Parallel: 3}
+	suite := NewSuite(opts, Tests{
+		"Test": func(h *H) {
+			h.Parallel() // no panic for calling it again
+			started.Done()
+			select {
+			case <-all:
+			case <-time.After(10 * time.Second):
+				h.Fatal("runs didn't run in parallel")
+			}
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatalf("suite failed: %v", err)
+	}
+}
+
+func TestRepeatStats(t *testing.T) {
+	st := repeatStats{durations: []time.Duration{1, 2, 4, 9}}
+	if got := st.mean(); got != 4 {
+		t.Errorf("got mean %v, want 4", got)
+	}
+	if got := st.median(); got != 3 {
+		t.Errorf("got median %v, want 3", got)
+	}
+	if got := st.max(); got != 9 {
+		t.Errorf("got max %v, want 9", got)
+	}
+}
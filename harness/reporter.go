@@ -0,0 +1,108 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Reporter receives the progress of a suite as each test starts and
+// finishes, to report the results in a format of its own. The suite's
+// TAP log, JSON events, and JUnit report are written by Reporters;
+// Options.Reporters adds more, such as one loading the results into a
+// database. A suite calls its Reporters from one goroutine at a time.
+type Reporter interface {
+	// TestStarted is called as a test or subtest starts to run, and
+	// again as each later attempt at a failed test starts.
+	TestStarted(t TestInfo, start time.Time)
+
+	// TestFinished is called with the result of a test or subtest
+	// once it and its subtests have finished, so after the results
+	// of its subtests.
+	TestFinished(t TestInfo, r TestResult)
+
+	// SuiteFinished is called once all tests have finished, with the
+	// error the suite is about to return and how long it took. An
+	// error returned is printed, and returned by the suite if it
+	// otherwise passed.
+	SuiteFinished(err error, elapsed time.Duration) error
+}
+
+// TestInfo identifies a test to a Reporter.
+type TestInfo struct {
+	Name   string // full name, such as "Parent/Sub"
+	Parent string // full name of the parent, "" for a top-level test
+	Level  int    // 1 for top-level tests, 2 for their subtests, and so on
+}
+
+// info returns the TestInfo of the test.
+func (t *H) info() TestInfo {
+	info := TestInfo{Name: t.name, Level: t.level}
+	if t.parent != nil && t.parent.level > 0 {
+		info.Parent = t.parent.name
+	}
+	return info
+}
+
+// initReporters sets up the Reporters for a run: the TAP log, if tap
+// isn't nil, JSON events and the JUnit report, if enabled, and then
+// Options.Reporters.
+func (s *Suite) initReporters(tap io.Writer) {
+	s.reporters = nil
+	if tap != nil {
+		s.reporters = append(s.reporters, newTAPReporter(tap))
+	}
+	if s.events != nil {
+		s.reporters = append(s.reporters, s.events)
+	}
+	if s.opts.JUnitFile != "" {
+		s.reporters = append(s.reporters, &junitReporter{suite: s, start: time.Now()})
+	}
+	s.reporters = append(s.reporters, s.opts.Reporters...)
+}
+
+func (s *Suite) testStarted(t TestInfo, start time.Time) {
+	s.reportersMu.Lock()
+	defer s.reportersMu.Unlock()
+	for _, r := range s.reporters {
+		r.TestStarted(t, start)
+	}
+}
+
+func (s *Suite) testFinished(t TestInfo, result TestResult) {
+	s.reportersMu.Lock()
+	defer s.reportersMu.Unlock()
+	for _, r := range s.reporters {
+		r.TestFinished(t, result)
+	}
+}
+
+// suiteFinished tells the Reporters the suite has finished, printing
+// their errors to out and returning the suite's error.
+func (s *Suite) suiteFinished(out io.Writer, err error, elapsed time.Duration) error {
+	s.reportersMu.Lock()
+	defer s.reportersMu.Unlock()
+	for _, r := range s.reporters {
+		if err2 := r.SuiteFinished(err, elapsed); err2 != nil {
+			fmt.Fprintf(out, "harness: %v\n", err2)
+			if err == nil {
+				err = err2
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// eventRecorder is a Reporter noting the events it receives.
+type eventRecorder struct {
+	events []string
+	err    error
+}
+
+func (r *eventRecorder) TestStarted(t TestInfo, start time.Time) {
+	r.events = append(r.events, fmt.Sprintf("start %s parent=%q level=%d", t.Name, t.Parent, t.Level))
+}
+
+func (r *eventRecorder) TestFinished(t TestInfo, result TestResult) {
+	r.events = append(r.events, fmt.Sprintf("finish %s %s", t.Name, result.Result))
+}
+
+func (r *eventRecorder) SuiteFinished(err error, elapsed time.Duration) error {
+	r.events = append(r.events, fmt.Sprintf("done %v", err))
+	return r.err
+}
+
+func TestReporters(t *testing.T) {
+	var rec eventRecorder
+	suite := NewSuite(Options{Retries: 1, Reporters: []Reporter{&rec}}, Tests{
+		"Parent": func(h *H) {
+			h.Run("Sub", func(h *H) {})
+		},
+		"Flaky": func(h *H) {
+			if h.Attempt() == 1 {
+				h.Fail()
+			}
+		},
+	})
+	err := suite.runTests(ioutil.Discard, nil)
+	err = suite.suiteFinished(ioutil.Discard, err, 0)
+	if err != nil {
+		t.Fatalf("suite failed: %v", err)
+	}
+
+	want := []string{
+		`start Flaky parent="" level=1`,
+		`start Flaky parent="" level=1`,
+		`finish Flaky FLAKY`,
+		`start Parent parent="" level=1`,
+		`start Parent/Sub parent="Parent" level=2`,
+		`finish Parent/Sub PASS`,
+		`finish Parent PASS`,
+		`done <nil>`,
+	}
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("got events:\n%q\nwant:\n%q", rec.events, want)
+	}
+}
+
+func TestReporterError(t *testing.T) {
+	rec := eventRecorder{err: errors.New("database unavailable")}
+	suite := NewSuite(Options{Reporters: []Reporter{&rec}}, Tests{
+		"Pass": func(h *H) {},
+	})
+	err := suite.runTests(ioutil.Discard, nil)
+	if err := suite.suiteFinished(ioutil.Discard, err, 0); err != rec.err {
+		t.Errorf("got error %v, want %v", err, rec.err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SetRetries runs the test again up to n more times if it fails,
+// overriding Options.Retries; a negative n disables retries. Only
+// top-level tests are retried. A test which passes on a later attempt
+// is reported as FLAKY instead of PASS, and the output directories of
+// the failed attempts are kept with an ".attempt-N" suffix.
+func (t *H) SetRetries(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retries = n
+	t.retriesSet = true
+}
+
+// Attempt returns the number of the current attempt at the test,
+// starting at 1.
+func (t *H) Attempt() int {
+	return t.attempt
+}
+
+// maxRetries returns how many times the test may be run again.
+func (t *H) maxRetries() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if !t.retriesSet {
+		return t.suite.opts.Retries
+	}
+	if t.retries < 0 {
+		return 0
+	}
+	return t.retries
+}
+
+// retry starts another attempt at a failed top-level test, reporting
+// whether it did. The new attempt takes over signalling the parent.
+func (t *H) retry(fn func(t *H)) bool {
+	if t.level != 1 || !t.Failed() || t.NotRun() || t.expectsFailure() || t.attempt > t.maxRetries() || t.suite.isInterrupted() {
+		return false
+	}
+
+	t.flushLog()
+	header := fmt.Sprintf("--- RETRY: %s (%s)\n", t.name, fmtDuration(t.duration))
+	t.suite.events.output(t.name, []byte(header))
+	p := t.parent
+	p.mu.Lock()
+	fmt.Fprint(p.w, header)
+	t.mu.Lock()
+	io.Copy(p.w, &t.output)
+	t.mu.Unlock()
+	p.mu.Unlock()
+
+	r := p.newChild(t.name, t.signal)
+	r.attempt = t.attempt + 1
+	r.rerun = t.isParallel
+	r.weight = t.weight
+	t.mu.RLock()
+	r.retries, r.retriesSet = t.retries, t.retriesSet
+	r.severity = t.severity
+	t.mu.RUnlock()
+
+	t.suite.dropSubResults(t.name)
+	t.suite.match.forget(t.name)
+	dir := t.suite.testOutputPath(t.name)
+	if _, err := os.Stat(dir); err == nil {
+		old := fmt.Sprintf("%s.attempt-%d", dir, t.attempt)
+		if err := os.Rename(dir, old); err != nil {
+			r.log(fmt.Sprintf("Failed to keep output of attempt %d: %v", t.attempt, err))
+		}
+	}
+
+	r.announce()
+	go tRunner(r, fn)
+	return true
+}
+
+// waitRerun stands in for Parallel in later attempts at a parallel
+// test, and in tests added by AddTest. The parent has already moved on,
+// so the attempt only waits for a free slot, and added tests for the
+// sequential tests to finish.
+func (t *H) waitRerun() {
+	t.isParallel = true
+
+	t.duration += time.Since(t.start)
+	t.mu.Lock()
+	phase := t.endPhase()
+	t.mu.Unlock()
+	t.pauseTimeout()
+	t.pauseWatchdog()
+	t.pauseProfiles()
+
+	t.releaseShared()
+	if t.added {
+		<-t.suite.sequentialDone
+	}
+	t.suite.waitParallel(t.slots())
+	t.acquireShared()
+	t.start = time.Now()
+	t.stopIfFailing()
+	t.resumeTimeout()
+	t.resumeWatchdog()
+	t.startProfiles()
+	if phase != "" {
+		t.Phase(phase)
+	}
+}
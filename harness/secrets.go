@@ -0,0 +1,178 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoSecret is returned by a SecretProvider which doesn't have a
+// secret.
+var ErrNoSecret = errors.New("harness: no such secret")
+
+// redacted replaces the values of secrets in logs.
+const redacted = "[REDACTED]"
+
+// SecretProvider looks up the secrets tests get with H.Secret, such as
+// credentials for external services.
+type SecretProvider interface {
+	// Secret returns the value of the named secret, or ErrNoSecret
+	// if there is no such secret.
+	Secret(name string) (string, error)
+}
+
+// EnvSecrets looks up secrets in environment variables named after them
+// with this prefix, upper case, and with characters other than letters
+// and digits replaced by underscores. With the prefix "KOLA_SECRET_",
+// the secret "aws-token" is in $KOLA_SECRET_AWS_TOKEN.
+type EnvSecrets string
+
+func (p EnvSecrets) Secret(name string) (string, error) {
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	value, ok := os.LookupEnv(string(p) + key)
+	if !ok {
+		return "", ErrNoSecret
+	}
+	return value, nil
+}
+
+// FileSecrets looks up secrets in files named after them in a
+// directory, as mounted by Kubernetes and Docker. A trailing newline is
+// not part of the secret.
+type FileSecrets string
+
+func (d FileSecrets) Secret(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(string(d), name))
+	if os.IsNotExist(err) {
+		return "", ErrNoSecret
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// SecretProviders looks up secrets in each provider in turn, returning
+// the first found.
+type SecretProviders []SecretProvider
+
+func (ps SecretProviders) Secret(name string) (string, error) {
+	for _, p := range ps {
+		value, err := p.Secret(name)
+		if err != ErrNoSecret {
+			return value, err
+		}
+	}
+	return "", ErrNoSecret
+}
+
+// secretLookup is a cached answer from Options.Secrets.
+type secretLookup struct {
+	value string
+	err   error
+}
+
+// secret looks up the named secret in Options.Secrets, remembering its
+// value to redact from logs. Secrets are only looked up once, unless
+// the lookup fails.
+func (s *Suite) secret(name string) (string, error) {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+	if l, ok := s.secrets[name]; ok {
+		return l.value, l.err
+	}
+	if s.opts.Secrets == nil {
+		return "", ErrNoSecret
+	}
+	value, err := s.opts.Secrets.Secret(name)
+	if err != nil && err != ErrNoSecret {
+		return "", err
+	}
+	if s.secrets == nil {
+		s.secrets = make(map[string]secretLookup)
+	}
+	s.secrets[name] = secretLookup{value, err}
+	if err == nil && value != "" {
+		s.secretValues = append(s.secretValues, value)
+	}
+	return value, err
+}
+
+// redact replaces the values of the secrets looked up so far in str.
+func (s *Suite) redact(str string) string {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+	for _, value := range s.secretValues {
+		str = strings.Replace(str, value, redacted, -1)
+	}
+	return str
+}
+
+// redactEntry replaces the values of secrets in the fields of e.
+func (s *Suite) redactEntry(e *logEntry) {
+	for i, v := range e.values {
+		str := fmt.Sprint(v)
+		if r := s.redact(str); r != str {
+			e.values[i] = r
+		}
+	}
+}
+
+// Secret returns the value of the named secret from Options.Secrets,
+// skipping the test if there is no such secret and failing it if the
+// lookup fails. The value is redacted from the logs of all tests from
+// then on.
+func (t *H) Secret(name string) string {
+	value, err := t.suite.secret(name)
+	if err == ErrNoSecret {
+		t.Skipf("Secret %q is not available", name)
+	} else if err != nil {
+		t.Fatalf("Getting secret %q: %v", name, err)
+	}
+	return value
+}
+
+// RequireSecrets skips the test unless all the named secrets are
+// available, listing those which aren't, for tests to declare the
+// secrets they need before doing anything else.
+func (t *H) RequireSecrets(names ...string) {
+	var missing []string
+	for _, name := range names {
+		_, err := t.suite.secret(name)
+		if err == ErrNoSecret {
+			missing = append(missing, name)
+		} else if err != nil {
+			t.Fatalf("Getting secret %q: %v", name, err)
+		}
+	}
+	if len(missing) > 0 {
+		t.Skipf("Missing secrets: %s", strings.Join(missing, ", "))
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvSecrets(t *testing.T) {
+	os.Setenv("HARNESS_TEST_SECRET_AWS_TOKEN_2", "hunter2")
+	defer os.Unsetenv("HARNESS_TEST_SECRET_AWS_TOKEN_2")
+	p := EnvSecrets("HARNESS_TEST_SECRET_")
+	if v, err := p.Secret("aws-token.2"); err != nil || v != "hunter2" {
+		t.Errorf("got %q, %v; want hunter2", v, err)
+	}
+	if _, err := p.Secret("missing"); err != ErrNoSecret {
+		t.Errorf("got %v for a missing secret, want ErrNoSecret", err)
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harness-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "token"), []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := SecretProviders{EnvSecrets("HARNESS_TEST_SECRET_"), FileSecrets(dir)}
+	if v, err := p.Secret("token"); err != nil || v != "hunter2" {
+		t.Errorf("got %q, %v; want hunter2", v, err)
+	}
+	if _, err := p.Secret("missing"); err != ErrNoSecret {
+		t.Errorf("got %v for a missing secret, want ErrNoSecret", err)
+	}
+	for _, name := range []string{"", "../token", ".hidden"} {
+		if _, err := p.Secret(name); err == nil || err == ErrNoSecret {
+			t.Errorf("got %v for invalid name %q", err, name)
+		}
+	}
+}
+
+type mapSecrets map[string]string
+
+func (m mapSecrets) Secret(name string) (string, error) {
+	if v, ok := m[name]; ok {
+		return v, nil
+	}
+	return "", ErrNoSecret
+}
+
+func TestSecret(t *testing.T) {
+	var got string
+	suite := NewSuite(Options{
+		Verbose: true,
+		Secrets: mapSecrets{"token": "hunter2", "user": "alice"},
+	}, Tests{
+		"Use": func(h *H) {
+			got = h.Secret("token")
+			h.Logf("logging in with %s", got)
+			h.Infow("login", "password", got)
+		},
+		"Missing": func(h *H) {
+			h.RequireSecrets("user", "key", "cert")
+			h.Error("not skipped")
+		},
+	})
+	suite.runTests(ioutil.Discard, nil)
+
+	if got != "hunter2" {
+		t.Errorf("got secret %q, want hunter2", got)
+	}
+	for _, r := range suite.Results() {
+		switch r.Name {
+		case "Use":
+			if strings.Contains(r.Output, "hunter2") || !strings.Contains(r.Output, "logging in with "+redacted) ||
+				!strings.Contains(r.Output, "password="+redacted) {
+				t.Errorf("secret not redacted:\n%s", r.Output)
+			}
+		case "Missing":
+			if r.Result != "SKIP" || !strings.Contains(r.Output, "Missing secrets: key, cert") {
+				t.Errorf("got %s, want SKIP for missing secrets:\n%s", r.Result, r.Output)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Severity ranks how much a test failing matters. Tests are Major
+// unless they call H.SetSeverity. Options.FailSeverity decides which
+// failures fail the suite.
+type Severity int
+
+const (
+	Minor Severity = iota + 1
+	Major
+	Critical
+)
+
+var severityNames = map[Severity]string{
+	Minor:    "minor",
+	Major:    "major",
+	Critical: "critical",
+}
+
+// ParseSeverity parses the name of a severity, such as "major".
+func ParseSeverity(s string) (Severity, error) {
+	for sev, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return sev, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q; use critical, major, or minor", s)
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Set implements flag.Value.
+func (s *Severity) Set(value string) error {
+	sev, err := ParseSeverity(value)
+	if err != nil {
+		return err
+	}
+	*s = sev
+	return nil
+}
+
+// Type implements pflag.Value.
+func (s *Severity) Type() string {
+	return "severity"
+}
+
+// MarshalText records severities by name in reports.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	return s.Set(string(text))
+}
+
+// SetSeverity sets the severity of the test and any subtests which
+// don't set their own.
+func (t *H) SetSeverity(s Severity) {
+	if _, ok := severityNames[s]; !ok {
+		panic(fmt.Sprintf("harness: invalid severity %d", int(s)))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.severity = s
+}
+
+// Severity returns the severity of the test, inherited from its parent
+// if not set.
+func (t *H) Severity() Severity {
+	for c := t; c != nil; c = c.parent {
+		c.mu.RLock()
+		s := c.severity
+		c.mu.RUnlock()
+		if s != 0 {
+			return s
+		}
+	}
+	return Major
+}
+
+// countResult tallies a finished top-level test by severity.
+func (s *Suite) countResult(r TestResult) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	counts := s.severities[r.Severity]
+	if counts == nil {
+		counts = make(map[string]int)
+		s.severities[r.Severity] = counts
+	}
+	counts[r.Result]++
+	if r.Result != "FAIL" {
+		s.countBudget(r)
+	} else if r.Quarantined {
+		s.quarantined = append(s.quarantined, r.Name)
+	} else {
+		s.failures++
+		if r.Severity >= s.opts.FailSeverity && !s.countBudget(r) {
+			s.blocking++
+			if s.opts.FailFast && s.failedFast == "" {
+				s.failedFast = r.Name
+				s.cancel()
+			}
+		}
+	}
+}
+
+// reportSeverities breaks down the top-level results by severity,
+// if any test changed its severity or FailSeverity is in use.
+func (s *Suite) reportSeverities(out io.Writer) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	if _, ok := s.severities[Major]; ok && len(s.severities) == 1 && s.opts.FailSeverity == Minor {
+		return
+	}
+	for _, sev := range []Severity{Critical, Major, Minor} {
+		counts, ok := s.severities[sev]
+		if !ok {
+			continue
+		}
+		var parts []string
+		for _, result := range []string{"PASS", "FLAKY", "WARN", "FAIL", "XFAIL", "XPASS", "SKIP", "NOT RUN"} {
+			if n := counts[result]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", n, result))
+			}
+		}
+		note := ""
+		if sev < s.opts.FailSeverity && counts["FAIL"] > 0 {
+			note = " (failures ignored)"
+		}
+		fmt.Fprintf(out, "harness: %s: %s%s\n", sev, strings.Join(parts, ", "), note)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Shard selects the part of a suite run by one of several workers
+// splitting it between them, written "N/M" for the Nth of M shards
+// counting from 1. The zero Shard runs every test.
+//
+// Top-level tests are assigned to shards by a hash of their name, so
+// each worker picks the same tests without coordinating, and a test
+// stays in its shard as others are added or removed.
+type Shard struct {
+	Index int // from 1 to Count
+	Count int
+}
+
+// ParseShard parses a shard written as "N/M".
+func ParseShard(s string) (Shard, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Shard{}, fmt.Errorf("shard %q is not of the form N/M", s)
+	}
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Shard{}, fmt.Errorf("shard %q: %v", s, err)
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Shard{}, fmt.Errorf("shard %q: %v", s, err)
+	}
+	shard := Shard{Index: index, Count: count}
+	if err := shard.validate(); err != nil {
+		return Shard{}, err
+	}
+	return shard, nil
+}
+
+func (s Shard) validate() error {
+	if s == (Shard{}) {
+		return nil
+	}
+	if s.Count < 1 || s.Index < 1 || s.Index > s.Count {
+		return fmt.Errorf("shard %d/%d is out of range; N must be from 1 to M", s.Index, s.Count)
+	}
+	return nil
+}
+
+func (s Shard) String() string {
+	if s == (Shard{}) {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// Set implements flag.Value.
+func (s *Shard) Set(value string) error {
+	if value == "" {
+		*s = Shard{}
+		return nil
+	}
+	shard, err := ParseShard(value)
+	if err != nil {
+		return err
+	}
+	*s = shard
+	return nil
+}
+
+// Type implements pflag.Value.
+func (s *Shard) Type() string {
+	return "shard"
+}
+
+// Contains reports whether the named top-level test is in the shard.
+func (s Shard) Contains(name string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index-1
+}
+
+// Filter returns the tests in the shard.
+func (s Shard) Filter(tests Tests) Tests {
+	if s.Count <= 1 {
+		return tests
+	}
+	shard := make(Tests)
+	for name, test := range tests {
+		if s.Contains(name) {
+			shard[name] = test
+		}
+	}
+	return shard
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Shard
+		ok   bool
+	}{
+		{"1/1", Shard{1, 1}, true},
+		{"3/4", Shard{3, 4}, true},
+		{"0/4", Shard{}, false},
+		{"5/4", Shard{}, false},
+		{"1/0", Shard{}, false},
+		{"1", Shard{}, false},
+		{"a/b", Shard{}, false},
+	} {
+		got, err := ParseShard(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseShard(%q) = %v, %v; want %v, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestShardPartition(t *testing.T) {
+	const shards = 4
+	tests := make(Tests)
+	for i := 0; i < 200; i++ {
+		tests[fmt.Sprintf("coreos.test%d", i)] = func(h *H) {}
+	}
+
+	seen := make(map[string]int)
+	for i := 1; i <= shards; i++ {
+		shard := Shard{i, shards}.Filter(tests)
+		if n := len(shard); n < len(tests)/shards/2 || n > len(tests)/shards*2 {
+			t.Errorf("shard %d/%d has %d of %d tests", i, shards, n, len(tests))
+		}
+		for name := range shard {
+			seen[name]++
+		}
+	}
+	for name := range tests {
+		if seen[name] != 1 {
+			t.Errorf("%s is in %d shards; want 1", name, seen[name])
+		}
+	}
+
+	if n := len(Shard{}.Filter(tests)); n != len(tests) {
+		t.Errorf("zero shard has %d of %d tests", n, len(tests))
+	}
+}
+
+func TestSuiteShard(t *testing.T) {
+	tests := make(Tests)
+	for i := 0; i < 20; i++ {
+		tests[fmt.Sprintf("Test%d", i)] = func(h *H) {}
+	}
+
+	shard := Shard{2, 3}
+	suite := NewSuite(Options{Shard: shard}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	results := suite.Results()
+	if len(results) != len(shard.Filter(tests)) {
+		t.Errorf("ran %d tests; want %d", len(results), len(shard.Filter(tests)))
+	}
+	for _, r := range results {
+		if !shard.Contains(r.Name) {
+			t.Errorf("ran %s from another shard", r.Name)
+		}
+	}
+
+	if err := (&Options{Shard: Shard{4, 3}}).Validate(); err == nil {
+		t.Errorf("Validate accepted shard 4/3")
+	}
+}
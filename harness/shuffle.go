@@ -0,0 +1,59 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// parseShuffle parses Options.Shuffle, returning whether to shuffle and
+// the seed to shuffle with.
+func parseShuffle(value string) (shuffle bool, seed int64, err error) {
+	switch value {
+	case "", "off":
+		return false, 0, nil
+	case "on":
+		return true, time.Now().UnixNano(), nil
+	}
+	seed, err = strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("%q is not off, on, or a seed", value)
+	}
+	return true, seed, nil
+}
+
+// testOrder returns the names of the top-level tests in the order they
+// are started: sorted, or shuffled by the seed in Options.Shuffle.
+func (s *Suite) testOrder() []string {
+	names := make([]string, 0, len(s.tests))
+	for name := range s.tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	shuffle, seed, _ := parseShuffle(s.opts.Shuffle)
+	if !shuffle {
+		return names
+	}
+	shuffled := make([]string, len(names))
+	for i, j := range rand.New(rand.NewSource(seed)).Perm(len(names)) {
+		shuffled[i] = names[j]
+	}
+	return shuffled
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// runOrder runs ten sequential tests, returning the order they ran in
+// and the shuffle seed recorded by the suite.
+func runOrder(t *testing.T, shuffle string) ([]string, string) {
+	var order []string
+	tests := make(Tests)
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("Test%d", i)
+		tests[name] = func(h *H) { order = append(order, name) }
+	}
+	suite := NewSuite(Options{Shuffle: shuffle}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	return order, suite.opts.Shuffle
+}
+
+func TestShuffle(t *testing.T) {
+	sorted, _ := runOrder(t, "off")
+	if !sort.StringsAreSorted(sorted) {
+		t.Errorf("tests ran out of order without shuffling: %v", sorted)
+	}
+
+	first, seed := runOrder(t, "on")
+	if seed == "on" {
+		t.Fatalf("seed was not recorded")
+	}
+	again, _ := runOrder(t, seed)
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("seed %s gave %v, then %v", seed, first, again)
+	}
+
+	shuffled := false
+	for i := 1; i <= 5 && !shuffled; i++ {
+		order, _ := runOrder(t, fmt.Sprint(i))
+		shuffled = !reflect.DeepEqual(order, sorted)
+	}
+	if !shuffled {
+		t.Errorf("shuffling never changed the order")
+	}
+
+	if err := (&Options{Shuffle: "sometimes"}).Validate(); err == nil {
+		t.Errorf("Validate accepted an invalid shuffle")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// slowest returns the n slowest top-level tests that ran, slowest
+// first, and how long all of them took together.
+func (s *Suite) slowest(n int) ([]TestResult, time.Duration) {
+	var tests []TestResult
+	var total time.Duration
+	for _, r := range s.Results() {
+		if strings.Contains(r.Name, "/") || r.Result == "NOT RUN" {
+			continue
+		}
+		tests = append(tests, r)
+		total += r.Duration
+	}
+	sort.Sort(bySlowest(tests))
+	if len(tests) > n {
+		tests = tests[:n]
+	}
+	return tests, total
+}
+
+type bySlowest []TestResult
+
+func (b bySlowest) Len() int      { return len(b) }
+func (b bySlowest) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b bySlowest) Less(i, j int) bool {
+	if b[i].Duration != b[j].Duration {
+		return b[i].Duration > b[j].Duration
+	}
+	return b[i].Name < b[j].Name
+}
+
+// reportSlowest lists the slowest tests and compares the time all tests
+// took to the elapsed time of the suite, to show how much running them
+// in parallel saved. The list is written to out and as comments to tap.
+func (s *Suite) reportSlowest(elapsed time.Duration, out, tap io.Writer) {
+	if s.opts.Slowest <= 0 {
+		return
+	}
+	tests, total := s.slowest(s.opts.Slowest)
+	if len(tests) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "harness: %d slowest tests:\n", len(tests))
+	tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, r := range tests {
+		fmt.Fprintf(tw, "\t%s\t  %s\n", fmtDuration(r.Duration), r.Name)
+	}
+	tw.Flush()
+	fmt.Fprintf(&buf, "harness: tests took %s in total over %s of wall-clock time", fmtDuration(total), fmtDuration(elapsed))
+	if elapsed > 0 {
+		fmt.Fprintf(&buf, " (%.1fx)", total.Seconds()/elapsed.Seconds())
+	}
+	fmt.Fprintf(&buf, "\n")
+
+	out.Write(buf.Bytes())
+	if tap != nil {
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			fmt.Fprintf(tap, "# %s\n", scanner.Text())
+		}
+	}
+}
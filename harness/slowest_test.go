@@ -0,0 +1,70 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowest(t *testing.T) {
+	suite := NewSuite(Options{Slowest: 2}, Tests{
+		"Fast": func(h *H) {},
+		"Slow": func(h *H) {
+			h.Run("Sub", func(h *H) { time.Sleep(40 * time.Millisecond) })
+		},
+		"Slower": func(h *H) { time.Sleep(60 * time.Millisecond) },
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatalf("suite failed: %v", err)
+	}
+
+	var out, tap bytes.Buffer
+	suite.reportSlowest(time.Second, &out, &tap)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4:\n%s", len(lines), out.String())
+	}
+	if lines[0] != "harness: 2 slowest tests:" {
+		t.Errorf("got header %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "  Slower") || !strings.HasSuffix(lines[2], "  Slow") {
+		t.Errorf("got slowest tests:\n%s\n%s\nwant Slower then Slow", lines[1], lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "harness: tests took 0.1") || !strings.HasSuffix(lines[3], " over 1.00s of wall-clock time (0.1x)") {
+		t.Errorf("got total %q", lines[3])
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(tap.String(), "\n"), "\n") {
+		if !strings.HasPrefix(line, "# ") {
+			t.Errorf("TAP line %q isn't a comment", line)
+		}
+	}
+}
+
+func TestSlowestDisabled(t *testing.T) {
+	suite := NewSuite(Options{}, Tests{
+		"Pass": func(h *H) {},
+	})
+	suite.runTests(ioutil.Discard, nil)
+
+	var out bytes.Buffer
+	suite.reportSlowest(time.Second, &out, nil)
+	if out.Len() != 0 {
+		t.Errorf("got output %q with Slowest unset", out.String())
+	}
+}
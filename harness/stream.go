@@ -0,0 +1,236 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBacklog is the number of lines replayed to new clients.
+	streamBacklog = 10000
+	// streamBuffer is the number of lines a client may fall behind
+	// before it is disconnected.
+	streamBuffer = 1024
+)
+
+// streamPage is a minimal viewer for the event stream.
+const streamPage = `<!DOCTYPE html>
+<html>
+<head><title>harness</title></head>
+<body>
+<pre id="out"></pre>
+<script>
+var out = document.getElementById("out");
+var src = new EventSource("events");
+src.onmessage = function(e) {
+	var follow = window.innerHeight + window.scrollY >= document.body.offsetHeight;
+	out.appendChild(document.createTextNode(e.data + "\n"));
+	if (follow) window.scrollTo(0, document.body.scrollHeight);
+};
+src.addEventListener("done", function() {
+	out.appendChild(document.createTextNode("[suite finished]\n"));
+	src.close();
+});
+</script>
+</body>
+</html>
+`
+
+// stream copies suite output to HTTP clients as server-sent events.
+// Clients that connect late are sent recent output first.
+type stream struct {
+	mu      sync.Mutex
+	backlog []string
+	clients map[chan string]bool
+	done    bool
+}
+
+func newStream() *stream {
+	return &stream{clients: make(map[chan string]bool)}
+}
+
+// Write sends each line to clients. It expects whole lines, as given
+// by output.
+func (st *stream) Write(p []byte) (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		st.send(line)
+	}
+	return len(p), nil
+}
+
+// send delivers a line to every client, disconnecting any that have
+// fallen too far behind. st.mu must be held.
+func (st *stream) send(line string) {
+	st.backlog = append(st.backlog, line)
+	if len(st.backlog) > streamBacklog {
+		st.backlog = st.backlog[len(st.backlog)-streamBacklog:]
+	}
+	for c := range st.clients {
+		select {
+		case c <- line:
+		default:
+			delete(st.clients, c)
+			close(c)
+		}
+	}
+}
+
+// close ends every client's stream.
+func (st *stream) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for c := range st.clients {
+		delete(st.clients, c)
+		close(c)
+	}
+	st.done = true
+}
+
+// subscribe returns the backlog and a channel of later lines, which is
+// closed when the suite finishes or the client falls behind.
+func (st *stream) subscribe() ([]string, chan string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c := make(chan string, streamBuffer)
+	if st.done {
+		close(c)
+	} else {
+		st.clients[c] = true
+	}
+	return append([]string(nil), st.backlog...), c
+}
+
+func (st *stream) unsubscribe(c chan string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.clients[c] {
+		delete(st.clients, c)
+		close(c)
+	}
+}
+
+// ServeHTTP streams output as server-sent events, one line per event.
+// A "done" event is sent when the suite finishes.
+func (st *stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	backlog, c := st.subscribe()
+	defer st.unsubscribe(c)
+	for _, line := range backlog {
+		fmt.Fprintf(w, "data: %s\n\n", line)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case line, ok := <-c:
+			if !ok {
+				st.mu.Lock()
+				done := st.done
+				st.mu.Unlock()
+				if done {
+					fmt.Fprint(w, "event: done\ndata:\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", line)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// suiteStatus is the JSON served at /status.
+type suiteStatus struct {
+	Running []runningTest
+	Results []TestResult
+}
+
+type runningTest struct {
+	Name  string
+	Start time.Time
+}
+
+func (s *Suite) serveStatus(w http.ResponseWriter, r *http.Request) {
+	s.resultsMu.Lock()
+	status := suiteStatus{
+		Running: make([]runningTest, 0, len(s.active)),
+		Results: append([]TestResult{}, s.results...),
+	}
+	names := make([]string, 0, len(s.active))
+	for name := range s.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		status.Running = append(status.Running, runningTest{name, s.active[name]})
+	}
+	s.resultsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveStream starts an HTTP server on Options.StreamAddr serving a live
+// view of the suite's output at /, the raw event stream at /events, and
+// running and finished tests at /status, noting its address in out. The
+// returned function stops the server once clients have been told the
+// suite is done.
+func (s *Suite) serveStream(st *stream, out io.Writer) (func(), error) {
+	l, err := net.Listen("tcp", s.opts.StreamAddr)
+	if err != nil {
+		return nil, fmt.Errorf("harness: can't listen for output stream: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, streamPage)
+	})
+	mux.Handle("/events", st)
+	mux.HandleFunc("/status", s.serveStatus)
+
+	fmt.Fprintf(out, "harness: streaming output at http://%s/\n", l.Addr())
+	go http.Serve(l, mux)
+	return func() {
+		st.close()
+		l.Close()
+	}, nil
+}
@@ -16,28 +16,39 @@
 package harness
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
 	"runtime/trace"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/coreos/mantle/system/exec"
 )
 
 const (
-	defaultOutputDir = "_harness_temp"
+	defaultOutputDir   = "_harness_temp"
+	defaultGracePeriod = time.Minute
 )
 
 var (
 	SuiteEmpty  = errors.New("harness: no tests to run")
 	SuiteFailed = errors.New("harness: test suite failed")
+
+	// SuiteInterrupted is returned by Run if the suite was stopped
+	// by SIGINT or SIGTERM.
+	SuiteInterrupted = errors.New("harness: test suite interrupted")
 )
 
 // Options
@@ -51,6 +62,20 @@ type Options struct {
 	// Run only tests matching a regexp.
 	Match string
 
+	// Tags of the top-level tests by name, such as "slow" or
+	// "reboot". See H.Tags.
+	TestTags map[string][]string
+
+	// Run only top-level tests whose tags match an expression such
+	// as "network && !slow || reboot": alternatives separated by
+	// "||" of tags separated by "&&", each of which the test must
+	// have, or not have if prefixed by "!".
+	TagMatch string
+
+	// List the names and tags of the top-level tests which would run
+	// and match a regexp, instead of running anything.
+	List string
+
 	// Enable memory profiling.
 	MemProfile     bool
 	MemProfileRate int
@@ -58,6 +83,18 @@ type Options struct {
 	// Enable CPU profiling.
 	CpuProfile bool
 
+	// Write a CPU profile of each top-level test to cpu.prof in its
+	// output directory. The profiler covers the whole process and can
+	// only profile one test at a time, so tests starting while another
+	// is profiled are not; samples are labelled with the test they
+	// were taken in. Run one test at a time to profile them all.
+	TestCpuProfile bool
+
+	// Write heap profiles taken as each top-level test starts and
+	// finishes to heap-start.prof and heap.prof in its output
+	// directory, to compare with `go tool pprof -base`.
+	TestMemProfile bool
+
 	// Enable goroutine block profiling.
 	BlockProfile     bool
 	BlockProfileRate int
@@ -68,8 +105,186 @@ type Options struct {
 	// Panic Suite execution after a timeout (0 means unlimited).
 	Timeout time.Duration
 
+	// Fail each top-level test that runs for longer than this (0 means
+	// unlimited). See H.SetTimeout.
+	TestTimeout time.Duration
+
 	// Limit number of tests to run in parallel (0 means GOMAXPROCS).
 	Parallel int
+
+	// Collapse consecutive identical log messages into a single
+	// "last message repeated N times" line.
+	CollapseLogs bool
+
+	// Limit log messages per second for each test (0 means unlimited).
+	LogRate int
+
+	// Drop messages logged below this level with H.Debug, H.Info,
+	// and friends. The default is LevelInfo.
+	LogLevel Level
+
+	// Prefix log lines with the time they were logged: "rfc3339"
+	// for the date and time, or "relative" for the time since the
+	// test started. Empty or "off" leaves them out.
+	LogTimestamps string
+
+	// Cgroup v2 directory in which to create a cgroup for each test's
+	// helper processes. See H.Cgroup.
+	Cgroup string
+
+	// Limit the CPUs each test's cgroup may use (0 means unlimited).
+	CPUQuota float64
+
+	// Restrict each test's cgroup to a list of CPUs, such as "2-7".
+	CPUSet string
+
+	// Limit subprocesses started through H.Procs across all tests
+	// (0 means unlimited).
+	MaxProcs int
+
+	// Serve live test output and status over HTTP on this address,
+	// such as "localhost:8080". Disabled if empty.
+	StreamAddr string
+
+	// Save the goroutine stacks of a test to its output directory
+	// once neither it nor its subtests have logged anything for
+	// this long, to help diagnose hangs (0 means disabled). Time
+	// spent waiting to run does not count.
+	Watchdog time.Duration
+
+	// Also fail tests found stalled by Watchdog and cancel their
+	// contexts.
+	WatchdogKill bool
+
+	// Print a line of how many tests are running, finished, and
+	// queued, and how long the running ones have taken, this often
+	// (0 means disabled).
+	Progress time.Duration
+
+	// How long top-level tests usually take, such as their mean
+	// duration in past runs, by name. Progress lines estimate how long
+	// the suite has left from these, using the mean duration of the
+	// tests finished so far for tests not listed, and point out tests
+	// running for longer than expected.
+	ExpectedDurations map[string]time.Duration
+
+	// Once the suite finishes, list this many of the slowest top-level
+	// tests and compare the time all tests took to that of the whole
+	// run, in the log and as comments ending the TAP log (0 means
+	// disabled).
+	Slowest int
+
+	// Stop starting tests once this many have failed, reporting the
+	// rest as not run (0 means unlimited).
+	MaxFailures int
+
+	// Stop starting tests once a test fails the suite, reporting the
+	// rest as not run, and cancel the contexts of running tests so
+	// they can abort early. See H.Context.
+	FailFast bool
+
+	// On SIGINT or SIGTERM, stop starting tests and cancel the contexts
+	// of running tests, as FailFast does, then wait this long for them
+	// to clean up before reporting them as interrupted (0 means one
+	// minute). A second signal stops waiting at once.
+	GracePeriod time.Duration
+
+	// Run failed top-level tests again up to this many times. Tests
+	// which pass on a later attempt are reported as "FLAKY". See
+	// H.SetRetries.
+	Retries int
+
+	// Run each top-level test this many times, to reproduce flaky
+	// failures and measure how often they happen. Later runs are named
+	// "Name#01", "Name#02", and so on, and how often each test passed
+	// and how long it took is listed once the suite finishes.
+	Count int
+
+	// Run the repeats of each test asked for by Count in parallel, as
+	// if every test called H.Parallel.
+	CountParallel bool
+
+	// Start top-level tests in a random order if "on" or the order
+	// given by an integer seed, to find tests which depend on the
+	// state left by others; "off" or empty starts them sorted by
+	// name. The seed used is printed so the order can be repeated.
+	Shuffle string
+
+	// Run only the top-level tests in this shard of the suite, so
+	// the suite can be split between several machines. See Shard.
+	Shard Shard
+
+	// Run each benchmark for this long or this many iterations;
+	// zero means one second. See Benchmark.
+	BenchTime BenchTime
+
+	// Report the allocations of every benchmark. See B.ReportAllocs.
+	BenchMem bool
+
+	// Directory holding the tests' data files, such as golden files;
+	// default "testdata". See H.DataDir.
+	DataDir string
+
+	// Replace golden files with what the tests got rather than
+	// comparing them. See H.MatchGolden.
+	UpdateGolden bool
+
+	// Only failures of tests with at least this severity fail the
+	// suite; zero means Minor, so any failure does. See H.SetSeverity.
+	FailSeverity Severity
+
+	// Failures of these top-level tests and their subtests don't fail
+	// the suite. See Quarantine.
+	Quarantine Quarantine
+
+	// Tolerate this many failures of top-level tests before failing
+	// the suite. See FailureBudget.
+	FailureBudget FailureBudget
+
+	// SuiteSetup, if set, is run as a top-level test named
+	// "SuiteSetup" before any others, whatever Match is. If it fails
+	// the other tests are reported as not run.
+	SuiteSetup func(h *H)
+
+	// SuiteTeardown, if set, is run as a top-level test named
+	// "SuiteTeardown" once all others have finished, even if
+	// SuiteSetup failed, so it can undo a partial setup.
+	SuiteTeardown func(h *H)
+
+	// OnFailure is called with the test's name and output directory
+	// when a test or subtest first fails, while the test is still
+	// running, so the host can collect extra data about it. It is
+	// called from the goroutine that failed the test and delays the
+	// test until it returns.
+	OnFailure func(testName, outputDir string)
+
+	// Write `go test -json` events to this file, or to standard output
+	// in place of the usual report if "-". Disabled if empty.
+	JSONFile string
+
+	// Outputs are given the suite's output, one or more whole lines
+	// at a time, along with standard output, test.log in OutputDir,
+	// and the stream served at StreamAddr. A sink which returns an
+	// error is given no further output.
+	Outputs []io.Writer
+
+	// Write a JUnit XML report of the results to this file, for CI
+	// systems that don't understand TAP. Disabled if empty.
+	JUnitFile string
+
+	// Also report the start and result of each test to these, after
+	// the TAP log, JSON events, and JUnit report.
+	Reporters []Reporter
+
+	// Look up the secrets tests get with H.Secret here. Tests needing
+	// secrets are skipped if nil.
+	Secrets SecretProvider
+
+	// Version of the program running the suite and any Properties of
+	// the run, such as the program's own flags, are recorded in the
+	// reports along with the options. See Suite.Config.
+	Version    string
+	Properties map[string]string
 }
 
 // FlagSet can be used to setup options via command line flags.
@@ -85,12 +300,20 @@ func (o *Options) FlagSet(prefix string, errorHandling flag.ErrorHandling) *flag
 		"verbose: print additional output")
 	f.StringVar(&o.Match, prefix+"run", o.Match,
 		"run only tests matching `regexp`")
+	f.StringVar(&o.TagMatch, prefix+"tags", o.TagMatch,
+		"run only tests whose tags match `expr`, such as 'network && !slow'")
+	f.StringVar(&o.List, prefix+"list", o.List,
+		"list the tests which would run matching `regexp` without running them")
 	f.BoolVar(&o.MemProfile, prefix+"memprofile", o.MemProfile,
 		"write a memory profile to 'dir/mem.prof'")
 	f.IntVar(&o.MemProfileRate, prefix+"memprofilerate", o.MemProfileRate,
 		"set memory profiling `rate` (see runtime.MemProfileRate)")
 	f.BoolVar(&o.CpuProfile, prefix+"cpuprofile", o.CpuProfile,
 		"write a cpu profile to 'dir/cpu.prof'")
+	f.BoolVar(&o.TestCpuProfile, prefix+"testcpuprofile", o.TestCpuProfile,
+		"write a cpu profile of each test to cpu.prof in its output directory")
+	f.BoolVar(&o.TestMemProfile, prefix+"testmemprofile", o.TestMemProfile,
+		"write heap profiles from the start and end of each test to its output directory")
 	f.BoolVar(&o.BlockProfile, prefix+"blockprofile", o.BlockProfile,
 		"write a goroutine blocking profile to 'dir/block.prof'")
 	f.IntVar(&o.BlockProfileRate, prefix+"blockprofilerate", o.BlockProfileRate,
@@ -99,8 +322,70 @@ func (o *Options) FlagSet(prefix string, errorHandling flag.ErrorHandling) *flag
 		"write an execution trace to 'dir/exec.trace'")
 	f.DurationVar(&o.Timeout, prefix+"timeout", o.Timeout,
 		"fail test binary execution after duration `d` (0 means unlimited)")
+	f.DurationVar(&o.TestTimeout, prefix+"testtimeout", o.TestTimeout,
+		"fail each test after duration `d` (0 means unlimited)")
+	f.DurationVar(&o.Watchdog, prefix+"watchdog", o.Watchdog,
+		"save goroutine stacks of tests with no output for duration `d` (0 means disabled)")
+	f.BoolVar(&o.WatchdogKill, prefix+"watchdogkill", o.WatchdogKill,
+		"fail tests found stalled by the watchdog")
+	f.DurationVar(&o.Progress, prefix+"progress", o.Progress,
+		"print the progress of the suite every duration `d` (0 means disabled)")
+	f.IntVar(&o.Slowest, prefix+"slowest", o.Slowest,
+		"list the `n` slowest tests once the suite finishes")
 	f.IntVar(&o.Parallel, prefix+"parallel", o.Parallel,
 		"run at most `n` tests in parallel")
+	f.BoolVar(&o.CollapseLogs, prefix+"collapselogs", o.CollapseLogs,
+		"collapse repeated log messages")
+	f.IntVar(&o.LogRate, prefix+"lograte", o.LogRate,
+		"log at most `n` messages per second for each test (0 means unlimited)")
+	f.Var(&o.LogLevel, prefix+"loglevel",
+		"drop leveled messages below `level`: debug, info, or warn")
+	f.StringVar(&o.LogTimestamps, prefix+"logtimestamps", o.LogTimestamps,
+		"prefix log lines with `format` timestamps: off, rfc3339, or relative")
+	f.StringVar(&o.Cgroup, prefix+"cgroup", o.Cgroup,
+		"create a cgroup for each test's helper processes under `dir`")
+	f.Float64Var(&o.CPUQuota, prefix+"cpuquota", o.CPUQuota,
+		"limit each test's cgroup to `n` CPUs (0 means unlimited)")
+	f.StringVar(&o.CPUSet, prefix+"cpuset", o.CPUSet,
+		"restrict each test's cgroup to `cpus`")
+	f.IntVar(&o.MaxProcs, prefix+"maxprocs", o.MaxProcs,
+		"run at most `n` test subprocesses at once (0 means unlimited)")
+	f.StringVar(&o.StreamAddr, prefix+"streamaddr", o.StreamAddr,
+		"serve live output and status over HTTP on `addr`")
+	f.IntVar(&o.MaxFailures, prefix+"maxfailures", o.MaxFailures,
+		"stop starting tests after `n` have failed (0 means unlimited)")
+	f.BoolVar(&o.FailFast, prefix+"failfast", o.FailFast,
+		"stop the suite at the first failed test, cancelling running tests")
+	f.DurationVar(&o.GracePeriod, prefix+"grace", o.GracePeriod,
+		"when interrupted, wait `d` for running tests to clean up")
+	f.IntVar(&o.Retries, prefix+"retries", o.Retries,
+		"run failed tests again up to `n` times")
+	f.IntVar(&o.Count, prefix+"count", o.Count,
+		"run each test `n` times")
+	f.BoolVar(&o.CountParallel, prefix+"count-parallel", o.CountParallel,
+		"run the repeats of each test in parallel")
+	f.StringVar(&o.Shuffle, prefix+"shuffle", o.Shuffle,
+		"start tests in random order: `off`, on, or the seed of an earlier shuffled run")
+	f.Var(&o.Shard, prefix+"shard",
+		"run only shard `N/M` of the tests, for splitting them between M machines")
+	f.Var(&o.BenchTime, prefix+"benchtime",
+		"run each benchmark for duration `d`, or Nx for N iterations")
+	f.BoolVar(&o.BenchMem, prefix+"benchmem", o.BenchMem,
+		"report the memory allocations of benchmarks")
+	f.StringVar(&o.DataDir, prefix+"datadir", o.DataDir,
+		"read test data files such as golden files from `dir`")
+	f.BoolVar(&o.UpdateGolden, prefix+"update", o.UpdateGolden,
+		"update golden files instead of comparing with them")
+	f.Var(&o.FailSeverity, prefix+"failseverity",
+		"only fail the suite for failed tests of at least this `severity`")
+	f.Var(&o.Quarantine, prefix+"quarantine",
+		"comma-separated `tests` whose failures don't fail the suite")
+	f.Var(&o.FailureBudget, prefix+"failbudget",
+		"only fail the suite if more than `N`, or N%, of the tests fail, optionally only counting tests matching N:tags")
+	f.StringVar(&o.JSONFile, prefix+"json", o.JSONFile,
+		"write go test -json events to `file`, or - for stdout")
+	f.StringVar(&o.JUnitFile, prefix+"junitfile", o.JUnitFile,
+		"write a JUnit XML report to `file`")
 	return f
 }
 
@@ -109,6 +394,9 @@ func (o *Options) init() {
 	if o.OutputDir == "" {
 		o.OutputDir = defaultOutputDir
 	}
+	if o.DataDir == "" {
+		o.DataDir = defaultDataDir
+	}
 	if o.MemProfileRate < 1 {
 		o.MemProfileRate = runtime.MemProfileRate
 	}
@@ -118,6 +406,237 @@ func (o *Options) init() {
 	if o.Parallel < 1 {
 		o.Parallel = runtime.GOMAXPROCS(0)
 	}
+	if o.LogRate < 0 {
+		o.LogRate = 0
+	}
+	if o.CPUQuota < 0 {
+		o.CPUQuota = 0
+	}
+	if o.MaxProcs < 0 {
+		o.MaxProcs = 0
+	}
+	if o.MaxFailures < 0 {
+		o.MaxFailures = 0
+	}
+	if o.GracePeriod == 0 {
+		o.GracePeriod = defaultGracePeriod
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	}
+	if o.Count < 1 {
+		o.Count = 1
+	}
+	if o.BenchTime.validate() != nil || o.BenchTime == (BenchTime{}) {
+		o.BenchTime = BenchTime{D: time.Second}
+	}
+	if _, ok := severityNames[o.FailSeverity]; !ok {
+		o.FailSeverity = Minor
+	}
+	if _, ok := levelNames[o.LogLevel]; !ok {
+		o.LogLevel = LevelInfo
+	}
+}
+
+// cpuSetRegexp matches a cgroup cpuset list, such as "0-3,6".
+var cpuSetRegexp = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+
+// OptionsError lists every problem found by Options.Validate.
+type OptionsError struct {
+	Problems []string
+}
+
+func (e *OptionsError) Error() string {
+	return "harness: invalid options:\n\t" + strings.Join(e.Problems, "\n\t")
+}
+
+// Validate checks the options for values which are out of range,
+// conflict with each other, or refer to paths that cannot be used,
+// reporting all problems at once as an *OptionsError. Zero values are
+// valid and replaced with defaults.
+func (o *Options) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, pattern := range splitRegexp(o.Match) {
+		if _, err := regexp.Compile(rewrite(pattern)); err != nil {
+			add("run: invalid regexp %q: %v", pattern, err)
+		}
+	}
+	if _, err := parseTagExpr(o.TagMatch); err != nil {
+		add("tags: %v", err)
+	}
+	if _, err := regexp.Compile(o.List); err != nil {
+		add("list: invalid regexp %q: %v", o.List, err)
+	}
+
+	if o.OutputDir != "" {
+		dir := filepath.Clean(o.OutputDir)
+		if dir == "." {
+			add("outputdir: must not be the current directory")
+		} else if fi, err := os.Stat(filepath.Dir(dir)); err != nil {
+			add("outputdir: parent directory of %q: %v", dir, err)
+		} else if !fi.IsDir() {
+			add("outputdir: parent of %q is not a directory", dir)
+		} else if _, err := os.Stat(dir); err == nil && !outputDirRemovable(dir) {
+			add("outputdir: %q already exists and is not a harness directory; remove it or name it like _foo_temp", dir)
+		}
+	}
+
+	if o.Parallel < 0 {
+		add("parallel: %d is negative; use 0 for GOMAXPROCS", o.Parallel)
+	}
+	if o.Timeout < 0 {
+		add("timeout: %v is negative; use 0 for unlimited", o.Timeout)
+	}
+	if o.TestTimeout < 0 {
+		add("testtimeout: %v is negative; use 0 for unlimited", o.TestTimeout)
+	}
+	if o.Watchdog < 0 {
+		add("watchdog: %v is negative; use 0 to disable", o.Watchdog)
+	}
+	if o.Progress < 0 {
+		add("progress: %v is negative; use 0 to disable", o.Progress)
+	}
+	if o.Slowest < 0 {
+		add("slowest: %d is negative; use 0 to disable", o.Slowest)
+	}
+	if o.TestCpuProfile && o.CpuProfile {
+		add("testcpuprofile: can't be used with cpuprofile")
+	}
+	if o.LogRate < 0 {
+		add("lograte: %d is negative; use 0 for unlimited", o.LogRate)
+	}
+	if _, ok := levelNames[o.LogLevel]; !ok && o.LogLevel != 0 {
+		add("loglevel: %v is not debug, info, or warn", o.LogLevel)
+	}
+	if err := validateTimestamps(o.LogTimestamps); err != nil {
+		add("logtimestamps: %v", err)
+	}
+	if o.MaxProcs < 0 {
+		add("maxprocs: %d is negative; use 0 for unlimited", o.MaxProcs)
+	}
+	if o.MaxFailures < 0 {
+		add("maxfailures: %d is negative; use 0 for unlimited", o.MaxFailures)
+	}
+	if o.GracePeriod < 0 {
+		add("grace: %v is negative", o.GracePeriod)
+	}
+	if o.Retries < 0 {
+		add("retries: %d is negative", o.Retries)
+	}
+	if o.Count < 0 {
+		add("count: %d is negative", o.Count)
+	}
+	if _, _, err := parseShuffle(o.Shuffle); err != nil {
+		add("shuffle: %v", err)
+	}
+	if err := o.Shard.validate(); err != nil {
+		add("shard: %v", err)
+	}
+	if err := o.BenchTime.validate(); err != nil {
+		add("benchtime: %v", err)
+	}
+	if _, ok := severityNames[o.FailSeverity]; !ok && o.FailSeverity != 0 {
+		add("failseverity: %v is not critical, major, or minor", o.FailSeverity)
+	}
+	if err := o.FailureBudget.validate(); err != nil {
+		add("failbudget: %v", err)
+	}
+
+	if o.CPUQuota < 0 {
+		add("cpuquota: %v is negative; use 0 for unlimited", o.CPUQuota)
+	} else if o.CPUQuota > 0 && o.Cgroup == "" {
+		add("cpuquota: requires cgroup")
+	}
+	if o.CPUSet != "" {
+		if !cpuSetRegexp.MatchString(o.CPUSet) {
+			add("cpuset: %q is not a list of CPUs such as \"0-3,6\"", o.CPUSet)
+		}
+		if o.Cgroup == "" {
+			add("cpuset: requires cgroup")
+		}
+	}
+	if o.Cgroup != "" {
+		if fi, err := os.Stat(o.Cgroup); err != nil {
+			add("cgroup: %v", err)
+		} else if !fi.IsDir() {
+			add("cgroup: %q is not a directory", o.Cgroup)
+		}
+	}
+
+	if o.StreamAddr != "" {
+		if _, _, err := net.SplitHostPort(o.StreamAddr); err != nil {
+			add("streamaddr: %v", err)
+		}
+	}
+
+	for flag, file := range map[string]string{
+		"json":      o.JSONFile,
+		"junitfile": o.JUnitFile,
+	} {
+		if file == "" || file == "-" && flag == "json" {
+			continue
+		}
+		dir := filepath.Dir(file)
+		if fi, err := os.Stat(dir); err != nil {
+			add("%s: %v", flag, err)
+		} else if !fi.IsDir() {
+			add("%s: %q is not a directory", flag, dir)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &OptionsError{Problems: problems}
+	}
+	return nil
+}
+
+// TestResult describes the outcome of a single test or subtest.
+type TestResult struct {
+	Name     string
+	Result   string // One of "PASS", "FLAKY", "WARN", "FAIL", "XFAIL", "XPASS", "SKIP", or "NOT RUN".
+	Severity Severity
+	Attempts int // Times the test was run, more than one if retried.
+	Start    time.Time
+	Duration time.Duration
+	Phases   []PhaseResult // Phases marked with H.Phase, in order.
+	Output   string        `json:"-"` // Log of the test, including its subtests.
+
+	// Benchmark is the result of a test made by Benchmark, if it ran
+	// to completion.
+	Benchmark *BenchmarkResult `json:",omitempty"`
+
+	// Quarantined is set if the test is in Options.Quarantine, so
+	// its failure didn't fail the suite.
+	Quarantined bool `json:",omitempty"`
+
+	// ExpectedFailure is the reason given to H.ExpectFailure, if the
+	// test or its parent was expected to fail.
+	ExpectedFailure string `json:",omitempty"`
+
+	// Attachments are the files saved by H.Attach and H.AttachFile.
+	Attachments []Attachment `json:",omitempty"`
+
+	// Params are the parameters given to the test, or one of its
+	// parents, by H.RunMatrix.
+	Params []Property `json:",omitempty"`
+
+	// Interrupted is set if the test was running when the suite was
+	// interrupted, so it may not have finished of its own accord.
+	Interrupted bool `json:",omitempty"`
+
+	// Panicked is set if the test function panicked. The panic and
+	// its stack are in Output.
+	Panicked bool `json:",omitempty"`
+}
+
+// PhaseResult records the time a test spent in a named phase.
+type PhaseResult struct {
+	Name     string
+	Duration time.Duration
 }
 
 // Suite is a type passed to a TestMain function to run the actual tests.
@@ -127,59 +646,199 @@ type Suite struct {
 	tests Tests
 	match *matcher
 
+	// repeats maps the names of the later runs of each test asked for
+	// by Options.Count to the name of the test.
+	repeats map[string]string
+
 	// mu protects the following fields which are used to manage
 	// parallel test execution.
 	mu sync.Mutex
 
-	// Channel used to signal tests that are ready to be run in parallel.
-	startParallel chan bool
-
-	// running is the number of tests currently running in parallel.
+	// running is the total weight of tests currently running in parallel.
 	// This does not include tests that are waiting for subtests to complete.
 	running int
 
-	// waiting is the number tests waiting to be run in parallel.
-	waiting int
+	// waiting are the tests waiting to be run in parallel, in order.
+	waiting []*parallelWaiter
+
+	// exclusive is held for reading by running tests and for writing
+	// by tests that called H.Exclusive.
+	exclusive sync.RWMutex
+
+	// watchMu protects watched, the top-level tests under the watchdog.
+	watchMu sync.Mutex
+	watched map[*H]bool
+
+	// profileMu protects profiled, the test holding the CPU profiler
+	// for Options.TestCpuProfile.
+	profileMu sync.Mutex
+	profiled  *H
+
+	// reportersMu serializes calls to reporters, which receive the
+	// start and end of each test.
+	reportersMu sync.Mutex
+	reporters   []Reporter
+
+	// secretsMu protects secrets, the lookups made in
+	// Options.Secrets, and secretValues, the values found, which are
+	// redacted from logs.
+	secretsMu    sync.Mutex
+	secrets      map[string]secretLookup
+	secretValues []string
+
+	// addedMu protects added, the names of the tests added by
+	// H.AddTest, and addedWG counts those still running. They start
+	// once sequentialDone is closed, after the sequential top-level
+	// tests, as subtests of root.
+	addedMu        sync.Mutex
+	added          map[string]bool
+	addedWG        sync.WaitGroup
+	sequentialDone chan struct{}
+	root           *H
+
+	// resourcesMu protects resources, the locks taken by H.Lock.
+	resourcesMu sync.Mutex
+	resources   map[string]*sync.Mutex
+
+	// config is recorded when the suite starts running.
+	config Config
+
+	// setupFailed is set if Options.SuiteSetup failed, before any
+	// other tests start.
+	setupFailed bool
+
+	// ctx is the parent of the top-level tests' contexts, cancelled
+	// by Options.FailFast or an interrupt.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// resultsMu protects results, which records each finished test,
+	// active, the start time of each running test, severities, the
+	// top-level results of each severity, failures, the number of
+	// top-level tests that have failed, blocking, the number of
+	// those which fail the suite, failedFast, the test which
+	// stopped the suite under Options.FailFast, quarantined, the
+	// failed tests in Options.Quarantine, budgeted, the failed tests
+	// covered by Options.FailureBudget, budgetRun, the number of
+	// covered tests which ran, interrupted, the signal which stopped
+	// the suite, interruptedTests, the tests running at the time, and
+	// abandoned, those given up on after Options.GracePeriod.
+	resultsMu   sync.Mutex
+	results     []TestResult
+	active      map[string]time.Time
+	severities  map[Severity]map[string]int
+	failures    int
+	blocking    int
+	failedFast  string
+	quarantined []string
+	budgeted    []string
+	budgetRun   int
+
+	interrupted      string
+	interruptedTests map[string]bool
+	abandoned        map[string]bool
+
+	// abandon is closed once the suite stops waiting for interrupted
+	// tests.
+	abandon     chan struct{}
+	abandonOnce sync.Once
+
+	// events receives `go test -json` events, if enabled.
+	events *eventWriter
+
+	// procs limits subprocesses across all tests, if set.
+	procs *exec.Limiter
+
+	// dirsMu protects the mapping between tests and output directories.
+	dirsMu   sync.Mutex
+	testDirs map[string]string // test name to directory
+	dirTests map[string]string // directory to test name
+
+	// err is set if the options given to NewSuite are invalid.
+	err error
+}
+
+// parallelWaiter is a test waiting for enough of Options.Parallel to be
+// free to cover its weight.
+type parallelWaiter struct {
+	weight int
+	start  chan bool
 }
 
-func (c *Suite) waitParallel() {
+func (c *Suite) waitParallel(weight int) {
 	c.mu.Lock()
-	if c.running < c.opts.Parallel {
-		c.running++
+	if len(c.waiting) == 0 && c.running+weight <= c.opts.Parallel {
+		c.running += weight
 		c.mu.Unlock()
 		return
 	}
-	c.waiting++
+	w := &parallelWaiter{weight: weight, start: make(chan bool)}
+	c.waiting = append(c.waiting, w)
 	c.mu.Unlock()
-	<-c.startParallel
+	<-w.start
 }
 
-func (c *Suite) release() {
+func (c *Suite) release(weight int) {
 	c.mu.Lock()
-	if c.waiting == 0 {
-		c.running--
-		c.mu.Unlock()
-		return
+	defer c.mu.Unlock()
+	c.running -= weight
+	// Start waiting tests in order, so that light tests can't keep
+	// slipping in ahead of a heavy one.
+	for len(c.waiting) > 0 && c.running+c.waiting[0].weight <= c.opts.Parallel {
+		w := c.waiting[0]
+		c.waiting = c.waiting[1:]
+		c.running += w.weight
+		close(w.start)
 	}
-	c.waiting--
-	c.mu.Unlock()
-	c.startParallel <- true // Pick a waiting test to be run.
 }
 
 // NewSuite creates a new test suite.
 // All parameters in Options cannot be modified once given to Suite.
+// The options are checked with Options.Validate; if they are invalid,
+// Run returns the error without running anything.
 func NewSuite(opts Options, tests Tests) *Suite {
+	verr := opts.Validate()
+	if verr != nil {
+		opts.Match = ""
+		opts.TagMatch = ""
+		opts.Shuffle = ""
+	} else if shuffle, seed, _ := parseShuffle(opts.Shuffle); shuffle {
+		// record the seed for the report and for repeating the run
+		opts.Shuffle = strconv.FormatInt(seed, 10)
+	}
 	opts.init()
+	var procs *exec.Limiter
+	if opts.MaxProcs > 0 {
+		procs = exec.NewLimiter(opts.MaxProcs)
+	}
+	tests = opts.Shard.Filter(opts.filterTags(tests))
 	return &Suite{
-		opts:          opts,
-		tests:         tests,
-		match:         newMatcher(opts.Match, "Match"),
-		startParallel: make(chan bool),
+		procs:      procs,
+		opts:       opts,
+		tests:      tests,
+		repeats:    repeatNames(tests, opts.Count),
+		match:      newMatcher(opts.Match, "Match"),
+		active:     make(map[string]time.Time),
+		severities: make(map[Severity]map[string]int),
+		testDirs:   make(map[string]string),
+		dirTests:   make(map[string]string),
+		abandon:    make(chan struct{}),
+		err:        verr,
+
+		sequentialDone: make(chan struct{}),
 	}
 }
 
-// Run runs the tests. Returns SuiteFailed for any test failure.
+// Run runs the tests. Returns SuiteFailed for any test failure, or
+// SuiteInterrupted if stopped by SIGINT or SIGTERM.
 func (s *Suite) Run() (err error) {
+	if s.err != nil {
+		return s.err
+	}
+	if s.opts.List != "" {
+		return s.list(os.Stdout)
+	}
+
 	flushProfile := func(name string, f *os.File) {
 		err2 := pprof.Lookup(name).WriteTo(f, 0)
 		if err == nil && err2 != nil {
@@ -188,18 +847,46 @@ func (s *Suite) Run() (err error) {
 		f.Close()
 	}
 
+	unlock, err := LockOutputDir(s.opts.OutputDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if err := s.cleanOutputDir(); err != nil {
 		return err
 	}
 
-	tap, err := os.Create(s.outputPath("test.tap"))
+	if s.opts.Cgroup != "" {
+		if err := s.initCgroup(); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	s.config = newConfig(s.opts, start)
+
+	tapFile, err := os.Create(s.outputPath("test.tap"))
 	if err != nil {
 		return err
 	}
+	defer tapFile.Close()
+	tap := newOutput(tapFile)
 	defer tap.Close()
-	if _, err := fmt.Fprintf(tap, "1..%d\n", len(s.tests)); err != nil {
+	planned := len(s.tests) * s.opts.Count
+	if s.opts.SuiteSetup != nil {
+		planned++
+	}
+	if s.opts.SuiteTeardown != nil {
+		planned++
+	}
+	if _, err := fmt.Fprintf(tap, "%s\n1..%d\n", tapVersion, planned); err != nil {
 		return err
 	}
+	for _, p := range s.config.Flatten() {
+		if _, err := fmt.Fprintf(tap, "# %s: %s\n", p.Name, p.Value); err != nil {
+			return err
+		}
+	}
 
 	if s.opts.MemProfile {
 		runtime.MemProfileRate = s.opts.MemProfileRate
@@ -253,41 +940,273 @@ func (s *Suite) Run() (err error) {
 		defer timer.Stop()
 	}
 
-	return s.runTests(os.Stdout, tap)
+	logFile, err := os.Create(s.outputPath("test.log"))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	out := newOutput(logFile)
+	for _, w := range s.opts.Outputs {
+		out.add(w)
+	}
+	if s.opts.JSONFile != "-" {
+		out.add(os.Stdout)
+	}
+	if s.opts.JSONFile == "-" {
+		s.events = newEventWriter(os.Stdout, filepath.Base(os.Args[0]))
+	} else if s.opts.JSONFile != "" {
+		f, err := os.Create(s.opts.JSONFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		s.events = newEventWriter(f, filepath.Base(os.Args[0]))
+	}
+	if s.opts.StreamAddr != "" {
+		st := newStream()
+		stop, err := s.serveStream(st, out)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		out.add(st)
+	}
+	// Runs first, so every sink gets the last of the output.
+	defer func() {
+		if err := out.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "harness: writing output: %v\n", err)
+		}
+	}()
+
+	if s.opts.Shuffle != "" && s.opts.Shuffle != "off" {
+		fmt.Fprintf(out, "harness: shuffling tests with seed %s\n", s.opts.Shuffle)
+	}
+	stopProgress := s.startProgress(out)
+	stopSignals := s.handleSignals(out)
+	err = s.runInterruptible(out, tap)
+	stopSignals()
+	stopProgress()
+	s.reportProcs(out)
+	s.reportNotRun(out)
+	s.reportSeverities(out)
+	s.reportQuarantine(out)
+	s.reportBudget(out)
+	s.reportUnexpectedPasses(out)
+	s.reportRepeats(out)
+	s.reportSlowest(time.Since(start), out, tap)
+	return s.suiteFinished(out, err, time.Since(start))
+}
+
+// reportNotRun notes how many tests MaxFailures, FailFast, or an
+// interrupt kept from running.
+func (s *Suite) reportNotRun(out io.Writer) {
+	var notRun int
+	for _, r := range s.Results() {
+		if r.Result == "NOT RUN" {
+			notRun++
+		}
+	}
+	if notRun > 0 && s.interrupted != "" {
+		fmt.Fprintf(out, "harness: interrupted by %s, %d tests not run\n", s.interrupted, notRun)
+	} else if notRun > 0 && s.setupFailed {
+		fmt.Fprintf(out, "harness: suite setup failed, %d tests not run\n", notRun)
+	} else if notRun > 0 && s.failedFast != "" {
+		fmt.Fprintf(out, "harness: stopped after %s failed, %d tests not run\n", s.failedFast, notRun)
+	} else if notRun > 0 {
+		fmt.Fprintf(out, "harness: stopped after %d failures, %d tests not run\n",
+			s.opts.MaxFailures, notRun)
+	}
+}
+
+// reportProcs notes how much subprocesses were held back by MaxProcs.
+func (s *Suite) reportProcs(out io.Writer) {
+	if s.procs == nil {
+		return
+	}
+	stats := s.procs.Stats()
+	if stats.Queued == 0 {
+		return
+	}
+	fmt.Fprintf(out, "harness: %d subprocesses waited %s for one of %d slots (at most %d waiting)\n",
+		stats.Queued, fmtDuration(stats.Waited), stats.Limit, stats.PeakQueued)
+}
+
+// Procs returns the Limiter for subprocesses started on behalf of tests,
+// or nil if Options.MaxProcs is unlimited. Set it on commands with
+// exec.ExecCmd.Limiter, or Reserve the slots for a test which needs
+// several commands running at once.
+func (t *H) Procs() *exec.Limiter {
+	return t.suite.procs
 }
 
 func (s *Suite) runTests(out, tap io.Writer) error {
 	s.running = 1 // Set the count to 1 for the main (sequential) test.
-	t := &H{
-		signal:  make(chan bool),
-		barrier: make(chan bool),
-		w:       out,
-		tap:     tap,
-		suite:   s,
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.resultsMu.Lock()
+	s.ctx, s.cancel = ctx, cancel
+	if s.interrupted != "" {
+		cancel()
+	}
+	s.resultsMu.Unlock()
+	s.initReporters(tap)
+	defer s.startWatchdog()()
+	if s.opts.SuiteSetup != nil {
+		s.setupFailed = !s.runHook(out, "SuiteSetup", s.opts.SuiteSetup)
 	}
+
+	t := s.newRoot(out)
+	s.root = t
 	tRunner(t, func(t *H) {
-		for name, test := range s.tests {
-			t.Run(name, test)
-		}
+		s.runRepeats(t)
+		close(s.sequentialDone)
 		// Run catching the signal rather than the tRunner as a separate
 		// goroutine to avoid adding a goroutine during the sequential
 		// phase as this pollutes the stacktrace output when aborting.
 		go func() { <-t.signal }()
 	})
+	s.addedWG.Wait()
+
+	if s.opts.SuiteTeardown != nil {
+		s.runHook(out, "SuiteTeardown", s.opts.SuiteTeardown)
+	}
+
 	if !t.ran {
 		return SuiteEmpty
 	}
-	if t.Failed() {
+	// Includes failures of the setup and teardown.
+	if s.failedSuite() {
 		return SuiteFailed
 	}
 	return nil
 }
 
+// newRoot creates the parent of the top-level tests.
+func (s *Suite) newRoot(out io.Writer) *H {
+	return &H{
+		signal:  make(chan bool),
+		barrier: make(chan bool),
+		w:       out,
+		suite:   s,
+	}
+}
+
+// runHook runs a suite setup or teardown function as a top-level test,
+// regardless of Match, and reports whether it succeeded.
+func (s *Suite) runHook(out io.Writer, name string, fn func(h *H)) bool {
+	t := s.newRoot(out)
+	t.hooks = true
+	var ok bool
+	tRunner(t, func(t *H) {
+		t.hasSub = true
+		ok = t.runChild(name, fn)
+		go func() { <-t.signal }()
+	})
+	return ok
+}
+
+// Results returns the outcome of every test and subtest that has finished,
+// in the order they completed.
+func (s *Suite) Results() []TestResult {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	return append([]TestResult(nil), s.results...)
+}
+
+// dropSubResults forgets the results of the subtests of the named test,
+// when it is about to be run again.
+func (s *Suite) dropSubResults(name string) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	results := s.results[:0]
+	for _, r := range s.results {
+		if !strings.HasPrefix(r.Name, name+"/") {
+			results = append(results, r)
+		}
+	}
+	s.results = results
+}
+
+func (s *Suite) addResult(r TestResult) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	s.results = append(s.results, r)
+	delete(s.active, r.Name)
+}
+
+// failedSuite reports whether any top-level test failed with at least
+// FailSeverity, beyond the FailureBudget.
+func (s *Suite) failedSuite() bool {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	return s.blocking > 0 || !s.withinBudget()
+}
+
+// tooManyFailures reports whether MaxFailures tests have failed, a
+// test has failed under FailFast, or the suite was interrupted.
+func (s *Suite) tooManyFailures() bool {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	return s.failedFast != "" || s.interrupted != "" || s.opts.MaxFailures > 0 && s.failures >= s.opts.MaxFailures
+}
+
+// startTest records that the named test has started running.
+func (s *Suite) startTest(name string) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	s.active[name] = time.Now()
+}
+
 // outputPath returns the file name under Options.OutputDir.
 func (s *Suite) outputPath(path string) string {
 	return filepath.Join(s.opts.OutputDir, path)
 }
 
+// testOutputPath returns the output directory for the named test.
+// Test names are sanitized for use as paths and any tests whose names
+// collide after sanitizing are disambiguated by appending a count.
+func (s *Suite) testOutputPath(name string) string {
+	s.dirsMu.Lock()
+	defer s.dirsMu.Unlock()
+
+	if dir, ok := s.testDirs[name]; ok {
+		return s.outputPath(dir)
+	}
+
+	base := sanitizePath(name)
+	dir := base
+	for i := 1; ; i++ {
+		if _, exists := s.dirTests[dir]; !exists {
+			break
+		}
+		dir = fmt.Sprintf("%s#%02d", base, i)
+	}
+	s.testDirs[name] = dir
+	s.dirTests[dir] = name
+
+	return s.outputPath(dir)
+}
+
+// sanitizePath converts a slash separated test name into a relative path
+// that is safe to create on any filesystem.
+func sanitizePath(name string) string {
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		elem = strings.Map(func(r rune) rune {
+			switch {
+			case r < ' ', r == 0x7f, strings.ContainsRune(`\:*?"<>|`, r):
+				return '_'
+			}
+			return r
+		}, elem)
+		if elem == "" || elem == "." || elem == ".." {
+			elem = strings.Replace(elem, ".", "_", -1) + "_"
+		}
+		elems[i] = elem
+	}
+	return filepath.Join(elems...)
+}
+
 // cleanOutputDir creates/empties Options.OutputDir.
 // If the path already exists it must be named similar to `_foo_temp`
 // or contain `.harness_temp` to indicate removal is safe; we don't
@@ -302,13 +1221,7 @@ func (s *Suite) cleanOutputDir() error {
 
 	// Remove any existing data if it is safe to do so.
 	marker := filepath.Join(s.opts.OutputDir, ".harness_temp")
-	base := filepath.Base(s.opts.OutputDir)
-	safe := base[0] == '_' && strings.HasSuffix(base, "_temp")
-	if !safe {
-		if _, err := os.Stat(marker); err == nil {
-			safe = true
-		}
-	}
+	safe := outputDirRemovable(s.opts.OutputDir)
 	if safe {
 		if err := os.RemoveAll(s.opts.OutputDir); err != nil {
 			return err
@@ -330,3 +1243,14 @@ func (s *Suite) cleanOutputDir() error {
 
 	return nil
 }
+
+// outputDirRemovable reports whether dir is named like `_foo_temp` or
+// contains `.harness_temp`, marking it as safe to remove.
+func outputDirRemovable(dir string) bool {
+	base := filepath.Base(dir)
+	if base[0] == '_' && strings.HasSuffix(base, "_temp") {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, ".harness_temp"))
+	return err == nil
+}
@@ -16,7 +16,16 @@
 package harness
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestSuiteParallelism(t *testing.T) {
@@ -26,7 +35,8 @@ func TestSuiteParallelism(t *testing.T) {
 	)
 	// Apply a series of calls to the Suite, checking state after each.
 	type call struct {
-		typ int // add1 or done
+		typ    int // add1 or done
+		weight int // of the test added or done, default 1
 		// result from applying the call
 		running int
 		waiting int
@@ -68,35 +78,63 @@ func TestSuiteParallelism(t *testing.T) {
 			{typ: done, running: 1, waiting: 0, started: false},
 			{typ: done, running: 0, waiting: 0, started: false},
 		},
+	}, {
+		max: 4,
+		run: []call{
+			{typ: add1, running: 1, waiting: 0, started: true},
+			{typ: add1, weight: 2, running: 3, waiting: 0, started: true},
+			{typ: add1, weight: 4, running: 3, waiting: 1, started: false},
+			// light tests don't jump the queue
+			{typ: add1, running: 3, waiting: 2, started: false},
+			{typ: done, running: 2, waiting: 2, started: false},
+			{typ: done, weight: 2, running: 4, waiting: 1, started: true},
+			{typ: done, weight: 4, running: 1, waiting: 0, started: true},
+			{typ: done, running: 0, waiting: 0, started: false},
+		},
 	}}
 	for i, tc := range testCases {
 		suite := NewSuite(Options{Parallel: tc.max}, nil)
+		waiting := func() int {
+			suite.mu.Lock()
+			defer suite.mu.Unlock()
+			return len(suite.waiting)
+		}
+		var queued []chan bool // signals of tests waiting to start, in order
 		for j, call := range tc.run {
-			doCall := func(f func()) chan bool {
-				done := make(chan bool)
-				go func() {
-					f()
-					done <- true
-				}()
-				return done
+			weight := call.weight
+			if weight == 0 {
+				weight = 1
 			}
 			started := false
 			switch call.typ {
 			case add1:
-				signal := doCall(suite.waitParallel)
-				select {
-				case <-signal:
-					started = true
-				case suite.startParallel <- true:
-					<-signal
+				signal := make(chan bool)
+				go func() {
+					suite.waitParallel(weight)
+					close(signal)
+				}()
+				// Wait for the test to either start or join the queue.
+				for {
+					select {
+					case <-signal:
+						started = true
+					default:
+					}
+					if started || waiting() > len(queued) {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+				if !started {
+					queued = append(queued, signal)
 				}
 			case done:
-				signal := doCall(suite.release)
-				select {
-				case <-signal:
-				case <-suite.startParallel:
+				before := waiting()
+				suite.release(weight)
+				for n := before - waiting(); n > 0; n-- {
+					<-queued[0]
+					queued = queued[1:]
 					started = true
-					<-signal
 				}
 			}
 			if started != call.started {
@@ -105,9 +143,478 @@ func TestSuiteParallelism(t *testing.T) {
 			if suite.running != call.running {
 				t.Errorf("%d:%d:running: got %v; want %v", i, j, suite.running, call.running)
 			}
-			if suite.waiting != call.waiting {
-				t.Errorf("%d:%d:waiting: got %v; want %v", i, j, suite.waiting, call.waiting)
+			if n := waiting(); n != call.waiting {
+				t.Errorf("%d:%d:waiting: got %v; want %v", i, j, n, call.waiting)
+			}
+		}
+	}
+}
+
+func TestSuiteResults(t *testing.T) {
+	suite := NewSuite(Options{}, Tests{
+		"Results": func(h *H) {
+			h.Run("pass", func(h *H) {})
+			h.Run("fail", func(h *H) { h.Fail() })
+			h.Run("skip", func(h *H) { h.Skip() })
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+
+	expect := map[string]string{
+		"Results/pass": "PASS",
+		"Results/fail": "FAIL",
+		"Results/skip": "SKIP",
+		"Results":      "FAIL",
+	}
+	results := suite.Results()
+	if len(results) != len(expect) {
+		t.Fatalf("got %d results; want %d", len(results), len(expect))
+	}
+	for _, r := range results {
+		if expect[r.Name] != r.Result {
+			t.Errorf("%s: got %q; want %q", r.Name, r.Result, expect[r.Name])
+		}
+	}
+}
+
+func TestSuitePhases(t *testing.T) {
+	suite := NewSuite(Options{}, Tests{
+		"Phases": func(h *H) {
+			h.Phase("setup")
+			time.Sleep(10 * time.Millisecond)
+			h.Phase("run")
+			h.Phase("setup")
+			time.Sleep(10 * time.Millisecond)
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results := suite.Results()
+	if len(results) != 1 {
+		t.Fatalf("got %d results; want 1", len(results))
+	}
+	phases := results[0].Phases
+	if len(phases) != 2 || phases[0].Name != "setup" || phases[1].Name != "run" {
+		t.Fatalf("unexpected phases %v", phases)
+	}
+	if phases[0].Duration < 20*time.Millisecond {
+		t.Errorf("setup took %v; want at least 20ms", phases[0].Duration)
+	}
+	if phases[0].Duration+phases[1].Duration > results[0].Duration {
+		t.Errorf("phases %v exceed test duration %v", phases, results[0].Duration)
+	}
+}
+
+func TestSuiteExclusive(t *testing.T) {
+	var running, overlaps int32
+	run := func(exclusive bool) func(h *H) {
+		return func(h *H) {
+			h.Parallel()
+			if exclusive {
+				h.Exclusive()
+			}
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			time.Sleep(10 * time.Millisecond)
+			if exclusive && (n != 1 || atomic.LoadInt32(&running) != 1) {
+				atomic.AddInt32(&overlaps, 1)
+			}
+		}
+	}
+
+	tests := Tests{}
+	for i := 0; i < 8; i++ {
+		tests.Add(fmt.Sprintf("Shared%d", i), run(false))
+	}
+	tests.Add("Exclusive1", run(true))
+	tests.Add("Exclusive2", run(true))
+	tests.Add("Sequential", func(h *H) {
+		h.Exclusive()
+		h.Run("Sub", run(false))
+	})
+
+	suite := NewSuite(Options{Parallel: 4}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if overlaps != 0 {
+		t.Errorf("exclusive tests overlapped other tests %d times", overlaps)
+	}
+}
+
+func TestSuiteMaxFailures(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		tests := Tests{}
+		for i := 0; i < 5; i++ {
+			tests.Add(fmt.Sprintf("Fail%d", i), func(h *H) {
+				if parallel {
+					h.Parallel()
+				}
+				h.Fail()
+			})
+		}
+
+		suite := NewSuite(Options{Parallel: 1, MaxFailures: 2}, tests)
+		if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+			t.Errorf("parallel=%v: got %v; want %v", parallel, err, SuiteFailed)
+		}
+
+		counts := map[string]int{}
+		for _, r := range suite.Results() {
+			counts[r.Result]++
+		}
+		if counts["FAIL"] != 2 || counts["NOT RUN"] != 3 {
+			t.Errorf("parallel=%v: got results %v; want 2 FAIL and 3 NOT RUN", parallel, counts)
+		}
+	}
+}
+
+func TestSuiteFailFast(t *testing.T) {
+	tests := Tests{
+		"A": func(h *H) { h.Fail() },
+		"B": func(h *H) {},
+		"C": func(h *H) {},
+	}
+	suite := NewSuite(Options{Parallel: 1, FailFast: true}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+	for _, r := range suite.Results() {
+		if want := map[string]string{"A": "FAIL", "B": "NOT RUN", "C": "NOT RUN"}[r.Name]; r.Result != want {
+			t.Errorf("%s: got %s; want %s", r.Name, r.Result, want)
+		}
+	}
+
+	// a running test sees its context cancelled
+	started := make(chan bool)
+	tests = Tests{
+		"Fail": func(h *H) {
+			h.Parallel()
+			<-started
+			h.Fail()
+		},
+		"Wait": func(h *H) {
+			h.Parallel()
+			close(started)
+			select {
+			case <-h.Context().Done():
+				h.Skip("cancelled")
+			case <-time.After(10 * time.Second):
+			}
+		},
+	}
+	suite = NewSuite(Options{Parallel: 2, FailFast: true}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+	for _, r := range suite.Results() {
+		if want := map[string]string{"Fail": "FAIL", "Wait": "SKIP"}[r.Name]; r.Result != want {
+			t.Errorf("%s: got %s; want %s", r.Name, r.Result, want)
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		opts     Options
+		problems int
+	}{
+		{Options{}, 0},
+		{Options{Parallel: 4, Match: "Foo/Bar", Timeout: time.Minute}, 0},
+		{Options{Match: "Foo/[Bar"}, 1},
+		{Options{Parallel: -1, MaxProcs: -1}, 2},
+		{Options{OutputDir: "."}, 1},
+		{Options{OutputDir: "/nonexistent/_harness_temp"}, 1},
+		{Options{CPUQuota: 2}, 1},
+		{Options{CPUSet: "0-3;6"}, 2},
+		{Options{StreamAddr: "localhost"}, 1},
+	} {
+		err := tc.opts.Validate()
+		var problems []string
+		if err != nil {
+			oerr, ok := err.(*OptionsError)
+			if !ok {
+				t.Errorf("%+v: got %T; want *OptionsError", tc.opts, err)
+				continue
+			}
+			problems = oerr.Problems
+		}
+		if len(problems) != tc.problems {
+			t.Errorf("%+v: got problems %q; want %d", tc.opts, problems, tc.problems)
+		}
+	}
+
+	suite := NewSuite(Options{Match: "[", Parallel: -1}, Tests{
+		"Foo": func(h *H) { t.Error("test ran with invalid options") },
+	})
+	if _, ok := suite.Run().(*OptionsError); !ok {
+		t.Errorf("Run did not return an *OptionsError")
+	}
+}
+
+func TestSuiteOnFailure(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var mu sync.Mutex
+	failures := map[string]string{}
+	opts := Options{
+		OutputDir: filepath.Join(tmp, "out"),
+		OnFailure: func(name, dir string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := failures[name]; ok {
+				t.Errorf("OnFailure called twice for %s", name)
+			}
+			failures[name] = dir
+		},
+	}
+	suite := NewSuite(opts, Tests{
+		"Pass": func(h *H) {},
+		"Fail": func(h *H) {
+			h.Error("one")
+			h.Error("two")
+		},
+		"Parent": func(h *H) {
+			h.Run("Sub", func(h *H) { h.Fail() })
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+
+	want := map[string]string{
+		"Fail":       filepath.Join(opts.OutputDir, "Fail"),
+		"Parent/Sub": filepath.Join(opts.OutputDir, "Parent", "Sub"),
+	}
+	if !reflect.DeepEqual(failures, want) {
+		t.Errorf("got failures %v; want %v", failures, want)
+	}
+}
+
+func TestSuiteTestTimeout(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	opts := Options{
+		OutputDir:   filepath.Join(tmp, "out"),
+		TestTimeout: 100 * time.Millisecond,
+		Parallel:    1,
+	}
+	suite := NewSuite(opts, Tests{
+		"Fast": func(h *H) {
+			h.Parallel()
+			if _, ok := h.Deadline(); !ok {
+				h.Error("no deadline")
+			}
+		},
+		"Hung": func(h *H) {
+			h.Parallel()
+			<-h.Context().Done()
+		},
+		"Extended": func(h *H) {
+			h.SetTimeout(time.Minute)
+			time.Sleep(200 * time.Millisecond)
+		},
+		"Cleared": func(h *H) {
+			h.SetTimeout(0)
+			if _, ok := h.Deadline(); ok {
+				h.Error("deadline after SetTimeout(0)")
+			}
+			time.Sleep(200 * time.Millisecond)
+		},
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+
+	want := map[string]string{
+		"Fast":     "PASS",
+		"Hung":     "FAIL",
+		"Extended": "PASS",
+		"Cleared":  "PASS",
+	}
+	for _, r := range suite.Results() {
+		if r.Result != want[r.Name] {
+			t.Errorf("%s: got %s; want %s", r.Name, r.Result, want[r.Name])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(opts.OutputDir, "Hung", "stacks.txt")); err != nil {
+		t.Errorf("no stacks saved: %v", err)
+	}
+}
+
+func TestSuiteFailSeverity(t *testing.T) {
+	tests := Tests{
+		"Minor": func(h *H) {
+			h.SetSeverity(Minor)
+			h.Fail()
+		},
+		"Major": func(h *H) {
+			h.Run("Sub", func(h *H) {
+				if s := h.Severity(); s != Major {
+					h.Errorf("got severity %v; want %v", s, Major)
+				}
+			})
+		},
+		"Critical": func(h *H) {
+			h.SetSeverity(Critical)
+			h.Run("Sub", func(h *H) {
+				if s := h.Severity(); s != Critical {
+					h.Errorf("got severity %v; want %v", s, Critical)
+				}
+			})
+		},
+	}
+
+	for _, tc := range []struct {
+		fail Severity
+		want error
+	}{
+		{0, SuiteFailed},
+		{Minor, SuiteFailed},
+		{Major, nil},
+		{Critical, nil},
+	} {
+		suite := NewSuite(Options{FailSeverity: tc.fail}, tests)
+		if err := suite.runTests(ioutil.Discard, nil); err != tc.want {
+			t.Errorf("FailSeverity %v: got %v; want %v", tc.fail, err, tc.want)
+		}
+		for _, r := range suite.Results() {
+			if r.Name == "Minor" && (r.Result != "FAIL" || r.Severity != Minor) {
+				t.Errorf("FailSeverity %v: got %s %v for Minor", tc.fail, r.Result, r.Severity)
+			}
+		}
+	}
+
+	if err := (&Options{FailSeverity: 7}).Validate(); err == nil {
+		t.Errorf("Validate accepted an invalid severity")
+	}
+}
+
+func TestSuiteRetries(t *testing.T) {
+	tests := Tests{
+		"Flaky": func(h *H) {
+			if h.Attempt() == 1 {
+				h.Fail()
+			}
+		},
+		"FlakyParallel": func(h *H) {
+			h.Parallel()
+			if h.Attempt() < 3 {
+				h.Fail()
 			}
+		},
+		"Broken": func(h *H) {
+			h.Parallel()
+			h.Run("Sub", func(h *H) { h.Fail() })
+		},
+		"NoRetry": func(h *H) {
+			h.SetRetries(-1)
+			h.Fail()
+		},
+		"Pass": func(h *H) {},
+	}
+
+	suite := NewSuite(Options{Retries: 2, Parallel: 2}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+
+	want := map[string]struct {
+		result   string
+		attempts int
+	}{
+		"Flaky":         {"FLAKY", 2},
+		"FlakyParallel": {"FLAKY", 3},
+		"Broken":        {"FAIL", 3},
+		"Broken/Sub":    {"FAIL", 1},
+		"NoRetry":       {"FAIL", 1},
+		"Pass":          {"PASS", 1},
+	}
+	got := make(map[string]int)
+	for _, r := range suite.Results() {
+		got[r.Name]++
+		w, ok := want[r.Name]
+		if !ok {
+			t.Errorf("unexpected result for %s", r.Name)
+		} else if r.Result != w.result || r.Attempts != w.attempts {
+			t.Errorf("%s: got %s after %d attempts; want %s after %d",
+				r.Name, r.Result, r.Attempts, w.result, w.attempts)
+		}
+	}
+	for name := range want {
+		if got[name] != 1 {
+			t.Errorf("%s: got %d results; want 1", name, got[name])
+		}
+	}
+
+	// Tests which only flaked don't fail the suite.
+	suite = NewSuite(Options{Retries: 1}, Tests{"Flaky": tests["Flaky"]})
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Errorf("got %v for flaky test; want nil", err)
+	}
+
+	if err := (&Options{Retries: -1}).Validate(); err == nil {
+		t.Errorf("Validate accepted negative retries")
+	}
+}
+
+func TestSuiteSetupTeardown(t *testing.T) {
+	var setUp, tornDown bool
+	tests := Tests{
+		"Test": func(h *H) {
+			if !setUp {
+				h.Error("test ran before setup")
+			}
+			if tornDown {
+				h.Error("test ran after teardown")
+			}
+		},
+	}
+	opts := Options{
+		Match:         "Test",
+		SuiteSetup:    func(h *H) { setUp = true },
+		SuiteTeardown: func(h *H) { tornDown = true },
+	}
+	suite := NewSuite(opts, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !tornDown {
+		t.Errorf("teardown did not run")
+	}
+	var names []string
+	for _, r := range suite.Results() {
+		names = append(names, r.Name+" "+r.Result)
+	}
+	if want := []string{"SuiteSetup PASS", "Test PASS", "SuiteTeardown PASS"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got results %v; want %v", names, want)
+	}
+
+	// Tests are not run after setup fails, but teardown is.
+	tornDown = false
+	opts.SuiteSetup = func(h *H) { h.Fatal("no setup for you") }
+	suite = NewSuite(opts, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v after failed setup; want %v", err, SuiteFailed)
+	}
+	if !tornDown {
+		t.Errorf("teardown did not run after failed setup")
+	}
+	for _, r := range suite.Results() {
+		if r.Name == "Test" && (r.Result != "NOT RUN" || !strings.Contains(r.Output, "suite setup failed")) {
+			t.Errorf("got %s %q for test after failed setup", r.Result, r.Output)
 		}
 	}
 }
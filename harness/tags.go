@@ -0,0 +1,108 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tagTerm is a tag in a tag expression, possibly negated.
+type tagTerm struct {
+	tag string
+	not bool
+}
+
+// tagExpr is a parsed Options.TagMatch: alternatives separated by "||",
+// each of which is a list of terms separated by "&&" that must all
+// hold. A term is a tag, which holds if the test has it, or "!" and a
+// tag, which holds if it doesn't. The empty expression matches every
+// test.
+type tagExpr [][]tagTerm
+
+func parseTagExpr(s string) (tagExpr, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var expr tagExpr
+	for _, alt := range strings.Split(s, "||") {
+		var terms []tagTerm
+		for _, term := range strings.Split(alt, "&&") {
+			term = strings.TrimSpace(term)
+			t := tagTerm{tag: term}
+			if strings.HasPrefix(term, "!") {
+				t = tagTerm{tag: strings.TrimSpace(term[1:]), not: true}
+			}
+			if t.tag == "" || strings.ContainsAny(t.tag, " \t!|&()") {
+				return nil, fmt.Errorf("invalid term %q in tag expression %q", term, s)
+			}
+			terms = append(terms, t)
+		}
+		expr = append(expr, terms)
+	}
+	return expr, nil
+}
+
+// match reports whether a test with the given tags matches.
+func (e tagExpr) match(tags []string) bool {
+	if len(e) == 0 {
+		return true
+	}
+	has := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		has[tag] = true
+	}
+	for _, terms := range e {
+		ok := true
+		for _, t := range terms {
+			ok = ok && has[t.tag] != t.not
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTags reports whether a test with the given tags matches the tag
+// expression, written as for Options.TagMatch.
+func MatchTags(expr string, tags []string) (bool, error) {
+	e, err := parseTagExpr(expr)
+	if err != nil {
+		return false, err
+	}
+	return e.match(tags), nil
+}
+
+// filterTags returns the tests whose tags in Options.TestTags match
+// Options.TagMatch.
+func (o *Options) filterTags(tests Tests) Tests {
+	expr, err := parseTagExpr(o.TagMatch)
+	if err != nil || len(expr) == 0 {
+		return tests
+	}
+	matched := make(Tests)
+	for name, test := range tests {
+		if expr.match(o.TestTags[name]) {
+			matched[name] = test
+		}
+	}
+	return matched
+}
+
+// Tags returns the tags of the top-level test the test belongs to.
+func (t *H) Tags() []string {
+	return t.suite.opts.TestTags[strings.SplitN(t.suite.baseName(t.name), "/", 2)[0]]
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTagExpr(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		tags []string
+		want bool
+	}{
+		{"", nil, true},
+		{"slow", []string{"slow"}, true},
+		{"slow", []string{"reboot"}, false},
+		{"!slow", []string{"reboot"}, true},
+		{"!slow", []string{"slow", "reboot"}, false},
+		{"network && !slow", []string{"network"}, true},
+		{"network && !slow", []string{"network", "slow"}, false},
+		{"network && !slow || reboot", []string{"slow", "reboot"}, true},
+		{"network&&reboot", []string{"network"}, false},
+	} {
+		expr, err := parseTagExpr(tc.expr)
+		if err != nil {
+			t.Errorf("parseTagExpr(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := expr.match(tc.tags); got != tc.want {
+			t.Errorf("%q matching %v = %v; want %v", tc.expr, tc.tags, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"slow &&", "||", "!", "a b", "(slow)"} {
+		if _, err := parseTagExpr(bad); err == nil {
+			t.Errorf("parseTagExpr(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSuiteTags(t *testing.T) {
+	var ran []string
+	var tags []string
+	test := func(h *H) {
+		ran = append(ran, h.Name())
+		h.Run("Sub", func(h *H) {
+			if h.Name() == "Boot/Sub" {
+				tags = h.Tags()
+			}
+		})
+	}
+	tests := Tests{"Boot": test, "Reboot": test, "Network": test, "Untagged": test}
+	opts := Options{
+		TestTags: map[string][]string{
+			"Boot":    {"fast"},
+			"Reboot":  {"reboot", "slow"},
+			"Network": {"network", "slow"},
+		},
+		TagMatch: "fast || slow && !network",
+	}
+
+	suite := NewSuite(opts, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(ran)
+	if want := []string{"Boot", "Reboot"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v; want %v", ran, want)
+	}
+	if want := []string{"fast"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("subtest has tags %v; want %v", tags, want)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The TAP log follows version 13 of the Test Anything Protocol. Top-level
+// tests are numbered in the order they finish. The subtests of a test
+// are written as an indented block ahead of its own result, with their
+// own numbers and plan, and each result is followed by a YAML block with
+// its duration and, where there is one, why it failed or was skipped,
+// its benchmark figures, and its attachments:
+//
+//	TAP version 13
+//	1..2
+//	ok 1 - Good
+//	  ---
+//	  duration_ms: 1.502
+//	  ...
+//	    # Subtest: Parent
+//	    not ok 1 - Parent/Sub
+//	      ---
+//	      duration_ms: 0.031
+//	      message: "something broke"
+//	      ...
+//	    1..1
+//	not ok 2 - Parent
+//	  ---
+//	  duration_ms: 0.107
+//	  ...
+
+const tapVersion = "TAP version 13"
+
+// tapReporter is a Reporter writing the TAP log to w.
+type tapReporter struct {
+	w     io.Writer
+	count int // top-level tests written so far
+
+	// subs holds the results of the finished subtests of each test
+	// still running, to be written ahead of its own result.
+	subs map[string]*tapBlock
+}
+
+type tapBlock struct {
+	buf   bytes.Buffer
+	count int
+}
+
+func newTAPReporter(w io.Writer) *tapReporter {
+	return &tapReporter{w: w, subs: make(map[string]*tapBlock)}
+}
+
+// TestStarted drops the subtests of an earlier attempt at a test.
+func (tr *tapReporter) TestStarted(t TestInfo, start time.Time) {
+	delete(tr.subs, t.Name)
+}
+
+// TestFinished adds the test's result to the TAP log, or to its
+// parent's block of subtests.
+func (tr *tapReporter) TestFinished(t TestInfo, r TestResult) {
+	var block bytes.Buffer
+	if sub := tr.subs[t.Name]; sub != nil {
+		w := tapIndenter{&block}
+		fmt.Fprintf(w, "# Subtest: %s\n", tapName(t.Name))
+		w.Write(sub.buf.Bytes())
+		fmt.Fprintf(w, "1..%d\n", sub.count)
+		delete(tr.subs, t.Name)
+	}
+
+	if t.Level == 1 {
+		tr.count++
+		writeTAPResult(&block, tr.count, r)
+		tr.w.Write(block.Bytes())
+		return
+	}
+	p := tr.subs[t.Parent]
+	if p == nil {
+		p = &tapBlock{}
+		tr.subs[t.Parent] = p
+	}
+	p.count++
+	writeTAPResult(&block, p.count, r)
+	p.buf.Write(block.Bytes())
+}
+
+func (tr *tapReporter) SuiteFinished(err error, elapsed time.Duration) error {
+	return nil
+}
+
+// writeTAPResult writes the result line of test number n and its YAML
+// diagnostics.
+func writeTAPResult(w io.Writer, n int, r TestResult) {
+	name := tapName(r.Name)
+	switch r.Result {
+	case "NOT RUN":
+		fmt.Fprintf(w, "ok %d - %s # SKIP not run\n", n, name)
+	case "XFAIL":
+		fmt.Fprintf(w, "not ok %d - %s # TODO %s\n", n, name, r.ExpectedFailure)
+	case "FAIL":
+		fmt.Fprintf(w, "not ok %d - %s\n", n, name)
+	case "SKIP":
+		fmt.Fprintf(w, "ok %d - %s # SKIP\n", n, name)
+	case "XPASS":
+		fmt.Fprintf(w, "ok %d - %s # TODO %s\n", n, name, r.ExpectedFailure)
+	case "FLAKY":
+		fmt.Fprintf(w, "ok %d - %s (flaky, passed on attempt %d)\n", n, name, r.Attempts)
+	case "WARN":
+		fmt.Fprintf(w, "ok %d - %s (with warnings)\n", n, name)
+	default:
+		fmt.Fprintf(w, "ok %d - %s\n", n, name)
+	}
+
+	// Strings are quoted as in JSON, which is also valid YAML.
+	fmt.Fprintf(w, "  ---\n")
+	fmt.Fprintf(w, "  duration_ms: %.3f\n", r.Duration.Seconds()*1000)
+	switch r.Result {
+	case "FAIL", "XFAIL", "SKIP":
+		if msg := junitSummary(r.Output); msg != "" {
+			fmt.Fprintf(w, "  message: %s\n", strconv.Quote(msg))
+		}
+	}
+	if r.Benchmark != nil {
+		fmt.Fprintf(w, "  benchmark: %s\n", strconv.Quote(strings.Join(strings.Fields(r.Benchmark.String()), " ")))
+	}
+	if len(r.Attachments) > 0 {
+		fmt.Fprintf(w, "  attachments:\n")
+		for _, a := range r.Attachments {
+			fmt.Fprintf(w, "    - name: %s\n", strconv.Quote(a.Name))
+			fmt.Fprintf(w, "      path: %s\n", strconv.Quote(a.Path))
+		}
+	}
+	fmt.Fprintf(w, "  ...\n")
+}
+
+// tapName returns a test name which can't be mistaken for a directive.
+func tapName(name string) string {
+	return strings.Replace(name, "#", "", -1)
+}
+
+// tapIndenter indents each line written to it for a subtest block.
+type tapIndenter struct {
+	w io.Writer
+}
+
+func (w tapIndenter) Write(b []byte) (n int, err error) {
+	n = len(b)
+	for len(b) > 0 {
+		end := bytes.IndexByte(b, '\n') + 1
+		if end == 0 {
+			end = len(b)
+		}
+		if _, err := io.WriteString(w.w, "    "); err != nil {
+			return 0, err
+		}
+		if _, err := w.w.Write(b[:end]); err != nil {
+			return 0, err
+		}
+		b = b[end:]
+	}
+	return n, nil
+}
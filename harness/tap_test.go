@@ -0,0 +1,65 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"testing"
+)
+
+func TestTAP(t *testing.T) {
+	suite := NewSuite(Options{}, Tests{
+		"Fail": func(h *H) { h.Error("something broke") },
+		"Parent": func(h *H) {
+			h.Run("Good", func(h *H) {})
+			h.Run("Skip", func(h *H) { h.Skip("not today") })
+		},
+		"Pass": func(h *H) {},
+	})
+	var tap bytes.Buffer
+	suite.runTests(ioutil.Discard, &tap)
+
+	got := regexp.MustCompile(`duration_ms: [0-9.]+`).ReplaceAllString(tap.String(), "duration_ms: 0")
+	want := `not ok 1 - Fail
+  ---
+  duration_ms: 0
+  message: "something broke"
+  ...
+    # Subtest: Parent
+    ok 1 - Parent/Good
+      ---
+      duration_ms: 0
+      ...
+    ok 2 - Parent/Skip # SKIP
+      ---
+      duration_ms: 0
+      message: "not today"
+      ...
+    1..2
+ok 2 - Parent
+  ---
+  duration_ms: 0
+  ...
+ok 3 - Pass
+  ---
+  duration_ms: 0
+  ...
+`
+	if got != want {
+		t.Errorf("got TAP:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// timeoutGrace is how long a test that timed out has to return before
+// the whole suite is aborted.
+var timeoutGrace = 5 * time.Minute
+
+// SetTimeout fails the test if it is still running d from now, replacing
+// any earlier timeout; 0 removes it. A test that times out has its
+// context cancelled so it can clean up and return, and stack traces of
+// all goroutines are saved to stacks.txt in its output directory. If it
+// still hasn't returned a few minutes later the suite is aborted rather
+// than left to hang. Time spent waiting in Parallel or Exclusive does
+// not count.
+func (t *H) SetTimeout(d time.Duration) {
+	t.timeoutMu.Lock()
+	defer t.timeoutMu.Unlock()
+	t.timeout = d
+	t.startTimer()
+}
+
+// Deadline reports when the test or one of its parents will time out.
+func (t *H) Deadline() (deadline time.Time, ok bool) {
+	for c := t; c != nil; c = c.parent {
+		c.timeoutMu.Lock()
+		d := c.deadline
+		c.timeoutMu.Unlock()
+		if !d.IsZero() && (!ok || d.Before(deadline)) {
+			deadline, ok = d, true
+		}
+	}
+	return
+}
+
+// startTimer (re)starts the timeout. t.timeoutMu must be held.
+func (t *H) startTimer() {
+	t.stopTimer()
+	if t.timeout <= 0 || t.timeoutDone {
+		return
+	}
+	d := t.timeout
+	t.deadline = time.Now().Add(d)
+	t.timer = time.AfterFunc(d, func() { t.expire(d) })
+}
+
+// stopTimer stops the timeout. t.timeoutMu must be held.
+func (t *H) stopTimer() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.deadline = time.Time{}
+}
+
+// pauseTimeout stops the timeout while the test waits to run.
+func (t *H) pauseTimeout() {
+	t.timeoutMu.Lock()
+	defer t.timeoutMu.Unlock()
+	t.stopTimer()
+}
+
+// resumeTimeout restarts the timeout in full once the test runs again.
+func (t *H) resumeTimeout() {
+	t.timeoutMu.Lock()
+	defer t.timeoutMu.Unlock()
+	t.startTimer()
+}
+
+// endTimeout stops the timeout for good once the test has finished.
+func (t *H) endTimeout() {
+	t.timeoutMu.Lock()
+	defer t.timeoutMu.Unlock()
+	t.stopTimer()
+	t.timeoutDone = true
+}
+
+// expire fails a test which ran for longer than d.
+func (t *H) expire(d time.Duration) {
+	t.timeoutMu.Lock()
+	defer t.timeoutMu.Unlock()
+	if t.timeoutDone || t.timer == nil {
+		return
+	}
+	t.timer = nil
+	t.deadline = time.Time{}
+
+	stacks := allStacks()
+	t.Errorf("test timed out after %v", d)
+	t.saveStacks("stacks.txt", stacks)
+	t.cancel()
+
+	t.timer = time.AfterFunc(timeoutGrace, func() {
+		t.timeoutMu.Lock()
+		defer t.timeoutMu.Unlock()
+		if t.timeoutDone {
+			return
+		}
+		debug.SetTraceback("all")
+		panic(fmt.Sprintf("harness: test %s timed out after %v and did not return within %v",
+			t.name, d, timeoutGrace))
+	})
+}
+
+// allStacks returns the stack traces of all goroutines.
+func allStacks() []byte {
+	stacks := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(stacks, true)
+		if n < len(stacks) {
+			return stacks[:n]
+		}
+		stacks = make([]byte, 2*len(stacks))
+	}
+}
+
+// saveStacks writes stack traces to the named file in the test's
+// output directory, logging where they are.
+func (t *H) saveStacks(name string, stacks []byte) {
+	dir, err := t.mkOutputDir()
+	if err != nil {
+		t.log(err.Error())
+		return
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, stacks, 0666); err != nil {
+		t.log(err.Error())
+	} else {
+		t.Logf("goroutine stacks saved to %s", path)
+	}
+}
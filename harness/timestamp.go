@@ -0,0 +1,51 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"time"
+)
+
+// Log timestamp formats for Options.LogTimestamps.
+const (
+	TimestampsOff      = "off"
+	TimestampsRFC3339  = "rfc3339"
+	TimestampsRelative = "relative"
+)
+
+// rfc3339Milli is RFC 3339 with milliseconds, fine enough to line up
+// with machine journals.
+const rfc3339Milli = "2006-01-02T15:04:05.000Z07:00"
+
+func validateTimestamps(format string) error {
+	switch format {
+	case "", TimestampsOff, TimestampsRFC3339, TimestampsRelative:
+		return nil
+	}
+	return fmt.Errorf("%q is not off, rfc3339, or relative", format)
+}
+
+// timestamp returns the prefix for a line logged now, in the format
+// given by Options.LogTimestamps, or "" if timestamps are off.
+func (t *H) timestamp(now time.Time) string {
+	switch t.suite.opts.LogTimestamps {
+	case TimestampsRFC3339:
+		return now.Format(rfc3339Milli) + " "
+	case TimestampsRelative:
+		return fmt.Sprintf("+%.3fs ", now.Sub(t.logStart).Seconds())
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLogTimestamps(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{"", `^        timestamp_test\.go:\d+: hello$`},
+		{TimestampsOff, `^        timestamp_test\.go:\d+: hello$`},
+		{TimestampsRFC3339, `^        \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}(Z|[+-]\d\d:\d\d) timestamp_test\.go:\d+: hello$`},
+		{TimestampsRelative, `^        \+0\.\d{3}s timestamp_test\.go:\d+: hello$`},
+	} {
+		var out bytes.Buffer
+		suite := NewSuite(Options{Verbose: true, LogTimestamps: tc.format}, Tests{
+			"Test": func(h *H) {
+				h.Log("hello")
+			},
+		})
+		if err := suite.runTests(&out, nil); err != nil {
+			t.Fatal(err)
+		}
+		re := regexp.MustCompile(tc.want)
+		var found bool
+		for _, line := range bytes.Split(out.Bytes(), []byte("\n")) {
+			if bytes.Contains(line, []byte("hello")) {
+				found = true
+				if !re.Match(line) {
+					t.Errorf("%q: line %q does not match %s", tc.format, line, tc.want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%q: no log line in output:\n%s", tc.format, out.String())
+		}
+	}
+}
+
+func TestRelativeTimestamp(t *testing.T) {
+	suite := NewSuite(Options{LogTimestamps: TimestampsRelative}, nil)
+	h := &H{suite: suite, logStart: time.Unix(100, 0)}
+	if got := h.timestamp(time.Unix(112, 345e6)); got != "+12.345s " {
+		t.Errorf("got %q", got)
+	}
+	if err := (&Options{LogTimestamps: "unix"}).Validate(); err == nil {
+		t.Errorf("Validate accepted timestamp format unix")
+	}
+}
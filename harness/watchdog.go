@@ -0,0 +1,157 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The watchdog looks out for top-level tests which have stopped making
+// progress: neither they nor their subtests have logged anything for
+// Options.Watchdog, and none of them are waiting their turn to run. It
+// saves the stacks of all goroutines to stalled-stacks.txt in the
+// test's output directory and, with Options.WatchdogKill, fails the
+// test and cancels its context.
+
+// top returns the top-level test t belongs to, or nil for a root.
+func (t *H) top() *H {
+	if t.level == 0 {
+		return nil
+	}
+	for t.level > 1 {
+		t = t.parent
+	}
+	return t
+}
+
+// active tells the watchdog the test is making progress.
+func (t *H) active() {
+	if top := t.top(); top != nil {
+		atomic.StoreInt64(&top.lastActive, time.Now().UnixNano())
+	}
+}
+
+// pauseWatchdog keeps the watchdog quiet while the test waits to run.
+func (t *H) pauseWatchdog() {
+	if top := t.top(); top != nil {
+		atomic.AddInt32(&top.waits, 1)
+	}
+}
+
+// resumeWatchdog restarts the watchdog once the test runs again.
+func (t *H) resumeWatchdog() {
+	if top := t.top(); top != nil {
+		t.active()
+		atomic.AddInt32(&top.waits, -1)
+	}
+}
+
+// watch puts a top-level test under the watchdog until unwatch.
+func (s *Suite) watch(t *H) {
+	if s.opts.Watchdog <= 0 {
+		return
+	}
+	t.active()
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if s.watched == nil {
+		s.watched = make(map[*H]bool)
+	}
+	s.watched[t] = true
+}
+
+func (s *Suite) unwatch(t *H) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	delete(s.watched, t)
+}
+
+// startWatchdog checks on the watched tests until the returned
+// function is called.
+func (s *Suite) startWatchdog() func() {
+	if s.opts.Watchdog <= 0 {
+		return func() {}
+	}
+	interval := s.opts.Watchdog / 10
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				s.checkWatchdog(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// checkWatchdog reports each test which has stalled since it was last
+// reported.
+func (s *Suite) checkWatchdog(now time.Time) {
+	s.watchMu.Lock()
+	tests := make([]*H, 0, len(s.watched))
+	for t := range s.watched {
+		tests = append(tests, t)
+	}
+	s.watchMu.Unlock()
+
+	for _, t := range tests {
+		last := atomic.LoadInt64(&t.lastActive)
+		idle := now.Sub(time.Unix(0, last))
+		if atomic.LoadInt32(&t.waits) > 0 || last == t.stalledAt || idle < s.opts.Watchdog {
+			continue
+		}
+		s.reportStall(t, idle)
+	}
+}
+
+// reportStall reports that a test has stalled, unless it has finished
+// since it was checked. tRunner unwatches a test before completing it,
+// so holding watchMu keeps it from completing during the report.
+func (s *Suite) reportStall(t *H, idle time.Duration) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if !s.watched[t] {
+		return
+	}
+	t.stalled(idle)
+	// Logging about the stall was activity, but the test is still
+	// stuck until it does something itself.
+	t.stalledAt = atomic.LoadInt64(&t.lastActive)
+}
+
+// stalled reports that the test has made no progress for idle.
+func (t *H) stalled(idle time.Duration) {
+	stacks := allStacks()
+	if t.suite.opts.WatchdogKill {
+		t.Errorf("test stalled: no output for %s", fmtDuration(idle))
+	} else {
+		t.Logf("test stalled: no output for %s", fmtDuration(idle))
+	}
+	t.saveStacks("stalled-stacks.txt", stacks)
+	if t.suite.opts.WatchdogKill {
+		t.cancel()
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"os"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuiteWatchdog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chatter := func(h *H) {
+		for i := 0; i < 15; i++ {
+			h.Logf("still going")
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	tests := Tests{
+		"Stuck": func(h *H) {
+			h.Parallel()
+			select {
+			case <-h.Context().Done():
+			case <-time.After(5 * time.Second):
+				h.Error("context not cancelled")
+			}
+		},
+		"Chatty": func(h *H) {
+			h.Parallel()
+			h.Lock("resource")
+			chatter(h)
+		},
+		"Sub": func(h *H) {
+			h.Parallel()
+			h.Run("Chatty", chatter)
+		},
+		"Waiting": func(h *H) {
+			h.Parallel()
+			// don't count time spent waiting for Chatty
+			time.Sleep(5 * time.Millisecond)
+			h.Lock("resource")
+		},
+	}
+	opts := Options{
+		OutputDir:    dir,
+		Parallel:     4,
+		Watchdog:     50 * time.Millisecond,
+		WatchdogKill: true,
+	}
+	suite := NewSuite(opts, tests)
+	suite.runTests(ioutil.Discard, nil)
+
+	for _, r := range suite.Results() {
+		stacks := filepath.Join(dir, r.Name, "stalled-stacks.txt")
+		_, err := os.Stat(stacks)
+		if r.Name == "Stuck" {
+			if r.Result != "FAIL" || !strings.Contains(r.Output, "test stalled") {
+				t.Errorf("stuck test: got %s: %q", r.Result, r.Output)
+			}
+			if err != nil {
+				t.Errorf("stuck test: %v", err)
+			}
+		} else {
+			if r.Result != "PASS" {
+				t.Errorf("%s: got %s: %q", r.Name, r.Result, r.Output)
+			}
+			if err == nil {
+				t.Errorf("%s: stacks saved", r.Name)
+			}
+		}
+	}
+}
+
+// TestWatchdogRacesCompletion reports stalls of tests as they finish,
+// which must not fail a test that has already completed.
+func TestWatchdogRacesCompletion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := make(Tests)
+	for i := 0; i < 100; i++ {
+		d := time.Duration(i%10) * time.Millisecond
+		tests[fmt.Sprintf("Test%d", i)] = func(h *H) {
+			h.Parallel()
+			time.Sleep(d)
+		}
+	}
+	opts := Options{
+		OutputDir:    dir,
+		Parallel:     100,
+		Watchdog:     time.Hour,
+		WatchdogKill: true,
+	}
+	suite := NewSuite(opts, tests)
+
+	// Every test looks stalled to a watchdog an hour from now.
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				suite.checkWatchdog(time.Now().Add(2 * time.Hour))
+			}
+		}
+	}()
+	suite.runTests(ioutil.Discard, nil)
+	close(done)
+	<-stopped
+}
@@ -0,0 +1,43 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+// SetWeight sets how much of Options.Parallel the test takes up once it
+// calls Parallel, such as the number of machines it boots, so heavy
+// tests don't overcommit resources shared by the suite. The default
+// weight is 1. A weight above Options.Parallel is reduced to it, so the
+// test runs alone rather than never. SetWeight must be called before
+// Parallel.
+func (t *H) SetWeight(weight int) {
+	if t.isParallel {
+		panic("testing: t.SetWeight called after t.Parallel")
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	if weight > t.suite.opts.Parallel {
+		weight = t.suite.opts.Parallel
+	}
+	t.weight = weight
+}
+
+// slots returns how much of Options.Parallel the test holds while it
+// runs. Sequential tests share the slot of the test running them.
+func (t *H) slots() int {
+	if !t.isParallel || t.weight < 1 {
+		return 1
+	}
+	return t.weight
+}
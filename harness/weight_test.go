@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSuiteWeight(t *testing.T) {
+	const parallel = 4
+	var load, peak, overloads int32
+	run := func(weight int) func(h *H) {
+		return func(h *H) {
+			h.SetWeight(weight)
+			h.Parallel()
+			if weight > parallel {
+				weight = parallel
+			}
+			n := atomic.AddInt32(&load, int32(weight))
+			defer atomic.AddInt32(&load, -int32(weight))
+			if n > parallel {
+				atomic.AddInt32(&overloads, 1)
+			}
+			for {
+				max := atomic.LoadInt32(&peak)
+				if n <= max || atomic.CompareAndSwapInt32(&peak, max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	tests := Tests{}
+	for i := 0; i < 6; i++ {
+		tests.Add(fmt.Sprintf("Light%d", i), run(1))
+		tests.Add(fmt.Sprintf("Medium%d", i), run(2))
+	}
+	tests.Add("Heavy", run(4))
+	tests.Add("TooHeavy", run(8))
+
+	suite := NewSuite(Options{Parallel: parallel}, tests)
+	if err := suite.runTests(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if overloads != 0 {
+		t.Errorf("tests exceeded the parallel budget %d times", overloads)
+	}
+	if peak < 2 {
+		t.Errorf("tests didn't run in parallel")
+	}
+}
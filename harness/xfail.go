@@ -0,0 +1,71 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExpectFailure marks the test as known to be broken, for the reason
+// given. If it fails it is reported as XFAIL and doesn't fail its parent
+// or the suite; if it passes it is reported as XPASS, an unexpected pass,
+// so the fix is noticed and the mark can be removed. Failures of its
+// subtests are expected too. Call ExpectFailure before the test can
+// fail; failed tests are not retried.
+func (t *H) ExpectFailure(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.xfail = true
+	t.xfailReason = reason
+}
+
+// expectsFailure reports whether ExpectFailure was called on the test
+// itself.
+func (t *H) expectsFailure() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.xfail
+}
+
+// expectedFailure returns whether the test or an ancestor is expected to
+// fail, and why.
+func (t *H) expectedFailure() (bool, string) {
+	for c := t; c != nil; c = c.parent {
+		c.mu.RLock()
+		xfail, reason := c.xfail, c.xfailReason
+		c.mu.RUnlock()
+		if xfail {
+			return true, reason
+		}
+	}
+	return false, ""
+}
+
+// reportUnexpectedPasses lists the tests which passed despite
+// ExpectFailure.
+func (s *Suite) reportUnexpectedPasses(out io.Writer) {
+	var names []string
+	for _, r := range s.Results() {
+		if r.Result == "XPASS" {
+			names = append(names, r.Name)
+		}
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(out, "harness: %d tests expected to fail passed, remove ExpectFailure: %s\n",
+			len(names), strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestExpectFailure(t *testing.T) {
+	var onFailure []string
+	tests := Tests{
+		"Broken": func(h *H) {
+			h.ExpectFailure("bug 123")
+			h.Run("Sub", func(h *H) {
+				h.Error("still broken")
+			})
+		},
+		"Fixed": func(h *H) {
+			h.ExpectFailure("bug 456")
+		},
+		"Parent": func(h *H) {
+			h.Run("Broken", func(h *H) {
+				h.ExpectFailure("bug 789")
+				h.Fatal("still broken")
+			})
+			h.Run("Good", func(h *H) {})
+		},
+	}
+
+	opts := Options{
+		Retries:   1,
+		OnFailure: func(name, dir string) { onFailure = append(onFailure, name) },
+	}
+	suite := NewSuite(opts, tests)
+	var out, tap bytes.Buffer
+	if err := suite.runTests(&out, &tap); err != nil {
+		t.Fatalf("got %v; want no error\n%s", err, out.String())
+	}
+	suite.reportUnexpectedPasses(&out)
+
+	want := map[string]string{
+		"Broken":        "XFAIL",
+		"Broken/Sub":    "XFAIL",
+		"Fixed":         "XPASS",
+		"Parent":        "PASS",
+		"Parent/Broken": "XFAIL",
+		"Parent/Good":   "PASS",
+	}
+	for _, r := range suite.Results() {
+		if r.Result != want[r.Name] {
+			t.Errorf("%s: got %s; want %s", r.Name, r.Result, want[r.Name])
+		}
+		if r.Attempts != 1 {
+			t.Errorf("%s: retried an expected failure", r.Name)
+		}
+	}
+	if len(onFailure) != 0 {
+		t.Errorf("OnFailure called for expected failures %q", onFailure)
+	}
+	for _, s := range []string{
+		"--- XFAIL: Broken (",
+		"expected failure: bug 123)",
+		"--- XPASS: Fixed (",
+		"1 tests expected to fail passed, remove ExpectFailure: Fixed",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output missing %q:\n%s", s, out.String())
+		}
+	}
+	for _, s := range []string{
+		"not ok 1 - Broken # TODO bug 123",
+		"ok 2 - Fixed # TODO bug 456",
+		"    not ok 1 - Parent/Broken # TODO bug 789",
+	} {
+		if !strings.Contains(tap.String(), s) {
+			t.Errorf("TAP missing %q:\n%s", s, tap.String())
+		}
+	}
+
+	// an unexpected failure still fails the suite
+	suite = NewSuite(Options{}, Tests{
+		"Broken": func(h *H) { h.ExpectFailure("bug 123"); h.Fail() },
+		"Failed": func(h *H) { h.Fail() },
+	})
+	if err := suite.runTests(ioutil.Discard, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+}
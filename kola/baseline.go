@@ -0,0 +1,158 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/yaml"
+
+	"github.com/coreos/mantle/harness"
+)
+
+// Baseline lists tests known to fail, so runs can be compared against
+// it rather than requiring every test to pass, for example:
+//
+//     known_failures:
+//       - tests: [coreos.tpm.*]
+//         platforms: [qemu]
+//         architectures: [arm64]
+//         reason: https://github.com/coreos/bugs/issues/1234
+//
+// Empty lists in an entry match anything.
+type Baseline struct {
+	KnownFailures []KnownFailure `yaml:"known_failures"`
+}
+
+// KnownFailure marks the tests matching all of its criteria as expected
+// to fail.
+type KnownFailure struct {
+	Tests         []string `yaml:"tests"` // glob patterns
+	Platforms     []string `yaml:"platforms"`
+	Architectures []string `yaml:"architectures"`
+	Reason        string   `yaml:"reason"`
+}
+
+// BaselineComparison sorts the top-level tests of a run by how their
+// results differ from a Baseline.
+type BaselineComparison struct {
+	Regressions   []string // failed but not known to fail
+	KnownFailures []string // failed as expected
+	Fixes         []string // known to fail but passed
+}
+
+// LoadBaseline parses the YAML baseline at path.
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var baseline Baseline
+	if err := yaml.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("parsing baseline %q: %v", path, err)
+	}
+
+	for i, known := range baseline.KnownFailures {
+		if len(known.Tests) == 0 {
+			return nil, fmt.Errorf("baseline %q: entry %d: no tests", path, i)
+		}
+		for _, pattern := range known.Tests {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("baseline %q: entry %d: %q: %v", path, i, pattern, err)
+			}
+		}
+	}
+
+	return &baseline, nil
+}
+
+// KnownFailure returns the entry expecting the test to fail on the given
+// platform and architecture, or nil if it is expected to pass.
+func (b *Baseline) KnownFailure(name, pltfrm, arch string) *KnownFailure {
+	for i := range b.KnownFailures {
+		if b.KnownFailures[i].matches(name, pltfrm, arch) {
+			return &b.KnownFailures[i]
+		}
+	}
+	return nil
+}
+
+func (k *KnownFailure) matches(name, pltfrm, arch string) bool {
+	match := false
+	for _, pattern := range k.Tests {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			match = true
+			break
+		}
+	}
+	if !match {
+		return false
+	}
+	if len(k.Platforms) > 0 && !contains(k.Platforms, pltfrm) {
+		return false
+	}
+	if len(k.Architectures) > 0 && !contains(k.Architectures, arch) {
+		return false
+	}
+	return true
+}
+
+// Compare sorts the top-level results by the baseline. Tests that were
+// not run count as failures; skipped tests are left out.
+func (b *Baseline) Compare(results []harness.TestResult, pltfrm, arch string) BaselineComparison {
+	var cmp BaselineComparison
+	for _, r := range results {
+		if strings.Contains(r.Name, "/") {
+			continue
+		}
+		known := b.KnownFailure(r.Name, pltfrm, arch) != nil
+		switch r.Result {
+		case "FAIL", "NOT RUN":
+			if known {
+				cmp.KnownFailures = append(cmp.KnownFailures, r.Name)
+			} else {
+				cmp.Regressions = append(cmp.Regressions, r.Name)
+			}
+		case "PASS", "FLAKY", "WARN":
+			if known {
+				cmp.Fixes = append(cmp.Fixes, r.Name)
+			}
+		}
+	}
+	return cmp
+}
+
+// report writes the known failures, fixes, and regressions of a run
+// to w.
+func (b *Baseline) report(w io.Writer, cmp BaselineComparison, pltfrm, arch string) {
+	for _, name := range cmp.KnownFailures {
+		reason := b.KnownFailure(name, pltfrm, arch).Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		fmt.Fprintf(w, "--- KNOWN FAILURE: %s (%s)\n", name, reason)
+	}
+	for _, name := range cmp.Fixes {
+		fmt.Fprintf(w, "--- FIXED: %s passed, remove it from the baseline\n", name)
+	}
+	for _, name := range cmp.Regressions {
+		fmt.Fprintf(w, "--- REGRESSION: %s\n", name)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache implements a content-addressed store for test assets
+// such as images and container tarballs. The cache may be shared by
+// concurrent tests and kola processes; each asset is downloaded once.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/mantle/sdk"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "kola/cache")
+
+// Cache stores assets under a directory, named by their SHA-256 digest.
+type Cache struct {
+	dir string
+}
+
+// DefaultDir returns the per-user cache directory for assets.
+func DefaultDir() string {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		base = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return filepath.Join(base, "kola", "assets")
+}
+
+// New returns a cache using dir, which is created if needed.
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Fetch returns the path to the cached asset with the given SHA-256
+// digest, downloading it from url if it is not already present. The
+// downloaded data must match the digest. The returned file must not be
+// modified.
+func (c *Cache) Fetch(url, digest string) (string, error) {
+	digest = strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+	if len(digest) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid SHA-256 digest %q for %s", digest, url)
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("invalid SHA-256 digest %q for %s: %v", digest, url, err)
+	}
+
+	path := filepath.Join(c.dir, "sha256", digest)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	partial := filepath.Join(c.dir, "partial", digest)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(partial), 0777); err != nil {
+		return "", err
+	}
+
+	unlock, err := lock(partial + ".lock")
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	// another process may have finished the download while we waited
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	// a partial download left behind would be resumed by the next
+	// fetch, possibly from another url, so always start over
+	if err := sdk.DownloadFile(partial, url, nil); err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("downloading %s: %v", url, err)
+	}
+
+	got, err := fileDigest(partial)
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	if got != digest {
+		os.Remove(partial)
+		return "", fmt.Errorf("%s has SHA-256 %s, expected %s", url, got, digest)
+	}
+
+	if err := os.Chmod(partial, 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return "", err
+	}
+
+	plog.Infof("Cached %s as %s", url, digest)
+	return path, nil
+}
+
+// lock takes an exclusive lock on path, waiting for any other holder.
+func lock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking %s: %v", path, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const asset = "some test asset"
+
+func assetDigest() string {
+	sum := sha256.Sum256([]byte(asset))
+	return hex.EncodeToString(sum[:])
+}
+
+func tempCache(t *testing.T) (*Cache, string) {
+	dir, err := ioutil.TempDir("", "kola-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(dir), dir
+}
+
+// checkNoPartial fails the test if a partial download was left behind.
+func checkNoPartial(t *testing.T, dir, digest string) {
+	if _, err := os.Stat(filepath.Join(dir, "partial", digest)); !os.IsNotExist(err) {
+		t.Errorf("partial download was left behind: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sha256", digest)); !os.IsNotExist(err) {
+		t.Errorf("failed download was cached: %v", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(asset))
+	}))
+	defer srv.Close()
+	c, dir := tempCache(t)
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 2; i++ {
+		path, err := c.Fetch(srv.URL, "sha256:"+assetDigest())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != asset {
+			t.Errorf("fetched %q, expected %q", data, asset)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("downloaded the asset %d times, expected once", hits)
+	}
+}
+
+func TestFetchInvalidDigest(t *testing.T) {
+	c, dir := tempCache(t)
+	defer os.RemoveAll(dir)
+
+	for _, digest := range []string{"", "abc", "sha256:" + assetDigest()[1:] + "x"} {
+		if _, err := c.Fetch("http://invalid.", digest); err == nil {
+			t.Errorf("fetching with digest %q succeeded", digest)
+		}
+	}
+}
+
+func TestFetchDigestMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not the asset"))
+	}))
+	defer srv.Close()
+	c, dir := tempCache(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := c.Fetch(srv.URL, assetDigest()); err == nil {
+		t.Fatal("fetching the wrong data succeeded")
+	}
+	checkNoPartial(t, dir, assetDigest())
+}
+
+func TestFetchDownloadError(t *testing.T) {
+	// Send half the asset and then drop the connection, leaving a partial
+	// file for DownloadFile to resume until it gives up.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte(asset[:5]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+	c, dir := tempCache(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := c.Fetch(srv.URL, assetDigest()); err == nil {
+		t.Fatal("fetching from a failing server succeeded")
+	}
+	checkNoPartial(t, dir, assetDigest())
+}
+
+func TestFetchConcurrent(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		// give the other fetches time to wait on the lock
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(asset))
+	}))
+	defer srv.Close()
+	_, dir := tempCache(t)
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	paths := make([]string, 8)
+	errs := make([]error, len(paths))
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// a Cache per fetch, as separate kola processes would have
+			paths[i], errs[i] = New(dir).Fetch(srv.URL, assetDigest())
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range paths {
+		if errs[i] != nil {
+			t.Errorf("fetch %d: %v", i, errs[i])
+		} else if paths[i] != paths[0] {
+			t.Errorf("fetch %d returned %s, expected %s", i, paths[i], paths[0])
+		}
+	}
+	if hits != 1 {
+		t.Errorf("downloaded the asset %d times, expected once", hits)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/platform"
+)
+
+// ChaosTag marks tests whose machines may be disrupted by chaos mode.
+const ChaosTag = "resilient"
+
+const (
+	chaosMinPause = 5 * time.Second
+	chaosMaxPause = 30 * time.Second
+)
+
+// chaosSeed returns the seed for a test's chaos, derived from ChaosSeed
+// and the test name so that each test is reproducible on its own.
+func chaosSeed(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return ChaosSeed ^ int64(h.Sum64())
+}
+
+// startChaos disrupts machines in c at random until the returned function
+// is called. About every ChaosInterval it picks a machine and either
+// reboots it or, where supported, pauses it for a while. Every action is
+// logged to the test.
+func startChaos(h *harness.H, c platform.Cluster) func() {
+	seed := chaosSeed(h.Name())
+	rng := rand.New(rand.NewSource(seed))
+	h.Logf("chaos: seed %d (from --chaos-seed=%d)", seed, ChaosSeed)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			wait := ChaosInterval/2 + time.Duration(rng.Int63n(int64(ChaosInterval)))
+			select {
+			case <-stop:
+				return
+			case <-time.After(wait):
+			}
+
+			machines := c.Machines()
+			if len(machines) == 0 {
+				continue
+			}
+			m := machines[rng.Intn(len(machines))]
+			pause := chaosMinPause + time.Duration(rng.Int63n(int64(chaosMaxPause-chaosMinPause)))
+			if rng.Intn(2) == 0 {
+				if err := m.Pause(); err == nil {
+					h.Logf("chaos: paused %s for %v", m.ID(), pause)
+					select {
+					case <-stop:
+					case <-time.After(pause):
+					}
+					if err := m.Resume(); err != nil {
+						h.Errorf("chaos: resuming %s: %v", m.ID(), err)
+					}
+					continue
+				} else if err != platform.ErrNotSupported {
+					h.Errorf("chaos: pausing %s: %v", m.ID(), err)
+					continue
+				}
+			}
+
+			h.Logf("chaos: rebooting %s", m.ID())
+			if err := m.Reboot(); err != nil {
+				h.Errorf("chaos: rebooting %s: %v", m.ID(), err)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
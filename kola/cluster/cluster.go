@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 
 	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/cache"
 	"github.com/coreos/mantle/platform"
 )
 
@@ -30,12 +31,22 @@ type TestCluster struct {
 	*harness.H
 	platform.Cluster
 	NativeFuncs []string
+	Assets      *cache.Cache
 }
 
 // Run runs f as a subtest and reports whether f succeeded.
 func (t *TestCluster) Run(name string, f func(c TestCluster)) bool {
 	return t.H.Run(name, func(h *harness.H) {
-		f(TestCluster{H: h, Cluster: t.Cluster})
+		f(TestCluster{H: h, Cluster: t.Cluster, Assets: t.Assets})
+	})
+}
+
+// RunMatrix runs f as a subtest for each combination of the parameters
+// in m, as harness.H.RunMatrix does, and reports whether all of them
+// succeeded.
+func (t *TestCluster) RunMatrix(m harness.Matrix, f func(c TestCluster, p harness.Params)) bool {
+	return t.H.RunMatrix(m, func(h *harness.H, p harness.Params) {
+		f(TestCluster{H: h, Cluster: t.Cluster, Assets: t.Assets}, p)
 	})
 }
 
@@ -90,3 +101,13 @@ func (t *TestCluster) DropFile(localPath string) error {
 	}
 	return nil
 }
+
+// FetchAsset returns the local path to a file downloaded from url, which
+// must have the given SHA-256 digest. Assets are cached across tests and
+// runs so each is only downloaded once.
+func (t *TestCluster) FetchAsset(url, sha256 string) (string, error) {
+	if t.Assets == nil {
+		return "", fmt.Errorf("no asset cache configured")
+	}
+	return t.Assets.Fetch(url, sha256)
+}
@@ -0,0 +1,341 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/yaml"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// CompliancePolicy is a set of hardening checks, such as those of a CIS
+// benchmark, declared in YAML. It is run against a booted machine as a
+// single test with a subtest for each check, for example:
+//
+//     name: coreos.compliance.cis
+//     platforms: [qemu, gce]
+//     tags: [compliance]
+//     sysctl:
+//       - name: "3.1.1"
+//         key: net.ipv4.ip_forward
+//         value: "0"
+//     mounts:
+//       - path: /tmp
+//         options: [nodev, nosuid, noexec]
+//     sshd:
+//       - key: PermitRootLogin
+//         value: "no"
+//     files:
+//       - path: /etc/shadow
+//         mode: "0640"
+//         owner: root
+//         group: root
+//
+// Each check's subtest is named after the check, such as the rule
+// number in the benchmark, or else its sysctl key, path or sshd option.
+type CompliancePolicy struct {
+	Name          string        `yaml:"name"`
+	Platforms     []string      `yaml:"platforms"`
+	Architectures []string      `yaml:"architectures"`
+	Tags          []string      `yaml:"tags"`
+	UserData      string        `yaml:"user_data"`
+	Severity      string        `yaml:"severity"`
+	Sysctls       []SysctlCheck `yaml:"sysctl"`
+	Mounts        []MountCheck  `yaml:"mounts"`
+	SSHD          []SSHDCheck   `yaml:"sshd"`
+	Files         []FileCheck   `yaml:"files"`
+}
+
+// SysctlCheck checks the value of a kernel parameter.
+type SysctlCheck struct {
+	Name string `yaml:"name"`
+	// Key is the parameter, such as net.ipv4.ip_forward.
+	Key string `yaml:"key"`
+	// Value is what sysctl must report, ignoring differences in
+	// whitespace.
+	Value string `yaml:"value"`
+}
+
+// MountCheck checks that a path is a mount point with some options.
+type MountCheck struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	// Options must all be set, or not set if prefixed by "!".
+	Options []string `yaml:"options"`
+}
+
+// SSHDCheck checks an option of the effective sshd configuration.
+type SSHDCheck struct {
+	Name string `yaml:"name"`
+	// Key is the option, such as PermitRootLogin.
+	Key string `yaml:"key"`
+	// Value is what the option must be set to, ignoring case.
+	Value string `yaml:"value"`
+}
+
+// FileCheck checks the permissions and ownership of a file.
+type FileCheck struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	// Mode, if set, is the most permissive octal mode the file may
+	// have: "0640" allows 0600 but not 0644.
+	Mode string `yaml:"mode"`
+	// Owner and Group, if set, are the names the file must belong to.
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+
+	mode uint64
+}
+
+// LoadCompliancePolicy parses the YAML policy at path and registers its
+// test.
+func LoadCompliancePolicy(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var policy CompliancePolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("parsing compliance policy %q: %v", path, err)
+	}
+
+	t, err := policy.test()
+	if err != nil {
+		return fmt.Errorf("compliance policy %q: %v", path, err)
+	}
+	register.Register(t)
+	return nil
+}
+
+// test validates the policy and converts it to a registered test.
+func (p *CompliancePolicy) test() (*register.Test, error) {
+	if p.Name == "" {
+		return nil, fmt.Errorf("policy is missing a name")
+	}
+	if _, ok := register.Tests[p.Name]; ok {
+		return nil, fmt.Errorf("test %q already registered", p.Name)
+	}
+	if len(p.Sysctls)+len(p.Mounts)+len(p.SSHD)+len(p.Files) == 0 {
+		return nil, fmt.Errorf("test %q has no checks", p.Name)
+	}
+	if p.UserData == "" {
+		p.UserData = "#cloud-config"
+	}
+
+	t := &register.Test{
+		Name:          p.Name,
+		Platforms:     p.Platforms,
+		Architectures: p.Architectures,
+		Tags:          p.Tags,
+		ClusterSize:   1,
+		UserData:      p.UserData,
+	}
+	if p.Severity != "" {
+		var err error
+		if t.Severity, err = harness.ParseSeverity(p.Severity); err != nil {
+			return nil, fmt.Errorf("test %q: severity: %v", p.Name, err)
+		}
+	}
+
+	for i, chk := range p.Sysctls {
+		if chk.Key == "" {
+			return nil, fmt.Errorf("test %q: sysctl check %d has no key", p.Name, i)
+		}
+	}
+	for i, chk := range p.Mounts {
+		if chk.Path == "" {
+			return nil, fmt.Errorf("test %q: mount check %d has no path", p.Name, i)
+		}
+	}
+	for i, chk := range p.SSHD {
+		if chk.Key == "" {
+			return nil, fmt.Errorf("test %q: sshd check %d has no key", p.Name, i)
+		}
+	}
+	for i := range p.Files {
+		chk := &p.Files[i]
+		if chk.Path == "" {
+			return nil, fmt.Errorf("test %q: file check %d has no path", p.Name, i)
+		}
+		if chk.Mode != "" {
+			var err error
+			if chk.mode, err = strconv.ParseUint(chk.Mode, 8, 32); err != nil {
+				return nil, fmt.Errorf("test %q: file check %d: invalid mode %q", p.Name, i, chk.Mode)
+			}
+		}
+	}
+
+	policy := *p
+	t.Run = func(c cluster.TestCluster) {
+		policy.run(c, c.Machines()[0])
+	}
+	return t, nil
+}
+
+// run runs each of the policy's checks against m as a subtest, grouped
+// by their kind.
+func (p *CompliancePolicy) run(c cluster.TestCluster, m platform.Machine) {
+	if len(p.Sysctls) > 0 {
+		c.Run("sysctl", func(c cluster.TestCluster) {
+			for _, chk := range p.Sysctls {
+				chk := chk
+				c.Run(checkName(chk.Name, chk.Key), func(c cluster.TestCluster) {
+					chk.check(c, m)
+				})
+			}
+		})
+	}
+	if len(p.Mounts) > 0 {
+		c.Run("mounts", func(c cluster.TestCluster) {
+			for _, chk := range p.Mounts {
+				chk := chk
+				c.Run(checkName(chk.Name, chk.Path), func(c cluster.TestCluster) {
+					chk.check(c, m)
+				})
+			}
+		})
+	}
+	if len(p.SSHD) > 0 {
+		c.Run("sshd", func(c cluster.TestCluster) {
+			config, err := sshdConfig(m)
+			if err != nil {
+				c.Fatal(err)
+			}
+			for _, chk := range p.SSHD {
+				chk := chk
+				c.Run(checkName(chk.Name, chk.Key), func(c cluster.TestCluster) {
+					chk.check(c, config)
+				})
+			}
+		})
+	}
+	if len(p.Files) > 0 {
+		c.Run("files", func(c cluster.TestCluster) {
+			for _, chk := range p.Files {
+				chk := chk
+				c.Run(checkName(chk.Name, chk.Path), func(c cluster.TestCluster) {
+					chk.check(c, m)
+				})
+			}
+		})
+	}
+}
+
+// checkName names a check's subtest, preferring the name given in the
+// policy. Paths lose their leading slash so they don't read as an empty
+// level of subtests.
+func checkName(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return strings.TrimPrefix(fallback, "/")
+}
+
+func (chk SysctlCheck) check(c cluster.TestCluster, m platform.Machine) {
+	out, err := m.SSH("sysctl -n " + chk.Key)
+	if err != nil {
+		c.Fatalf("reading sysctl %s: %v: %s", chk.Key, err, out)
+	}
+	got := strings.Join(strings.Fields(string(out)), " ")
+	want := strings.Join(strings.Fields(chk.Value), " ")
+	if got != want {
+		c.Errorf("sysctl %s is %q, expected %q", chk.Key, got, want)
+	}
+}
+
+func (chk MountCheck) check(c cluster.TestCluster, m platform.Machine) {
+	out, err := m.SSH("findmnt -n -o OPTIONS --mountpoint " + chk.Path)
+	if err != nil {
+		c.Fatalf("%s is not a mount point: %v", chk.Path, err)
+	}
+	set := make(map[string]bool)
+	for _, opt := range strings.Split(strings.TrimSpace(string(out)), ",") {
+		set[opt] = true
+	}
+	for _, opt := range chk.Options {
+		if strings.HasPrefix(opt, "!") {
+			if set[opt[1:]] {
+				c.Errorf("%s is mounted with %s", chk.Path, opt[1:])
+			}
+		} else if !set[opt] {
+			c.Errorf("%s is mounted without %s: %s", chk.Path, opt, out)
+		}
+	}
+}
+
+// sshdConfig returns the effective sshd configuration on m as lists of
+// values by lower case option name.
+func sshdConfig(m platform.Machine) (map[string][]string, error) {
+	out, err := m.SSH("sudo sshd -T")
+	if err != nil {
+		return nil, fmt.Errorf("reading sshd configuration: %v: %s", err, out)
+	}
+	config := make(map[string][]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		key := strings.ToLower(fields[0])
+		config[key] = append(config[key], fields[1])
+	}
+	return config, nil
+}
+
+func (chk SSHDCheck) check(c cluster.TestCluster, config map[string][]string) {
+	values, ok := config[strings.ToLower(chk.Key)]
+	if !ok {
+		c.Fatalf("sshd option %s is not set", chk.Key)
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, chk.Value) {
+			return
+		}
+	}
+	c.Errorf("sshd option %s is %q, expected %q", chk.Key, strings.Join(values, ", "), chk.Value)
+}
+
+func (chk FileCheck) check(c cluster.TestCluster, m platform.Machine) {
+	out, err := m.SSH("sudo stat -c '%a %U %G' " + chk.Path)
+	if err != nil {
+		c.Fatalf("stat %s: %v: %s", chk.Path, err, out)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 3 {
+		c.Fatalf("stat %s: unexpected output %q", chk.Path, out)
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		c.Fatalf("stat %s: invalid mode %q", chk.Path, fields[0])
+	}
+	if chk.Mode != "" && mode&^chk.mode != 0 {
+		c.Errorf("%s has mode %04o, expected %04o or more restrictive", chk.Path, mode, chk.mode)
+	}
+	if chk.Owner != "" && fields[1] != chk.Owner {
+		c.Errorf("%s is owned by %s, expected %s", chk.Path, fields[1], chk.Owner)
+	}
+	if chk.Group != "" && fields[2] != chk.Group {
+		c.Errorf("%s has group %s, expected %s", chk.Path, fields[2], chk.Group)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+// FlakeStat counts how often a test has flaked in past runs.
+type FlakeStat struct {
+	Runs   int // runs which passed, failed, or flaked
+	Flakes int // runs which only passed on a retry
+}
+
+// Rate is the fraction of runs in which the test flaked.
+func (s FlakeStat) Rate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Flakes) / float64(s.Runs)
+}
+
+// FlakeStats maps test names to how often they have flaked.
+type FlakeStats map[string]FlakeStat
+
+// LoadFlakeStats counts the flakes of each top-level test on a platform
+// in the newline-delimited JSON records written by WriteResults, which
+// may span many runs, or exported from a database they were loaded into.
+func LoadFlakeStats(path, pltfrm string) (FlakeStats, error) {
+	history, err := LoadHistory(path, pltfrm)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(FlakeStats)
+	for _, h := range history {
+		stats[h.Test] = FlakeStat{Runs: h.Runs, Flakes: h.Flakes}
+	}
+	return stats, nil
+}
+
+// Retries returns the retries for harness.H.SetRetries to allow the test:
+// one if it flaked in more than threshold of its past runs, otherwise
+// none, so failures of tests which aren't known to flake are final.
+func (fs FlakeStats) Retries(name string, threshold float64) int {
+	if fs[name].Rate() > threshold {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/yaml"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+)
+
+const (
+	// Failures of blocking tests fail the test run.
+	Blocking = "blocking"
+	// Failures of informational tests are reported but do not fail
+	// the test run.
+	Informational = "informational"
+)
+
+// GatingPolicy decides which test failures fail a test run, for example:
+//
+//     default: blocking
+//     rules:
+//       - tests: [coreos.tpm.*]
+//         policy: informational
+//       - tags: [new]
+//         platforms: [aws, gce]
+//         streams: [alpha]
+//         policy: informational
+//
+// The first matching rule applies. Empty lists in a rule match anything.
+type GatingPolicy struct {
+	Default string       `yaml:"default"`
+	Rules   []GatingRule `yaml:"rules"`
+}
+
+// GatingRule sets the policy for tests matching all of its criteria.
+type GatingRule struct {
+	Tests     []string `yaml:"tests"` // glob patterns
+	Tags      []string `yaml:"tags"`
+	Platforms []string `yaml:"platforms"`
+	Streams   []string `yaml:"streams"`
+	Policy    string   `yaml:"policy"`
+}
+
+// LoadGatingPolicy parses the YAML gating policy at path.
+func LoadGatingPolicy(path string) (*GatingPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy GatingPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parsing gating policy %q: %v", path, err)
+	}
+
+	if policy.Default == "" {
+		policy.Default = Blocking
+	}
+	if err := checkPolicy(policy.Default); err != nil {
+		return nil, fmt.Errorf("gating policy %q: default: %v", path, err)
+	}
+	for i, rule := range policy.Rules {
+		if err := checkPolicy(rule.Policy); err != nil {
+			return nil, fmt.Errorf("gating policy %q: rule %d: %v", path, i, err)
+		}
+		for _, pattern := range rule.Tests {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("gating policy %q: rule %d: %q: %v", path, i, pattern, err)
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+func checkPolicy(policy string) error {
+	if policy != Blocking && policy != Informational {
+		return fmt.Errorf("invalid policy %q, must be %q or %q", policy, Blocking, Informational)
+	}
+	return nil
+}
+
+// IsBlocking reports whether a failure of the test on the given platform
+// and stream should fail the test run.
+func (p *GatingPolicy) IsBlocking(t *register.Test, pltfrm, stream string) bool {
+	for _, rule := range p.Rules {
+		if rule.matches(t, pltfrm, stream) {
+			return rule.Policy == Blocking
+		}
+	}
+	return p.Default == Blocking
+}
+
+func (r *GatingRule) matches(t *register.Test, pltfrm, stream string) bool {
+	if len(r.Tests) > 0 {
+		match := false
+		for _, pattern := range r.Tests {
+			if ok, _ := filepath.Match(pattern, t.Name); ok {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if len(r.Tags) > 0 && !hasTag(t, r.Tags) {
+		return false
+	}
+	if len(r.Platforms) > 0 && !contains(r.Platforms, pltfrm) {
+		return false
+	}
+	if len(r.Streams) > 0 && !contains(r.Streams, stream) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// failures splits the named failed tests into those the policy
+// considers blocking and those it considers informational.
+func (p *GatingPolicy) failures(failed []string, tests map[string]*register.Test, pltfrm, stream string) (blocking, informational []string) {
+	for _, name := range failed {
+		t, ok := tests[name]
+		if !ok || p.IsBlocking(t, pltfrm, stream) {
+			blocking = append(blocking, name)
+		} else {
+			informational = append(informational, name)
+		}
+	}
+	return
+}
+
+// failedTests returns the names of failed top-level tests. Tests that
+// were not run count as failures, since a test cannot pass without
+// running.
+func failedTests(results []harness.TestResult) []string {
+	var failed []string
+	for _, r := range results {
+		if (r.Result == "FAIL" || r.Result == "NOT RUN") && !strings.Contains(r.Name, "/") {
+			failed = append(failed, r.Name)
+		}
+	}
+	return failed
+}
@@ -15,7 +15,10 @@
 package kola
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -26,6 +29,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/cache"
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
 	"github.com/coreos/mantle/platform"
@@ -35,6 +39,8 @@ import (
 	"github.com/coreos/mantle/platform/machine/gcloud"
 	"github.com/coreos/mantle/platform/machine/qemu"
 	"github.com/coreos/mantle/system"
+	"github.com/coreos/mantle/system/exec"
+	"github.com/coreos/mantle/version"
 )
 
 var (
@@ -45,8 +51,67 @@ var (
 	GCEOptions  = gcloudapi.Options{Options: &Options} // glue to set platform options from main
 	AWSOptions  = awsapi.Options{Options: &Options}    // glue to set platform options from main
 
-	TestParallelism int    //glue var to set test parallelism from main
-	TAPFile         string // if not "", write TAP results here
+	TestParallelism int      //glue var to set test parallelism from main
+	TAPFile         string   // if not "", write TAP results here
+	JUnitFile       string   // if not "", write a JUnit XML report here
+	JSONFile        string   // if not "", write go test -json events here, "-" for stdout
+	CollapseLogs    bool     // collapse repeated test log messages
+	LogRate         int      // limit test log messages per second (0 means unlimited)
+	LogTimestamps   string   // prefix test log lines with rfc3339 or relative timestamps, or "off"
+	ResultsFile     string   // if not "", append JSON test results here
+	TPMPCRFile      string   // if not "", JSON file of expected TPM PCR values
+	Tags            []string // if not empty, only run tests with one of these tags and matching TagMatch
+	TagMatch        string   // if not "", only run tests whose tags match this expression
+	ListTests       string   // if not "", list the tests matching this regexp which would run instead of running them
+	Cgroup          string   // if not "", cgroup v2 directory for per-test cgroups
+	CPUQuota        float64  // CPUs each test's helper processes may use (0 means unlimited)
+	CPUSet          string   // if not "", CPUs each test's helper processes may run on
+	AssetCacheDir   string   // directory to cache downloaded test assets in
+	GatingFile      string   // if not "", YAML policy of blocking and informational tests
+	Stream          string   // release stream being tested, used by the gating policy
+	BaselineFile    string   // if not "", YAML list of tests known to fail
+	QuotaCheck      string   // whether to warn or abort when quota is insufficient, or "off"
+	DebugAddr       string   // if not "", serve live test output over HTTP here
+	MaxProcs        int      // limit QEMU and helper processes across tests (0 means unlimited)
+	MaxFailures     int      // stop starting tests after this many fail (0 means unlimited)
+	FailFast        bool     // stop at the first failed test, cancelling running tests
+	OnFailureCmd    string   // if not "", shell command to run on the host when a test fails
+	InfraServer     bool     // serve NTP, DNS, and a proxy to cloud machines from a shared server
+
+	TestTimeout  time.Duration // fail tests running longer than this (0 means unlimited)
+	Watchdog     time.Duration // save goroutine stacks of tests silent this long (0 means disabled)
+	WatchdogKill bool          // also fail tests the watchdog finds stalled
+	Progress     time.Duration // print counts of running and finished tests this often (0 means disabled)
+	Slowest      int           // list this many of the slowest tests once the run finishes (0 means disabled)
+	ProfileTests bool          // write CPU and heap profiles of each test to its output directory
+	GracePeriod  time.Duration // when interrupted, wait this long for running tests to destroy their machines
+
+	Count         int  // run each test this many times
+	CountParallel bool // run the repeats of each test in parallel
+
+	FailSeverity = harness.Minor       // only failures of tests this severe fail the run
+	Quarantine   harness.Quarantine    // tests whose failures don't fail the run
+	FailBudget   harness.FailureBudget // failures tolerated before failing the run
+	LogLevel     = harness.LevelInfo   // drop leveled test log messages below this level
+	Retries      int                   // run failed tests again up to this many times
+	FlakeHistory string                // if not "", retry only tests which flaked in these past results
+	FlakeRate    float64               // fraction of past runs a test must flake in to be retried
+	DurHistory   string                // if not "", estimate the time left of the run from these past results
+	RerunFailed  bool                  // only run the tests which failed in the last run
+	Shard        harness.Shard         // if set, run only this shard of the tests
+	Shuffle      string                // start tests in random order: off, on, or a seed
+	DataDir      string                // if not "", directory of test data such as golden files
+	UpdateGolden bool                  // replace golden files instead of comparing with them
+
+	Flags map[string]string // kola's flags by name, recorded in reports
+
+	SecretsEnvPrefix  string // look up test secrets in environment variables with this prefix
+	SecretsDir        string // if not "", look up test secrets in files in this directory
+	SecretsGCPProject string // if not "", look up test secrets in this project's Secret Manager
+
+	Chaos         bool          // randomly disrupt machines of tests tagged ChaosTag
+	ChaosSeed     int64         // seed for chaos mode (0 means pick one)
+	ChaosInterval time.Duration // mean time between chaos actions
 )
 
 // NativeRunner is a closure passed to all kola test functions and used
@@ -103,6 +168,64 @@ func filterTests(tests map[string]*register.Test, pattern, platform string, vers
 	return r, nil
 }
 
+// procsPerMachine is how many processes each QEMU machine runs.
+func procsPerMachine() int {
+	if QEMUOptions.TPM {
+		return 2 // and swtpm
+	}
+	return 1
+}
+
+// checkMaxProcs ensures every test can start all of its machines within
+// MaxProcs. runTest reserves them all before booting any, which would
+// otherwise wait forever.
+func checkMaxProcs(tests map[string]*register.Test, pltfrm string) error {
+	if MaxProcs == 0 || pltfrm != "qemu" {
+		return nil
+	}
+	for name, t := range tests {
+		if need := procsPerMachine() * t.ClusterSize; need > MaxProcs {
+			return fmt.Errorf("--max-procs=%d is too low for %s, which may need %d processes", MaxProcs, name, need)
+		}
+	}
+	return nil
+}
+
+// tagMatch returns the expression selecting tests by tag, which is
+// TagMatch limited to the tests with one of Tags. Tag expressions have
+// no parentheses, so each tag is added to every alternative of TagMatch.
+func tagMatch() string {
+	if len(Tags) == 0 {
+		return TagMatch
+	}
+	if strings.TrimSpace(TagMatch) == "" {
+		return strings.Join(Tags, " || ")
+	}
+	var alts []string
+	for _, tag := range Tags {
+		for _, alt := range strings.Split(TagMatch, "||") {
+			alts = append(alts, tag+" && "+strings.TrimSpace(alt))
+		}
+	}
+	return strings.Join(alts, " || ")
+}
+
+// hasTag reports whether the test has any of the given tags. An empty tag
+// list matches all tests.
+func hasTag(t *register.Test, tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, want := range tags {
+		for _, have := range t.Tags {
+			if want == have {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // versionOutsideRange checks to see if version is outside [min, end). If end
 // is a zero value, it is ignored and there is no upper bound. If version is a
 // zero value, the bounds are ignored.
@@ -129,6 +252,127 @@ func versionOutsideRange(version, minVersion, endVersion semver.Version) bool {
 // outputDir is where various test logs and data will be written for
 // analysis after the test run. If it already exists it will be erased!
 func RunTests(pattern, pltfrm, outputDir string) error {
+	// check the harness options before starting any machines
+	opts := harness.Options{
+		OutputDir:    outputDir,
+		Parallel:     TestParallelism,
+		Verbose:      true,
+		CollapseLogs: CollapseLogs,
+		LogRate:      LogRate,
+		Cgroup:       Cgroup,
+		CPUQuota:     CPUQuota,
+		CPUSet:       CPUSet,
+		StreamAddr:   DebugAddr,
+		MaxProcs:     MaxProcs,
+		MaxFailures:  MaxFailures,
+		FailFast:     FailFast,
+		JUnitFile:    JUnitFile,
+		JSONFile:     JSONFile,
+		TestTimeout:  TestTimeout,
+		Watchdog:     Watchdog,
+		WatchdogKill: WatchdogKill,
+		FailSeverity: FailSeverity,
+		Quarantine:   Quarantine,
+		Retries:      Retries,
+		Shard:        Shard,
+		Shuffle:      Shuffle,
+		TagMatch:     tagMatch(),
+		List:         ListTests,
+		DataDir:      DataDir,
+		UpdateGolden: UpdateGolden,
+		Version:      version.Version,
+		Properties:   map[string]string{"platform": pltfrm, "pattern": pattern},
+	}
+	opts.FailureBudget = FailBudget
+	opts.LogLevel = LogLevel
+	opts.LogTimestamps = LogTimestamps
+	opts.Progress = Progress
+	opts.Slowest = Slowest
+	opts.TestCpuProfile = ProfileTests
+	opts.TestMemProfile = ProfileTests
+	opts.Count = Count
+	opts.CountParallel = CountParallel
+	opts.GracePeriod = GracePeriod
+	secrets, err := secretProviders()
+	if err != nil {
+		return err
+	}
+	opts.Secrets = secrets
+	for name, value := range Flags {
+		opts.Properties["flag."+name] = value
+	}
+	if OnFailureCmd != "" {
+		opts.OnFailure = func(name, dir string) {
+			runOnFailureCmd(name, dir, pltfrm)
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if opts.List != "" {
+		return listTests(opts, pattern, pltfrm)
+	}
+	// keep other runs out of outputDir before anything is written there
+	unlock, err := harness.LockOutputDir(outputDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var policy *GatingPolicy
+	if GatingFile != "" {
+		var err error
+		if policy, err = LoadGatingPolicy(GatingFile); err != nil {
+			return err
+		}
+	}
+	var baseline *Baseline
+	if BaselineFile != "" {
+		var err error
+		if baseline, err = LoadBaseline(BaselineFile); err != nil {
+			return err
+		}
+	}
+	var flakes FlakeStats
+	if FlakeHistory != "" {
+		if FlakeRate < 0 || FlakeRate > 1 {
+			return fmt.Errorf("flake rate must be between 0 and 1, not %v", FlakeRate)
+		}
+		var err error
+		if flakes, err = LoadFlakeStats(FlakeHistory, pltfrm); err != nil {
+			return err
+		}
+	}
+
+	if DurHistory != "" {
+		history, err := LoadHistory(DurHistory, pltfrm)
+		if err != nil {
+			return err
+		}
+		opts.ExpectedDurations = make(map[string]time.Duration)
+		for _, h := range history {
+			opts.ExpectedDurations[h.Test] = h.Mean()
+		}
+	}
+
+	// the harness erases the output directory, so read the last run's
+	// outcome first
+	var rerun map[string]bool
+	if RerunFailed {
+		state, err := LoadRunState(outputDir, pltfrm)
+		if err != nil {
+			return err
+		}
+		if len(state.Failed) == 0 {
+			plog.Noticef("No tests failed in the previous run")
+			return nil
+		}
+		rerun = make(map[string]bool)
+		for _, name := range state.Failed {
+			rerun[name] = true
+		}
+	}
+
 	// Avoid incurring cost of starting machine in getClusterSemver when
 	// either:
 	// 1) we already know 0 tests will run
@@ -138,6 +382,47 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 	if err != nil {
 		plog.Fatal(err)
 	}
+	for name, t := range tests {
+		// the harness only runs the shard and the tests matching
+		// the tag expression, so only plan for them
+		if match, _ := harness.MatchTags(opts.TagMatch, t.Tags); !match || !Shard.Contains(name) {
+			delete(tests, name)
+		} else if rerun != nil && !rerun[name] {
+			delete(tests, name)
+		}
+	}
+
+	if err := checkQuota(tests, pltfrm); err != nil {
+		return err
+	}
+
+	if err := checkMaxProcs(tests, pltfrm); err != nil {
+		return err
+	}
+
+	if Chaos {
+		if ChaosSeed == 0 {
+			ChaosSeed = time.Now().UnixNano()
+		}
+		if ChaosInterval <= 0 {
+			return fmt.Errorf("chaos interval must be positive, not %v", ChaosInterval)
+		}
+		plog.Noticef("Chaos mode enabled for tests tagged %q with --chaos-seed=%d", ChaosTag, ChaosSeed)
+	}
+
+	if InfraServer && len(tests) > 0 {
+		server, err := newInfraServer(pltfrm)
+		if err != nil {
+			return fmt.Errorf("creating infra server: %v", err)
+		}
+		defer func() {
+			if err := server.Destroy(); err != nil {
+				plog.Errorf("Destroying infra server: %v", err)
+			}
+		}()
+		Options.InfraHost = server.IP()
+		plog.Noticef("Machines will use the infra server at %s", Options.InfraHost)
+	}
 
 	var skipGetVersion bool
 	if len(tests) == 0 {
@@ -150,11 +435,13 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 		}
 	}
 
+	var versionStr string
 	if !skipGetVersion {
 		version, err := getClusterSemver(pltfrm, outputDir)
 		if err != nil {
 			plog.Fatal(err)
 		}
+		versionStr = version.String()
 
 		// one more filter pass now that we know real version
 		tests, err = filterTests(tests, pattern, pltfrm, *version)
@@ -163,18 +450,22 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 		}
 	}
 
-	opts := harness.Options{
-		OutputDir: outputDir,
-		Parallel:  TestParallelism,
-		Verbose:   true,
-	}
 	var htests harness.Tests
+	opts.TestTags = make(map[string][]string)
 	for _, test := range tests {
 		test := test // for the closure
 		run := func(h *harness.H) {
+			if flakes != nil {
+				h.SetRetries(flakes.Retries(test.Name, FlakeRate))
+				if h.Attempt() == 1 && flakes[test.Name].Flakes > 0 {
+					stat := flakes[test.Name]
+					h.Logf("Flaked in %d of %d past runs", stat.Flakes, stat.Runs)
+				}
+			}
 			runTest(h, test, pltfrm)
 		}
 		htests.Add(test.Name, run)
+		opts.TestTags[test.Name] = test.Tags
 	}
 
 	suite := harness.NewSuite(opts, htests)
@@ -187,15 +478,153 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 		}
 	}
 
+	if err2 := SaveRunState(outputDir, pltfrm, suite.Results()); err == nil && err2 != nil {
+		err = err2
+	}
+
+	if err2 := writeTimelineSummary(outputDir); err == nil && err2 != nil {
+		err = err2
+	}
+
+	if ResultsFile != "" {
+		if err2 := WriteResults(ResultsFile, pltfrm, versionStr, suite.Config(), suite.Results()); err == nil && err2 != nil {
+			err = err2
+		}
+	}
+
+	failed := failedTests(suite.Results())
+	out := summaryOutput()
+	if baseline != nil {
+		arch := architecture(pltfrm)
+		cmp := baseline.Compare(suite.Results(), pltfrm, arch)
+		baseline.report(out, cmp, pltfrm, arch)
+		failed = cmp.Regressions
+	}
+	if policy != nil {
+		blocking, informational := policy.failures(failed, tests, pltfrm, Stream)
+		for _, name := range informational {
+			fmt.Fprintf(out, "--- INFORMATIONAL: %s failed but does not block\n", name)
+		}
+		failed = blocking
+	}
+	// quarantined failures didn't fail the suite either
+	remaining := failed[:0]
+	for _, name := range failed {
+		if !Quarantine.Contains(name) {
+			remaining = append(remaining, name)
+		}
+	}
+	failed = remaining
+	if err == harness.SuiteFailed && (baseline != nil || policy != nil) && len(failed) == 0 {
+		err = nil
+	}
+
 	if err != nil {
-		fmt.Println("FAIL")
+		fmt.Fprintln(out, "FAIL")
+	} else if warned(suite.Results()) {
+		fmt.Fprintln(out, "PASS (with warnings)")
 	} else {
-		fmt.Println("PASS")
+		fmt.Fprintln(out, "PASS")
 	}
 
 	return err
 }
 
+// summaryOutput returns where RunTests writes the outcome of the run:
+// stdout, unless --json - has taken it for test events.
+func summaryOutput() io.Writer {
+	if JSONFile == "-" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// listTests prints the tests RunTests would run without starting any
+// machines. The harness applies the tag, shard, and list filters; tests
+// which would be skipped for the version of the OS under test are
+// still listed, since finding it out means booting a machine.
+func listTests(opts harness.Options, pattern, pltfrm string) error {
+	tests, err := filterTests(register.Tests, pattern, pltfrm, semver.Version{})
+	if err != nil {
+		return err
+	}
+	var htests harness.Tests
+	opts.TestTags = make(map[string][]string)
+	for _, test := range tests {
+		htests.Add(test.Name, func(h *harness.H) {})
+		opts.TestTags[test.Name] = test.Tags
+	}
+	return harness.NewSuite(opts, htests).Run()
+}
+
+// runOnFailureCmd runs OnFailureCmd for a failed test while its machines
+// still exist, saving its output in the test's output directory. The
+// test name, output directory and platform are passed in the
+// environment as KOLA_TEST, KOLA_OUTPUT_DIR and KOLA_PLATFORM.
+func runOnFailureCmd(name, dir, pltfrm string) {
+	cmd := exec.Command("sh", "-c", OnFailureCmd)
+	cmd.Env = append(os.Environ(),
+		"KOLA_TEST="+name,
+		"KOLA_OUTPUT_DIR="+dir,
+		"KOLA_PLATFORM="+pltfrm)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		plog.Errorf("%s: --on-failure command failed: %v", name, err)
+	}
+	if dir == "" {
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "on-failure.txt"), out, 0666); err != nil {
+		plog.Errorf("%s: saving --on-failure output: %v", name, err)
+	}
+}
+
+// writeTimelineSummary aggregates the provisioning timelines of all
+// machines in the run and saves the percentiles to outputDir.
+func writeTimelineSummary(outputDir string) error {
+	summaries, err := platform.SummarizeTimelines(outputDir)
+	if err != nil {
+		return fmt.Errorf("summarizing machine timelines: %v", err)
+	}
+	if len(summaries) == 0 {
+		return nil
+	}
+
+	for _, s := range summaries {
+		plog.Infof("Provisioning %s: p50 %.1fs p90 %.1fs p99 %.1fs max %.1fs (%d machines)",
+			s.Event, s.P50, s.P90, s.P99, s.Max, s.Machines)
+	}
+
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outputDir, "timeline-summary.json"), data, 0666)
+}
+
+// warned reports whether any test passed with warnings.
+func warned(results []harness.TestResult) bool {
+	for _, r := range results {
+		if r.Result == "WARN" {
+			return true
+		}
+	}
+	return false
+}
+
+// newInfraServer starts a platform.InfraServer for the cloud platforms
+// that support one.
+func newInfraServer(pltfrm string) (platform.InfraServer, error) {
+	switch pltfrm {
+	case "gce":
+		return gcloud.NewInfraServer(&GCEOptions)
+	case "aws":
+		return aws.NewInfraServer(&AWSOptions)
+	default:
+		return nil, fmt.Errorf("platform %q does not support an infra server", pltfrm)
+	}
+}
+
 // getClusterSemVer returns the CoreOS semantic version via starting a
 // machine and checking
 func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
@@ -249,7 +678,26 @@ func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
 // outputDir is where various test logs and data will be written for
 // analysis after the test run. It should already exist.
 func runTest(h *harness.H, t *register.Test, pltfrm string) {
+	if t.Severity != 0 {
+		h.SetSeverity(t.Severity)
+	}
+	if t.Retries != 0 {
+		h.SetRetries(t.Retries)
+	}
+	// skip before waiting for a slot if the test can't run anyway
+	h.RequireSecrets(t.Secrets...)
+	// Each machine counts against --parallel, so big clusters don't
+	// overcommit cloud quotas.
+	if t.ClusterSize > 1 {
+		h.SetWeight(t.ClusterSize)
+	}
 	h.Parallel()
+	if t.Exclusive {
+		h.Exclusive()
+	}
+	if len(t.Resources) > 0 {
+		h.Lock(t.Resources...)
+	}
 
 	// don't go too fast, in case we're talking to a rate limiting api like AWS EC2.
 	// FIXME(marineam): API requests must do their own
@@ -261,7 +709,26 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 	var c platform.Cluster
 	var err error
 
+	h.Phase("provision")
 	testDir := h.OutputDir()
+	// listed once the cluster is destroyed, when consoles are saved
+	defer func() {
+		if h.Failed() {
+			attachMachineLogs(h, testDir)
+		}
+	}()
+	// Reserve the processes of all the test's machines before booting
+	// any, so parallel tests can't each hold some while waiting for
+	// more. Machines beyond the cluster size wait for a free slot.
+	var procs *exec.Limiter
+	if pltfrm == "qemu" {
+		procs, err = h.Procs().Reserve(h.Context(), procsPerMachine()*t.ClusterSize)
+		if err != nil {
+			h.Fatalf("Reserving processes: %v", err)
+		}
+		defer procs.Close()
+	}
+
 	switch pltfrm {
 	case "qemu":
 		c, err = qemu.NewCluster(&QEMUOptions, testDir)
@@ -276,12 +743,61 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 	if err != nil {
 		h.Fatalf("Cluster failed: %v", err)
 	}
+	if qc, ok := c.(*qemu.Cluster); ok {
+		qc.Cgroup = h.Cgroup()
+		qc.Procs = procs
+		qc.Group = h.ProcessGroup()
+	}
 	defer func() {
 		if err := c.Destroy(); err != nil {
 			plog.Errorf("cluster.Destroy(): %v", err)
 		}
 	}()
 
+	if t.Timeout > 0 {
+		h.SetTimeout(t.Timeout)
+	}
+
+	if len(t.Metadata) > 0 {
+		mc, ok := c.(platform.MetadataCluster)
+		if !ok {
+			h.Skipf("Platform %q does not support instance metadata", pltfrm)
+		}
+		mc.SetMetadata(t.Metadata)
+	}
+
+	if len(t.Firewall) > 0 {
+		fc, ok := c.(platform.FirewallCluster)
+		if !ok {
+			h.Skipf("Platform %q does not support firewall rules", pltfrm)
+		}
+		if err := fc.SetFirewallRules(t.Firewall); err == platform.ErrNotSupported {
+			h.Skipf("Platform %q does not support these firewall rules", pltfrm)
+		} else if err != nil {
+			h.Fatalf("Setting firewall rules: %v", err)
+		}
+	}
+
+	if len(t.BootDisks) > 0 {
+		bc, ok := c.(platform.BootDiskCluster)
+		if !ok {
+			h.Skipf("Platform %q does not support multiple boot disks", pltfrm)
+		}
+		bc.SetBootDisks(t.BootDisks)
+	}
+
+	if t.LocalDisks > 0 {
+		lc, ok := c.(platform.LocalDiskCluster)
+		if !ok {
+			h.Skipf("Platform %q does not support local disks", pltfrm)
+		}
+		if err := lc.SetLocalDisks(t.LocalDisks); err == platform.ErrNotSupported {
+			h.Skipf("Platform %q does not support %d local disks with this machine type", pltfrm, t.LocalDisks)
+		} else if err != nil {
+			h.Fatalf("Setting local disks: %v", err)
+		}
+	}
+
 	if t.ClusterSize > 0 {
 		url, err := c.GetDiscoveryURL(t.ClusterSize)
 		if err != nil {
@@ -289,7 +805,9 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 		}
 
 		cfg := strings.Replace(t.UserData, "$discovery", url, -1)
-		if _, err := platform.NewMachines(c, cfg, t.ClusterSize); err != nil {
+		if _, err := platform.NewMachines(c, cfg, t.ClusterSize); platform.IsCapacityError(err) {
+			h.Skipf("Cloud out of capacity: %v", err)
+		} else if err != nil {
 			h.Fatalf("Cluster failed starting machines: %v", err)
 		}
 	}
@@ -305,6 +823,7 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 		H:           h,
 		Cluster:     c,
 		NativeFuncs: names,
+		Assets:      cache.New(AssetCacheDir),
 	}
 
 	// drop kolet binary on machines
@@ -319,9 +838,32 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 	}()
 
 	// run test
+	h.Phase("test")
+	defer h.Phase("teardown")
+	if Chaos && hasTag(t, []string{ChaosTag}) {
+		stop := startChaos(h, c)
+		defer stop()
+	}
 	t.Run(tcluster)
 }
 
+// attachMachineLogs attaches the consoles and journals of a failed
+// test's machines so reports can link to them.
+func attachMachineLogs(h *harness.H, testDir string) {
+	filepath.Walk(testDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); name == "console.txt" || name == "journal.txt" {
+			rel, err := filepath.Rel(testDir, path)
+			if err == nil {
+				h.AttachFile(rel, path)
+			}
+		}
+		return nil
+	})
+}
+
 // architecture returns the machine architecture of the given platform.
 func architecture(pltfrm string) string {
 	nativeArch := "amd64"
@@ -0,0 +1,139 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TestHistory summarizes the past runs of a top-level test on a platform.
+type TestHistory struct {
+	Test     string
+	Platform string
+	Runs     int // runs which passed, failed, or flaked
+	Failures int // runs which failed every attempt
+	Flakes   int // runs which only passed on a retry
+	Total    time.Duration
+	Max      time.Duration
+	Last     time.Time // start of the most recent run
+}
+
+// FlakeRate is the fraction of runs in which the test flaked.
+func (h *TestHistory) FlakeRate() float64 {
+	return FlakeStat{Runs: h.Runs, Flakes: h.Flakes}.Rate()
+}
+
+// FailRate is the fraction of runs in which the test failed.
+func (h *TestHistory) FailRate() float64 {
+	if h.Runs == 0 {
+		return 0
+	}
+	return float64(h.Failures) / float64(h.Runs)
+}
+
+// Mean is the average duration of the test's runs.
+func (h *TestHistory) Mean() time.Duration {
+	if h.Runs == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Runs)
+}
+
+// LoadHistory summarizes the newline-delimited JSON records written by
+// WriteResults, across however many runs they span, by test and
+// platform. Subtests are skipped. If pltfrm isn't "", only records for
+// that platform are included.
+func LoadHistory(path, pltfrm string) ([]*TestHistory, error) {
+	byTest := make(map[string]*TestHistory)
+	err := readResults(path, func(r *Result) {
+		if (pltfrm != "" && r.Platform != pltfrm) || strings.Contains(r.Test, "/") {
+			return
+		}
+		key := r.Platform + "\x00" + r.Test
+		h := byTest[key]
+		if h == nil {
+			h = &TestHistory{Test: r.Test, Platform: r.Platform}
+			byTest[key] = h
+		}
+		switch r.Result {
+		case "FLAKY":
+			h.Flakes++
+		case "FAIL":
+			h.Failures++
+		case "PASS", "WARN":
+		default:
+			return
+		}
+		h.Runs++
+		d := time.Duration(r.Duration * float64(time.Second))
+		h.Total += d
+		if d > h.Max {
+			h.Max = d
+		}
+		if r.Start.After(h.Last) {
+			h.Last = r.Start
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]*TestHistory, 0, len(byTest))
+	for _, h := range byTest {
+		if h.Runs > 0 {
+			history = append(history, h)
+		}
+	}
+	sort.Sort(byPlatformAndTest(history))
+	return history, nil
+}
+
+type byPlatformAndTest []*TestHistory
+
+func (h byPlatformAndTest) Len() int      { return len(h) }
+func (h byPlatformAndTest) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h byPlatformAndTest) Less(i, j int) bool {
+	if h[i].Platform != h[j].Platform {
+		return h[i].Platform < h[j].Platform
+	}
+	return h[i].Test < h[j].Test
+}
+
+// readResults calls fn with each record in a file written by
+// WriteResults.
+func readResults(path string, fn func(r *Result)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for {
+		var r Result
+		if err := dec.Decode(&r); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("parsing results %q: %v", path, err)
+		}
+		fn(&r)
+	}
+}
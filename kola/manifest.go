@@ -0,0 +1,184 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/yaml"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+)
+
+// Manifest is a set of simple tests declared in YAML, for example:
+//
+//     tests:
+//       - name: coreos.manifest.docker
+//         platforms: [qemu, gce]
+//         cluster_size: 1
+//         tags: [smoke]
+//         user_data: |
+//           #cloud-config
+//         steps:
+//           - command: systemctl is-active docker.socket
+//             match: ^active$
+//           - command: test -e /does/not/exist
+//             exit_code: 1
+type Manifest struct {
+	Tests []ManifestTest `yaml:"tests"`
+}
+
+// ManifestTest declares a single test.
+type ManifestTest struct {
+	Name          string         `yaml:"name"`
+	Platforms     []string       `yaml:"platforms"`
+	Architectures []string       `yaml:"architectures"`
+	Tags          []string       `yaml:"tags"`
+	ClusterSize   int            `yaml:"cluster_size"`
+	UserData      string         `yaml:"user_data"`
+	MinVersion    string         `yaml:"min_version"`
+	EndVersion    string         `yaml:"end_version"`
+	Severity      string         `yaml:"severity"`
+	Retries       int            `yaml:"retries"`
+	Steps         []ManifestStep `yaml:"steps"`
+}
+
+// ManifestStep runs a command on one machine and checks the result.
+type ManifestStep struct {
+	// Machine is the index of the machine to run on, default 0.
+	Machine int `yaml:"machine"`
+	// Command is run via SSH as the core user.
+	Command string `yaml:"command"`
+	// ExitCode is the expected exit status, default 0.
+	ExitCode int `yaml:"exit_code"`
+	// Match, if set, is a regular expression stdout must match.
+	Match string `yaml:"match"`
+}
+
+// LoadManifest parses the YAML manifest at path and registers its tests.
+func LoadManifest(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parsing manifest %q: %v", path, err)
+	}
+
+	for _, mt := range manifest.Tests {
+		t, err := mt.test()
+		if err != nil {
+			return fmt.Errorf("manifest %q: %v", path, err)
+		}
+		register.Register(t)
+	}
+
+	return nil
+}
+
+// test validates the manifest entry and converts it to a registered test.
+func (mt *ManifestTest) test() (*register.Test, error) {
+	if mt.Name == "" {
+		return nil, fmt.Errorf("test is missing a name")
+	}
+	if _, ok := register.Tests[mt.Name]; ok {
+		return nil, fmt.Errorf("test %q already registered", mt.Name)
+	}
+	if mt.ClusterSize < 1 {
+		mt.ClusterSize = 1
+	}
+	if mt.UserData == "" {
+		mt.UserData = "#cloud-config"
+	}
+
+	t := &register.Test{
+		Name:          mt.Name,
+		Platforms:     mt.Platforms,
+		Architectures: mt.Architectures,
+		Tags:          mt.Tags,
+		ClusterSize:   mt.ClusterSize,
+		UserData:      mt.UserData,
+		Retries:       mt.Retries,
+	}
+
+	var err error
+	if t.MinVersion, err = parseVersion(mt.MinVersion); err != nil {
+		return nil, fmt.Errorf("test %q: min_version: %v", mt.Name, err)
+	}
+	if t.EndVersion, err = parseVersion(mt.EndVersion); err != nil {
+		return nil, fmt.Errorf("test %q: end_version: %v", mt.Name, err)
+	}
+	if mt.Severity != "" {
+		if t.Severity, err = harness.ParseSeverity(mt.Severity); err != nil {
+			return nil, fmt.Errorf("test %q: severity: %v", mt.Name, err)
+		}
+	}
+
+	matches := make([]*regexp.Regexp, len(mt.Steps))
+	for i, step := range mt.Steps {
+		if step.Command == "" {
+			return nil, fmt.Errorf("test %q: step %d has no command", mt.Name, i)
+		}
+		if step.Machine < 0 || step.Machine >= mt.ClusterSize {
+			return nil, fmt.Errorf("test %q: step %d: machine %d out of range", mt.Name, i, step.Machine)
+		}
+		if step.Match != "" {
+			if matches[i], err = regexp.Compile(step.Match); err != nil {
+				return nil, fmt.Errorf("test %q: step %d: %v", mt.Name, i, err)
+			}
+		}
+	}
+
+	steps := mt.Steps
+	t.Run = func(c cluster.TestCluster) {
+		machines := c.Machines()
+		for i, step := range steps {
+			out, err := machines[step.Machine].SSH(step.Command)
+			code := 0
+			if exit, ok := err.(*ssh.ExitError); ok {
+				code = exit.ExitStatus()
+			} else if err != nil {
+				c.Fatalf("step %d: %q failed: %v", i, step.Command, err)
+			}
+			if code != step.ExitCode {
+				c.Fatalf("step %d: %q exited %d, expected %d: %s", i, step.Command, code, step.ExitCode, out)
+			}
+			if matches[i] != nil && !matches[i].Match(out) {
+				c.Fatalf("step %d: %q output %q does not match %q", i, step.Command, out, step.Match)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+func parseVersion(v string) (semver.Version, error) {
+	if v == "" {
+		return semver.Version{}, nil
+	}
+	parsed, err := semver.NewVersion(v)
+	if err != nil {
+		return semver.Version{}, err
+	}
+	return *parsed, nil
+}
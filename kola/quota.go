@@ -0,0 +1,93 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/mantle/kola/register"
+	awsapi "github.com/coreos/mantle/platform/api/aws"
+	gcloudapi "github.com/coreos/mantle/platform/api/gcloud"
+)
+
+// Quota check modes.
+const (
+	QuotaCheckOff   = "off"
+	QuotaCheckWarn  = "warn"
+	QuotaCheckAbort = "abort"
+)
+
+// plannedMachines returns the most machines the tests may have running at
+// once: the largest clusters, one per parallel test.
+func plannedMachines(tests map[string]*register.Test, parallel int) int {
+	var sizes []int
+	for _, t := range tests {
+		sizes = append(sizes, t.ClusterSize)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	var n int
+	for i := 0; i < len(sizes) && i < parallel; i++ {
+		n += sizes[i]
+	}
+	return n
+}
+
+// checkQuota checks the platform has quota for the machines the tests will
+// create, warning or returning an error as selected by QuotaCheck.
+func checkQuota(tests map[string]*register.Test, pltfrm string) error {
+	switch QuotaCheck {
+	case QuotaCheckOff:
+		return nil
+	case QuotaCheckWarn, QuotaCheckAbort:
+	default:
+		return fmt.Errorf("invalid quota check mode %q", QuotaCheck)
+	}
+
+	machines := plannedMachines(tests, TestParallelism)
+	if machines == 0 {
+		return nil
+	}
+
+	var err error
+	switch pltfrm {
+	case "gce":
+		var api *gcloudapi.API
+		if api, err = gcloudapi.New(&GCEOptions); err == nil {
+			err = api.CheckQuota(machines)
+		}
+	case "aws":
+		var api *awsapi.API
+		if api, err = awsapi.New(&AWSOptions); err == nil {
+			err = api.CheckQuota(machines)
+		}
+	default:
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("quota check for %d machines: %v", machines, err)
+	if QuotaCheck == QuotaCheckWarn {
+		plog.Warning(err)
+		return nil
+	}
+	return err
+}
@@ -16,10 +16,13 @@ package register
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
 
+	"github.com/coreos/mantle/harness"
 	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/platform"
 )
 
 // Test provides the main test abstraction for kola. The run function is
@@ -34,6 +37,56 @@ type Test struct {
 	ClusterSize   int
 	Platforms     []string // whitelist of platforms to run test against -- defaults to all
 	Architectures []string // whitelist of machine architectures supported -- defaults to all
+	Tags          []string // labels used to select groups of tests
+	Exclusive     bool     // run with no other tests in flight, for tests that change host state
+
+	// Resources names external resources, such as an image or a
+	// quota, the test needs to itself. Tests sharing a resource
+	// don't run at the same time, but other tests still run
+	// alongside them.
+	Resources []string
+
+	// Secrets names the secrets, such as credentials for external
+	// services, the test gets with harness.H.Secret. The test is
+	// skipped if any of them aren't available.
+	Secrets []string
+
+	// Metadata is attached to each machine and can be read by the
+	// guest from the platform metadata service. Only supported on
+	// platforms whose clusters implement platform.MetadataCluster.
+	Metadata map[string]string
+
+	// Firewall rules open ports on each machine beyond SSH, so tests
+	// can reach exposed services directly. Only supported on platforms
+	// whose clusters implement platform.FirewallCluster.
+	Firewall []platform.FirewallRule
+
+	// BootDisks are the disk images attached to each machine, in
+	// their initial boot order, with "" for the image under test.
+	// Tests switch between them with platform.BootDiskMachine. Only
+	// supported on platforms whose clusters implement
+	// platform.BootDiskCluster.
+	BootDisks []string
+
+	// LocalDisks is the number of local disks, such as GCE local SSDs
+	// or AWS instance store volumes, attached to each machine. Tests
+	// find their devices with platform.LocalDiskMachine. Only
+	// supported on platforms whose clusters implement
+	// platform.LocalDiskCluster.
+	LocalDisks int
+
+	// Timeout fails the test if it runs for longer, in place of
+	// kola's --test-timeout.
+	Timeout time.Duration
+
+	// Severity is how much the test failing matters, default
+	// harness.Major. Failures below kola's --fail-severity are
+	// reported but don't fail the run, e.g. for experimental tests.
+	Severity harness.Severity
+
+	// Retries overrides kola's --retries for the test if not zero; -1
+	// disables retries, e.g. for tests which are never flaky.
+	Retries int
 
 	// MinVersion prevents the test from executing on CoreOS machines
 	// less than MinVersion. This will be ignored if the name fully
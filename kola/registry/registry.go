@@ -2,6 +2,7 @@ package registry
 
 // Tests imported for registration side effects. These make up the OS test suite and is explicitly imported from the main package.
 import (
+	_ "github.com/coreos/mantle/kola/tests/boot"
 	_ "github.com/coreos/mantle/kola/tests/coretest"
 	_ "github.com/coreos/mantle/kola/tests/docker"
 	_ "github.com/coreos/mantle/kola/tests/etcd"
@@ -14,5 +15,8 @@ import (
 	_ "github.com/coreos/mantle/kola/tests/metadata"
 	_ "github.com/coreos/mantle/kola/tests/misc"
 	_ "github.com/coreos/mantle/kola/tests/rkt"
+	_ "github.com/coreos/mantle/kola/tests/storage"
 	_ "github.com/coreos/mantle/kola/tests/systemd"
+	_ "github.com/coreos/mantle/kola/tests/tpm"
+	_ "github.com/coreos/mantle/kola/tests/update"
 )
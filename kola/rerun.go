@@ -0,0 +1,76 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/mantle/harness"
+)
+
+// RunStateFile is the file in the output directory recording the
+// outcome of the last run for --rerun-failed.
+const RunStateFile = "run-state.json"
+
+// RunState is the outcome of each top-level test in a run.
+type RunState struct {
+	Platform string
+	Results  map[string]string // test name to "PASS", "FAIL", etc.
+	Failed   []string          // tests which failed or didn't run
+}
+
+// SaveRunState records the outcome of a run in outputDir.
+func SaveRunState(outputDir, pltfrm string, results []harness.TestResult) error {
+	state := RunState{
+		Platform: pltfrm,
+		Results:  make(map[string]string),
+		Failed:   failedTests(results),
+	}
+	for _, r := range results {
+		if !strings.Contains(r.Name, "/") {
+			state.Results[r.Name] = r.Result
+		}
+	}
+	data, err := json.MarshalIndent(&state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outputDir, RunStateFile), data, 0666)
+}
+
+// LoadRunState reads the outcome of the last run on pltfrm from
+// outputDir.
+func LoadRunState(outputDir, pltfrm string) (*RunState, error) {
+	path := filepath.Join(outputDir, RunStateFile)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no previous run recorded in %s", outputDir)
+	} else if err != nil {
+		return nil, err
+	}
+	var state RunState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing %q: %v", path, err)
+	}
+	if state.Platform != pltfrm {
+		return nil, fmt.Errorf("previous run in %s was on %s, not %s", outputDir, state.Platform, pltfrm)
+	}
+	return &state, nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/coreos/mantle/harness"
+)
+
+// ResultsSchema is the BigQuery table schema matching the records
+// written by WriteResults. Load with:
+//
+//     bq load --source_format=NEWLINE_DELIMITED_JSON table results.json schema.json
+const ResultsSchema = `[
+  {"name": "run_id", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "test", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "platform", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "version", "type": "STRING", "mode": "NULLABLE"},
+  {"name": "result", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "start_time", "type": "TIMESTAMP", "mode": "REQUIRED"},
+  {"name": "duration_seconds", "type": "FLOAT", "mode": "REQUIRED"},
+  {"name": "attempts", "type": "INTEGER", "mode": "NULLABLE"},
+  {"name": "phases", "type": "RECORD", "mode": "REPEATED", "fields": [
+    {"name": "name", "type": "STRING", "mode": "REQUIRED"},
+    {"name": "duration_seconds", "type": "FLOAT", "mode": "REQUIRED"}
+  ]},
+  {"name": "metrics", "type": "RECORD", "mode": "REPEATED", "fields": [
+    {"name": "unit", "type": "STRING", "mode": "REQUIRED"},
+    {"name": "value", "type": "FLOAT", "mode": "REQUIRED"}
+  ]},
+  {"name": "params", "type": "RECORD", "mode": "REPEATED", "fields": [
+    {"name": "name", "type": "STRING", "mode": "REQUIRED"},
+    {"name": "value", "type": "STRING", "mode": "REQUIRED"}
+  ]},
+  {"name": "config", "type": "RECORD", "mode": "REPEATED", "fields": [
+    {"name": "name", "type": "STRING", "mode": "REQUIRED"},
+    {"name": "value", "type": "STRING", "mode": "REQUIRED"}
+  ]}
+]
+`
+
+// Result is a single test result record suitable for loading into an
+// analytics database such as BigQuery.
+type Result struct {
+	RunID    string    `json:"run_id"`
+	Test     string    `json:"test"`
+	Platform string    `json:"platform"`
+	Version  string    `json:"version,omitempty"`
+	Result   string    `json:"result"`
+	Start    time.Time `json:"start_time"`
+	Duration float64   `json:"duration_seconds"`
+	Attempts int       `json:"attempts,omitempty"`
+	Phases   []Phase   `json:"phases,omitempty"`
+	Metrics  []Metric  `json:"metrics,omitempty"`
+
+	// Params are the parameters the test was run with, by
+	// harness.H.RunMatrix.
+	Params []harness.Property `json:"params,omitempty"`
+
+	// Config is how kola was run, the same for every record of a run.
+	Config []harness.Property `json:"config,omitempty"`
+}
+
+// Phase is the time a test spent in a phase such as provisioning.
+type Phase struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// Metric is a figure reported by a benchmark, such as its "ns/op".
+type Metric struct {
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+}
+
+// WriteResults appends a newline-delimited JSON record for every test
+// result to path. All records from one call share a random run ID and
+// the config of the run.
+func WriteResults(path, pltfrm, version string, config harness.Config, results []harness.TestResult) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	runID := uuid.NewV4().String()
+	props := config.Flatten()
+	enc := json.NewEncoder(f)
+	for _, r := range results {
+		var phases []Phase
+		for _, p := range r.Phases {
+			phases = append(phases, Phase{Name: p.Name, Duration: p.Duration.Seconds()})
+		}
+		var metrics []Metric
+		if r.Benchmark != nil {
+			m := r.Benchmark.Metrics()
+			var units []string
+			for unit := range m {
+				units = append(units, unit)
+			}
+			sort.Strings(units)
+			for _, unit := range units {
+				metrics = append(metrics, Metric{Unit: unit, Value: m[unit]})
+			}
+		}
+		if err := enc.Encode(&Result{
+			RunID:    runID,
+			Test:     r.Name,
+			Platform: pltfrm,
+			Version:  version,
+			Result:   r.Result,
+			Start:    r.Start.UTC(),
+			Duration: r.Duration.Seconds(),
+			Attempts: r.Attempts,
+			Phases:   phases,
+			Metrics:  metrics,
+			Params:   r.Params,
+			Config:   props,
+		}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/coreos/mantle/auth"
+	"github.com/coreos/mantle/harness"
+)
+
+// secretManagerScope is the OAuth scope needed to read secrets from
+// Google Cloud Secret Manager.
+const secretManagerScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// secretProviders returns where tests look up the secrets they get with
+// harness.H.Secret and declare with register.Test.Secrets: environment
+// variables named with SecretsEnvPrefix, then files in SecretsDir, then
+// Google Cloud Secret Manager in SecretsGCPProject.
+func secretProviders() (harness.SecretProvider, error) {
+	providers := harness.SecretProviders{harness.EnvSecrets(SecretsEnvPrefix)}
+	if SecretsDir != "" {
+		providers = append(providers, harness.FileSecrets(SecretsDir))
+	}
+	if SecretsGCPProject != "" {
+		p, err := newGCPSecrets(SecretsGCPProject)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// gcpSecrets looks up the latest versions of secrets in Google Cloud
+// Secret Manager.
+type gcpSecrets struct {
+	project string
+	client  *http.Client
+}
+
+// newGCPSecrets authenticates with the GCE service account or JSON key
+// given to kola, as the interactive login doesn't grant access to
+// Secret Manager.
+func newGCPSecrets(project string) (*gcpSecrets, error) {
+	var client *http.Client
+	if GCEOptions.ServiceAuth {
+		client = auth.GoogleServiceClient()
+	} else if GCEOptions.JSONKeyFile != "" {
+		b, err := ioutil.ReadFile(GCEOptions.JSONKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		client, err = auth.GoogleClientFromJSONKey(b, secretManagerScope)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("reading secrets from project %q needs --gce-service-auth or --gce-json-key", project)
+	}
+	return &gcpSecrets{project: project, client: client}, nil
+}
+
+func (g *gcpSecrets) Secret(name string) (string, error) {
+	u := fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/latest:access",
+		url.PathEscape(g.project), url.PathEscape(name))
+	resp, err := g.client.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", harness.ErrNoSecret
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("accessing secret %q: %s: %s", name, resp.Status, body)
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &version); err != nil {
+		return "", fmt.Errorf("decoding secret %q: %v", name, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decoding secret %q: %v", name, err)
+	}
+	return string(value), nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/machine/qemu"
+)
+
+// oemGrubConfig is sourced by the GRUB configuration of Container Linux,
+// and is the supported place to change kernel arguments and other boot
+// loader settings.
+const oemGrubConfig = "/usr/share/oem/grub.cfg"
+
+// bootloaderChange is a change to oemGrubConfig and how to tell whether
+// the machine booted with it.
+type bootloaderChange struct {
+	name   string // of the subtest
+	config string // appended to oemGrubConfig
+	check  string // command whose output includes want once booted
+	want   string
+}
+
+var bootloaderChanges = []bootloaderChange{
+	{
+		name:   "kargs",
+		config: `set linux_append="$linux_append kola.bootloader=kargs"`,
+		check:  "cat /proc/cmdline",
+		want:   "kola.bootloader=kargs",
+	},
+	{
+		name:   "setenv",
+		config: `set linux_append="$linux_append systemd.setenv=KOLA_BOOTLOADER=setenv"`,
+		check:  "systemctl show-environment",
+		want:   "KOLA_BOOTLOADER=setenv",
+	},
+}
+
+func init() {
+	register.Register(&register.Test{
+		Run:         Bootloader,
+		ClusterSize: 1,
+		Name:        "coreos.boot.bootloader",
+		UserData:    `#cloud-config`,
+	})
+}
+
+// Bootloader changes the boot loader configuration, reboots, checks the
+// change took effect, then reverts it and reboots again to check the
+// machine is back as it was. Each change is a subtest under the boot
+// mode the machine uses, "bios" or "uefi", so running the test on both
+// kinds of machine, such as QEMU with and without --qemu-uefi-vars,
+// covers the whole matrix. On QEMU the machine must have booted the way
+// its firmware options say.
+func Bootloader(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	mode, err := bootMode(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+	if _, ok := c.Cluster.(*qemu.Cluster); ok {
+		want := "bios"
+		if kola.QEMUOptions.UEFIVars != "" {
+			want = "uefi"
+		}
+		if mode != want {
+			c.Fatalf("Machine booted with %s, want %s", mode, want)
+		}
+	}
+
+	c.Run(mode, func(c cluster.TestCluster) {
+		for _, change := range bootloaderChanges {
+			change := change
+			c.Run(change.name, func(c cluster.TestCluster) {
+				testBootloaderChange(c, m, change)
+			})
+		}
+	})
+}
+
+// bootMode returns "uefi" if the machine was booted by UEFI firmware,
+// otherwise "bios".
+func bootMode(m platform.Machine) (string, error) {
+	out, err := m.SSH("if test -d /sys/firmware/efi; then echo uefi; else echo bios; fi")
+	if err != nil {
+		return "", fmt.Errorf("failed to find boot mode: output: %q status: %v", out, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func testBootloaderChange(c cluster.TestCluster, m platform.Machine, change bootloaderChange) {
+	c.Phase("modify")
+	// Keep the original, or note there wasn't one, to revert to.
+	backup := oemGrubConfig + ".kola"
+	save := fmt.Sprintf("if test -e %[1]s; then sudo cp -a %[1]s %[2]s; else sudo rm -f %[2]s; fi", oemGrubConfig, backup)
+	if out, err := m.SSH(save); err != nil {
+		c.Fatalf("failed to back up %s: output: %q status: %v", oemGrubConfig, out, err)
+	}
+	restore := fmt.Sprintf("if test -e %[2]s; then sudo mv %[2]s %[1]s; else sudo rm -f %[1]s; fi", oemGrubConfig, backup)
+	reverted := false
+	defer func() {
+		if !reverted {
+			m.SSH(restore)
+		}
+	}()
+
+	appendCmd := fmt.Sprintf("echo '%s' | sudo tee -a %s >/dev/null", change.config, oemGrubConfig)
+	if out, err := m.SSH(appendCmd); err != nil {
+		c.Fatalf("failed to change %s: output: %q status: %v", oemGrubConfig, out, err)
+	}
+
+	c.Phase("reboot")
+	if err := m.Reboot(); err != nil {
+		c.Fatalf("failed to reboot with the change: %v", err)
+	}
+
+	c.Phase("verify")
+	if !bootedWith(c, m, change) {
+		c.Errorf("%q not in output of %q after rebooting with the change", change.want, change.check)
+	}
+
+	c.Phase("revert")
+	reverted = true
+	if out, err := m.SSH(restore); err != nil {
+		c.Fatalf("failed to restore %s: output: %q status: %v", oemGrubConfig, out, err)
+	}
+	if err := m.Reboot(); err != nil {
+		c.Fatalf("failed to reboot after reverting the change: %v", err)
+	}
+	if bootedWith(c, m, change) {
+		c.Errorf("%q still in output of %q after reverting the change", change.want, change.check)
+	}
+}
+
+// bootedWith reports whether the machine booted with the change.
+func bootedWith(c cluster.TestCluster, m platform.Machine, change bootloaderChange) bool {
+	out, err := m.SSH(change.check)
+	if err != nil {
+		c.Fatalf("failed to run %q: output: %q status: %v", change.check, out, err)
+	}
+	return strings.Contains(string(out), change.want)
+}
@@ -21,27 +21,12 @@ import (
 
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/conf"
 )
 
 func init() {
 	// Set the hostname
-	config := `{
-		          "ignition": {
-		              "version": "2.0.0"
-		          },
-		          "storage": {
-		              "files": [
-		                  {
-		                      "filesystem": "root",
-		                      "path": "/etc/hostname",
-		                      "mode": 420,
-		                      "contents": {
-		                          "source": "data:,core1"
-		                      }
-		                  }
-		              ]
-		          }
-		      }`
+	config := conf.Ignition(conf.File("/etc/hostname", "core1", 0644))
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.sethostname.aws",
 		Run:         setHostname,
@@ -17,6 +17,7 @@ package kubernetes
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"text/template"
@@ -57,8 +58,8 @@ func setupCluster(c cluster.TestCluster, nodes int, version, runtime string) (*k
 	options := map[string]string{
 		"HYPERKUBE_IMAGE_REPO": "quay.io/coreos/hyperkube",
 		"MASTER_HOST":          master.PrivateIP(),
-		"ETCD_ENDPOINTS":       fmt.Sprintf("http://%v:2379", etcdNode.PrivateIP()),
-		"CONTROLLER_ENDPOINT":  fmt.Sprintf("https://%v:443", master.PrivateIP()),
+		"ETCD_ENDPOINTS":       "http://" + net.JoinHostPort(etcdNode.PrivateIP(), "2379"),
+		"CONTROLLER_ENDPOINT":  "https://" + net.JoinHostPort(master.PrivateIP(), "443"),
 		"K8S_SERVICE_IP":       "10.3.0.1",
 		"K8S_VER":              version,
 		"CONTAINER_RUNTIME":    runtime,
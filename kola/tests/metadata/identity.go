@@ -0,0 +1,53 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/identity"
+)
+
+func init() {
+	// AWS and Azure documents are checked against certificates which
+	// kola has no way to be given, so only GCE is covered here.
+	register.Register(&register.Test{
+		Name:        "coreos.metadata.identity",
+		Run:         verifyIdentity,
+		ClusterSize: 1,
+		Platforms:   []string{"gce"},
+		UserData:    `#cloud-config`,
+	})
+}
+
+func verifyIdentity(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	token, err := identity.FetchGCE(m, "kola")
+	if err != nil {
+		c.Fatal(err)
+	}
+	certs, err := identity.GoogleCerts()
+	if err != nil {
+		c.Fatal(err)
+	}
+	claims, err := identity.VerifyGCE(token, "kola", certs)
+	if err != nil {
+		c.Fatal(err)
+	}
+	if name := claims.Google.ComputeEngine.InstanceName; name != m.ID() {
+		c.Errorf("identity token is for instance %q, expected %q", name, m.ID())
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"fmt"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+)
+
+var testMetadata = map[string]string{
+	"kola-metadata-test": "f00-b4r",
+}
+
+func init() {
+	// The vendored EC2 API cannot enable instance tags in the instance
+	// metadata service, so tags are only readable by guests on GCE.
+	register.Register(&register.Test{
+		Name:        "coreos.metadata.tags",
+		Run:         verifyTags,
+		ClusterSize: 1,
+		Platforms:   []string{"gce"},
+		UserData:    `#cloud-config`,
+		Metadata:    testMetadata,
+	})
+}
+
+func verifyTags(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	for key, value := range testMetadata {
+		cmd := fmt.Sprintf("curl -sf -H 'Metadata-Flavor: Google' http://metadata.google.internal/computeMetadata/v1/instance/attributes/%s", key)
+		out, err := m.SSH(cmd)
+		if err != nil {
+			c.Fatalf("reading metadata %q: %s: %v", key, out, err)
+		}
+		if string(out) != value {
+			c.Errorf("metadata %q is %q, expected %q", key, out, value)
+		}
+	}
+}
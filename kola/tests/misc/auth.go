@@ -15,6 +15,10 @@
 package misc
 
 import (
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
 )
@@ -27,6 +31,13 @@ func init() {
 		Platforms:   []string{"qemu", "aws", "gce"},
 		UserData:    `#cloud-config`,
 	})
+	register.Register(&register.Test{
+		Run:         AuthRotateKey,
+		ClusterSize: 1,
+		Name:        "coreos.auth.rotatekey",
+		Platforms:   []string{"qemu", "aws", "gce"},
+		UserData:    `#cloud-config`,
+	})
 }
 
 // Basic authentication tests.
@@ -41,3 +52,22 @@ func AuthVerify(c cluster.TestCluster) {
 		c.Fatalf("Successfully authenticated despite invalid password auth")
 	}
 }
+
+// AuthRotateKey asserts that the machine's SSH key can be replaced while
+// it runs, leaving only the new key authorized.
+func AuthRotateKey(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	if err := c.RotateKey(); err != nil {
+		c.Fatalf("rotating SSH key: %v", err)
+	}
+
+	out, err := m.SSH("cat ~/.ssh/authorized_keys")
+	if err != nil {
+		c.Fatalf("reading authorized keys: %s: %v", out, err)
+	}
+	keys := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(keys) != 1 || !strings.HasPrefix(keys[0], ssh.KeyAlgoED25519+" ") {
+		c.Errorf("authorized keys are %q; want only the new ed25519 key", out)
+	}
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/conf"
 )
 
 func init() {
@@ -26,17 +27,8 @@ func init() {
 		Run:         InstallCloudConfig,
 		ClusterSize: 1,
 		Name:        "coreos.install.cloudinit",
-		UserData: `{
-  "ignition": { "version": "2.0.0" },
-  "storage": {
-    "files": [{
-      "filesystem": "root",
-      "path": "/var/lib/coreos-install/user_data",
-      "contents": { "source": "data:,%23cloud-config%0Ahostname:%20%22cloud-config-worked%22" },
-      "mode": 420
-    }]
-  }
-}`,
+		UserData: conf.Ignition(conf.File("/var/lib/coreos-install/user_data",
+			"#cloud-config\nhostname: \"cloud-config-worked\"", 0644)),
 	})
 }
 
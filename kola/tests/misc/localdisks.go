@@ -0,0 +1,55 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         LocalDisks,
+		ClusterSize: 1,
+		Name:        "coreos.localdisks",
+		Platforms:   []string{"aws", "gce"},
+		UserData:    `#cloud-config`,
+		LocalDisks:  2,
+	})
+}
+
+// LocalDisks checks the machine's local disks are at their expected
+// devices and can hold a filesystem.
+func LocalDisks(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	lm, ok := m.(platform.LocalDiskMachine)
+	if !ok {
+		c.Fatalf("machine %s has no local disks", m.ID())
+	}
+
+	disks := lm.LocalDisks()
+	if len(disks) != 2 {
+		c.Fatalf("got %d local disks; want 2", len(disks))
+	}
+	for _, dev := range disks {
+		cmd := fmt.Sprintf("test -b %[1]s && sudo mkfs.ext4 -q %[1]s && sudo mount %[1]s /mnt && sudo touch /mnt/marker && sudo umount /mnt", dev)
+		if out, err := m.SSH(cmd); err != nil {
+			c.Errorf("using local disk %s: %s: %v", dev, out, err)
+		}
+	}
+}
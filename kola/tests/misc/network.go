@@ -17,9 +17,13 @@ package misc
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/machine/qemu"
+	"github.com/coreos/mantle/util"
 )
 
 func init() {
@@ -29,6 +33,20 @@ func init() {
 		Name:        "coreos.network.listeners",
 		UserData:    `#cloud-config`,
 	})
+	register.Register(&register.Test{
+		Run:         NetworkLinkFlap,
+		ClusterSize: 1,
+		Name:        "coreos.network.linkflap",
+		Platforms:   []string{"qemu"},
+		UserData:    `#cloud-config`,
+	})
+	register.Register(&register.Test{
+		Run:         NetworkRouted,
+		ClusterSize: 0,
+		Name:        "coreos.network.routed",
+		Platforms:   []string{"qemu"},
+		UserData:    `#cloud-config`,
+	})
 }
 
 type listener struct {
@@ -90,3 +108,79 @@ func NetworkListeners(c cluster.TestCluster) {
 	checkListeners(c, "TCP", "TCP:LISTEN", TCPListeners)
 	checkListeners(c, "UDP", "", UDPListeners)
 }
+
+// NetworkLinkFlap disconnects the machine's NIC and checks networkd notices
+// the carrier loss and recovers once the link is restored.
+func NetworkLinkFlap(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	if err := m.SetLinkDown("eth0"); err != nil {
+		c.Fatalf("SetLinkDown: %v", err)
+	}
+	time.Sleep(5 * time.Second)
+	if err := m.SetLinkUp("eth0"); err != nil {
+		c.Fatalf("SetLinkUp: %v", err)
+	}
+
+	checker := func() error {
+		out, err := m.SSH("journalctl -b -u systemd-networkd --no-pager")
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(out), "Lost carrier") {
+			return fmt.Errorf("networkd did not log the lost carrier")
+		}
+		if !strings.Contains(string(out), "Gained carrier") {
+			return fmt.Errorf("networkd did not log the regained carrier")
+		}
+		return nil
+	}
+	if err := util.Retry(6, 5*time.Second, checker); err != nil {
+		c.Fatal(err)
+	}
+}
+
+// NetworkRouted boots machines on two directly attached subnets and one
+// behind a DHCP relay, and checks each gets its subnet's default gateway
+// and can reach the others through it.
+func NetworkRouted(c cluster.TestCluster) {
+	qc, ok := c.Cluster.(*qemu.Cluster)
+	if !ok {
+		c.Fatal("test only works in qemu")
+	}
+
+	var machines []platform.Machine
+	for _, bridge := range []string{"br0", "br1", "br3"} {
+		m, err := qc.NewMachineOnSegment("#cloud-config", bridge)
+		if err != nil {
+			c.Fatalf("NewMachineOnSegment %s: %v", bridge, err)
+		}
+		defer m.Destroy()
+		machines = append(machines, m)
+
+		var gateway string
+		for _, seg := range qc.Dnsmasq.Segments {
+			if seg.BridgeName == bridge {
+				gateway = seg.Gateway().String()
+			}
+		}
+		out, err := m.SSH("ip -4 route show default")
+		if err != nil {
+			c.Fatalf("ip route on %s: %v", bridge, err)
+		}
+		if !strings.HasPrefix(string(out), "default via "+gateway+" ") {
+			c.Fatalf("machine on %s has default route %q, expected gateway %s", bridge, out, gateway)
+		}
+	}
+
+	for _, m := range machines {
+		for _, peer := range machines {
+			if m == peer {
+				continue
+			}
+			if out, err := m.SSH("ping -c 1 -W 5 " + peer.PrivateIP()); err != nil {
+				c.Fatalf("%s cannot reach %s: %s: %v", m.PrivateIP(), peer.PrivateIP(), out, err)
+			}
+		}
+	}
+}
@@ -23,51 +23,10 @@ import (
 
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/kola/tests/storage"
 	"github.com/coreos/mantle/util"
 )
 
-var (
-	nfsserverconf = config.CloudConfig{
-		CoreOS: config.CoreOS{
-			Units: []config.Unit{
-				config.Unit{
-					Name:    "rpc-statd.service",
-					Command: "start",
-				},
-				config.Unit{
-					Name:    "rpc-mountd.service",
-					Command: "start",
-				},
-				config.Unit{
-					Name:    "nfsd.service",
-					Command: "start",
-				},
-			},
-		},
-		WriteFiles: []config.File{
-			config.File{
-				Content: "/tmp	*(ro,insecure,all_squash,no_subtree_check,fsid=0)",
-				Path: "/etc/exports",
-			},
-		},
-		Hostname: "nfs1",
-	}
-
-	mounttmpl = `[Unit]
-Description=NFS Client
-After=network-online.target
-Requires=network-online.target
-After=rpc-statd.service
-Requires=rpc-statd.service
-
-[Mount]
-What=%s:/tmp
-Where=/mnt
-Type=nfs
-Options=defaults,noexec,nfsvers=%d
-`
-)
-
 func init() {
 	register.Register(&register.Test{
 		Run:         NFSv3,
@@ -86,17 +45,17 @@ func init() {
 }
 
 func testNFS(c cluster.TestCluster, nfsversion int) {
-	m1, err := c.NewMachine(nfsserverconf.String())
+	m1, err := storage.NewNFSServer(c)
 	if err != nil {
-		c.Fatalf("Cluster.NewMachine: %s", err)
+		c.Fatalf("NFS server: %s", err)
 	}
 
 	defer m1.Destroy()
 
 	c.Log("NFS server booted.")
 
-	/* poke a file in /tmp */
-	tmp, err := m1.SSH("mktemp")
+	/* poke a file in the export */
+	tmp, err := m1.SSH("mktemp -p " + storage.NFSExport)
 	if err != nil {
 		c.Fatalf("Machine.SSH: %s", err)
 	}
@@ -109,7 +68,7 @@ func testNFS(c cluster.TestCluster, nfsversion int) {
 				config.Unit{
 					Name:    "mnt.mount",
 					Command: "start",
-					Content: fmt.Sprintf(mounttmpl, m1.PrivateIP(), nfsversion),
+					Content: m1.MountUnit("/mnt", nfsversion),
 				},
 			},
 		},
@@ -0,0 +1,93 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         Resize("m3.medium"),
+		ClusterSize: 1,
+		Name:        "coreos.resize.aws",
+		Platforms:   []string{"aws"},
+		UserData:    `#cloud-config`,
+	})
+	register.Register(&register.Test{
+		Run:         Resize("n1-standard-2"),
+		ClusterSize: 1,
+		Name:        "coreos.resize.gce",
+		Platforms:   []string{"gce"},
+		UserData:    `#cloud-config`,
+	})
+}
+
+// resources returns the number of CPUs and KiB of memory of a machine.
+func resources(c cluster.TestCluster, m platform.Machine) (cpus, mem int) {
+	out, err := m.SSH("nproc && awk '/^MemTotal:/ { print $2 }' /proc/meminfo")
+	if err != nil {
+		c.Fatalf("reading resources: %s: %v", out, err)
+	}
+	f := strings.Fields(string(out))
+	if len(f) != 2 {
+		c.Fatalf("unexpected resources output %q", out)
+	}
+	if cpus, err = strconv.Atoi(f[0]); err != nil {
+		c.Fatalf("parsing CPUs: %v", err)
+	}
+	if mem, err = strconv.Atoi(f[1]); err != nil {
+		c.Fatalf("parsing memory: %v", err)
+	}
+	return cpus, mem
+}
+
+// Resize returns a test that checks a machine comes back with more
+// memory, and keeps its state, after being resized to machineType, which
+// must be larger than the default.
+func Resize(machineType string) func(cluster.TestCluster) {
+	return func(c cluster.TestCluster) {
+		resize(c, machineType)
+	}
+}
+
+func resize(c cluster.TestCluster, machineType string) {
+	m := c.Machines()[0]
+	if out, err := m.SSH("touch ~/resize-marker"); err != nil {
+		c.Fatalf("creating marker: %s: %v", out, err)
+	}
+	cpus, mem := resources(c, m)
+
+	if err := m.Resize(machineType); err != nil {
+		c.Fatalf("resizing to %s: %v", machineType, err)
+	}
+
+	newCPUs, newMem := resources(c, m)
+	c.Logf("resized from %d CPUs, %d KiB to %d CPUs, %d KiB", cpus, mem, newCPUs, newMem)
+	if newMem <= mem {
+		c.Errorf("memory did not grow: had %d KiB, now %d KiB", mem, newMem)
+	}
+	if newCPUs < cpus {
+		c.Errorf("lost CPUs: had %d, now %d", cpus, newCPUs)
+	}
+	if out, err := m.SSH("test -e ~/resize-marker"); err != nil {
+		c.Errorf("marker file lost across resize: %s: %v", out, err)
+	}
+}
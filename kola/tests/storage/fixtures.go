@@ -0,0 +1,184 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage provides network storage servers for tests, and tests
+// of the clients for them. The servers run on helper machines in the
+// test's cluster, so they work the same on every platform and need
+// nothing from the host.
+package storage
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/platform"
+)
+
+const (
+	// NFSExport is the directory exported by NFSServer.
+	NFSExport = "/srv/nfs"
+
+	// ISCSIIQN is the name of the target exported by ISCSITarget.
+	ISCSIIQN = "iqn.2017-01.com.coreos.kola:target"
+
+	iscsiPort  = 3260
+	iscsiImage = "/var/lib/kola-iscsi.img"
+)
+
+var nfsServerConf = config.CloudConfig{
+	CoreOS: config.CoreOS{
+		Units: []config.Unit{
+			config.Unit{
+				Name:    "rpc-statd.service",
+				Command: "start",
+			},
+			config.Unit{
+				Name:    "rpc-mountd.service",
+				Command: "start",
+			},
+			config.Unit{
+				Name:    "nfsd.service",
+				Command: "start",
+			},
+		},
+	},
+	WriteFiles: []config.File{
+		config.File{
+			Content: NFSExport + "	*(rw,insecure,all_squash,no_subtree_check,fsid=0)",
+			Path:    "/etc/exports",
+		},
+	},
+	Hostname: "nfs",
+}
+
+const nfsMountTmpl = `[Unit]
+Description=NFS Client
+After=network-online.target
+Requires=network-online.target
+After=rpc-statd.service
+Requires=rpc-statd.service
+
+[Mount]
+What=%s:%s
+Where=%s
+Type=nfs
+Options=defaults,noexec,nfsvers=%d
+`
+
+// NFSServer is a helper machine exporting NFSExport to the cluster.
+// Files written by clients are owned by nobody.
+type NFSServer struct {
+	platform.Machine
+}
+
+// NewNFSServer boots an NFS server in the cluster. The caller must
+// destroy it.
+func NewNFSServer(c cluster.TestCluster) (*NFSServer, error) {
+	m, err := c.NewMachine(nfsServerConf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// the export doesn't exist when nfsd first reads /etc/exports
+	cmd := fmt.Sprintf("sudo mkdir -p -m 1777 %s && sudo exportfs -ra", NFSExport)
+	if out, err := m.SSH(cmd); err != nil {
+		m.Destroy()
+		return nil, fmt.Errorf("exporting %s: %v: %s", NFSExport, err, out)
+	}
+
+	return &NFSServer{m}, nil
+}
+
+// MountUnit returns a systemd mount unit mounting the export on where
+// with the given NFS version. The unit must be named after where, e.g.
+// mnt.mount for /mnt.
+func (s *NFSServer) MountUnit(where string, version int) string {
+	host := s.PrivateIP()
+	if strings.Contains(host, ":") {
+		// IPv6 addresses are bracketed in NFS sources
+		host = "[" + host + "]"
+	}
+	return fmt.Sprintf(nfsMountTmpl, host, NFSExport, where, version)
+}
+
+// iscsiTargetScript creates a file backed LUN and exports it through
+// the kernel's LIO target, configured directly in configfs since the
+// image has no targetcli. Any initiator may log in without
+// authentication.
+const iscsiTargetScript = `set -e
+modprobe target_core_file
+modprobe iscsi_target_mod
+truncate -s %[1]dM %[2]s
+core=/sys/kernel/config/target/core/fileio_0/kola
+mkdir -p $core
+echo fd_dev_name=%[2]s,fd_dev_size=%[3]d > $core/control
+echo 1 > $core/enable
+tpg=/sys/kernel/config/target/iscsi/%[4]s/tpgt_1
+mkdir -p $tpg/lun/lun_0 $tpg/np/0.0.0.0:%[5]d
+ln -s $core $tpg/lun/lun_0/kola
+echo 0 > $tpg/attrib/authentication
+echo 1 > $tpg/attrib/generate_node_acls
+echo 1 > $tpg/attrib/cache_dynamic_acls
+echo 0 > $tpg/attrib/demo_mode_write_protect
+echo 1 > $tpg/enable
+`
+
+// ISCSITarget is a helper machine exporting a single empty LUN as the
+// target ISCSIIQN.
+type ISCSITarget struct {
+	platform.Machine
+}
+
+// NewISCSITarget boots an iSCSI target in the cluster with a LUN of
+// sizeMB megabytes. The caller must destroy it.
+func NewISCSITarget(c cluster.TestCluster, sizeMB int) (*ISCSITarget, error) {
+	m, err := c.NewMachine(`#cloud-config
+hostname: iscsi
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	script := fmt.Sprintf(iscsiTargetScript, sizeMB, iscsiImage,
+		int64(sizeMB)<<20, ISCSIIQN, iscsiPort)
+	if out, err := m.SSH("sudo sh <<'EOF'\n" + script + "EOF"); err != nil {
+		m.Destroy()
+		return nil, fmt.Errorf("configuring iSCSI target: %v: %s", err, out)
+	}
+
+	return &ISCSITarget{m}, nil
+}
+
+// Portal returns the address initiators connect to.
+func (t *ISCSITarget) Portal() string {
+	return net.JoinHostPort(t.PrivateIP(), strconv.Itoa(iscsiPort))
+}
+
+// LoginCommand returns a command which logs an initiator into the
+// target. The LUN then appears as the device named by DevicePath.
+func (t *ISCSITarget) LoginCommand() string {
+	return fmt.Sprintf("sudo iscsiadm -m discovery -t sendtargets -p %[1]s && "+
+		"sudo iscsiadm -m node -T %[2]s -p %[1]s --login", t.Portal(), ISCSIIQN)
+}
+
+// DevicePath returns the path of the LUN on an initiator logged in
+// with LoginCommand.
+func (t *ISCSITarget) DevicePath() string {
+	return fmt.Sprintf("/dev/disk/by-path/ip-%s-iscsi-%s-lun-0", t.Portal(), ISCSIIQN)
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/util"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         ISCSI,
+		ClusterSize: 0,
+		Name:        "linux.iscsi",
+		Platforms:   []string{"qemu", "aws"},
+		UserData:    `#cloud-config`,
+	})
+}
+
+// Test that the iSCSI initiator can log in to a target and use the LUN.
+func ISCSI(c cluster.TestCluster) {
+	target, err := NewISCSITarget(c, 64)
+	if err != nil {
+		c.Fatalf("iSCSI target: %v", err)
+	}
+	defer target.Destroy()
+
+	c.Log("iSCSI target booted.")
+
+	m, err := c.NewMachine(`#cloud-config
+hostname: initiator
+coreos:
+  units:
+    - name: iscsid.service
+      command: start
+`)
+	if err != nil {
+		c.Fatalf("Cluster.NewMachine: %s", err)
+	}
+	defer m.Destroy()
+
+	c.Log("iSCSI initiator booted.")
+
+	if out, err := m.SSH(target.LoginCommand()); err != nil {
+		c.Fatalf("iSCSI login failed: %v: %s", err, out)
+	}
+
+	dev := target.DevicePath()
+	checkdev := func() error {
+		if _, err := m.SSH("test -b " + dev); err != nil {
+			return fmt.Errorf("%s did not appear", dev)
+		}
+		return nil
+	}
+	if err := util.Retry(10, 3*time.Second, checkdev); err != nil {
+		c.Fatal(err)
+	}
+
+	cmds := []string{
+		"sudo mkfs.ext4 -q " + dev,
+		"sudo mount " + dev + " /mnt",
+		"echo kola | sudo tee /mnt/test",
+		"sudo umount /mnt",
+		"sudo mount " + dev + " /mnt",
+	}
+	for _, cmd := range cmds {
+		if out, err := m.SSH(cmd); err != nil {
+			c.Fatalf("%q failed: %v: %s", cmd, err, out)
+		}
+	}
+
+	out, err := m.SSH("cat /mnt/test")
+	if err != nil || strings.TrimSpace(string(out)) != "kola" {
+		c.Fatalf("read %q from the LUN: %v", out, err)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// allowlistCheck lists something on a freshly booted machine which
+// should only change on purpose.
+type allowlistCheck struct {
+	name  string // of the subtest and its directory under DataDir
+	desc  string // of each item, for messages
+	list  string // command printing the items
+	parse func(line string) string
+}
+
+// firstField returns the first whitespace-separated field of line.
+func firstField(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// socketField returns the protocol and local address of a line of
+// `ss -tlnu` output, such as "tcp *:22", skipping the header.
+func socketField(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] == "Netid" {
+		return ""
+	}
+	return fields[0] + " " + fields[4]
+}
+
+var allowlistChecks = []allowlistCheck{
+	{
+		name:  "units",
+		desc:  "running unit",
+		list:  "systemctl list-units --state=running --no-legend --plain",
+		parse: firstField,
+	},
+	{
+		name:  "enabled",
+		desc:  "enabled unit",
+		list:  "systemctl list-unit-files --state=enabled --no-legend",
+		parse: firstField,
+	},
+	{
+		name:  "sockets",
+		desc:  "listening socket",
+		list:  "sudo ss -tlnu",
+		parse: socketField,
+	},
+}
+
+func init() {
+	register.Register(&register.Test{
+		Run:         allowlist,
+		ClusterSize: 1,
+		Name:        "systemd.allowlist",
+		UserData:    `#cloud-config`,
+	})
+}
+
+// allowlist compares what is running, enabled, and listening on a freshly
+// booted machine with the allowlists for its release stream, so new
+// services don't slip in unnoticed. Each check has a subtest whose
+// DataDir holds a file per stream, such as "stable.allowlist", of glob
+// patterns one per line, with blank lines and lines starting with "#"
+// ignored. Items no pattern matches fail the subtest; patterns which
+// match nothing are only logged, as the item may just not have started
+// yet. What the machine had is attached to the subtest's results, to
+// start or update an allowlist from.
+func allowlist(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	stream, err := machineStream(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	// collect everything before logging in again for each check
+	got := make([][]string, len(allowlistChecks))
+	for i, check := range allowlistChecks {
+		out, err := m.SSH(check.list)
+		if err != nil {
+			c.Fatalf("failed to run %q: output: %q status: %v", check.list, out, err)
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if item := check.parse(line); item != "" {
+				got[i] = append(got[i], item)
+			}
+		}
+		sort.Strings(got[i])
+	}
+
+	for i, check := range allowlistChecks {
+		items := got[i]
+		c.Run(check.name, func(c cluster.TestCluster) {
+			checkAllowlist(c, check, stream, items)
+		})
+	}
+}
+
+// machineStream returns the release stream the machine updates from.
+func machineStream(m platform.Machine) (string, error) {
+	cmd := "grep -h '^GROUP=' /usr/share/coreos/update.conf /etc/coreos/update.conf 2>/dev/null | tail -n1 | cut -d= -f2"
+	out, err := m.SSH(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to find release stream: output: %q status: %v", out, err)
+	}
+	stream := strings.TrimSpace(string(out))
+	if stream == "" {
+		return "", fmt.Errorf("no GROUP in update.conf")
+	}
+	return stream, nil
+}
+
+func checkAllowlist(c cluster.TestCluster, check allowlistCheck, stream string, items []string) {
+	name := stream + ".allowlist"
+	c.Attach(name, strings.NewReader(strings.Join(items, "\n")+"\n"))
+
+	path := filepath.Join(c.DataDir(), name)
+	patterns, err := readAllowlist(path)
+	if os.IsNotExist(err) {
+		c.Fatalf("Allowlist %s does not exist; start it from the attached %s", path, name)
+	} else if err != nil {
+		c.Fatalf("Failed to read allowlist: %v", err)
+	}
+
+	used := make(map[string]bool)
+	var unexpected []string
+	for _, item := range items {
+		allowed := false
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, item); ok {
+				used[pattern] = true
+				allowed = true
+			}
+		}
+		if !allowed {
+			unexpected = append(unexpected, item)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !used[pattern] {
+			c.Logf("No %s matches %q in %s", check.desc, pattern, path)
+		}
+	}
+	if len(unexpected) > 0 {
+		c.Errorf("Unexpected %s not in %s:\n\t%s", check.desc, path, strings.Join(unexpected, "\n\t"))
+	}
+}
+
+// readAllowlist returns the patterns in an allowlist file, checking that
+// they are valid globs.
+func readAllowlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := filepath.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("%s: bad pattern %q: %v", path, line, err)
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
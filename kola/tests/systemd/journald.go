@@ -16,6 +16,7 @@ package systemd
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -96,7 +97,7 @@ func journalRemote(c cluster.TestCluster, journalFmt string) {
 	defer collector.Destroy()
 
 	// collect logs from gatewayd machine
-	cmd := fmt.Sprintf("sudo systemd-run --unit systemd-journal-remote-client /usr/lib/systemd/systemd-journal-remote --url http://%s:19531", gateway.PrivateIP())
+	cmd := fmt.Sprintf("sudo systemd-run --unit systemd-journal-remote-client /usr/lib/systemd/systemd-journal-remote --url http://%s", net.JoinHostPort(gateway.PrivateIP(), "19531"))
 	out, err = collector.SSH(cmd)
 	if err != nil {
 		c.Fatalf("failed to start systemd-journal-remote: %v: %v", out, err)
@@ -0,0 +1,153 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	algSHA256   = 0x000b
+	evNoAction  = 0x00000003
+	specIDEvent = "Spec ID Event03\x00"
+)
+
+// replayEventLog parses a TCG crypto agile firmware event log and returns
+// the SHA-256 PCR values that result from replaying its measurements.
+func replayEventLog(log []byte) (map[uint32][]byte, error) {
+	r := bytes.NewReader(log)
+
+	// The first event uses the legacy SHA-1 format and describes the
+	// digest sizes used by the rest of the log.
+	var hdr struct {
+		PCR       uint32
+		Type      uint32
+		Digest    [20]byte
+		EventSize uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("reading log header: %v", err)
+	}
+	spec := make([]byte, hdr.EventSize)
+	if _, err := io.ReadFull(r, spec); err != nil {
+		return nil, fmt.Errorf("reading log header: %v", err)
+	}
+	sizes, err := parseSpecID(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	pcrs := make(map[uint32][]byte)
+	for r.Len() > 0 {
+		var ev struct {
+			PCR   uint32
+			Type  uint32
+			Count uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &ev); err != nil {
+			return nil, fmt.Errorf("reading event: %v", err)
+		}
+
+		var digest []byte
+		for i := uint32(0); i < ev.Count; i++ {
+			var alg uint16
+			if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+				return nil, fmt.Errorf("reading event digest: %v", err)
+			}
+			size, ok := sizes[alg]
+			if !ok {
+				return nil, fmt.Errorf("unknown digest algorithm %#x", alg)
+			}
+			d := make([]byte, size)
+			if _, err := io.ReadFull(r, d); err != nil {
+				return nil, fmt.Errorf("reading event digest: %v", err)
+			}
+			if alg == algSHA256 {
+				digest = d
+			}
+		}
+
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("reading event size: %v", err)
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("event data is truncated")
+		}
+		if _, err := r.Seek(int64(size), io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("skipping event data: %v", err)
+		}
+
+		if ev.Type == evNoAction {
+			continue
+		}
+		if digest == nil {
+			return nil, fmt.Errorf("event for PCR %d has no SHA-256 digest", ev.PCR)
+		}
+
+		pcr, ok := pcrs[ev.PCR]
+		if !ok {
+			pcr = make([]byte, sha256.Size)
+		}
+		h := sha256.New()
+		h.Write(pcr)
+		h.Write(digest)
+		pcrs[ev.PCR] = h.Sum(nil)
+	}
+
+	return pcrs, nil
+}
+
+// parseSpecID returns the digest sizes by algorithm ID listed in the
+// TCG_EfiSpecIdEvent structure at the start of a crypto agile log.
+func parseSpecID(spec []byte) (map[uint16]int, error) {
+	r := bytes.NewReader(spec)
+	var hdr struct {
+		Signature  [16]byte
+		Class      uint32
+		Minor      uint8
+		Major      uint8
+		Errata     uint8
+		UintnSize  uint8
+		Algorithms uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("reading spec ID event: %v", err)
+	}
+	if string(hdr.Signature[:]) != specIDEvent {
+		return nil, fmt.Errorf("event log is not in crypto agile format")
+	}
+
+	sizes := make(map[uint16]int)
+	for i := uint32(0); i < hdr.Algorithms; i++ {
+		var alg struct {
+			ID   uint16
+			Size uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return nil, fmt.Errorf("reading spec ID algorithms: %v", err)
+		}
+		sizes[alg.ID] = int(alg.Size)
+	}
+	if _, ok := sizes[algSHA256]; !ok {
+		return nil, fmt.Errorf("event log has no SHA-256 digests")
+	}
+
+	return sizes, nil
+}
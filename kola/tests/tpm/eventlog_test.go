@@ -0,0 +1,148 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata/eventlog.bin is a crypto agile log with SHA-1 and SHA-256
+// banks in the layout OVMF writes: a StartupLocality event, firmware
+// measurements into PCR 0, the SecureBoot variable into PCR 7, separators
+// into PCRs 0-7 and two boot applications into PCR 4. testdata/pcrs.json
+// holds the PCR values it replays to, computed separately from the
+// digests in the log.
+
+func TestReplayEventLog(t *testing.T) {
+	log, err := ioutil.ReadFile("testdata/eventlog.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := loadPCRFile("testdata/pcrs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := replayEventLog(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Errorf("replayed %d PCRs, expected %d", len(got), len(want))
+	}
+	for pcr, value := range want {
+		if !bytes.Equal(got[pcr], value) {
+			t.Errorf("PCR %d = %x, expected %x", pcr, got[pcr], value)
+		}
+	}
+
+	// Truncating the log anywhere but at an event boundary must fail
+	// rather than replay part of it.
+	for _, n := range []int{0, 10, 40, 80, 100, len(log) - 1} {
+		if _, err := replayEventLog(log[:n]); err == nil {
+			t.Errorf("replaying the first %d bytes of the log succeeded", n)
+		}
+	}
+}
+
+func TestParseSpecID(t *testing.T) {
+	log, err := ioutil.ReadFile("testdata/eventlog.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The spec ID event follows the 32 byte legacy event header.
+	spec := log[32:]
+
+	sizes, err := parseSpecID(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 || sizes[0x0004] != 20 || sizes[algSHA256] != 32 {
+		t.Errorf("got digest sizes %v, expected SHA-1 and SHA-256", sizes)
+	}
+
+	legacy := append([]byte("Spec ID Event02\x00"), spec[16:]...)
+	if _, err := parseSpecID(legacy); err == nil || !strings.Contains(err.Error(), "crypto agile") {
+		t.Errorf("got error %v for a legacy log", err)
+	}
+
+	// List only the SHA-1 algorithm.
+	sha1Only := append([]byte(nil), spec[:24]...)
+	sha1Only = append(sha1Only, 1, 0, 0, 0)
+	sha1Only = append(sha1Only, spec[28:32]...)
+	if _, err := parseSpecID(sha1Only); err == nil || !strings.Contains(err.Error(), "no SHA-256") {
+		t.Errorf("got error %v for a log without SHA-256", err)
+	}
+
+	if _, err := parseSpecID(spec[:30]); err == nil {
+		t.Error("parsing a truncated spec ID event succeeded")
+	}
+}
+
+func TestLoadPCRFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kola-tpm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name string
+		data string
+		want map[uint32]string
+		err  string
+	}{
+		{"empty", `{}`, map[uint32]string{}, ""},
+		{"values", `{"0": "00ff", "7": "a1b2"}`, map[uint32]string{0: "00ff", 7: "a1b2"}, ""},
+		{"bad index", `{"seven": "a1b2"}`, nil, "invalid PCR index"},
+		{"negative index", `{"-1": "a1b2"}`, nil, "invalid PCR index"},
+		{"bad value", `{"7": "xyz"}`, nil, "invalid value for PCR 7"},
+		{"not an object", `["00ff"]`, nil, "cannot unmarshal"},
+	} {
+		path := filepath.Join(dir, "pcrs.json")
+		if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadPCRFile(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, expected %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d PCRs, expected %d", tt.name, len(got), len(tt.want))
+		}
+		for pcr, value := range tt.want {
+			if hex.EncodeToString(got[pcr]) != value {
+				t.Errorf("%s: PCR %d = %x, expected %s", tt.name, pcr, got[pcr], value)
+			}
+		}
+	}
+
+	if _, err := loadPCRFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("loading a missing file succeeded")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// PCRs measured by firmware and the boot loader which must be reproducible
+// from the firmware event log.
+var firmwarePCRs = []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+// PCR extended by systemd-pcrphase at each boot phase.
+const pcrphasePCR = 11
+
+func init() {
+	register.Register(&register.Test{
+		Run:         MeasuredBoot,
+		ClusterSize: 1,
+		Name:        "coreos.tpm.measuredboot",
+		Platforms:   []string{"qemu"},
+		UserData:    `#cloud-config`,
+	})
+}
+
+// MeasuredBoot verifies that the boot chain was measured into the TPM:
+// the firmware event log must replay to the current PCR values, PCR
+// values must match any expectations given via kola.TPMPCRFile, and
+// systemd-pcrphase must have extended its PCR if it is present.
+func MeasuredBoot(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	if _, err := m.SSH("test -e /sys/class/tpm/tpm0"); err != nil {
+		c.Skip("no TPM present, use --qemu-tpm")
+	}
+
+	out, err := m.SSH("sudo base64 -w0 /sys/kernel/security/tpm0/binary_bios_measurements")
+	if err != nil {
+		c.Fatalf("failed reading firmware event log: %s: %v", out, err)
+	}
+	log, err := base64.StdEncoding.DecodeString(string(out))
+	if err != nil {
+		c.Fatalf("failed decoding firmware event log: %v", err)
+	}
+	replayed, err := replayEventLog(log)
+	if err != nil {
+		c.Fatalf("failed replaying firmware event log: %v", err)
+	}
+
+	zero := make([]byte, 32)
+	for _, pcr := range firmwarePCRs {
+		got := readPCR(c, m, pcr)
+		want, ok := replayed[pcr]
+		if !ok {
+			want = zero
+		}
+		if !bytes.Equal(got, want) {
+			c.Errorf("PCR %d is %x but the event log replays to %x", pcr, got, want)
+		}
+	}
+
+	if kola.TPMPCRFile != "" {
+		expect, err := loadPCRFile(kola.TPMPCRFile)
+		if err != nil {
+			c.Fatalf("failed loading expected PCRs: %v", err)
+		}
+		for pcr, want := range expect {
+			if got := readPCR(c, m, pcr); !bytes.Equal(got, want) {
+				c.Errorf("PCR %d is %x but %x was expected", pcr, got, want)
+			}
+		}
+	}
+
+	if _, err := m.SSH("systemctl cat systemd-pcrphase.service"); err != nil {
+		c.Log("systemd-pcrphase not present, skipping phase measurement checks")
+		return
+	}
+	if out, err := m.SSH("systemctl is-active systemd-pcrphase.service"); err != nil {
+		c.Errorf("systemd-pcrphase.service is not active: %s: %v", out, err)
+	}
+	if pcr := readPCR(c, m, pcrphasePCR); bytes.Equal(pcr, zero) {
+		c.Errorf("PCR %d was not extended by systemd-pcrphase", pcrphasePCR)
+	}
+}
+
+// readPCR reads a SHA-256 PCR value through sysfs.
+func readPCR(c cluster.TestCluster, m platform.Machine, pcr uint32) []byte {
+	path := fmt.Sprintf("/sys/class/tpm/tpm0/pcr-sha256/%d", pcr)
+	out, err := m.SSH("cat " + path)
+	if err != nil {
+		c.Fatalf("failed reading %s: %s: %v", path, out, err)
+	}
+	value, err := hex.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		c.Fatalf("failed parsing %s: %v", path, err)
+	}
+	return value
+}
+
+// loadPCRFile reads a JSON object mapping PCR indexes to hex encoded
+// SHA-256 values, e.g. {"7": "a1b2..."}.
+func loadPCRFile(path string) (map[uint32][]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	pcrs := make(map[uint32][]byte, len(raw))
+	for k, v := range raw {
+		pcr, err := strconv.ParseUint(k, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCR index %q: %v", k, err)
+		}
+		value, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for PCR %d: %v", pcr, err)
+		}
+		pcrs[uint32(pcr)] = value
+	}
+
+	return pcrs, nil
+}
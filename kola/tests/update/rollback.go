@@ -0,0 +1,277 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package update provides a fixture for testing A/B updates of the USR
+// partitions: staging an update, booting it with GPT boot counting, and
+// checking whether a failed health check rolls it back.
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/platform"
+)
+
+const (
+	// targetFile records the partition device being tried so the
+	// health check only runs when booted from it.
+	targetFile = "/etc/kola/update-target"
+	// healthCheck is the scenario's health check script.
+	healthCheck = "/etc/kola/health-check"
+	// updateCheck runs healthCheck on the trial boot of the update
+	// and marks the partition successful if it passes.
+	updateCheck = "/etc/kola/update-check"
+
+	updateCheckScript = `#!/bin/bash
+set -e
+dev=$(rootdev -s /usr)
+[ "${dev}" = "$(cat ` + targetFile + `)" ] || exit 0
+disk=/dev/$(lsblk -no PKNAME "${dev}")
+num=$(cat "/sys/class/block/${dev##*/}/partition")
+[ "$(cgpt show -i "${num}" -S "${disk}")" = 1 ] && exit 0
+` + healthCheck + `
+cgpt add -i "${num}" -S 1 "${disk}"
+`
+
+	// The check runs before sshd can start, so a machine that fails
+	// it reboots without ever being reachable from the bad update.
+	updateCheckUnit = `[Unit]
+Description=Kola update health check
+DefaultDependencies=no
+After=local-fs.target
+Before=sshd.socket sshd.service
+OnFailure=reboot.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=` + updateCheck + `
+
+[Install]
+WantedBy=sockets.target
+`
+)
+
+// Partition is a USR partition and its GPT boot attributes.
+type Partition struct {
+	Label      string // USR-A or USR-B
+	Device     string // partition device, e.g. /dev/vda3
+	Disk       string // disk containing the partition, e.g. /dev/vda
+	Number     int
+	Priority   int
+	Tries      int
+	Successful bool
+}
+
+// Kernel returns the path of the kernel booted with the partition.
+func (p Partition) Kernel() string {
+	return "/boot/coreos/vmlinuz-" + strings.ToLower(strings.TrimPrefix(p.Label, "USR-"))
+}
+
+// Partitions returns the USR partition /usr is mounted from and the
+// other one, which updates are written to.
+func Partitions(m platform.Machine) (active, inactive Partition, err error) {
+	out, err := m.SSH(`for label in USR-A USR-B; do
+	dev=$(readlink -f /dev/disk/by-partlabel/${label})
+	disk=/dev/$(lsblk -no PKNAME "${dev}")
+	num=$(cat "/sys/class/block/${dev##*/}/partition")
+	echo ${label} ${dev} ${disk} ${num} $(sudo cgpt show -i ${num} -P ${disk}) $(sudo cgpt show -i ${num} -T ${disk}) $(sudo cgpt show -i ${num} -S ${disk})
+done
+rootdev -s /usr`)
+	if err != nil {
+		return active, inactive, fmt.Errorf("reading USR partitions: %s: %v", out, err)
+	}
+
+	lines := strings.Split(string(bytes.TrimSpace(out)), "\n")
+	if len(lines) != 3 {
+		return active, inactive, fmt.Errorf("unexpected USR partition output %q", out)
+	}
+	var parts [2]Partition
+	for i := range parts {
+		if parts[i], err = parsePartition(lines[i]); err != nil {
+			return active, inactive, err
+		}
+	}
+
+	switch lines[2] {
+	case parts[0].Device:
+		return parts[0], parts[1], nil
+	case parts[1].Device:
+		return parts[1], parts[0], nil
+	default:
+		return active, inactive, fmt.Errorf("/usr is mounted from %s, not a USR partition", lines[2])
+	}
+}
+
+func parsePartition(line string) (Partition, error) {
+	var p Partition
+	f := strings.Fields(line)
+	if len(f) != 7 {
+		return p, fmt.Errorf("unexpected USR partition line %q", line)
+	}
+	p.Label, p.Device, p.Disk = f[0], f[1], f[2]
+
+	var n [4]int
+	for i := range n {
+		v, err := strconv.Atoi(f[3+i])
+		if err != nil {
+			return p, fmt.Errorf("parsing USR partition line %q: %v", line, err)
+		}
+		n[i] = v
+	}
+	p.Number, p.Priority, p.Tries, p.Successful = n[0], n[1], n[2], n[3] == 1
+	return p, nil
+}
+
+// CopyActive stages an update by copying the running USR partition and
+// its kernel to the inactive partition.
+func CopyActive(m platform.Machine, active, target Partition) error {
+	cmd := fmt.Sprintf("sudo dd if=%s of=%s bs=1M conv=fsync status=none && sudo cp %s %s",
+		active.Device, target.Device, active.Kernel(), target.Kernel())
+	if out, err := m.SSH(cmd); err != nil {
+		return fmt.Errorf("copying %s to %s: %s: %v", active.Label, target.Label, out, err)
+	}
+	return nil
+}
+
+// Scenario describes an update to deploy and how it is expected to end.
+type Scenario struct {
+	// Stage writes the update to the target partition. If nil,
+	// CopyActive is used.
+	Stage func(m platform.Machine, active, target Partition) error
+
+	// HealthCheck is a shell script run as root early in the first
+	// boot of the update. If it fails the machine reboots without
+	// marking the update successful, which rolls it back. If empty,
+	// the update is always healthy.
+	HealthCheck string
+
+	// Rollback is whether the update is expected to be rolled back.
+	Rollback bool
+}
+
+// Run deploys the update to m, reboots into it, and fails the test
+// unless the machine ends up booted from the expected partition with
+// the expected boot attributes. The stage, reboot, and verify phases
+// are timed separately.
+func (s *Scenario) Run(c cluster.TestCluster, m platform.Machine) {
+	c.Phase("stage")
+	active, target, err := Partitions(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+	stage := s.Stage
+	if stage == nil {
+		stage = CopyActive
+	}
+	if err := stage(m, active, target); err != nil {
+		c.Fatalf("staging update: %v", err)
+	}
+	if err := s.install(m, target); err != nil {
+		c.Fatal(err)
+	}
+	boots, err := countBoots(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	// Try the target once, ahead of the active partition. Booting it
+	// uses up its only try, so unless the health check marks it
+	// successful the bootloader falls back on the next boot.
+	if out, err := m.SSH(fmt.Sprintf("sudo cgpt add -i %d -P 2 -T 1 -S 0 %s && sudo cgpt add -i %d -P 1 %s",
+		target.Number, target.Disk, active.Number, active.Disk)); err != nil {
+		c.Fatalf("prioritizing %s: %s: %v", target.Label, out, err)
+	}
+
+	c.Phase("reboot")
+	if err := m.Reboot(); err != nil {
+		c.Fatalf("rebooting into %s: %v", target.Label, err)
+	}
+
+	c.Phase("verify")
+	booted, other, err := Partitions(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+	newBoots, err := countBoots(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	if s.Rollback {
+		if booted.Label != active.Label {
+			c.Fatalf("booted from %s; want rollback to %s", booted.Label, active.Label)
+		}
+		if other.Successful || other.Tries != 0 {
+			c.Errorf("rolled back %s has tries %d and successful %v; want 0 and false", other.Label, other.Tries, other.Successful)
+		}
+		if newBoots != boots+2 {
+			c.Errorf("machine booted %d times; want 2, into the update and back", newBoots-boots)
+		}
+	} else {
+		if booted.Label != target.Label {
+			c.Fatalf("booted from %s; want update on %s", booted.Label, target.Label)
+		}
+		if !booted.Successful {
+			c.Errorf("updated %s was not marked successful", booted.Label)
+		}
+		if newBoots != boots+1 {
+			c.Errorf("machine booted %d times; want 1", newBoots-boots)
+		}
+	}
+}
+
+// install sets up the health check for the trial boot of target. The
+// update engine is masked so it does not mark the boot successful
+// itself.
+func (s *Scenario) install(m platform.Machine, target Partition) error {
+	check := s.HealthCheck
+	if check == "" {
+		check = "#!/bin/sh\nexit 0\n"
+	}
+
+	files := map[string]string{
+		healthCheck: check,
+		updateCheck: updateCheckScript,
+		targetFile:  target.Device + "\n",
+		"/etc/systemd/system/kola-update.service": updateCheckUnit,
+	}
+	for path, contents := range files {
+		if err := platform.InstallFile(strings.NewReader(contents), m, path); err != nil {
+			return fmt.Errorf("installing %s: %v", path, err)
+		}
+	}
+
+	if out, err := m.SSH("sudo systemctl daemon-reload && sudo systemctl enable kola-update.service && sudo systemctl mask --now update-engine.service"); err != nil {
+		return fmt.Errorf("enabling health check: %s: %v", out, err)
+	}
+	return nil
+}
+
+// countBoots returns the number of boots recorded in the journal.
+func countBoots(m platform.Machine) (int, error) {
+	out, err := m.SSH("journalctl --list-boots --no-pager | wc -l")
+	if err != nil {
+		return 0, fmt.Errorf("listing boots: %s: %v", out, err)
+	}
+	n, err := strconv.Atoi(string(bytes.TrimSpace(out)))
+	if err != nil {
+		return 0, fmt.Errorf("parsing boot count %q: %v", out, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         HealthyUpdate,
+		ClusterSize: 1,
+		Name:        "coreos.update.healthy",
+		UserData:    `#cloud-config`,
+	})
+	register.Register(&register.Test{
+		Run:         RollbackUpdate,
+		ClusterSize: 1,
+		Name:        "coreos.update.rollback",
+		UserData:    `#cloud-config`,
+	})
+}
+
+// HealthyUpdate checks that an update passing its health check is kept.
+func HealthyUpdate(c cluster.TestCluster) {
+	s := Scenario{}
+	s.Run(c, c.Machines()[0])
+}
+
+// RollbackUpdate checks that an update failing its health check is
+// rolled back by boot counting.
+func RollbackUpdate(c cluster.TestCluster) {
+	s := Scenario{
+		HealthCheck: "#!/bin/sh\necho 'update is unhealthy' >&2\nexit 1\n",
+		Rollback:    true,
+	}
+	s.Run(c, c.Machines()[0])
+}
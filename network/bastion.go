@@ -0,0 +1,153 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// BastionDialer connects through an SSH bastion host, like ssh's
+// ProxyJump option, for machines that can't be reached directly.
+// The bastion is authenticated with the keys in the user's ssh-agent.
+type BastionDialer struct {
+	// Dialer connects to the bastion itself.
+	Dialer
+	// Retries is the number of attempts to connect through the bastion.
+	Retries int
+
+	user string
+	addr string
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// NewBastionDialer creates a BastionDialer for a bastion given as
+// [user@]host[:port]. The user defaults to the current user.
+func NewBastionDialer(bastion string) (*BastionDialer, error) {
+	user, addr := parseBastion(bastion)
+	if addr == "" {
+		return nil, fmt.Errorf("invalid bastion %q", bastion)
+	}
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	return &BastionDialer{
+		Dialer:  NewRetryDialer(),
+		Retries: DefaultRetries,
+		user:    user,
+		addr:    addr,
+	}, nil
+}
+
+// parseBastion splits [user@]host[:port] into the user and an address
+// with the port filled in.
+func parseBastion(bastion string) (user, addr string) {
+	if i := strings.LastIndex(bastion, "@"); i >= 0 {
+		user, bastion = bastion[:i], bastion[i+1:]
+	}
+	if bastion == "" {
+		return user, ""
+	}
+	return user, ensurePortSuffix(bastion, defaultPort)
+}
+
+// Dial connects to address from the bastion, retrying on failure since
+// the bastion cannot report a timeout the way a local dial would.
+func (d *BastionDialer) Dial(network, address string) (c net.Conn, err error) {
+	for i := 0; i < d.Retries; i++ {
+		var client *ssh.Client
+		client, err = d.connect()
+		if err != nil {
+			return nil, err
+		}
+		c, err = client.Dial(network, address)
+		if err == nil {
+			return
+		}
+		if _, ok := err.(*ssh.OpenChannelError); !ok {
+			// the connection to the bastion broke; reconnect.
+			d.disconnect(client)
+		}
+		time.Sleep(DefaultTimeout)
+	}
+	return
+}
+
+// connect returns the client connected to the bastion, connecting if
+// there is none.
+func (d *BastionDialer) connect() (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	sock, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil, fmt.Errorf("bastion %s: connecting to ssh-agent: %v", d.addr, err)
+	}
+	defer sock.Close()
+
+	// ssh.PublicKeysCallback only asks the agent for signers during the
+	// handshake, so the socket may be closed once connected.
+	cfg := ssh.ClientConfig{
+		User: d.user,
+		Auth: []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(sock).Signers)},
+	}
+	conn, err := d.Dialer.Dial("tcp", d.addr)
+	if err != nil {
+		return nil, fmt.Errorf("bastion %s: %v", d.addr, err)
+	}
+	sshconn, chans, reqs, err := ssh.NewClientConn(conn, d.addr, &cfg)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("bastion %s: %v", d.addr, err)
+	}
+
+	d.client = ssh.NewClient(sshconn, chans, reqs)
+	return d.client, nil
+}
+
+// disconnect drops the client if it is still the current one.
+func (d *BastionDialer) disconnect(client *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == client {
+		d.client.Close()
+		d.client = nil
+	}
+}
+
+// Close closes the connection to the bastion. Connections made through
+// it are closed too.
+func (d *BastionDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
@@ -16,13 +16,15 @@ package network
 
 import (
 	"crypto/rand"
-	"crypto/rsa"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
@@ -30,7 +32,15 @@ import (
 const (
 	defaultPort = 22
 	defaultUser = "core"
-	rsaKeySize  = 2048
+
+	// CertLifetime is how long the certificates issued by an
+	// SSHAgent's certificate authority are valid. They are renewed
+	// once half of it has passed.
+	CertLifetime = time.Hour
+
+	// certSkew backdates certificates in case a machine's clock is
+	// behind.
+	certSkew = 5 * time.Minute
 )
 
 // Dialer is an interface for anything compatible with net.Dialer
@@ -47,27 +57,27 @@ type SSHAgent struct {
 	Socket   string
 	sockDir  string
 	listener *net.UnixListener
+
+	// keysMu guards keys, the private keys added to the agent by
+	// their marshaled public keys, kept to be wiped when removed.
+	keysMu sync.Mutex
+	keys   map[string]ed25519.PrivateKey
+
+	// Also guarded by keysMu: the certificate authority set up by
+	// EnableCA, the certificates it issued to the keys by their
+	// marshaled public keys, when they are next renewed, and the
+	// serial number of the last one.
+	ca      ssh.Signer
+	caKey   ed25519.PrivateKey
+	certs   map[string]*ssh.Certificate
+	renewAt time.Time
+	serial  uint64
 }
 
 // NewSSHAgent constructs a new SSHAgent using dialer to create ssh
-// connections.
+// connections. The agent holds a new ed25519 key of its own, which
+// is only ever kept in memory.
 func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
-	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
-	if err != nil {
-		return nil, err
-	}
-
-	addedkey := agent.AddedKey{
-		PrivateKey: key,
-		Comment:    "core@default",
-	}
-
-	keyring := agent.NewKeyring()
-	err = keyring.Add(addedkey)
-	if err != nil {
-		return nil, err
-	}
-
 	sockDir, err := ioutil.TempDir("", "mantle-ssh-")
 	if err != nil {
 		return nil, err
@@ -81,14 +91,24 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 		os.RemoveAll(sockDir)
 		return nil, err
 	}
+	if err := os.Chmod(sockPath, 0600); err != nil {
+		listener.Close()
+		os.RemoveAll(sockDir)
+		return nil, err
+	}
 
 	a := &SSHAgent{
-		Agent:    keyring,
+		Agent:    agent.NewKeyring(),
 		Dialer:   dialer,
 		User:     defaultUser,
 		Socket:   sockPath,
 		sockDir:  sockDir,
 		listener: listener,
+		keys:     make(map[string]ed25519.PrivateKey),
+	}
+	if _, err := a.NewKey(); err != nil {
+		a.Close()
+		return nil, err
 	}
 
 	go func() {
@@ -104,9 +124,178 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 	return a, nil
 }
 
-// Close closes the unix socket of the agent.
+// NewKey generates a new ed25519 key and adds it to the agent,
+// returning its public half. The agent offers every key it holds until
+// the old ones are removed with RemoveKey.
+func (a *SSHAgent) NewKey() (ssh.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	a.keysMu.Lock()
+	defer a.keysMu.Unlock()
+	if err := a.Add(agent.AddedKey{
+		PrivateKey: priv,
+		Comment:    "core@default",
+	}); err != nil {
+		wipe(priv)
+		return nil, err
+	}
+	a.keys[string(sshPub.Marshal())] = priv
+	if a.ca != nil {
+		if err := a.addCert(sshPub, priv, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return sshPub, nil
+}
+
+// RemoveKey removes a key, and any certificate for it, from the agent
+// and wipes its private half.
+func (a *SSHAgent) RemoveKey(key ssh.PublicKey) error {
+	a.keysMu.Lock()
+	defer a.keysMu.Unlock()
+	if err := a.Remove(key); err != nil {
+		return err
+	}
+	if cert, ok := a.certs[string(key.Marshal())]; ok {
+		if err := a.Remove(cert); err != nil {
+			return err
+		}
+		delete(a.certs, string(key.Marshal()))
+	}
+	if priv, ok := a.keys[string(key.Marshal())]; ok {
+		wipe(priv)
+		delete(a.keys, string(key.Marshal()))
+	}
+	return nil
+}
+
+// EnableCA gives the agent a certificate authority of its own, also
+// only kept in memory, and has it issue each of the agent's keys, and
+// any added later, a certificate for the agent's User valid for
+// CertLifetime. It returns the authority's public key, for machines to
+// trust in sshd's TrustedUserCAKeys instead of authorizing the keys
+// themselves.
+func (a *SSHAgent) EnableCA() (ssh.PublicKey, error) {
+	a.keysMu.Lock()
+	defer a.keysMu.Unlock()
+	if a.ca != nil {
+		return a.ca.PublicKey(), nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		wipe(priv)
+		return nil, err
+	}
+	a.ca, a.caKey = signer, priv
+	a.certs = make(map[string]*ssh.Certificate)
+	if err := a.renewCerts(time.Now()); err != nil {
+		return nil, err
+	}
+	return signer.PublicKey(), nil
+}
+
+// renewCerts replaces the certificates of all of the agent's keys with
+// new ones valid from now. The caller must hold keysMu.
+func (a *SSHAgent) renewCerts(now time.Time) error {
+	for k, priv := range a.keys {
+		pub, err := ssh.ParsePublicKey([]byte(k))
+		if err != nil {
+			return err
+		}
+		if err := a.addCert(pub, priv, now); err != nil {
+			return err
+		}
+	}
+	a.renewAt = now.Add(CertLifetime / 2)
+	return nil
+}
+
+// addCert issues a certificate valid from now for a key of the agent,
+// replacing any earlier one. The caller must hold keysMu.
+func (a *SSHAgent) addCert(pub ssh.PublicKey, priv ed25519.PrivateKey, now time.Time) error {
+	a.serial++
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          a.serial,
+		CertType:        ssh.UserCert,
+		KeyId:           "mantle",
+		ValidPrincipals: []string{a.User},
+		ValidAfter:      uint64(now.Add(-certSkew).Unix()),
+		ValidBefore:     uint64(now.Add(CertLifetime).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-agent-forwarding": "",
+				"permit-port-forwarding":  "",
+				"permit-pty":              "",
+			},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, a.ca); err != nil {
+		return err
+	}
+
+	if old, ok := a.certs[string(pub.Marshal())]; ok {
+		if err := a.Remove(old); err != nil {
+			return err
+		}
+	}
+	if err := a.Add(agent.AddedKey{
+		PrivateKey:  priv,
+		Certificate: cert,
+		Comment:     "core@default",
+	}); err != nil {
+		return err
+	}
+	a.certs[string(pub.Marshal())] = cert
+	return nil
+}
+
+// renewCertsIfDue renews the certificates of the agent's keys once
+// half of their lifetime has passed.
+func (a *SSHAgent) renewCertsIfDue() error {
+	a.keysMu.Lock()
+	defer a.keysMu.Unlock()
+	if a.ca == nil || time.Now().Before(a.renewAt) {
+		return nil
+	}
+	return a.renewCerts(time.Now())
+}
+
+// wipe overwrites a private key so it doesn't linger in memory.
+func wipe(priv ed25519.PrivateKey) {
+	for i := range priv {
+		priv[i] = 0
+	}
+}
+
+// Close closes the unix socket of the agent and wipes its keys.
 func (a *SSHAgent) Close() error {
 	a.listener.Close()
+
+	a.keysMu.Lock()
+	a.RemoveAll()
+	for k, priv := range a.keys {
+		wipe(priv)
+		delete(a.keys, k)
+	}
+	if a.caKey != nil {
+		wipe(a.caKey)
+		a.ca, a.caKey, a.certs = nil, nil, nil
+	}
+	a.keysMu.Unlock()
+
 	return os.RemoveAll(a.sockDir)
 }
 
@@ -155,6 +344,9 @@ func (a *SSHAgent) newClient(host string, user string, auth []ssh.AuthMethod) (*
 // NewClient connects to the given host via SSH, the client will support
 // agent forwarding but it must also be enabled per-session.
 func (a *SSHAgent) NewClient(host string) (*ssh.Client, error) {
+	if err := a.renewCertsIfDue(); err != nil {
+		return nil, err
+	}
 	client, err := a.newClient(host, a.User, []ssh.AuthMethod{ssh.PublicKeysCallback(a.Signers)})
 	if err != nil {
 		return nil, err
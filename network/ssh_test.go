@@ -18,7 +18,9 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"os"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -93,3 +95,144 @@ func TestSSHNewClient(t *testing.T) {
 	// Oh god... I give up for now.
 	t.Skip("Implementation incomplete")
 }
+
+func TestSSHAgentKeys(t *testing.T) {
+	a, err := NewSSHAgent(&net.Dialer{})
+	if err != nil {
+		t.Fatalf("NewSSHAgent failed: %v", err)
+	}
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Type() != ssh.KeyAlgoED25519 {
+		t.Fatalf("got keys %v; want one ed25519 key", keys)
+	}
+	old := keys[0]
+
+	key, err := a.NewKey()
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	if err := a.RemoveKey(old); err != nil {
+		t.Fatalf("RemoveKey failed: %v", err)
+	}
+	if keys, err = a.List(); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || !bytes.Equal(keys[0].Marshal(), key.Marshal()) {
+		t.Errorf("got keys %v after rotating; want only the new key", keys)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if keys, _ := a.List(); len(keys) != 0 {
+		t.Errorf("agent still has %d keys after Close", len(keys))
+	}
+	if _, err := os.Stat(a.Socket); !os.IsNotExist(err) {
+		t.Errorf("socket not removed: %v", err)
+	}
+}
+
+func TestSSHAgentCA(t *testing.T) {
+	a, err := NewSSHAgent(&net.Dialer{})
+	if err != nil {
+		t.Fatalf("NewSSHAgent failed: %v", err)
+	}
+	defer a.Close()
+
+	ca, err := a.EnableCA()
+	if err != nil {
+		t.Fatalf("EnableCA failed: %v", err)
+	}
+	if keys, _ := a.List(); len(keys) != 2 {
+		t.Fatalf("got %d keys; want a key and its certificate", len(keys))
+	}
+
+	// the certificate is for core and signed by the agent's CA
+	checker := &ssh.CertChecker{
+		IsAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.Marshal())
+		},
+	}
+	cert := agentCert(t, a)
+	if err := checker.CheckCert("core", cert); err != nil {
+		t.Fatalf("certificate rejected: %v", err)
+	}
+	if err := checker.CheckCert("root", cert); err == nil {
+		t.Errorf("certificate accepted for root")
+	}
+
+	// new keys get certificates too, and lose them when removed
+	key, err := a.NewKey()
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	if keys, _ := a.List(); len(keys) != 4 {
+		t.Fatalf("got %d keys; want two keys and their certificates", len(keys))
+	}
+	if err := a.RemoveKey(key); err != nil {
+		t.Fatalf("RemoveKey failed: %v", err)
+	}
+	if keys, _ := a.List(); len(keys) != 2 {
+		t.Fatalf("got %d keys after RemoveKey; want a key and its certificate", len(keys))
+	}
+
+	// certificates are renewed once half their lifetime has passed
+	a.keysMu.Lock()
+	a.renewAt = time.Now().Add(-time.Minute)
+	a.keysMu.Unlock()
+	if err := a.renewCertsIfDue(); err != nil {
+		t.Fatalf("renewCertsIfDue failed: %v", err)
+	}
+	if renewed := agentCert(t, a); renewed.Serial == cert.Serial {
+		t.Errorf("certificate not renewed")
+	} else if err := checker.CheckCert("core", renewed); err != nil {
+		t.Errorf("renewed certificate rejected: %v", err)
+	}
+	if keys, _ := a.List(); len(keys) != 2 {
+		t.Errorf("got %d keys after renewal; want a key and its certificate", len(keys))
+	}
+}
+
+// agentCert returns the one certificate held by the agent.
+func agentCert(t *testing.T, a *SSHAgent) *ssh.Certificate {
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var certs []*ssh.Certificate
+	for _, k := range keys {
+		pub, err := ssh.ParsePublicKey(k.Marshal())
+		if err != nil {
+			t.Fatalf("ParsePublicKey failed: %v", err)
+		}
+		if cert, ok := pub.(*ssh.Certificate); ok {
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) != 1 {
+		t.Fatalf("got %d certificates; want 1", len(certs))
+	}
+	return certs[0]
+}
+
+func TestParseBastion(t *testing.T) {
+	tests := map[string][2]string{
+		"host":          {"", "host:22"},
+		"host:2222":     {"", "host:2222"},
+		"core@host":     {"core", "host:22"},
+		"core@[::1]:99": {"core", "[::1]:99"},
+		"a@b@host":      {"a@b", "host:22"},
+		"core@":         {"core", ""},
+	}
+
+	for input, expect := range tests {
+		user, addr := parseBastion(input)
+		if user != expect[0] || addr != expect[1] {
+			t.Errorf("%q: got %q, %q, expected %q, %q", input, user, addr, expect[0], expect[1])
+		}
+	}
+}
@@ -15,6 +15,8 @@
 package aws
 
 import (
+	"sync"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -44,6 +46,30 @@ type Options struct {
 	AMI           string
 	InstanceType  string
 	SecurityGroup string
+
+	// Zones, if set, spreads instances across the given availability
+	// zones in round-robin order.
+	Zones []string
+	// FallbackZones are tried in order when a zone has no capacity
+	// for an instance.
+	FallbackZones []string
+	// PlacementGroup, if set, launches instances in the given placement
+	// group. Use a group with the "spread" strategy to place instances on
+	// distinct hardware.
+	PlacementGroup string
+	// Subnet, if set, launches instances in the given VPC subnet
+	// rather than the default VPC. It must be an IPv6-only subnet
+	// if Options.IPv6Only is set.
+	Subnet string
+
+	// BootMode is the boot mode of AMI, if it was registered with
+	// one. Instances of UEFI-only AMIs must use Nitro instance types.
+	BootMode string
+	// TPM, if set, means instances need the NitroTPM from AMI.
+	TPM bool
+
+	// InfraAMI is the Debian AMI infra servers are created from.
+	InfraAMI string
 }
 
 type API struct {
@@ -51,6 +77,9 @@ type API struct {
 	ec2     *ec2.EC2
 	s3      *s3.S3
 	opts    *Options
+
+	zonelock sync.Mutex
+	nextZone int
 }
 
 // New creates a new AWS API wrapper. It uses credentials from any of the
@@ -89,3 +118,8 @@ func (a *API) PreflightCheck() error {
 
 	return err
 }
+
+// ipv6Only reports whether instances should only have IPv6 addresses.
+func (a *API) ipv6Only() bool {
+	return a.opts.Options != nil && a.opts.IPv6Only
+}
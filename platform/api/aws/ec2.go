@@ -18,12 +18,33 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/coreos/mantle/platform"
 )
 
+// capacityErrors are the error codes EC2 returns when a zone can't
+// take an instance right now, but another zone might.
+var capacityErrors = map[string]bool{
+	"InsufficientInstanceCapacity": true,
+	"InsufficientHostCapacity":     true,
+	"InsufficientCapacity":         true,
+	"Unsupported":                  true,
+}
+
+// isCapacityError reports whether err means the zone had no capacity.
+func isCapacityError(err error) bool {
+	if awserr, ok := err.(awserr.Error); ok {
+		return capacityErrors[awserr.Code()]
+	}
+	return false
+}
+
 func (a *API) AddKey(name, key string) error {
 	_, err := a.ec2.ImportKeyPair(&ec2.ImportKeyPairInput{
 		KeyName:           &name,
@@ -73,13 +94,24 @@ func (a *API) CheckInstances(ids []*string, d time.Duration) error {
 					continue
 				}
 
-				if i.PublicIpAddress == nil {
+				if *i.State.Name == ec2.InstanceStateNameRunning && a.opts.Options != nil && a.opts.Bastion != "" {
+					// only reachable through the bastion, so
+					// leave waiting for SSH to the cluster.
+					online[*i.InstanceId] = true
+					continue
+				}
+
+				addr := aws.StringValue(i.PublicIpAddress)
+				if a.ipv6Only() {
+					addr, _ = InstanceIPs(i)
+				}
+				if addr == "" {
 					continue
 				}
 
 				if *i.State.Name == ec2.InstanceStateNameRunning {
 					// XXX: ssh is a terrible way to check this, but it is all we have.
-					c, err := net.DialTimeout("tcp", *i.PublicIpAddress+":22", 3*time.Second)
+					c, err := net.DialTimeout("tcp", net.JoinHostPort(addr, "22"), 3*time.Second)
 					if err != nil {
 						continue
 					}
@@ -94,8 +126,15 @@ func (a *API) CheckInstances(ids []*string, d time.Duration) error {
 	return nil
 }
 
-// CreateInstances creates EC2 instances with a given ssh key name, user data. The image ID, instance type, and security group set in the API will be used. If wait is true, CreateInstances will block until all instances are reachable by SSH.
-func (a *API) CreateInstances(keyname, userdata string, count uint64, wait bool) ([]*ec2.Instance, error) {
+// CreateInstances creates EC2 instances with a given ssh key name, user data and tags. The image ID, instance type, and security group set in the API will be used, unless securityGroupID is set. The first localDisks instance store volumes are attached. If wait is true, CreateInstances will block until all instances are reachable by SSH.
+func (a *API) CreateInstances(keyname, userdata string, count uint64, tags map[string]string, securityGroupID string, localDisks int, wait bool) ([]*ec2.Instance, error) {
+	if err := a.checkInstanceType(); err != nil {
+		return nil, err
+	}
+	// a single request puts all of its instances in one zone
+	if count > 1 && len(a.opts.Zones) > 1 && a.opts.Subnet == "" {
+		return a.createSpreadInstances(keyname, userdata, count, tags, securityGroupID, localDisks, wait)
+	}
 	cnt := int64(count)
 
 	var ud *string
@@ -113,14 +152,57 @@ func (a *API) CreateInstances(keyname, userdata string, count uint64, wait bool)
 		SecurityGroups: []*string{&a.opts.SecurityGroup},
 		UserData:       ud,
 	}
+	if localDisks > 0 {
+		inst.BlockDeviceMappings = localDiskMappings(localDisks)
+	}
+	if securityGroupID != "" {
+		inst.SecurityGroups = nil
+		inst.SecurityGroupIds = []*string{&securityGroupID}
+	}
 
-	reservations, err := a.ec2.RunInstances(&inst)
-	if err != nil {
-		return nil, err
+	if a.opts.Subnet != "" {
+		ni, err := a.networkInterface(securityGroupID)
+		if err != nil {
+			return nil, err
+		}
+		inst.SecurityGroups = nil
+		inst.SecurityGroupIds = nil
+		inst.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{ni}
+	} else if a.ipv6Only() {
+		return nil, fmt.Errorf("IPv6-only instances need an IPv6-only subnet")
 	}
 
-	if !wait {
-		return reservations.Instances, nil
+	// a subnet is already in a single zone
+	zones := []string{""}
+	if a.opts.Subnet == "" {
+		zones = platform.ZoneOrder(a.zone(), a.opts.FallbackZones)
+	}
+
+	var reservations *ec2.Reservation
+	var err error
+	for _, zone := range zones {
+		inst.Placement = nil
+		if zone != "" || a.opts.PlacementGroup != "" {
+			inst.Placement = &ec2.Placement{}
+			if zone != "" {
+				inst.Placement.AvailabilityZone = aws.String(zone)
+			}
+			if a.opts.PlacementGroup != "" {
+				inst.Placement.GroupName = &a.opts.PlacementGroup
+			}
+		}
+
+		reservations, err = a.ec2.RunInstances(&inst)
+		if err == nil || !isCapacityError(err) {
+			break
+		}
+		plog.Warningf("No capacity for %s instances in zone %q: %v", a.opts.InstanceType, zone, err)
+	}
+	if err != nil {
+		if isCapacityError(err) {
+			return nil, &platform.CapacityError{Zones: zones, Err: err}
+		}
+		return nil, err
 	}
 
 	ids := make([]*string, len(reservations.Instances))
@@ -128,6 +210,16 @@ func (a *API) CreateInstances(keyname, userdata string, count uint64, wait bool)
 		ids[i] = inst.InstanceId
 	}
 
+	if len(tags) > 0 {
+		if err := a.CreateTags(aws.StringValueSlice(ids), tags); err != nil {
+			return nil, err
+		}
+	}
+
+	if !wait {
+		return reservations.Instances, nil
+	}
+
 	// 5 minutes is a pretty reasonable timeframe for AWS instances to work.
 	if err := a.CheckInstances(ids, 5*time.Minute); err != nil {
 		return nil, err
@@ -146,6 +238,172 @@ func (a *API) CreateInstances(keyname, userdata string, count uint64, wait bool)
 	return insts.Reservations[0].Instances, err
 }
 
+// createSpreadInstances creates count instances with a request each, so
+// they are spread across Options.Zones. If any fails, those already
+// created are terminated.
+func (a *API) createSpreadInstances(keyname, userdata string, count uint64, tags map[string]string, securityGroupID string, localDisks int, wait bool) ([]*ec2.Instance, error) {
+	var insts []*ec2.Instance
+	for i := uint64(0); i < count; i++ {
+		created, err := a.CreateInstances(keyname, userdata, 1, tags, securityGroupID, localDisks, wait)
+		if err != nil {
+			for _, inst := range insts {
+				if err := a.TerminateInstance(*inst.InstanceId); err != nil {
+					plog.Errorf("Terminating instance %s: %v", *inst.InstanceId, err)
+				}
+			}
+			return nil, err
+		}
+		insts = append(insts, created...)
+	}
+	return insts, nil
+}
+
+// networkInterface returns the primary network interface of instances
+// launched in Options.Subnet. The security group must be given by ID,
+// so Options.SecurityGroup is looked up if securityGroupID is empty.
+func (a *API) networkInterface(securityGroupID string) (*ec2.InstanceNetworkInterfaceSpecification, error) {
+	if securityGroupID == "" {
+		var err error
+		if securityGroupID, err = a.findSecurityGroup(a.opts.SecurityGroup); err != nil {
+			return nil, err
+		}
+	}
+
+	ni := &ec2.InstanceNetworkInterfaceSpecification{
+		DeviceIndex:         aws.Int64(0),
+		SubnetId:            aws.String(a.opts.Subnet),
+		Groups:              []*string{aws.String(securityGroupID)},
+		DeleteOnTermination: aws.Bool(true),
+	}
+	if a.ipv6Only() {
+		ni.Ipv6AddressCount = aws.Int64(1)
+		ni.AssociatePublicIpAddress = aws.Bool(false)
+	} else {
+		ni.AssociatePublicIpAddress = aws.Bool(true)
+	}
+	return ni, nil
+}
+
+// subnetVPC returns the ID of the VPC containing Options.Subnet.
+func (a *API) subnetVPC() (string, error) {
+	res, err := a.ec2.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		SubnetIds: []*string{aws.String(a.opts.Subnet)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing subnet %s: %v", a.opts.Subnet, err)
+	}
+	if len(res.Subnets) == 0 {
+		return "", fmt.Errorf("subnet %s not found", a.opts.Subnet)
+	}
+	return *res.Subnets[0].VpcId, nil
+}
+
+// findSecurityGroup returns the ID of the named security group in the
+// VPC of Options.Subnet.
+func (a *API) findSecurityGroup(name string) (string, error) {
+	vpc, err := a.subnetVPC()
+	if err != nil {
+		return "", err
+	}
+	res, err := a.ec2.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("group-name"), Values: []*string{aws.String(name)}},
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpc)}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing security group %q: %v", name, err)
+	}
+	if len(res.SecurityGroups) == 0 {
+		return "", fmt.Errorf("security group %q not found in %s", name, vpc)
+	}
+	return *res.SecurityGroups[0].GroupId, nil
+}
+
+// InstanceIPs returns the address to reach an instance at and the
+// address other instances should use. IPv6-only instances have only
+// their IPv6 address, and instances without a public address, such as
+// those reached through a bastion, are reached at their private one.
+func InstanceIPs(inst *ec2.Instance) (publicIP, privateIP string) {
+	var ipv6 string
+	for _, ni := range inst.NetworkInterfaces {
+		for _, addr := range ni.Ipv6Addresses {
+			if ipv6 == "" {
+				ipv6 = aws.StringValue(addr.Ipv6Address)
+			}
+		}
+	}
+
+	privateIP = aws.StringValue(inst.PrivateIpAddress)
+	if privateIP == "" {
+		privateIP = ipv6
+	}
+	publicIP = aws.StringValue(inst.PublicIpAddress)
+	if publicIP == "" {
+		publicIP = ipv6
+	}
+	if publicIP == "" {
+		publicIP = privateIP
+	}
+	return
+}
+
+// xenFamilies are the instance type families that run on the Xen
+// hypervisor rather than Nitro, and so cannot boot UEFI or provide a TPM.
+var xenFamilies = map[string]bool{
+	"c1": true, "c3": true, "c4": true, "cc2": true, "cr1": true,
+	"d2": true, "g2": true, "g3": true, "h1": true, "hs1": true,
+	"i2": true, "i3": true, "m1": true, "m2": true, "m3": true,
+	"m4": true, "p2": true, "p3": true, "r3": true, "r4": true,
+	"t1": true, "t2": true, "x1": true, "x1e": true,
+}
+
+// checkInstanceType checks the instance type can boot the AMI with the
+// boot mode and TPM requested in the options.
+func (a *API) checkInstanceType() error {
+	if a.opts.BootMode != BootModeUEFI && !a.opts.TPM {
+		return nil
+	}
+	family := strings.SplitN(a.opts.InstanceType, ".", 2)[0]
+	if xenFamilies[family] {
+		return fmt.Errorf("instance type %s cannot boot UEFI or provide a TPM; use a Nitro instance type", a.opts.InstanceType)
+	}
+	return nil
+}
+
+// GetConsoleOutput returns the most recent console output of an EC2
+// instance, which may lag the instance by several minutes.
+func (a *API) GetConsoleOutput(instanceID string) (string, error) {
+	res, err := a.ec2.GetConsoleOutput(&ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("getting console output of %s: %v", instanceID, err)
+	}
+	if res.Output == nil {
+		return "", nil
+	}
+	out, err := base64.StdEncoding.DecodeString(*res.Output)
+	if err != nil {
+		return "", fmt.Errorf("decoding console output of %s: %v", instanceID, err)
+	}
+	return string(out), nil
+}
+
+// zone returns the availability zone the next instance should be placed in,
+// or "" if the default zone should be used.
+func (a *API) zone() string {
+	if len(a.opts.Zones) == 0 {
+		return ""
+	}
+
+	a.zonelock.Lock()
+	defer a.zonelock.Unlock()
+	zone := a.opts.Zones[a.nextZone%len(a.opts.Zones)]
+	a.nextZone++
+	return zone
+}
+
 // TerminateInstance schedules an EC2 instance to be terminated.
 func (a *API) TerminateInstance(id string) error {
 	input := &ec2.TerminateInstancesInput{
@@ -159,6 +417,91 @@ func (a *API) TerminateInstance(id string) error {
 	return nil
 }
 
+// ResizeInstance stops an EC2 instance, changes its instance type, and
+// starts it again, returning the restarted instance.
+func (a *API) ResizeInstance(id, instanceType string) (*ec2.Instance, error) {
+	ids := []*string{aws.String(id)}
+
+	if _, err := a.ec2.StopInstances(&ec2.StopInstancesInput{InstanceIds: ids}); err != nil {
+		return nil, fmt.Errorf("stopping instance %s: %v", id, err)
+	}
+	if err := a.ec2.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{InstanceIds: ids}); err != nil {
+		return nil, fmt.Errorf("waiting for instance %s to stop: %v", id, err)
+	}
+
+	_, err := a.ec2.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:   aws.String(id),
+		InstanceType: &ec2.AttributeValue{Value: aws.String(instanceType)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("changing instance %s type to %s: %v", id, instanceType, err)
+	}
+
+	if _, err := a.ec2.StartInstances(&ec2.StartInstancesInput{InstanceIds: ids}); err != nil {
+		return nil, fmt.Errorf("starting instance %s: %v", id, err)
+	}
+	if err := a.ec2.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{InstanceIds: ids}); err != nil {
+		return nil, fmt.Errorf("waiting for instance %s to run: %v", id, err)
+	}
+
+	insts, err := a.ec2.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: ids})
+	if err != nil {
+		return nil, err
+	}
+	if len(insts.Reservations) == 0 || len(insts.Reservations[0].Instances) == 0 {
+		return nil, fmt.Errorf("instance %s not found", id)
+	}
+	return insts.Reservations[0].Instances[0], nil
+}
+
+// DetachNetworkInterface detaches the network interface at deviceIndex
+// from an instance and waits for it to become available, returning the
+// interface ID so it can be reattached. The primary interface cannot be
+// detached.
+func (a *API) DetachNetworkInterface(instanceID string, deviceIndex int64) (string, error) {
+	insts, err := a.ec2.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(insts.Reservations) == 0 || len(insts.Reservations[0].Instances) == 0 {
+		return "", fmt.Errorf("instance %s not found", instanceID)
+	}
+
+	for _, ni := range insts.Reservations[0].Instances[0].NetworkInterfaces {
+		if ni.Attachment == nil || *ni.Attachment.DeviceIndex != deviceIndex {
+			continue
+		}
+		if _, err := a.ec2.DetachNetworkInterface(&ec2.DetachNetworkInterfaceInput{
+			AttachmentId: ni.Attachment.AttachmentId,
+		}); err != nil {
+			return "", fmt.Errorf("detaching network interface %s: %v", *ni.NetworkInterfaceId, err)
+		}
+		if err := a.ec2.WaitUntilNetworkInterfaceAvailable(&ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: []*string{ni.NetworkInterfaceId},
+		}); err != nil {
+			return "", fmt.Errorf("waiting for network interface %s: %v", *ni.NetworkInterfaceId, err)
+		}
+		return *ni.NetworkInterfaceId, nil
+	}
+
+	return "", fmt.Errorf("instance %s has no network interface at index %d", instanceID, deviceIndex)
+}
+
+// AttachNetworkInterface attaches a network interface to an instance.
+func (a *API) AttachNetworkInterface(instanceID, interfaceID string, deviceIndex int64) error {
+	_, err := a.ec2.AttachNetworkInterface(&ec2.AttachNetworkInterfaceInput{
+		InstanceId:         aws.String(instanceID),
+		NetworkInterfaceId: aws.String(interfaceID),
+		DeviceIndex:        aws.Int64(deviceIndex),
+	})
+	if err != nil {
+		return fmt.Errorf("attaching network interface %s: %v", interfaceID, err)
+	}
+	return nil
+}
+
 func (a *API) CreateTags(resources []string, tags map[string]string) error {
 	tagObjs := make([]*ec2.Tag, 0, len(tags))
 	for key, value := range tags {
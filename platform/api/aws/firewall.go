@@ -0,0 +1,138 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// CreateSecurityGroup creates a security group in the default VPC, or
+// that of Options.Subnet, that allows SSH plus the rules, and returns
+// its ID. If there are outbound rules, the default rule allowing all
+// outbound traffic is removed.
+func (a *API) CreateSecurityGroup(name string, rules []platform.FirewallRule) (string, error) {
+	input := &ec2.CreateSecurityGroupInput{
+		GroupName:   &name,
+		Description: aws.String("kola firewall rules"),
+	}
+	if a.opts.Subnet != "" {
+		vpc, err := a.subnetVPC()
+		if err != nil {
+			return "", err
+		}
+		input.VpcId = &vpc
+	}
+	sg, err := a.ec2.CreateSecurityGroup(input)
+	if err != nil {
+		return "", fmt.Errorf("creating security group %q: %v", name, err)
+	}
+	id := *sg.GroupId
+
+	ingress := []*ec2.IpPermission{ipPermission(platform.FirewallRule{
+		Protocol: "tcp",
+		FromPort: 22,
+	})}
+	var egress []*ec2.IpPermission
+	for _, r := range rules {
+		if r.Inbound() {
+			ingress = append(ingress, ipPermission(r))
+		} else {
+			egress = append(egress, ipPermission(r))
+		}
+	}
+
+	if _, err := a.ec2.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       &id,
+		IpPermissions: ingress,
+	}); err != nil {
+		a.DeleteSecurityGroup(id)
+		return "", fmt.Errorf("authorizing ingress: %v", err)
+	}
+
+	if len(egress) > 0 {
+		if _, err := a.ec2.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+			GroupId: &id,
+			IpPermissions: []*ec2.IpPermission{{
+				IpProtocol: aws.String("-1"),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			}},
+		}); err != nil {
+			a.DeleteSecurityGroup(id)
+			return "", fmt.Errorf("revoking default egress: %v", err)
+		}
+		if _, err := a.ec2.AuthorizeSecurityGroupEgress(&ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       &id,
+			IpPermissions: egress,
+		}); err != nil {
+			a.DeleteSecurityGroup(id)
+			return "", fmt.Errorf("authorizing egress: %v", err)
+		}
+	}
+
+	return id, nil
+}
+
+// DeleteSecurityGroup deletes a security group, retrying while
+// instances using it finish terminating.
+func (a *API) DeleteSecurityGroup(id string) error {
+	var err error
+	for i := 0; i < 30; i++ {
+		_, err = a.ec2.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{
+			GroupId: &id,
+		})
+		if awserr, ok := err.(awserr.Error); !ok || awserr.Code() != "DependencyViolation" {
+			break
+		}
+		time.Sleep(10 * time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("deleting security group %q: %v", id, err)
+	}
+	return nil
+}
+
+// ipPermission converts a rule. TCP and UDP rules from anywhere cover
+// IPv6 as well as IPv4.
+func ipPermission(r platform.FirewallRule) *ec2.IpPermission {
+	p := &ec2.IpPermission{
+		IpProtocol: aws.String(r.Protocol),
+	}
+	if strings.Contains(r.Source(), ":") {
+		p.Ipv6Ranges = []*ec2.Ipv6Range{{CidrIpv6: aws.String(r.Source())}}
+	} else {
+		p.IpRanges = []*ec2.IpRange{{CidrIp: aws.String(r.Source())}}
+	}
+	if r.CIDR == "" && r.Protocol != "icmp" {
+		p.Ipv6Ranges = []*ec2.Ipv6Range{{CidrIpv6: aws.String("::/0")}}
+	}
+	if r.Protocol == "icmp" {
+		// all types and codes
+		p.FromPort = aws.Int64(-1)
+		p.ToPort = aws.Int64(-1)
+	} else {
+		from, to := r.Ports()
+		p.FromPort = aws.Int64(int64(from))
+		p.ToPort = aws.Int64(int64(to))
+	}
+	return p
+}
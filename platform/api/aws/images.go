@@ -16,6 +16,8 @@ package aws
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/url"
 	"strings"
 	"sync"
@@ -23,8 +25,11 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
+
+	"github.com/coreos/mantle/util"
 )
 
 type EC2ImageType string
@@ -338,21 +343,116 @@ func (a *API) CreateImportRole(bucket string) error {
 	return nil
 }
 
-func (a *API) CreateHVMImage(snapshotID string, name string, description string) (string, error) {
+// Boot modes of HVM images.
+const (
+	BootModeLegacyBIOS    = "legacy-bios"
+	BootModeUEFI          = "uefi"
+	BootModeUEFIPreferred = "uefi-preferred"
+)
+
+// TPMSupportV2 enables NitroTPM on instances launched from an image.
+const TPMSupportV2 = "v2.0"
+
+// HVMImageOptions are attributes set when registering an HVM image.
+type HVMImageOptions struct {
+	// BootMode is one of the BootMode constants, or empty to use the
+	// EC2 default of legacy BIOS.
+	BootMode string
+	// TPMSupport is TPMSupportV2 to give instances a NitroTPM, or
+	// empty for none. It requires UEFI boot.
+	TPMSupport string
+	// ENA enables the Elastic Network Adapter.
+	ENA bool
+	// SriovNet enables Intel 82599 VF enhanced networking.
+	SriovNet bool
+}
+
+// DefaultHVMImageOptions enables enhanced networking with the default
+// boot mode.
+var DefaultHVMImageOptions = HVMImageOptions{ENA: true, SriovNet: true}
+
+// Validate checks the options are a combination EC2 accepts.
+func (o HVMImageOptions) Validate() error {
+	switch o.BootMode {
+	case "", BootModeLegacyBIOS, BootModeUEFI, BootModeUEFIPreferred:
+	default:
+		return fmt.Errorf("invalid boot mode %q", o.BootMode)
+	}
+	switch o.TPMSupport {
+	case "":
+	case TPMSupportV2:
+		if o.BootMode != BootModeUEFI && o.BootMode != BootModeUEFIPreferred {
+			return fmt.Errorf("TPM support requires UEFI boot mode")
+		}
+	default:
+		return fmt.Errorf("invalid TPM support %q", o.TPMSupport)
+	}
+	return nil
+}
+
+func (a *API) CreateHVMImage(snapshotID string, name string, description string, opts HVMImageOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
 	params := registerImageParams(snapshotID, name, description, "xvd", EC2ImageTypeHVM)
-	params.EnaSupport = aws.Bool(true)
-	params.SriovNetSupport = aws.String("simple")
-	return a.createImage(params)
+	if opts.ENA {
+		params.EnaSupport = aws.Bool(true)
+	}
+	if opts.SriovNet {
+		params.SriovNetSupport = aws.String("simple")
+	}
+
+	// The vendored SDK predates these parameters, so add them to the
+	// request directly.
+	extra := url.Values{}
+	if opts.BootMode != "" {
+		extra.Set("BootMode", opts.BootMode)
+	}
+	if opts.TPMSupport != "" {
+		extra.Set("TpmSupport", opts.TPMSupport)
+	}
+	return a.createImage(params, extra)
 }
 
 func (a *API) CreatePVImage(snapshotID string, name string, description string) (string, error) {
 	params := registerImageParams(snapshotID, name, description, "sd", EC2ImageTypePV)
 	params.KernelId = aws.String(akis[a.opts.Region])
-	return a.createImage(params)
+	return a.createImage(params, nil)
+}
+
+// addParams returns a request handler that adds query parameters to an
+// EC2 request after it has been built.
+func addParams(params url.Values) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "mantle.aws.addParams",
+		Fn: func(r *request.Request) {
+			if r.Error != nil {
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				r.Error = awserr.New("SerializationError", "failed reading EC2 Query request", err)
+				return
+			}
+			values, err := url.ParseQuery(string(body))
+			if err != nil {
+				r.Error = awserr.New("SerializationError", "failed parsing EC2 Query request", err)
+				return
+			}
+			for k, v := range params {
+				values[k] = v
+			}
+			r.SetBufferBody([]byte(values.Encode()))
+		},
+	}
 }
 
-func (a *API) createImage(params *ec2.RegisterImageInput) (string, error) {
-	res, err := a.ec2.RegisterImage(params)
+func (a *API) createImage(params *ec2.RegisterImageInput, extra url.Values) (string, error) {
+	req, res := a.ec2.RegisterImageRequest(params)
+	if len(extra) > 0 {
+		req.Handlers.Build.PushBackNamed(addParams(extra))
+	}
+	err := req.Send()
 
 	if err == nil {
 		return *res.ImageId, nil
@@ -420,13 +520,20 @@ func (a *API) GrantLaunchPermission(imageID string, userIDs []string) error {
 	return nil
 }
 
-func (a *API) CopyImage(sourceImageID string, regions []string) (map[string]string, error) {
-	type result struct {
-		region  string
-		imageID string
-		err     error
-	}
+// copyImageAttempts is how many times CopyImage tries each region, and
+// copyImageRetryDelay how long it waits before retrying the first time.
+const (
+	copyImageAttempts   = 3
+	copyImageRetryDelay = 10 * time.Second
+)
 
+// CopyImage copies an image to each of the regions concurrently, along
+// with its tags and launch permissions. Regions that fail are retried.
+// The region status table is written to status, which may be nil. The
+// images that were copied are returned even if some regions failed, in
+// which case the error is a util.RegionErrors. Copying again resumes
+// where the last run left off.
+func (a *API) CopyImage(sourceImageID string, regions []string, status io.Writer) (map[string]string, error) {
 	image, err := a.describeImage(sourceImageID)
 	if err != nil {
 		return nil, err
@@ -449,38 +556,27 @@ func (a *API) CopyImage(sourceImageID string, regions []string) (map[string]stri
 	}
 	launchPermissions := describeAttributeRes.LaunchPermissions
 
-	var wg sync.WaitGroup
-	ch := make(chan result, len(regions))
-	for _, region := range regions {
+	var mu sync.Mutex
+	amis := make(map[string]string)
+	err = util.ForEachRegion(status, regions, copyImageAttempts, copyImageRetryDelay, func(region string) error {
 		opts := *a.opts
 		opts.Region = region
 		aa, err := New(&opts)
 		if err != nil {
-			break
-		}
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			res := result{region: aa.opts.Region}
-			res.imageID, res.err = aa.copyImageIn(a.opts.Region, sourceImageID,
-				*image.Name, *image.Description,
-				image.Tags, snapshot.Tags,
-				launchPermissions)
-			ch <- res
-		}()
-	}
-	wg.Wait()
-	close(ch)
-
-	amis := make(map[string]string)
-	for res := range ch {
-		if res.imageID != "" {
-			amis[res.region] = res.imageID
+			return err
 		}
-		if err == nil {
-			err = res.err
+		imageID, err := aa.copyImageIn(a.opts.Region, sourceImageID,
+			*image.Name, *image.Description,
+			image.Tags, snapshot.Tags,
+			launchPermissions)
+		if err != nil {
+			return err
 		}
-	}
+		mu.Lock()
+		amis[region] = imageID
+		mu.Unlock()
+		return nil
+	})
 	return amis, err
 }
 
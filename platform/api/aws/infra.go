@@ -0,0 +1,69 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// CreateInfraInstance creates an instance of ami running script as its
+// user data, to serve as a platform.InfraServer. It uses the same
+// instance type, security group, and subnet as other instances, and
+// waits for it to be running.
+func (a *API) CreateInfraInstance(ami, script string) (*ec2.Instance, error) {
+	inst := ec2.RunInstancesInput{
+		ImageId:        aws.String(ami),
+		MinCount:       aws.Int64(1),
+		MaxCount:       aws.Int64(1),
+		InstanceType:   &a.opts.InstanceType,
+		SecurityGroups: []*string{&a.opts.SecurityGroup},
+		UserData:       aws.String(base64.StdEncoding.EncodeToString([]byte(script))),
+	}
+	if a.opts.Subnet != "" {
+		ni, err := a.networkInterface("")
+		if err != nil {
+			return nil, err
+		}
+		inst.SecurityGroups = nil
+		inst.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{ni}
+	}
+
+	res, err := a.ec2.RunInstances(&inst)
+	if err != nil {
+		return nil, fmt.Errorf("creating infra instance: %v", err)
+	}
+	id := res.Instances[0].InstanceId
+
+	if err := a.CreateTags([]string{*id}, map[string]string{"Name": "kola-infra"}); err != nil {
+		a.TerminateInstance(*id)
+		return nil, err
+	}
+
+	describe := &ec2.DescribeInstancesInput{InstanceIds: []*string{id}}
+	if err := a.ec2.WaitUntilInstanceRunning(describe); err != nil {
+		a.TerminateInstance(*id)
+		return nil, fmt.Errorf("waiting for infra instance %s: %v", *id, err)
+	}
+	insts, err := a.ec2.DescribeInstances(describe)
+	if err != nil {
+		a.TerminateInstance(*id)
+		return nil, err
+	}
+	return insts.Reservations[0].Instances[0], nil
+}
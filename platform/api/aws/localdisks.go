@@ -0,0 +1,73 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// MaxLocalDisks is the most instance store volumes an instance can have.
+const MaxLocalDisks = 24
+
+// instanceStoreFamilies are the instance type families without a "d"
+// suffix that have instance store volumes, in some sizes at least.
+var instanceStoreFamilies = map[string]bool{
+	"c1": true, "c3": true, "d2": true, "d3": true, "f1": true,
+	"g2": true, "h1": true, "i2": true, "i3": true, "i3en": true,
+	"m1": true, "m2": true, "m3": true, "r3": true, "x1": true,
+	"x1e": true,
+}
+
+// HasInstanceStore reports whether the configured instance type can
+// have instance store volumes. Whether it has as many as a test wants
+// depends on its size, which is only found out once it runs.
+func (a *API) HasInstanceStore() bool {
+	family := strings.SplitN(a.opts.InstanceType, ".", 2)[0]
+	return instanceStoreFamilies[family] || strings.HasSuffix(family, "d")
+}
+
+// localDiskMappings maps the first n instance store volumes to /dev/sdb
+// onwards. Nitro instances attach their NVMe instance store volumes
+// regardless.
+func localDiskMappings(n int) []*ec2.BlockDeviceMapping {
+	var mappings []*ec2.BlockDeviceMapping
+	for i := 0; i < n; i++ {
+		mappings = append(mappings, &ec2.BlockDeviceMapping{
+			DeviceName:  aws.String(fmt.Sprintf("/dev/sd%c", 'b'+i)),
+			VirtualName: aws.String(fmt.Sprintf("ephemeral%d", i)),
+		})
+	}
+	return mappings
+}
+
+// LocalDiskPaths returns the devices the first n instance store volumes
+// are expected at in the guest: /dev/xvdb onwards on Xen, and the NVMe
+// namespaces after the root volume's on Nitro.
+func (a *API) LocalDiskPaths(n int) []string {
+	family := strings.SplitN(a.opts.InstanceType, ".", 2)[0]
+	var paths []string
+	for i := 0; i < n; i++ {
+		if xenFamilies[family] {
+			paths = append(paths, fmt.Sprintf("/dev/xvd%c", 'b'+i))
+		} else {
+			paths = append(paths, fmt.Sprintf("/dev/nvme%dn1", i+1))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// Quotas returns the instance quota of the region. The EC2 API does not
+// report vCPU limits.
+func (a *API) Quotas() ([]platform.Quota, error) {
+	attrs, err := a.ec2.DescribeAccountAttributes(&ec2.DescribeAccountAttributesInput{
+		AttributeNames: []*string{aws.String("max-instances")},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing account attributes: %v", err)
+	}
+
+	var limit float64
+	for _, attr := range attrs.AccountAttributes {
+		for _, v := range attr.AttributeValues {
+			if limit, err = strconv.ParseFloat(aws.StringValue(v.AttributeValue), 64); err != nil {
+				return nil, fmt.Errorf("parsing max-instances: %v", err)
+			}
+		}
+	}
+
+	var usage float64
+	err = a.ec2.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("instance-state-name"),
+			Values: aws.StringSlice([]string{"pending", "running"}),
+		}},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			usage += float64(len(r.Instances))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("counting instances: %v", err)
+	}
+
+	return []platform.Quota{{
+		Resource: platform.QuotaInstances,
+		Scope:    a.opts.Region,
+		Limit:    limit,
+		Usage:    usage,
+	}}, nil
+}
+
+// CheckQuota checks there is quota to create the given number of machines.
+func (a *API) CheckQuota(machines int) error {
+	quotas, err := a.Quotas()
+	if err != nil {
+		return err
+	}
+	return platform.CheckQuotas(quotas, map[string]map[string]float64{
+		a.opts.Region: {platform.QuotaInstances: float64(machines)},
+	})
+}
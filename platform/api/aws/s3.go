@@ -72,6 +72,27 @@ func (a *API) UploadObject(r io.Reader, bucket, path string, force bool) error {
 	return err
 }
 
+// TagObject replaces the tags on an S3 object. Bucket lifecycle rules
+// can filter on tags to expire objects.
+func (a *API) TagObject(bucket, path string, tags map[string]string) error {
+	tagSet := make([]*s3.Tag, 0, len(tags))
+	for key, value := range tags {
+		tagSet = append(tagSet, &s3.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+	_, err := a.s3.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(path),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return fmt.Errorf("error tagging s3://%v/%v: %v", bucket, path, err)
+	}
+	return nil
+}
+
 func (a *API) DeleteObject(bucket, path string) error {
 	plog.Infof("deleting s3://%v/%v", bucket, path)
 	_, err := a.s3.DeleteObject(&s3.DeleteObjectInput{
@@ -30,4 +30,7 @@ type Options struct {
 
 	// Azure Storage API endpoint suffix. If unset, the Azure SDK default will be used.
 	StorageEndpointSuffix string
+
+	// Number of pages to upload concurrently. If unset, 8 is used.
+	UploadParallelism int
 }
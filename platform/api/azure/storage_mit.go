@@ -111,7 +111,9 @@ func (a *API) UploadBlob(storageaccount, storagekey, vhd, container, blob string
 		}
 		rangesToSkip = ranges
 	} else {
-		createBlob(bsc, container, blob, ds.GetSize(), localMetaData)
+		if err := createBlob(bsc, container, blob, ds.GetSize(), localMetaData); err != nil {
+			return err
+		}
 	}
 
 	uploadableRanges, err := upload.LocateUploadableRanges(ds, rangesToSkip, pageBlobPageSize)
@@ -124,24 +126,14 @@ func (a *API) UploadBlob(storageaccount, storagekey, vhd, container, blob string
 		return err
 	}
 
-	cxt := &upload.DiskUploadContext{
-		VhdStream:             ds,
-		UploadableRanges:      uploadableRanges,
-		AlreadyProcessedBytes: common.TotalRangeLength(rangesToSkip),
-		BlobServiceClient:     bsc,
-		ContainerName:         container,
-		BlobName:              blob,
-		Parallelism:           8,
-		Resume:                resume,
-		MD5Hash:               localMetaData.FileMetaData.MD5Hash,
-	}
+	plog.Printf("Effective upload size: %d MiB (from %d MiB originally)",
+		common.TotalRangeLength(uploadableRanges)>>20, ds.GetSize()>>20)
 
-	err = upload.Upload(cxt)
-	if err != nil {
+	if err := uploadPages(bsc, container, blob, ds, uploadableRanges, a.opts.UploadParallelism); err != nil {
 		return err
 	}
 
-	return nil
+	return setBlobMD5(bsc, container, blob, localMetaData.FileMetaData.MD5Hash)
 }
 
 // getBlobMetaData returns the custom metadata associated with a page blob which is set by createBlob method.
@@ -0,0 +1,145 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/Microsoft/azure-vhd-utils-for-go/vhdcore/common"
+	"github.com/Microsoft/azure-vhd-utils-for-go/vhdcore/diskstream"
+
+	"github.com/coreos/mantle/util"
+)
+
+const (
+	defaultUploadParallelism = 8
+	pageUploadRetries        = 5
+	pageUploadRetryDelay     = 10 * time.Second
+)
+
+// page is a chunk of the disk stream destined for a page blob.
+type page struct {
+	r    *common.IndexRange
+	data []byte
+}
+
+// uploadPages uploads the given ranges of ds to a page blob using parallel
+// workers. Each page is sent with its MD5 so the storage service rejects
+// corrupted writes, and failed writes are retried before giving up.
+func uploadPages(bsc storage.BlobStorageClient, container, blob string, ds *diskstream.DiskStream, ranges []*common.IndexRange, parallelism int) error {
+	if parallelism < 1 {
+		parallelism = defaultUploadParallelism
+	}
+
+	var total int64
+	for _, r := range ranges {
+		total += r.Length()
+	}
+	plog.Infof("Uploading %d MiB in %d pages", total>>20, len(ranges))
+
+	pages := make(chan *page, parallelism)
+	done := make(chan struct{})
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		uploaded int64
+		reported int64
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			close(done)
+		}
+	}
+
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pages {
+				sum := md5.Sum(p.data)
+				headers := map[string]string{
+					"Content-MD5": base64.StdEncoding.EncodeToString(sum[:]),
+				}
+				put := func() error {
+					err := bsc.PutPage(container, blob, p.r.Start, p.r.End, storage.PageWriteTypeUpdate, p.data, headers)
+					if err != nil {
+						plog.Warningf("Uploading page %s failed: %v", p.r, err)
+					}
+					return err
+				}
+				if err := util.Retry(pageUploadRetries, pageUploadRetryDelay, put); err != nil {
+					fail(fmt.Errorf("uploading page %s: %v", p.r, err))
+					return
+				}
+
+				mu.Lock()
+				uploaded += p.r.Length()
+				if total > 0 && (uploaded-reported)*10 >= total {
+					reported = uploaded
+					plog.Infof("Uploaded %d%%", uploaded*100/total)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// The disk stream cannot be read concurrently so pages are read here
+	// and handed off to the workers.
+	func() {
+		defer close(pages)
+		for _, r := range ranges {
+			p := &page{r: r, data: make([]byte, r.Length())}
+			if _, err := ds.Seek(r.Start, 0); err != nil {
+				fail(err)
+				return
+			}
+			if _, err := io.ReadFull(ds, p.data); err != nil {
+				fail(err)
+				return
+			}
+			select {
+			case pages <- p:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	return firstErr
+}
+
+// setBlobMD5 records the MD5 of the complete image on the blob, which
+// marks the upload as finished so it won't be resumed. The service does
+// not compute the MD5 of page blobs, so this isn't a check of the data;
+// the per-page Content-MD5 headers in uploadPages are.
+func setBlobMD5(bsc storage.BlobStorageClient, container, blob string, md5Hash []byte) error {
+	headers := storage.BlobHeaders{ContentMD5: base64.StdEncoding.EncodeToString(md5Hash)}
+	if err := bsc.SetBlobProperties(container, blob, headers); err != nil {
+		return fmt.Errorf("setting blob MD5: %v", err)
+	}
+	return nil
+}
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/coreos/pkg/capnslog"
 	"google.golang.org/api/compute/v1"
@@ -39,8 +40,20 @@ type Options struct {
 	MachineType string
 	DiskType    string
 	Network     string
+	// Subnetwork, if set, is the subnetwork of Network to create
+	// instances in. It must be IPv6-only if Options.IPv6Only is set.
+	Subnetwork  string
 	JSONKeyFile string
 	ServiceAuth bool
+	// Zones, if set, spreads instances across the given zones in
+	// round-robin order instead of using Zone.
+	Zones []string
+	// FallbackZones are tried in order when a zone has no capacity
+	// for an instance.
+	FallbackZones []string
+	// InfraImage is the Debian image infra servers are booted from,
+	// DefaultInfraImage if empty.
+	InfraImage string
 	*platform.Options
 }
 
@@ -48,6 +61,9 @@ type API struct {
 	client  *http.Client
 	compute *compute.Service
 	options *Options
+
+	zonelock sync.Mutex
+	nextZone int
 }
 
 func New(opts *Options) (*API, error) {
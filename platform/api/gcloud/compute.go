@@ -24,6 +24,7 @@ import (
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 
+	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/util"
 )
 
@@ -33,9 +34,29 @@ func (a *API) vmname() string {
 	return fmt.Sprintf("%s-%x", a.options.BaseName, b)
 }
 
+// zone returns the zone the next instance should be created in.
+func (a *API) zone() string {
+	if len(a.options.Zones) == 0 {
+		return a.options.Zone
+	}
+
+	a.zonelock.Lock()
+	defer a.zonelock.Unlock()
+	zone := a.options.Zones[a.nextZone%len(a.options.Zones)]
+	a.nextZone++
+	return zone
+}
+
 // Taken from: https://github.com/golang/build/blob/master/buildlet/gce.go
-func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Instance {
+func (a *API) mkinstance(userdata, name, zone string, keys []*agent.Key, metadata map[string]string, tags []string, localDisks int) *compute.Instance {
 	var metadataItems []*compute.MetadataItems
+	for key, value := range metadata {
+		value := value // for the pointer
+		metadataItems = append(metadataItems, &compute.MetadataItems{
+			Key:   key,
+			Value: &value,
+		})
+	}
 	if len(keys) > 0 {
 		var sshKeys string
 		for i, key := range keys {
@@ -52,7 +73,7 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 
 	instance := &compute.Instance{
 		Name:        name,
-		MachineType: instancePrefix + "/zones/" + a.options.Zone + "/machineTypes/" + a.options.MachineType,
+		MachineType: instancePrefix + "/zones/" + zone + "/machineTypes/" + a.options.MachineType,
 		Metadata: &compute.Metadata{
 			Items: metadataItems,
 		},
@@ -60,7 +81,7 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 			// Apparently you need this tag in addition to the
 			// firewall rules to open the port because these ports
 			// are special?
-			Items: []string{"https-server", "http-server"},
+			Items: append([]string{"https-server", "http-server"}, tags...),
 		},
 		Disks: []*compute.AttachedDisk{
 			{
@@ -70,7 +91,7 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 				InitializeParams: &compute.AttachedDiskInitializeParams{
 					DiskName:    name,
 					SourceImage: a.options.Image,
-					DiskType:    "/zones/" + a.options.Zone + "/diskTypes/" + a.options.DiskType,
+					DiskType:    "/zones/" + zone + "/diskTypes/" + a.options.DiskType,
 					DiskSizeGb:  12,
 				},
 			},
@@ -87,6 +108,10 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 			},
 		},
 	}
+	instance.Disks = append(instance.Disks, localSSDs(zone, localDisks)...)
+	if a.options.Subnetwork != "" {
+		instance.NetworkInterfaces[0].Subnetwork = instancePrefix + "/regions/" + zone[:strings.LastIndex(zone, "-")] + "/subnetworks/" + a.options.Subnetwork
+	}
 	// add cloud config
 	if userdata != "" {
 		instance.Metadata.Items = append(instance.Metadata.Items, &compute.MetadataItems{
@@ -103,7 +128,35 @@ type doable interface {
 	Do(opts ...googleapi.CallOption) (*compute.Operation, error)
 }
 
+// operationError is an error reported by an operation which finished
+// unsuccessfully. Waiting longer won't change it.
+type operationError struct {
+	operation string
+	err       *compute.OperationErrorErrors
+}
+
+func (e *operationError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("Operation %q failed to start", e.operation)
+	}
+	return fmt.Sprintf("Operation %q failed: %+v", e.operation, *e.err)
+}
+
+// capacityErrors are the operation error codes GCE reports when a zone
+// can't take an instance right now, but another zone might.
+var capacityErrors = map[string]bool{
+	"ZONE_RESOURCE_POOL_EXHAUSTED":              true,
+	"ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS": true,
+}
+
+// isCapacityError reports whether err means the zone had no capacity.
+func isCapacityError(err error) bool {
+	operr, ok := err.(*operationError)
+	return ok && operr.err != nil && capacityErrors[operr.err.Code]
+}
+
 func (a *API) waitop(operation string, do doable) error {
+	var failed *operationError
 	retry := func() error {
 		op, err := do.Do()
 		if err != nil {
@@ -115,10 +168,10 @@ func (a *API) waitop(operation string, do doable) error {
 			return fmt.Errorf("Operation %q is %q", operation, op.Status)
 		case "DONE":
 			if op.Error != nil {
-				for _, operr := range op.Error.Errors {
-					return fmt.Errorf("Error creating instance: %+v", operr)
+				failed = &operationError{operation: operation}
+				if len(op.Error.Errors) > 0 {
+					failed.err = op.Error.Errors[0]
 				}
-				return fmt.Errorf("Operation %q failed to start", op.Status)
 			}
 
 			return nil
@@ -131,28 +184,57 @@ func (a *API) waitop(operation string, do doable) error {
 	if err := util.Retry(30, 10*time.Second, retry); err != nil {
 		return fmt.Errorf("Failed to wait for operation %q: %v", operation, err)
 	}
+	if failed != nil {
+		return failed
+	}
 
 	return nil
 }
 
-// CreateInstance creates a Google Compute Engine instance.
-func (a *API) CreateInstance(userdata string, keys []*agent.Key) (*compute.Instance, error) {
+// CreateInstance creates a Google Compute Engine instance. The metadata
+// is added to the instance's custom metadata attributes, and the tags to
+// its network tags. localDisks local SSDs are attached over NVMe. If the
+// zone has no capacity, Options.FallbackZones are tried in order, and a
+// platform.CapacityError is returned if none of them have any.
+func (a *API) CreateInstance(userdata string, keys []*agent.Key, metadata map[string]string, tags []string, localDisks int) (*compute.Instance, error) {
 	name := a.vmname()
-	inst := a.mkinstance(userdata, name, keys)
+	zones := platform.ZoneOrder(a.zone(), a.options.FallbackZones)
+
+	var err error
+	for _, zone := range zones {
+		var inst *compute.Instance
+		inst, err = a.createZoneInstance(userdata, name, zone, keys, metadata, tags, localDisks)
+		if err == nil || !isCapacityError(err) {
+			return inst, err
+		}
+		plog.Warningf("No capacity for instance %q in zone %q: %v", name, zone, err)
+	}
 
-	plog.Debugf("Creating instance %q", name)
+	return nil, &platform.CapacityError{Zones: zones, Err: err}
+}
+
+func (a *API) createZoneInstance(userdata, name, zone string, keys []*agent.Key, metadata map[string]string, tags []string, localDisks int) (*compute.Instance, error) {
+	inst := a.mkinstance(userdata, name, zone, keys, metadata, tags, localDisks)
 
-	op, err := a.compute.Instances.Insert(a.options.Project, a.options.Zone, inst).Do()
+	plog.Debugf("Creating instance %q in zone %q", name, zone)
+
+	var op *compute.Operation
+	var err error
+	if a.ipv6Only() {
+		op, err = a.insertIPv6Only(zone, inst)
+	} else {
+		op, err = a.compute.Instances.Insert(a.options.Project, zone, inst).Do()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to request new GCE instance: %v\n", err)
 	}
 
-	doable := a.compute.ZoneOperations.Get(a.options.Project, a.options.Zone, op.Name)
+	doable := a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name)
 	if err := a.waitop(op.Name, doable); err != nil {
 		return nil, err
 	}
 
-	inst, err = a.compute.Instances.Get(a.options.Project, a.options.Zone, name).Do()
+	inst, err = a.compute.Instances.Get(a.options.Project, zone, name).Do()
 	if err != nil {
 		return nil, fmt.Errorf("failed getting instance %s details after creation: %v", name, err)
 	}
@@ -162,27 +244,88 @@ func (a *API) CreateInstance(userdata string, keys []*agent.Key) (*compute.Insta
 	return inst, nil
 }
 
+// ResizeInstance stops an instance, changes its machine type, and starts
+// it again, returning the restarted instance.
+func (a *API) ResizeInstance(zone, name, machineType string) (*compute.Instance, error) {
+	plog.Debugf("Resizing instance %q in zone %q to %q", name, zone, machineType)
+
+	op, err := a.compute.Instances.Stop(a.options.Project, zone, name).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stop instance %s: %v", name, err)
+	}
+	if err := a.waitop(op.Name, a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name)); err != nil {
+		return nil, err
+	}
+
+	req := &compute.InstancesSetMachineTypeRequest{
+		MachineType: "zones/" + zone + "/machineTypes/" + machineType,
+	}
+	op, err = a.compute.Instances.SetMachineType(a.options.Project, zone, name, req).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set machine type of instance %s: %v", name, err)
+	}
+	if err := a.waitop(op.Name, a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name)); err != nil {
+		return nil, err
+	}
+
+	op, err = a.compute.Instances.Start(a.options.Project, zone, name).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start instance %s: %v", name, err)
+	}
+	if err := a.waitop(op.Name, a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name)); err != nil {
+		return nil, err
+	}
+
+	inst, err := a.compute.Instances.Get(a.options.Project, zone, name).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting instance %s details after resize: %v", name, err)
+	}
+	return inst, nil
+}
+
+// GetConsoleOutput returns the serial console output of an instance.
+func (a *API) GetConsoleOutput(zone, name string) (string, error) {
+	out, err := a.compute.Instances.GetSerialPortOutput(a.options.Project, zone, name).Do()
+	if err != nil {
+		return "", fmt.Errorf("getting console output of %s: %v", name, err)
+	}
+	return out.Contents, nil
+}
+
+// TerminateInstance deletes a Google Compute Engine instance in
+// Options.Zone. Use TerminateZoneInstance for instances which may be in
+// other zones.
 func (a *API) TerminateInstance(name string) error {
-	plog.Debugf("Terminating instance %q", name)
+	return a.TerminateZoneInstance(a.options.Zone, name)
+}
 
-	_, err := a.compute.Instances.Delete(a.options.Project, a.options.Zone, name).Do()
+// TerminateZoneInstance deletes a Google Compute Engine instance in the
+// given zone.
+func (a *API) TerminateZoneInstance(zone, name string) error {
+	plog.Debugf("Terminating instance %q in zone %q", name, zone)
+
+	_, err := a.compute.Instances.Delete(a.options.Project, zone, name).Do()
 	return err
 }
 
+// ListInstances lists the instances whose names start with prefix in
+// every zone instances may be created in, including the fallback zones.
 func (a *API) ListInstances(prefix string) ([]*compute.Instance, error) {
 	var instances []*compute.Instance
 
-	list, err := a.compute.Instances.List(a.options.Project, a.options.Zone).Do()
-	if err != nil {
-		return nil, err
-	}
-
-	for _, inst := range list.Items {
-		if !strings.HasPrefix(inst.Name, prefix) {
-			continue
+	for _, zone := range a.allZones() {
+		list, err := a.compute.Instances.List(a.options.Project, zone).Do()
+		if err != nil {
+			return nil, err
 		}
 
-		instances = append(instances, inst)
+		for _, inst := range list.Items {
+			if !strings.HasPrefix(inst.Name, prefix) {
+				continue
+			}
+
+			instances = append(instances, inst)
+		}
 	}
 
 	return instances, nil
@@ -202,3 +345,8 @@ func InstanceIPs(inst *compute.Instance) (intIP, extIP string) {
 	}
 	return
 }
+
+// InstanceZone returns the short name of the zone an instance is in.
+func InstanceZone(inst *compute.Instance) string {
+	return inst.Zone[strings.LastIndex(inst.Zone, "/")+1:]
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// DefaultExportWorkerImage is the image of the instance ExportImage
+// uses to copy a disk to Google Storage. It needs python3 and gsutil.
+const DefaultExportWorkerImage = "projects/debian-cloud/global/images/family/debian-12"
+
+// exportTimeout bounds how long the worker may take to copy the image.
+const exportTimeout = 2 * time.Hour
+
+// exportDevice is the device name of the disk being exported, which
+// appears in the worker as /dev/disk/by-id/google-export.
+const exportDevice = "export"
+
+// exportScript is run by the worker to stream the disk into a gzipped
+// tarball holding disk.raw, the format GCE creates images from, while
+// logging progress and the tarball's SHA-256 to the serial console.
+const exportScript = `#!/bin/bash
+exec >/dev/ttyS0 2>&1
+set -o pipefail
+python3 - <<'EOF' | gzip -c | tee >(sha256sum | cut -d' ' -f1 >/tmp/export.sha256) | gsutil -q cp - %q
+import os, sys, tarfile
+dev = "/dev/disk/by-id/google-%s"
+with open(dev, "rb") as f:
+    size = f.seek(0, os.SEEK_END)
+    f.seek(0)
+    class Progress:
+        done, shown = 0, -1
+        def read(self, n):
+            buf = f.read(n)
+            self.done += len(buf)
+            pct = self.done * 100 // size
+            if pct != self.shown and pct %% 5 == 0:
+                self.shown = pct
+                print("ExportProgress: %%d%%%%" %% pct, file=sys.stderr, flush=True)
+            return buf
+    info = tarfile.TarInfo("disk.raw")
+    info.size = size
+    with tarfile.open(fileobj=sys.stdout.buffer, mode="w|", format=tarfile.GNU_FORMAT) as tar:
+        tar.addfile(info, Progress())
+EOF
+status=$?
+sleep 1
+if [ $status -eq 0 ]; then
+    echo "ExportSuccess: $(cat /tmp/export.sha256)"
+else
+    echo "ExportFailed: exit status $status"
+fi
+`
+
+// ExportImage copies an image to gs://bucket/object as a gzipped
+// tarball holding disk.raw, the format CreateImage takes, returning the
+// tarball's SHA-256. GCE can't export images itself, so the image is
+// attached to a temporary worker instance booted from workerImage which
+// streams it to Google Storage. progress is called with each progress
+// message from the worker, such as "50%".
+func (a *API) ExportImage(image, workerImage, bucket, object string, progress func(string)) (string, error) {
+	name := a.vmname()
+	zone := a.options.Zone
+	if !strings.Contains(image, "/") {
+		image = "projects/" + a.options.Project + "/global/images/" + image
+	}
+
+	plog.Debugf("Creating disk %q from image %q", name+"-export", image)
+	disk := &compute.Disk{
+		Name:        name + "-export",
+		SourceImage: image,
+	}
+	op, err := a.compute.Disks.Insert(a.options.Project, zone, disk).Do()
+	if err != nil {
+		return "", fmt.Errorf("creating disk from image: %v", err)
+	}
+	if err := a.waitop(op.Name, a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name)); err != nil {
+		return "", fmt.Errorf("creating disk from image: %v", err)
+	}
+	defer func() {
+		plog.Debugf("Deleting disk %q", disk.Name)
+		if _, err := a.compute.Disks.Delete(a.options.Project, zone, disk.Name).Do(); err != nil {
+			plog.Errorf("Deleting disk %q: %v", disk.Name, err)
+		}
+	}()
+
+	script := fmt.Sprintf(exportScript, "gs://"+bucket+"/"+object, exportDevice)
+	inst := a.mkinstance("", name, zone, nil, map[string]string{"startup-script": script}, nil, 0)
+	inst.Disks[0].InitializeParams.SourceImage = workerImage
+	inst.Disks = append(inst.Disks, &compute.AttachedDisk{
+		AutoDelete: false,
+		Type:       "PERSISTENT",
+		Mode:       "READ_ONLY",
+		DeviceName: exportDevice,
+		Source:     "projects/" + a.options.Project + "/zones/" + zone + "/disks/" + disk.Name,
+	})
+	inst.ServiceAccounts = []*compute.ServiceAccount{{
+		Email:  "default",
+		Scopes: []string{"https://www.googleapis.com/auth/devstorage.read_write"},
+	}}
+
+	plog.Debugf("Creating export worker %q in zone %q", name, zone)
+	op, err = a.compute.Instances.Insert(a.options.Project, zone, inst).Do()
+	if err != nil {
+		return "", fmt.Errorf("creating export worker: %v", err)
+	}
+	if err := a.waitop(op.Name, a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name)); err != nil {
+		return "", fmt.Errorf("creating export worker: %v", err)
+	}
+	defer func() {
+		// the disk can't be deleted until the worker is gone
+		plog.Debugf("Deleting export worker %q", name)
+		op, err := a.compute.Instances.Delete(a.options.Project, zone, name).Do()
+		if err == nil {
+			err = a.waitop(op.Name, a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name))
+		}
+		if err != nil {
+			plog.Errorf("Deleting export worker %q: %v", name, err)
+		}
+	}()
+
+	return a.waitExport(zone, name, progress)
+}
+
+// waitExport follows the serial console of an export worker until it
+// reports the outcome of the export.
+func (a *API) waitExport(zone, name string, progress func(string)) (string, error) {
+	var seen int
+	deadline := time.Now().Add(exportTimeout)
+	for time.Now().Before(deadline) {
+		console, err := a.GetConsoleOutput(zone, name)
+		if err != nil {
+			return "", err
+		}
+		// the console is truncated once it grows large
+		if len(console) < seen {
+			seen = 0
+		}
+		lines := strings.Split(console[seen:], "\n")
+		// keep any partial last line for the next pass
+		lines = lines[:len(lines)-1]
+		for _, line := range lines {
+			seen += len(line) + 1
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "ExportProgress: "):
+				if progress != nil {
+					progress(strings.TrimPrefix(line, "ExportProgress: "))
+				}
+			case strings.HasPrefix(line, "ExportSuccess: "):
+				return strings.TrimPrefix(line, "ExportSuccess: "), nil
+			case strings.HasPrefix(line, "ExportFailed: "):
+				return "", fmt.Errorf("export failed: %s", strings.TrimPrefix(line, "ExportFailed: "))
+			}
+		}
+		time.Sleep(10 * time.Second)
+	}
+	return "", fmt.Errorf("export did not finish within %v", exportTimeout)
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+
+	"google.golang.org/api/compute/v1"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// CreateFirewalls creates a firewall in the configured network for each
+// rule, applying to instances with the tag, and returns their names.
+// GCE firewalls only filter inbound traffic, so outbound rules are
+// not supported.
+func (a *API) CreateFirewalls(tag string, rules []platform.FirewallRule) ([]string, error) {
+	var names []string
+	for i, r := range rules {
+		if !r.Inbound() {
+			a.DeleteFirewalls(names)
+			return nil, platform.ErrNotSupported
+		}
+
+		allowed := &compute.FirewallAllowed{IPProtocol: r.Protocol}
+		if r.Protocol != "icmp" {
+			from, to := r.Ports()
+			if from == to {
+				allowed.Ports = []string{fmt.Sprint(from)}
+			} else {
+				allowed.Ports = []string{fmt.Sprintf("%d-%d", from, to)}
+			}
+		}
+
+		fw := &compute.Firewall{
+			Name:         fmt.Sprintf("%s-%d", tag, i),
+			Network:      "projects/" + a.options.Project + "/global/networks/" + a.options.Network,
+			Allowed:      []*compute.FirewallAllowed{allowed},
+			SourceRanges: []string{r.Source()},
+			TargetTags:   []string{tag},
+		}
+
+		plog.Debugf("Creating firewall %q: %v", fw.Name, r)
+
+		op, err := a.compute.Firewalls.Insert(a.options.Project, fw).Do()
+		if err != nil {
+			a.DeleteFirewalls(names)
+			return nil, fmt.Errorf("creating firewall %q: %v", fw.Name, err)
+		}
+		names = append(names, fw.Name)
+
+		doable := a.compute.GlobalOperations.Get(a.options.Project, op.Name)
+		if err := a.waitop(op.Name, doable); err != nil {
+			a.DeleteFirewalls(names)
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// DeleteFirewalls deletes the named firewalls.
+func (a *API) DeleteFirewalls(names []string) error {
+	var firstErr error
+	for _, name := range names {
+		plog.Debugf("Deleting firewall %q", name)
+		if _, err := a.compute.Firewalls.Delete(a.options.Project, name).Do(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("deleting firewall %q: %v", name, err)
+		}
+	}
+	return firstErr
+}
@@ -17,6 +17,7 @@ package gcloud
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"google.golang.org/api/compute/v1"
 )
@@ -84,3 +85,23 @@ func (a *API) ListImages(prefix string) ([]string, error) {
 
 	return images, nil
 }
+
+// SetImageExpiry marks an image as deprecated and due for deletion at
+// expires. GCE doesn't delete the image itself, but the date is kept
+// with the image for cleanup tools to act on.
+func (a *API) SetImageExpiry(name string, expires time.Time) error {
+	status := &compute.DeprecationStatus{
+		State:   "DEPRECATED",
+		Deleted: expires.UTC().Format(time.RFC3339),
+	}
+
+	plog.Debugf("Setting image %q to expire at %s", name, status.Deleted)
+
+	op, err := a.compute.Images.Deprecate(a.options.Project, name, status).Do()
+	if err != nil {
+		return fmt.Errorf("deprecating image %q: %v", name, err)
+	}
+
+	doable := a.compute.GlobalOperations.Get(a.options.Project, op.Name)
+	return a.waitop(op.Name, doable)
+}
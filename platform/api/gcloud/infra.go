@@ -0,0 +1,53 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// DefaultInfraImage is the Debian image infra servers are booted from
+// unless Options.InfraImage is set.
+const DefaultInfraImage = "projects/debian-cloud/global/images/family/debian-12"
+
+// InfraTag is the network tag of infra servers, so firewalls can let
+// them reach the internet while keeping other instances from it.
+const InfraTag = "kola-infra"
+
+// CreateInfraInstance creates an instance booted from image that runs
+// script at startup, to serve as a platform.InfraServer.
+func (a *API) CreateInfraInstance(image, script string) (*compute.Instance, error) {
+	name := a.vmname()
+	zone := a.options.Zone
+	inst := a.mkinstance("", name, zone, nil, map[string]string{"startup-script": script}, []string{InfraTag}, 0)
+	inst.Disks[0].InitializeParams.SourceImage = image
+
+	plog.Debugf("Creating infra instance %q in zone %q", name, zone)
+	op, err := a.compute.Instances.Insert(a.options.Project, zone, inst).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to request infra instance: %v", err)
+	}
+	if err := a.waitop(op.Name, a.compute.ZoneOperations.Get(a.options.Project, zone, op.Name)); err != nil {
+		return nil, err
+	}
+
+	inst, err = a.compute.Instances.Get(a.options.Project, zone, name).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting infra instance %s details after creation: %v", name, err)
+	}
+	return inst, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// The vendored compute API predates IPv6 support, so IPv6-only
+// instances are created and inspected with raw requests that add the
+// missing fields.
+
+// ipv6Interface is the IPv6 state of a network interface.
+type ipv6Interface struct {
+	Ipv6Address       string `json:"ipv6Address"`
+	Ipv6AccessConfigs []struct {
+		ExternalIpv6 string `json:"externalIpv6"`
+	} `json:"ipv6AccessConfigs"`
+}
+
+// ipv6Only reports whether instances should only have IPv6 addresses.
+func (a *API) ipv6Only() bool {
+	return a.options.Options != nil && a.options.IPv6Only
+}
+
+// insertIPv6Only requests a new instance whose network interface has
+// an external IPv6 address and no IPv4 addresses. The subnetwork must
+// be IPv6-only.
+func (a *API) insertIPv6Only(zone string, inst *compute.Instance) (*compute.Operation, error) {
+	if a.options.Subnetwork == "" {
+		return nil, fmt.Errorf("IPv6-only instances need an IPv6-only subnetwork")
+	}
+
+	data, err := json.Marshal(inst)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for _, iface := range raw["networkInterfaces"].([]interface{}) {
+		iface := iface.(map[string]interface{})
+		delete(iface, "accessConfigs")
+		iface["stackType"] = "IPV6_ONLY"
+		iface["ipv6AccessConfigs"] = []map[string]string{{
+			"type":        "DIRECT_IPV6",
+			"name":        "External IPv6",
+			"networkTier": "PREMIUM",
+		}}
+	}
+	if data, err = json.Marshal(raw); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%sprojects/%s/zones/%s/instances", a.compute.BasePath, a.options.Project, zone)
+	res, err := a.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+
+	var op compute.Operation
+	if err := json.NewDecoder(res.Body).Decode(&op); err != nil {
+		return nil, fmt.Errorf("decoding operation: %v", err)
+	}
+	return &op, nil
+}
+
+// InstanceAddrs returns the internal and external IPs of an instance.
+// For IPv6-only instances these are its internal and external IPv6
+// addresses, which are fetched again since the compute API drops them.
+func (a *API) InstanceAddrs(inst *compute.Instance) (intIP, extIP string, err error) {
+	if !a.ipv6Only() {
+		intIP, extIP = InstanceIPs(inst)
+		return intIP, extIP, nil
+	}
+
+	res, err := a.client.Get(inst.SelfLink)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	if err := googleapi.CheckResponse(res); err != nil {
+		return "", "", err
+	}
+
+	var raw struct {
+		NetworkInterfaces []ipv6Interface `json:"networkInterfaces"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
+		return "", "", fmt.Errorf("decoding instance %s: %v", inst.Name, err)
+	}
+	for _, iface := range raw.NetworkInterfaces {
+		if intIP == "" {
+			intIP = iface.Ipv6Address
+		}
+		for _, ac := range iface.Ipv6AccessConfigs {
+			if extIP == "" {
+				extIP = ac.ExternalIpv6
+			}
+		}
+	}
+	if extIP == "" {
+		return "", "", fmt.Errorf("instance %s has no external IPv6 address", inst.Name)
+	}
+	if intIP == "" {
+		intIP = extIP
+	}
+	return intIP, extIP, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// MaxLocalDisks is the most local SSDs an instance can have.
+const MaxLocalDisks = 24
+
+// noLocalSSDFamilies are the machine type families that cannot have
+// local SSDs.
+var noLocalSSDFamilies = map[string]bool{
+	"e2": true, "f1": true, "g1": true, "t2a": true, "t2d": true,
+}
+
+// HasLocalSSDs reports whether the configured machine type can have
+// local SSDs.
+func (a *API) HasLocalSSDs() bool {
+	family := strings.SplitN(a.options.MachineType, "-", 2)[0]
+	return !noLocalSSDFamilies[family]
+}
+
+// localSSDs returns n local SSDs attached over NVMe.
+func localSSDs(zone string, n int) []*compute.AttachedDisk {
+	var disks []*compute.AttachedDisk
+	for i := 0; i < n; i++ {
+		disks = append(disks, &compute.AttachedDisk{
+			AutoDelete: true,
+			Type:       "SCRATCH",
+			Interface:  "NVME",
+			InitializeParams: &compute.AttachedDiskInitializeParams{
+				DiskType: "/zones/" + zone + "/diskTypes/local-ssd",
+			},
+		})
+	}
+	return disks
+}
+
+// LocalDiskPaths returns the devices the first n local SSDs are expected
+// at in the guest, as named by the GCE udev rules.
+func LocalDiskPaths(n int) []string {
+	var paths []string
+	for i := 0; i < n; i++ {
+		paths = append(paths, fmt.Sprintf("/dev/disk/by-id/google-local-nvme-ssd-%d", i))
+	}
+	return paths
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// quotaMetrics maps GCE region quota metrics to platform quota resources.
+var quotaMetrics = map[string]string{
+	"INSTANCES":        platform.QuotaInstances,
+	"CPUS":             platform.QuotaCPUs,
+	"IN_USE_ADDRESSES": platform.QuotaIPs,
+}
+
+// zoneRegion returns the region containing a zone such as us-central1-a.
+func zoneRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// zones returns every zone machines may be created in.
+func (a *API) zones() []string {
+	if len(a.options.Zones) > 0 {
+		return a.options.Zones
+	}
+	return []string{a.options.Zone}
+}
+
+// allZones returns every zone instances may be in, including the
+// fallback zones.
+func (a *API) allZones() []string {
+	zones := a.zones()
+	var rest []string
+	rest = append(rest, zones[1:]...)
+	rest = append(rest, a.options.FallbackZones...)
+	return platform.ZoneOrder(zones[0], rest)
+}
+
+// Quotas returns the instance, CPU, and IP quotas of every region
+// machines may be created in.
+func (a *API) Quotas() ([]platform.Quota, error) {
+	var quotas []platform.Quota
+	seen := make(map[string]bool)
+	for _, zone := range a.zones() {
+		region := zoneRegion(zone)
+		if seen[region] {
+			continue
+		}
+		seen[region] = true
+
+		r, err := a.compute.Regions.Get(a.options.Project, region).Do()
+		if err != nil {
+			return nil, fmt.Errorf("getting quotas for region %s: %v", region, err)
+		}
+		for _, q := range r.Quotas {
+			if resource, ok := quotaMetrics[q.Metric]; ok {
+				quotas = append(quotas, platform.Quota{
+					Resource: resource,
+					Scope:    region,
+					Limit:    q.Limit,
+					Usage:    q.Usage,
+				})
+			}
+		}
+	}
+	return quotas, nil
+}
+
+// CheckQuota checks there is quota to create the given number of machines,
+// spread across zones the same way CreateInstance does.
+func (a *API) CheckQuota(machines int) error {
+	mt, err := a.compute.MachineTypes.Get(a.options.Project, a.options.Zone, a.options.MachineType).Do()
+	if err != nil {
+		return fmt.Errorf("getting machine type %s: %v", a.options.MachineType, err)
+	}
+
+	need := make(map[string]map[string]float64)
+	zones := a.zones()
+	for i := 0; i < machines; i++ {
+		region := zoneRegion(zones[i%len(zones)])
+		if need[region] == nil {
+			need[region] = make(map[string]float64)
+		}
+		need[region][platform.QuotaInstances]++
+		need[region][platform.QuotaCPUs] += float64(mt.GuestCpus)
+		need[region][platform.QuotaIPs]++
+	}
+
+	quotas, err := a.Quotas()
+	if err != nil {
+		return err
+	}
+	return platform.CheckQuotas(quotas, need)
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hetzner creates images and servers on Hetzner Cloud using its
+// API.
+package hetzner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/mantle/util"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/hetzner")
+)
+
+const endpoint = "https://api.hetzner.cloud/v1"
+
+type Options struct {
+	// Token is an API token of the project to work in.
+	Token string
+
+	// Location and ServerType are where servers are created and their
+	// size, such as "fsn1" and "cx22".
+	Location   string
+	ServerType string
+}
+
+type API struct {
+	client *http.Client
+	opts   *Options
+}
+
+func New(opts *Options) (*API, error) {
+	if opts.Token == "" {
+		return nil, fmt.Errorf("no Hetzner Cloud API token")
+	}
+	return &API{
+		client: http.DefaultClient,
+		opts:   opts,
+	}, nil
+}
+
+// call sends a request with in, if not nil, as its JSON body and decodes
+// the JSON response into out, if not nil.
+func (a *API) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.opts.Token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response to %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+// Action is an asynchronous operation started by another call.
+type Action struct {
+	ID      int64  `json:"id"`
+	Command string `json:"command"`
+	Status  string `json:"status"`
+	Error   *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// waitAction waits for an action to finish, returning its error if it
+// failed.
+func (a *API) waitAction(action Action) error {
+	done := false
+	err := util.Retry(120, 5*time.Second, func() error {
+		var out struct {
+			Action Action `json:"action"`
+		}
+		if err := a.call("GET", fmt.Sprintf("/actions/%d", action.ID), nil, &out); err != nil {
+			return err
+		}
+		action = out.Action
+		if action.Status == "running" {
+			return fmt.Errorf("%s is still running", action.Command)
+		}
+		done = true
+		return nil
+	})
+	if !done {
+		return err
+	}
+	if action.Status == "error" && action.Error != nil {
+		return fmt.Errorf("%s failed: %s: %s", action.Command, action.Error.Code, action.Error.Message)
+	} else if action.Status != "success" {
+		return fmt.Errorf("%s ended with status %q", action.Command, action.Status)
+	}
+	return nil
+}
+
+// serverAction runs an action on a server and waits for it to finish,
+// decoding the response starting it into out, if not nil.
+func (a *API) serverAction(id int64, command string, in, out interface{}) error {
+	var raw json.RawMessage
+	if err := a.call("POST", fmt.Sprintf("/servers/%d/actions/%s", id, command), in, &raw); err != nil {
+		return err
+	}
+	var resp struct {
+		Action Action `json:"action"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("decoding %s action: %v", command, err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("decoding %s action: %v", command, err)
+		}
+	}
+	return a.waitAction(resp.Action)
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// redirectTransport sends every request to a test server.
+type redirectTransport struct {
+	host string
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = t.host
+	req.URL = &u
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func testAPI(t *testing.T, handler http.Handler) (*API, func()) {
+	srv := httptest.NewServer(handler)
+	srvURL, _ := url.Parse(srv.URL)
+	a, err := New(&Options{Token: "token", Location: "fsn1", ServerType: "cx22"})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	a.client = &http.Client{Transport: redirectTransport{srvURL.Host}}
+	return a, srv.Close
+}
+
+func TestCallError(t *testing.T) {
+	a, done := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"code":"not_found"}}`, http.StatusNotFound)
+	}))
+	defer done()
+
+	_, err := a.GetServer(42)
+	if err == nil {
+		t.Fatal("GetServer succeeded on a 404")
+	}
+	want := `GET /servers/42: 404 Not Found: {"error":{"code":"not_found"}}`
+	if err.Error() != want {
+		t.Errorf("got error %q, expected %q", err, want)
+	}
+}
+
+func TestCreateServer(t *testing.T) {
+	var created map[string]interface{}
+	a, done := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("%s %s: Authorization %q", r.Method, r.URL.Path, auth)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/servers":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Errorf("decoding request: %v", err)
+			}
+			fmt.Fprint(w, `{"server":{"id":7},"action":{"id":3,"command":"create_server","status":"running"}}`)
+		case "GET /v1/actions/3":
+			fmt.Fprint(w, `{"action":{"id":3,"command":"create_server","status":"success"}}`)
+		case "GET /v1/servers/7":
+			fmt.Fprint(w, `{"server":{"id":7,"name":"a","status":"running","public_net":{"ipv4":{"ip":"192.0.2.1"}},"labels":{"k":"v"}}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	server, err := a.CreateServer("a", "debian-12", "", map[string]string{"k": "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReq := map[string]interface{}{
+		"name":        "a",
+		"server_type": "cx22",
+		"location":    "fsn1",
+		"image":       "debian-12",
+		"labels":      map[string]interface{}{"k": "v"},
+	}
+	if !reflect.DeepEqual(created, wantReq) {
+		t.Errorf("created server with %v, expected %v", created, wantReq)
+	}
+	if server.ID != 7 || server.Name != "a" || server.IP() != "192.0.2.1" || server.Labels["k"] != "v" {
+		t.Errorf("got server %+v", server)
+	}
+}
+
+func TestServerAction(t *testing.T) {
+	a, done := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/servers/7/actions/enable_rescue":
+			fmt.Fprint(w, `{"root_password":"secret","action":{"id":4,"command":"enable_rescue","status":"running"}}`)
+		case "GET /v1/actions/4":
+			fmt.Fprint(w, `{"action":{"id":4,"command":"enable_rescue","status":"success"}}`)
+		case "POST /v1/servers/7/actions/reset":
+			fmt.Fprint(w, `{"action":{"id":5,"command":"reset","status":"running"}}`)
+		case "GET /v1/actions/5":
+			fmt.Fprint(w, `{"action":{"id":5,"command":"reset","status":"error","error":{"code":"locked","message":"server is locked"}}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	var rescue struct {
+		RootPassword string `json:"root_password"`
+	}
+	if err := a.serverAction(7, "enable_rescue", map[string]string{"type": "linux64"}, &rescue); err != nil {
+		t.Fatal(err)
+	}
+	if rescue.RootPassword != "secret" {
+		t.Errorf("got root password %q, expected %q", rescue.RootPassword, "secret")
+	}
+
+	err := a.serverAction(7, "reset", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "reset failed: locked: server is locked") {
+		t.Errorf("got error %v from failed action", err)
+	}
+}
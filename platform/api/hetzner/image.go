@@ -0,0 +1,163 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network"
+	"github.com/coreos/mantle/util"
+)
+
+// Hetzner Cloud has no way to upload an image. Instead, a server is
+// created from one of Hetzner's own images and booted into its rescue
+// system, which writes our image to the server's disk, and the disk is
+// then saved as a snapshot for other servers to be created from.
+
+// rescueImage is the image the server writing an image is created from.
+// It is never booted.
+const rescueImage = "debian-12"
+
+// Image is a snapshot servers can be created from.
+type Image struct {
+	ID          int64             `json:"id"`
+	Type        string            `json:"type"`
+	Status      string            `json:"status"`
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// CreateImage downloads a raw disk image from url, which must be
+// reachable from the internet and may be compressed with bzip2, gzip, or
+// xz according to its name, and saves it as an image.
+func (a *API) CreateImage(url, description string, labels map[string]string) (*Image, error) {
+	name := fmt.Sprintf("mantle-image-%d", time.Now().Unix())
+	server, err := a.CreateServer(name, rescueImage, "", labels)
+	if err != nil {
+		return nil, fmt.Errorf("creating server to write image: %v", err)
+	}
+	defer func() {
+		if err := a.DeleteServer(server.ID); err != nil {
+			plog.Errorf("Deleting server %d: %v", server.ID, err)
+		}
+	}()
+
+	var rescue struct {
+		RootPassword string `json:"root_password"`
+	}
+	if err := a.serverAction(server.ID, "enable_rescue", map[string]string{"type": "linux64"}, &rescue); err != nil {
+		return nil, fmt.Errorf("enabling rescue system: %v", err)
+	}
+	if err := a.serverAction(server.ID, "reset", nil, nil); err != nil {
+		return nil, fmt.Errorf("booting rescue system: %v", err)
+	}
+
+	plog.Infof("Writing %s to server %d", url, server.ID)
+	if err := writeImage(server.IP(), rescue.RootPassword, url); err != nil {
+		return nil, err
+	}
+
+	if err := a.serverAction(server.ID, "poweroff", nil, nil); err != nil {
+		return nil, fmt.Errorf("powering off server: %v", err)
+	}
+	in := struct {
+		Type        string            `json:"type"`
+		Description string            `json:"description,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty"`
+	}{"snapshot", description, labels}
+	var out struct {
+		Image Image `json:"image"`
+	}
+	if err := a.serverAction(server.ID, "create_image", &in, &out); err != nil {
+		return nil, fmt.Errorf("creating image: %v", err)
+	}
+	plog.Infof("Created image %d", out.Image.ID)
+	return a.GetImage(out.Image.ID)
+}
+
+// decompressor returns the command which decompresses a file with the
+// name of url.
+func decompressor(url string) string {
+	switch {
+	case strings.HasSuffix(url, ".bz2"):
+		return "bzip2 -dc"
+	case strings.HasSuffix(url, ".gz"):
+		return "gzip -dc"
+	case strings.HasSuffix(url, ".xz"):
+		return "xz -dc"
+	default:
+		return "cat"
+	}
+}
+
+// writeImageCommand returns the shell command which writes the image at
+// url to the server's disk.
+func writeImageCommand(url string) string {
+	return fmt.Sprintf("set -o pipefail; curl -fsSL %s | %s | dd of=/dev/sda bs=4M conv=fsync", shellQuote(url), decompressor(url))
+}
+
+// shellQuote quotes s as a single word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// writeImage logs in to the rescue system at ip and writes the image at
+// url to the server's disk.
+func writeImage(ip, password, url string) error {
+	agent, err := network.NewSSHAgent(network.NewRetryDialer())
+	if err != nil {
+		return err
+	}
+	defer agent.Close()
+
+	// The rescue system takes a while to come up after the reset.
+	var client *ssh.Client
+	err = util.Retry(30, 10*time.Second, func() error {
+		client, err = agent.NewPasswordClient(ip, "root", password)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("logging in to rescue system: %v", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if out, err := session.CombinedOutput(writeImageCommand(url)); err != nil {
+		return fmt.Errorf("writing image: %v: %s", err, out)
+	}
+	return nil
+}
+
+func (a *API) GetImage(id int64) (*Image, error) {
+	var out struct {
+		Image Image `json:"image"`
+	}
+	if err := a.call("GET", fmt.Sprintf("/images/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Image, nil
+}
+
+func (a *API) DeleteImage(id int64) error {
+	return a.call("DELETE", fmt.Sprintf("/images/%d", id), nil, nil)
+}
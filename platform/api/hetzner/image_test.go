@@ -0,0 +1,66 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestDecompressor(t *testing.T) {
+	for _, tt := range []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/image.bin.bz2", "bzip2 -dc"},
+		{"https://example.com/image.bin.gz", "gzip -dc"},
+		{"https://example.com/image.bin.xz", "xz -dc"},
+		{"https://example.com/image.bin", "cat"},
+		{"https://example.com/image.gz.bin", "cat"},
+	} {
+		if got := decompressor(tt.url); got != tt.want {
+			t.Errorf("decompressor(%q) = %q, expected %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{
+		"https://example.com/image.bin",
+		"https://example.com/it's.bin",
+		"https://example.com/'; rm -rf / #",
+		"https://example.com/$(id)`id`?a=1&b=2",
+		"''",
+		"",
+	} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Errorf("sh with %q: %v", s, err)
+			continue
+		}
+		if string(out) != s {
+			t.Errorf("shellQuote(%q) came out of sh as %q", s, out)
+		}
+	}
+}
+
+func TestWriteImageCommand(t *testing.T) {
+	cmd := writeImageCommand("https://example.com/it's.bin.xz")
+	want := `curl -fsSL 'https://example.com/it'\''s.bin.xz' | xz -dc | dd`
+	if !strings.Contains(cmd, want) {
+		t.Errorf("writeImageCommand = %q, expected it to contain %q", cmd, want)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+)
+
+// Server is a virtual machine.
+type Server struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	PublicNet struct {
+		IPv4 struct {
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+	} `json:"public_net"`
+	Labels map[string]string `json:"labels"`
+}
+
+// IP returns the server's public IPv4 address.
+func (s *Server) IP() string {
+	return s.PublicNet.IPv4.IP
+}
+
+// CreateServer creates a server from an image, given by ID or by name
+// for the images Hetzner provides, in the location and of the server type
+// of the Options, and waits for it to be running.
+func (a *API) CreateServer(name, image, userdata string, labels map[string]string) (*Server, error) {
+	in := struct {
+		Name       string            `json:"name"`
+		ServerType string            `json:"server_type"`
+		Location   string            `json:"location,omitempty"`
+		Image      string            `json:"image"`
+		UserData   string            `json:"user_data,omitempty"`
+		Labels     map[string]string `json:"labels,omitempty"`
+	}{
+		Name:       name,
+		ServerType: a.opts.ServerType,
+		Location:   a.opts.Location,
+		Image:      image,
+		UserData:   userdata,
+		Labels:     labels,
+	}
+	var out struct {
+		Server Server `json:"server"`
+		Action Action `json:"action"`
+	}
+	if err := a.call("POST", "/servers", &in, &out); err != nil {
+		return nil, err
+	}
+	plog.Infof("Created server %d", out.Server.ID)
+
+	if err := a.waitAction(out.Action); err != nil {
+		if err2 := a.DeleteServer(out.Server.ID); err2 != nil {
+			plog.Errorf("Deleting server %d: %v", out.Server.ID, err2)
+		}
+		return nil, err
+	}
+	return a.GetServer(out.Server.ID)
+}
+
+func (a *API) GetServer(id int64) (*Server, error) {
+	var out struct {
+		Server Server `json:"server"`
+	}
+	if err := a.call("GET", fmt.Sprintf("/servers/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Server, nil
+}
+
+// DeleteServer deletes a server and waits for it to be gone.
+func (a *API) DeleteServer(id int64) error {
+	var out struct {
+		Action Action `json:"action"`
+	}
+	if err := a.call("DELETE", fmt.Sprintf("/servers/%d", id), nil, &out); err != nil {
+		return err
+	}
+	return a.waitAction(out.Action)
+}
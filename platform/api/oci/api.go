@@ -0,0 +1,264 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oci stores disk images as OCI artifacts in a container registry
+// using the OCI distribution API.
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/oci")
+)
+
+type Options struct {
+	// Username and Password are optional registry credentials.
+	Username string
+	Password string
+
+	// Insecure uses plain HTTP to talk to the registry.
+	Insecure bool
+}
+
+type API struct {
+	client *http.Client
+	opts   *Options
+
+	mu     sync.Mutex
+	tokens map[string]string // bearer tokens by scope
+}
+
+func New(opts *Options) (*API, error) {
+	return &API{
+		client: http.DefaultClient,
+		opts:   opts,
+		tokens: make(map[string]string),
+	}, nil
+}
+
+// Reference identifies a repository in a registry and a tag or digest.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses a reference such as "quay.io/coreos/image:tag" or
+// "quay.io/coreos/image@sha256:...". The tag defaults to "latest".
+func ParseReference(ref string) (*Reference, error) {
+	i := strings.Index(ref, "/")
+	if i < 0 {
+		return nil, fmt.Errorf("reference %q has no registry", ref)
+	}
+	r := &Reference{Registry: ref[:i]}
+	rest := ref[i+1:]
+
+	if i := strings.Index(rest, "@"); i >= 0 {
+		r.Digest = rest[i+1:]
+		rest = rest[:i]
+		if !strings.HasPrefix(r.Digest, "sha256:") {
+			return nil, fmt.Errorf("reference %q has unsupported digest", ref)
+		}
+	} else if i := strings.LastIndex(rest, ":"); i >= 0 {
+		r.Tag = rest[i+1:]
+		rest = rest[:i]
+	} else {
+		r.Tag = "latest"
+	}
+
+	if rest == "" {
+		return nil, fmt.Errorf("reference %q has no repository", ref)
+	}
+	r.Repository = rest
+
+	return r, nil
+}
+
+// ref returns the tag or digest used to address a manifest.
+func (r *Reference) ref() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r *Reference) String() string {
+	if r.Digest != "" {
+		return fmt.Sprintf("%s/%s@%s", r.Registry, r.Repository, r.Digest)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Tag)
+}
+
+// url returns the registry API URL for the given path under the repository.
+func (a *API) url(r *Reference, path string) string {
+	scheme := "https"
+	if a.opts.Insecure {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, r.Registry, r.Repository, path)
+}
+
+// do sends the request built by mkreq, authenticating with the registry
+// and retrying once if the registry asks for a bearer token. mkreq is
+// called again for the retry so request bodies can be recreated.
+func (a *API) do(r *Reference, mkreq func() (*http.Request, error)) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:pull,push", r.Repository)
+
+	for attempt := 0; ; attempt++ {
+		req, err := mkreq()
+		if err != nil {
+			return nil, err
+		}
+
+		a.mu.Lock()
+		token := a.tokens[scope]
+		a.mu.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if a.opts.Username != "" {
+			req.SetBasicAuth(a.opts.Username, a.opts.Password)
+		}
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if !strings.HasPrefix(challenge, "Bearer ") {
+			return nil, fmt.Errorf("registry %s: unauthorized", r.Registry)
+		}
+		if err := a.fetchToken(challenge, scope); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetchToken implements the registry token authentication flow. The
+// token is requested for the scope in the challenge, if there is one,
+// but cached under the scope do looks tokens up by.
+func (a *API) fetchToken(challenge, key string) error {
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm := params["realm"]
+	if realm == "" {
+		return fmt.Errorf("registry auth challenge has no realm: %q", challenge)
+	}
+
+	q := url.Values{}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := key
+	if params["scope"] != "" {
+		scope = params["scope"]
+	}
+	q.Set("scope", scope)
+
+	req, err := http.NewRequest("GET", realm+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if a.opts.Username != "" {
+		req.SetBasicAuth(a.opts.Username, a.opts.Password)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching registry token: %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decoding registry token: %v", err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens[key] = token
+	return nil
+}
+
+// parseChallenge parses the comma separated key="value" pairs in a
+// WWW-Authenticate header.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:i])
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			if end := strings.Index(s[1:], `"`); end >= 0 {
+				value = s[1 : end+1]
+				s = s[end+2:]
+			} else {
+				// unterminated, take the rest
+				value = s[1:]
+				s = ""
+			}
+		} else if end := strings.Index(s, ","); end >= 0 {
+			value = s[:end]
+			s = s[end:]
+		} else {
+			value = s
+			s = ""
+		}
+		params[key] = value
+		s = strings.TrimLeft(s, ", ")
+	}
+	return params
+}
+
+// checkResponse returns an error including the registry's explanation if
+// the response status is not one of the expected codes.
+func checkResponse(resp *http.Response, codes ...int) error {
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s %s: %s: %s", resp.Request.Method, resp.Request.URL, resp.Status, strings.TrimSpace(string(body)))
+}
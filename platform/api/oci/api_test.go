@@ -0,0 +1,123 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want *Reference
+	}{
+		{"quay.io/coreos/image:1.2", &Reference{Registry: "quay.io", Repository: "coreos/image", Tag: "1.2"}},
+		{"quay.io/coreos/image", &Reference{Registry: "quay.io", Repository: "coreos/image", Tag: "latest"}},
+		{"localhost:5000/image:dev", &Reference{Registry: "localhost:5000", Repository: "image", Tag: "dev"}},
+		{"quay.io/coreos/image@sha256:abcd", &Reference{Registry: "quay.io", Repository: "coreos/image", Digest: "sha256:abcd"}},
+		{"image:tag", nil},
+		{"quay.io/", nil},
+		{"quay.io/:tag", nil},
+		{"quay.io/image@md5:abcd", nil},
+	} {
+		got, err := ParseReference(tc.in)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("ParseReference(%q) = %+v, want error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseReference(%q): %v", tc.in, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want map[string]string
+	}{
+		{``, map[string]string{}},
+		{`realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`,
+			map[string]string{
+				"realm":   "https://auth.example.com/token",
+				"service": "registry.example.com",
+				"scope":   "repository:a/b:pull",
+			}},
+		{`realm="https://auth", service=registry`, map[string]string{"realm": "https://auth", "service": "registry"}},
+		{`realm="a,b",error="insufficient_scope"`, map[string]string{"realm": "a,b", "error": "insufficient_scope"}},
+		{`realm="https://auth`, map[string]string{"realm": "https://auth"}},
+		{`realm="`, map[string]string{"realm": ""}},
+		{`realm`, map[string]string{}},
+	} {
+		if got := parseChallenge(tc.in); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseChallenge(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	var challenges, tokens int
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/token":
+			tokens++
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case req.Header.Get("Authorization") == "Bearer secret":
+			w.WriteHeader(http.StatusOK)
+		default:
+			challenges++
+			// registries reply with the scope the request needs, which
+			// may differ from the one asked for
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="test",scope="repository:coreos/image:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	a, err := New(&Options{Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/coreos/image:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		resp, err := a.do(ref, func() (*http.Request, error) {
+			return http.NewRequest("HEAD", a.url(ref, "manifests/latest"), nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: %s", i, resp.Status)
+		}
+	}
+	if challenges != 1 || tokens != 1 {
+		t.Errorf("got %d challenges and %d token fetches, want 1 of each", challenges, tokens)
+	}
+}
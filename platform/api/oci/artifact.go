@@ -0,0 +1,327 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	EmptyMediaType    = "application/vnd.oci.empty.v1+json"
+
+	// ArtifactType identifies manifests pushed by PushImage.
+	ArtifactType = "application/vnd.coreos.disk-image.v1"
+
+	// TitleAnnotation records the original file name of a layer.
+	TitleAnnotation = "org.opencontainers.image.title"
+)
+
+// emptyConfig is the config blob used for artifacts without configuration.
+var emptyConfig = []byte("{}")
+
+// Descriptor references a blob by media type, digest and size.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest describing an artifact.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	ArtifactType  string       `json:"artifactType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// ImageMediaType returns the layer media type for a disk image based on
+// its file name's compression suffix.
+func ImageMediaType(path string) string {
+	switch filepath.Ext(path) {
+	case ".bz2":
+		return ArtifactType + ".raw+bzip2"
+	case ".gz":
+		return ArtifactType + ".raw+gzip"
+	case ".xz":
+		return ArtifactType + ".raw+xz"
+	case ".vmdk":
+		return ArtifactType + ".vmdk"
+	case ".vhd":
+		return ArtifactType + ".vhd"
+	default:
+		return ArtifactType + ".raw"
+	}
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// PushImage uploads the file at path as the single layer of an artifact
+// tagged ref, returning the digest of the new manifest.
+func (a *API) PushImage(ref *Reference, path, mediaType string) (string, error) {
+	if ref.Tag == "" {
+		return "", fmt.Errorf("pushing %s: a tag is required", ref)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", fmt.Errorf("hashing %s: %v", path, err)
+	}
+	layer := Descriptor{
+		MediaType:   mediaType,
+		Digest:      "sha256:" + hex.EncodeToString(h.Sum(nil)),
+		Size:        size,
+		Annotations: map[string]string{TitleAnnotation: filepath.Base(path)},
+	}
+
+	config := Descriptor{
+		MediaType: EmptyMediaType,
+		Digest:    digestOf(emptyConfig),
+		Size:      int64(len(emptyConfig)),
+	}
+	if err := a.pushBlob(ref, config.Digest, config.Size, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(emptyConfig)), nil
+	}); err != nil {
+		return "", err
+	}
+
+	plog.Infof("Uploading %s (%d MiB) as %s", path, size>>20, layer.Digest)
+	if err := a.pushBlob(ref, layer.Digest, layer.Size, func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}); err != nil {
+		return "", err
+	}
+
+	manifest, err := json.Marshal(&Manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		ArtifactType:  ArtifactType,
+		Config:        config,
+		Layers:        []Descriptor{layer},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := a.do(ref, func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", a.url(ref, "manifests/"+ref.Tag), bytes.NewReader(manifest))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", ManifestMediaType)
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusCreated); err != nil {
+		return "", err
+	}
+
+	digest := digestOf(manifest)
+	if got := resp.Header.Get("Docker-Content-Digest"); got != "" && got != digest {
+		return "", fmt.Errorf("registry reported manifest digest %s, expected %s", got, digest)
+	}
+
+	return digest, nil
+}
+
+// pushBlob uploads a blob unless the registry already has it. open is
+// called for each upload attempt.
+func (a *API) pushBlob(ref *Reference, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	resp, err := a.do(ref, func() (*http.Request, error) {
+		return http.NewRequest("HEAD", a.url(ref, "blobs/"+digest), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		plog.Infof("Blob %s already exists", digest)
+		return nil
+	}
+
+	resp, err = a.do(ref, func() (*http.Request, error) {
+		return http.NewRequest("POST", a.url(ref, "blobs/uploads/"), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := checkResponse(resp, http.StatusAccepted); err != nil {
+		return err
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("parsing upload location: %v", err)
+	}
+	q := location.Query()
+	q.Set("digest", digest)
+	location.RawQuery = q.Encode()
+
+	resp, err = a.do(ref, func() (*http.Request, error) {
+		body, err := open()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest("PUT", location.String(), body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, http.StatusCreated)
+}
+
+// GetManifest fetches the artifact manifest for ref, verifying its digest
+// when ref is addressed by digest.
+func (a *API) GetManifest(ref *Reference) (*Manifest, error) {
+	resp, err := a.do(ref, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", a.url(ref, "manifests/"+url.PathEscape(ref.ref())), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", ManifestMediaType)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Digest != "" && digestOf(data) != ref.Digest {
+		return nil, fmt.Errorf("manifest digest %s does not match %s", digestOf(data), ref.Digest)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding manifest: %v", err)
+	}
+	if manifest.MediaType != "" && manifest.MediaType != ManifestMediaType {
+		return nil, fmt.Errorf("unsupported manifest media type %q", manifest.MediaType)
+	}
+
+	return &manifest, nil
+}
+
+// PullImage downloads the disk image layer of the artifact at ref into
+// dir, verifying its digest, and returns the path written. If mediaType
+// is not empty the layer must have that media type.
+func (a *API) PullImage(ref *Reference, dir, mediaType string) (string, error) {
+	manifest, err := a.GetManifest(ref)
+	if err != nil {
+		return "", err
+	}
+
+	var layer *Descriptor
+	for i := range manifest.Layers {
+		l := &manifest.Layers[i]
+		if mediaType == "" || l.MediaType == mediaType {
+			layer = l
+			break
+		}
+	}
+	if layer == nil {
+		return "", fmt.Errorf("%s has no layer with media type %q", ref, mediaType)
+	}
+	if !strings.HasPrefix(layer.Digest, "sha256:") {
+		return "", fmt.Errorf("unsupported layer digest %q", layer.Digest)
+	}
+
+	name := filepath.Base(layer.Annotations[TitleAnnotation])
+	if name == "" || name == "." || name == "/" {
+		name = strings.TrimPrefix(layer.Digest, "sha256:")
+	}
+	path := filepath.Join(dir, name)
+
+	resp, err := a.do(ref, func() (*http.Request, error) {
+		return http.NewRequest("GET", a.url(ref, "blobs/"+layer.Digest), nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	plog.Infof("Downloading %s (%d MiB) to %s", layer.Digest, layer.Size>>20, path)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %v", layer.Digest, err)
+	}
+	if n != layer.Size {
+		return "", fmt.Errorf("downloaded %d bytes, expected %d", n, layer.Size)
+	}
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != layer.Digest {
+		return "", fmt.Errorf("downloaded digest %s does not match %s", got, layer.Digest)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vultr creates snapshots and instances on Vultr using version 2
+// of its API.
+package vultr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/vultr")
+)
+
+const endpoint = "https://api.vultr.com/v2"
+
+type Options struct {
+	// APIKey is a personal access token from the Vultr control panel.
+	APIKey string
+
+	// Region and Plan are where instances are created and their size,
+	// such as "ewr" and "vc2-1c-2gb".
+	Region string
+	Plan   string
+}
+
+type API struct {
+	client *http.Client
+	opts   *Options
+}
+
+func New(opts *Options) (*API, error) {
+	if opts.APIKey == "" {
+		return nil, fmt.Errorf("no Vultr API key")
+	}
+	return &API{
+		client: http.DefaultClient,
+		opts:   opts,
+	}, nil
+}
+
+// call sends a request with in, if not nil, as its JSON body and decodes
+// the JSON response into out, if not nil.
+func (a *API) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.opts.APIKey)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response to %s %s: %v", method, path, err)
+	}
+	return nil
+}
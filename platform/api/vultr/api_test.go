@@ -0,0 +1,152 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vultr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// redirectTransport sends every request to a test server.
+type redirectTransport struct {
+	host string
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = t.host
+	req.URL = &u
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func testAPI(t *testing.T, handler http.Handler) (*API, func()) {
+	srv := httptest.NewServer(handler)
+	srvURL, _ := url.Parse(srv.URL)
+	a, err := New(&Options{APIKey: "key", Region: "ewr", Plan: "vc2-1c-2gb"})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	a.client = &http.Client{Transport: redirectTransport{srvURL.Host}}
+	return a, srv.Close
+}
+
+func TestCallError(t *testing.T) {
+	a, done := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid snapshot"}`, http.StatusBadRequest)
+	}))
+	defer done()
+
+	err := a.DeleteSnapshot("abc")
+	if err == nil {
+		t.Fatal("DeleteSnapshot succeeded on a 400")
+	}
+	want := `DELETE /snapshots/abc: 400 Bad Request: {"error":"invalid snapshot"}`
+	if err.Error() != want {
+		t.Errorf("got error %q, expected %q", err, want)
+	}
+}
+
+func TestCreateSnapshotFromURL(t *testing.T) {
+	a, done := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("%s %s: Authorization %q", r.Method, r.URL.Path, auth)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v2/snapshots/create-from-url":
+			var in struct {
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				t.Errorf("decoding request: %v", err)
+			}
+			if in.URL != "https://example.com/image.bin" || in.Description != "test" {
+				t.Errorf("created snapshot with %+v", in)
+			}
+			fmt.Fprint(w, `{"snapshot":{"id":"abc","status":"pending"}}`)
+		case "GET /v2/snapshots/abc":
+			fmt.Fprint(w, `{"snapshot":{"id":"abc","description":"test","status":"complete","size":1024}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	snap, err := a.CreateSnapshotFromURL("https://example.com/image.bin", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Snapshot{ID: "abc", Description: "test", Status: "complete", Size: 1024}
+	if *snap != want {
+		t.Errorf("got snapshot %+v, expected %+v", *snap, want)
+	}
+}
+
+func TestCreateInstance(t *testing.T) {
+	a, done := testAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v2/instances":
+			var in struct {
+				Region     string `json:"region"`
+				Plan       string `json:"plan"`
+				SnapshotID string `json:"snapshot_id"`
+				Label      string `json:"label"`
+				UserData   string `json:"user_data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				t.Errorf("decoding request: %v", err)
+			}
+			if in.Region != "ewr" || in.Plan != "vc2-1c-2gb" || in.SnapshotID != "abc" || in.Label != "a" {
+				t.Errorf("created instance with %+v", in)
+			}
+			if ud, err := base64.StdEncoding.DecodeString(in.UserData); err != nil || string(ud) != "#cloud-config" {
+				t.Errorf("got user data %q (%v)", ud, err)
+			}
+			fmt.Fprint(w, `{"instance":{"id":"i1","status":"pending"}}`)
+		case "GET /v2/instances/i1":
+			fmt.Fprint(w, `{"instance":{"id":"i1","label":"a","region":"ewr","plan":"vc2-1c-2gb","status":"active","power_status":"running","main_ip":"192.0.2.1","internal_ip":"10.0.0.1"}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	inst, err := a.CreateInstance("a", "abc", "#cloud-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Instance{
+		ID:          "i1",
+		Label:       "a",
+		Region:      "ewr",
+		Plan:        "vc2-1c-2gb",
+		Status:      "active",
+		PowerStatus: "running",
+		MainIP:      "192.0.2.1",
+		InternalIP:  "10.0.0.1",
+	}
+	if *inst != want {
+		t.Errorf("got instance %+v, expected %+v", *inst, want)
+	}
+}
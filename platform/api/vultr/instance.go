@@ -0,0 +1,103 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vultr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/coreos/mantle/util"
+)
+
+// Instance is a virtual machine.
+type Instance struct {
+	ID          string `json:"id"`
+	Label       string `json:"label"`
+	Region      string `json:"region"`
+	Plan        string `json:"plan"`
+	Status      string `json:"status"`
+	PowerStatus string `json:"power_status"`
+	MainIP      string `json:"main_ip"`
+	InternalIP  string `json:"internal_ip"`
+}
+
+// CreateInstance creates an instance from a snapshot in the region and
+// plan of the Options, and waits for it to be running.
+func (a *API) CreateInstance(label, snapshotID, userdata string) (*Instance, error) {
+	in := struct {
+		Region     string `json:"region"`
+		Plan       string `json:"plan"`
+		SnapshotID string `json:"snapshot_id"`
+		Label      string `json:"label"`
+		UserData   string `json:"user_data,omitempty"`
+	}{
+		Region:     a.opts.Region,
+		Plan:       a.opts.Plan,
+		SnapshotID: snapshotID,
+		Label:      label,
+		UserData:   base64.StdEncoding.EncodeToString([]byte(userdata)),
+	}
+	var out struct {
+		Instance Instance `json:"instance"`
+	}
+	if err := a.call("POST", "/instances", &in, &out); err != nil {
+		return nil, err
+	}
+	plog.Infof("Created instance %s", out.Instance.ID)
+
+	inst, err := a.waitInstance(out.Instance.ID)
+	if err != nil {
+		if err2 := a.DeleteInstance(out.Instance.ID); err2 != nil {
+			plog.Errorf("Deleting instance %s: %v", out.Instance.ID, err2)
+		}
+		return nil, err
+	}
+	return inst, nil
+}
+
+// waitInstance waits for an instance to be running.
+func (a *API) waitInstance(id string) (*Instance, error) {
+	var inst *Instance
+	err := util.Retry(60, 10*time.Second, func() error {
+		var err error
+		inst, err = a.GetInstance(id)
+		if err != nil {
+			return err
+		}
+		if inst.Status != "active" || inst.PowerStatus != "running" {
+			return fmt.Errorf("instance %s is %s and %s", id, inst.Status, inst.PowerStatus)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+func (a *API) GetInstance(id string) (*Instance, error) {
+	var out struct {
+		Instance Instance `json:"instance"`
+	}
+	if err := a.call("GET", "/instances/"+id, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Instance, nil
+}
+
+func (a *API) DeleteInstance(id string) error {
+	return a.call("DELETE", "/instances/"+id, nil, nil)
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vultr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/mantle/util"
+)
+
+// Snapshot is a disk image instances can be created from.
+type Snapshot struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Size        int64  `json:"size"`
+}
+
+// CreateSnapshotFromURL has Vultr download a raw disk image from url,
+// which must be reachable from the internet, and waits for it to become
+// a snapshot.
+func (a *API) CreateSnapshotFromURL(url, description string) (*Snapshot, error) {
+	in := struct {
+		URL         string `json:"url"`
+		Description string `json:"description,omitempty"`
+	}{url, description}
+	var out struct {
+		Snapshot Snapshot `json:"snapshot"`
+	}
+	if err := a.call("POST", "/snapshots/create-from-url", &in, &out); err != nil {
+		return nil, err
+	}
+	plog.Infof("Creating snapshot %s from %s", out.Snapshot.ID, url)
+	return a.waitSnapshot(out.Snapshot.ID)
+}
+
+// waitSnapshot waits for a snapshot to finish being created.
+func (a *API) waitSnapshot(id string) (*Snapshot, error) {
+	var snap *Snapshot
+	err := util.Retry(120, 15*time.Second, func() error {
+		var err error
+		snap, err = a.GetSnapshot(id)
+		if err != nil {
+			return err
+		}
+		if snap.Status != "complete" {
+			return fmt.Errorf("snapshot %s is %s", id, snap.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (a *API) GetSnapshot(id string) (*Snapshot, error) {
+	var out struct {
+		Snapshot Snapshot `json:"snapshot"`
+	}
+	if err := a.call("GET", "/snapshots/"+id, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Snapshot, nil
+}
+
+func (a *API) DeleteSnapshot(id string) error {
+	return a.call("DELETE", "/snapshots/"+id, nil, nil)
+}
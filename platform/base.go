@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/coreos/pkg/multierror"
@@ -31,20 +32,38 @@ import (
 )
 
 type BaseCluster struct {
-	agent *network.SSHAgent
+	agent   *network.SSHAgent
+	bastion *network.BastionDialer
+	sshCA   ssh.PublicKey // if Options.SSHCertificates; see ConfigureSSH
 
 	machlock sync.Mutex
 	machmap  map[string]Machine
 
+	opts *Options
 	name string
 	dir  string
 }
 
-func NewBaseCluster(basename, outputDir string) (*BaseCluster, error) {
-	return NewBaseClusterWithDialer(basename, outputDir, network.NewRetryDialer())
+// NewBaseCluster creates a BaseCluster which connects to machines
+// directly, or through Options.Bastion if it is set.
+func NewBaseCluster(opts *Options, outputDir string) (*BaseCluster, error) {
+	if opts.Bastion == "" {
+		return NewBaseClusterWithDialer(opts, outputDir, network.NewRetryDialer())
+	}
+
+	bastion, err := network.NewBastionDialer(opts.Bastion)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := NewBaseClusterWithDialer(opts, outputDir, bastion)
+	if err != nil {
+		return nil, err
+	}
+	bc.bastion = bastion
+	return bc, nil
 }
 
-func NewBaseClusterWithDialer(basename, outputDir string, dialer network.Dialer) (*BaseCluster, error) {
+func NewBaseClusterWithDialer(opts *Options, outputDir string, dialer network.Dialer) (*BaseCluster, error) {
 	agent, err := network.NewSSHAgent(dialer)
 	if err != nil {
 		return nil, err
@@ -53,10 +72,18 @@ func NewBaseClusterWithDialer(basename, outputDir string, dialer network.Dialer)
 	bc := &BaseCluster{
 		agent:   agent,
 		machmap: make(map[string]Machine),
-		name:    fmt.Sprintf("%s-%s", basename, uuid.NewV4()),
+		opts:    opts,
+		name:    fmt.Sprintf("%s-%s", opts.BaseName, uuid.NewV4()),
 		dir:     outputDir,
 	}
 
+	if opts.SSHCertificates {
+		if bc.sshCA, err = agent.EnableCA(); err != nil {
+			agent.Close()
+			return nil, err
+		}
+	}
+
 	return bc, nil
 }
 
@@ -121,8 +148,64 @@ func (bc *BaseCluster) DelMach(m Machine) {
 	delete(bc.machmap, m.ID())
 }
 
+// Keys returns the public keys of the cluster's SSH agent, leaving out
+// any certificates for them.
 func (bc *BaseCluster) Keys() ([]*agent.Key, error) {
-	return bc.agent.List()
+	all, err := bc.agent.List()
+	if err != nil {
+		return nil, err
+	}
+	var keys []*agent.Key
+	for _, k := range all {
+		if !strings.HasSuffix(k.Format, "-cert-v01@openssh.com") {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// RotateKey replaces the cluster's SSH key with a new one, both on the
+// machines already running and for those created later, and wipes the
+// old key. Machines configured with cloud-config may get the old key
+// back in their authorized keys when they reboot, but it can no
+// longer be used.
+func (bc *BaseCluster) RotateKey() error {
+	old, err := bc.Keys()
+	if err != nil {
+		return err
+	}
+	key, err := bc.agent.NewKey()
+	if err != nil {
+		return err
+	}
+
+	// Replace every authorized key, including those managed by
+	// update-ssh-keys, with the new one.
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	cmd := fmt.Sprintf(`set -e
+mkdir -p ~/.ssh/authorized_keys.d
+rm -f ~/.ssh/authorized_keys.d/*
+echo '%[1]s' > ~/.ssh/authorized_keys.d/kola
+echo '%[1]s' > ~/.ssh/authorized_keys.new
+mv ~/.ssh/authorized_keys.new ~/.ssh/authorized_keys`, authorized)
+	for _, m := range bc.Machines() {
+		if out, err := bc.SSH(m, cmd); err != nil {
+			return fmt.Errorf("installing new SSH key on %s: %s: %v", m.ID(), out, err)
+		}
+	}
+
+	for _, k := range old {
+		if err := bc.agent.RemoveKey(k); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range bc.Machines() {
+		if out, err := bc.SSH(m, "true"); err != nil {
+			return fmt.Errorf("connecting to %s with new SSH key: %s: %v", m.ID(), out, err)
+		}
+	}
+	return nil
 }
 
 // Destroy destroys each machine in the cluster and closes the SSH agent.
@@ -139,6 +222,12 @@ func (bc *BaseCluster) Destroy() error {
 		err = append(err, e)
 	}
 
+	if bc.bastion != nil {
+		if e := bc.bastion.Close(); e != nil {
+			err = append(err, e)
+		}
+	}
+
 	return err.AsError()
 }
 
@@ -158,6 +247,12 @@ func (bc *BaseCluster) GetDiscoveryURL(size int) (string, error) {
 	return string(body), nil
 }
 
+// NewJournal creates a Journal recorder in dir honoring the cluster's
+// log size limit.
+func (bc *BaseCluster) NewJournal(dir string) (*Journal, error) {
+	return NewJournal(dir, bc.opts.MaxLogSize)
+}
+
 func (bc *BaseCluster) Name() string {
 	return bc.name
 }
@@ -0,0 +1,61 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CapacityError is returned when a cloud has no capacity for a machine
+// in any of the zones tried. It is a problem with the cloud rather than
+// with the machine or the test which wanted it.
+type CapacityError struct {
+	Zones []string // zones tried, in order
+	Err   error    // error from the last zone
+}
+
+func (e *CapacityError) Error() string {
+	zones := make([]string, len(e.Zones))
+	for i, zone := range e.Zones {
+		if zone == "" {
+			zone = "(default)"
+		}
+		zones[i] = zone
+	}
+	return fmt.Sprintf("no capacity in zones %s: %v", strings.Join(zones, ", "), e.Err)
+}
+
+// IsCapacityError reports whether err is a CapacityError.
+func IsCapacityError(err error) bool {
+	_, ok := err.(*CapacityError)
+	return ok
+}
+
+// ZoneOrder returns the zones to try creating a machine in: zone, then
+// each of fallback in order, without repeats.
+func ZoneOrder(zone string, fallback []string) []string {
+	zones := []string{zone}
+	for _, z := range fallback {
+		seen := false
+		for _, s := range zones {
+			seen = seen || s == z
+		}
+		if !seen {
+			zones = append(zones, z)
+		}
+	}
+	return zones
+}
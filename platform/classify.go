@@ -0,0 +1,104 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Reasons a machine failed to come up, as reported by ProvisionError.
+const (
+	FailureKernelPanic = "kernel panic"
+	FailureIgnition    = "Ignition failure"
+	FailureSSHAuth     = "SSH authentication failure"
+	FailureNetwork     = "network failure"
+	FailureUnknown     = "unknown failure"
+)
+
+// failurePatterns match console output identifying a failure class, in
+// order of precedence.
+var failurePatterns = []struct {
+	class   string
+	pattern *regexp.Regexp
+}{
+	{FailureKernelPanic, regexp.MustCompile(`Kernel panic - not syncing.*`)},
+	{FailureIgnition, regexp.MustCompile(`(?i)failed to start ignition.*|ignition\[\d+\]: critical.*`)},
+	{FailureNetwork, regexp.MustCompile(`(?i)no dhcpoffers.*|dhcp.*(timed out|failed).*|failed to start network service.*|failed to configure interface.*`)},
+}
+
+// sshAuthErrors and networkErrors are substrings of SSH errors that
+// identify a failure class when the console has no better evidence.
+var (
+	sshAuthErrors = []string{"unable to authenticate", "no supported methods remain"}
+	networkErrors = []string{"i/o timeout", "no route to host", "connection refused", "network is unreachable"}
+)
+
+// ProvisionError is returned when a machine fails to come up. Class is
+// the likely cause and Evidence the console line or error it was
+// inferred from.
+type ProvisionError struct {
+	Class    string
+	Evidence string
+	Err      error
+}
+
+func (e *ProvisionError) Error() string {
+	if e.Evidence == "" {
+		return fmt.Sprintf("machine failed to come up (%s): %v", e.Class, e.Err)
+	}
+	return fmt.Sprintf("machine failed to come up (%s: %q): %v", e.Class, e.Evidence, e.Err)
+}
+
+// ClassifyFailure wraps err, returned while bringing up a machine, in a
+// ProvisionError naming the likely cause based on the machine's console
+// output and the error itself.
+func ClassifyFailure(err error, console string) *ProvisionError {
+	for _, p := range failurePatterns {
+		if match := p.pattern.FindString(console); match != "" {
+			return &ProvisionError{
+				Class:    p.class,
+				Evidence: strings.TrimSpace(match),
+				Err:      err,
+			}
+		}
+	}
+
+	msg := err.Error()
+	for _, s := range sshAuthErrors {
+		if strings.Contains(msg, s) {
+			return &ProvisionError{Class: FailureSSHAuth, Evidence: s, Err: err}
+		}
+	}
+	for _, s := range networkErrors {
+		if strings.Contains(msg, s) {
+			return &ProvisionError{Class: FailureNetwork, Evidence: s, Err: err}
+		}
+	}
+	return &ProvisionError{Class: FailureUnknown, Err: err}
+}
+
+// ConsoleFailure saves console output fetched from the platform to
+// console.txt in dir, for triage, and classifies err. The console is
+// best effort; if it couldn't be fetched it should be empty.
+func ConsoleFailure(err error, dir, console string) error {
+	if console != "" {
+		ioutil.WriteFile(filepath.Join(dir, "console.txt"), []byte(console), 0666)
+	}
+	return ClassifyFailure(err, console)
+}
@@ -16,7 +16,10 @@ package conf
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
 
 	cci "github.com/coreos/coreos-cloudinit/config"
 	v2 "github.com/coreos/ignition/config"
@@ -126,6 +129,66 @@ func (c *Conf) CopyKeys(keys []*agent.Key) {
 	}
 }
 
+// PasswordHash returns the password hash of the named user, if the
+// configuration sets one.
+func (c *Conf) PasswordHash(name string) string {
+	if c.ignitionV1 != nil {
+		for _, u := range c.ignitionV1.Passwd.Users {
+			if u.Name == name {
+				return u.PasswordHash
+			}
+		}
+	} else if c.ignitionV2 != nil {
+		for _, u := range c.ignitionV2.Passwd.Users {
+			if u.Name == name {
+				return u.PasswordHash
+			}
+		}
+	}
+	return ""
+}
+
+// SetPasswordHash sets the password of the named user, as hashed by
+// HashPassword, so it can log in on the console. Only Ignition
+// configurations can set passwords.
+func (c *Conf) SetPasswordHash(name, hash string) error {
+	if c.ignitionV1 != nil {
+		for i := range c.ignitionV1.Passwd.Users {
+			if c.ignitionV1.Passwd.Users[i].Name == name {
+				c.ignitionV1.Passwd.Users[i].PasswordHash = hash
+				return nil
+			}
+		}
+		c.ignitionV1.Passwd.Users = append(c.ignitionV1.Passwd.Users, v1types.User{
+			Name:         name,
+			PasswordHash: hash,
+		})
+	} else if c.ignitionV2 != nil {
+		user(c.ignitionV2, name).PasswordHash = hash
+	} else {
+		return errors.New("setting passwords is only supported for Ignition")
+	}
+	return nil
+}
+
+// AddFile adds a file with the given contents and mode to the root
+// filesystem. Only Ignition v2 and cloud-config configurations can have
+// files added.
+func (c *Conf) AddFile(path, contents string, mode os.FileMode) error {
+	if c.ignitionV2 != nil {
+		File(path, contents, mode)(c.ignitionV2)
+	} else if c.cloudconfig != nil {
+		c.cloudconfig.WriteFiles = append(c.cloudconfig.WriteFiles, cci.File{
+			Path:               path,
+			Content:            contents,
+			RawFilePermissions: fmt.Sprintf("%#o", mode),
+		})
+	} else {
+		return errors.New("adding files is only supported for Ignition v2 and cloud-config")
+	}
+	return nil
+}
+
 func keysToStrings(keys []*agent.Key) (keyStrs []string) {
 	for _, key := range keys {
 		keyStrs = append(keyStrs, key.String())
@@ -19,6 +19,9 @@ import (
 	"strings"
 	"testing"
 
+	v2types "github.com/coreos/ignition/config/types"
+	"github.com/vincent-petithory/dataurl"
+
 	"github.com/coreos/mantle/network"
 )
 
@@ -52,9 +55,105 @@ func TestConfCopyKey(t *testing.T) {
 
 		str := conf.String()
 
-		if !strings.Contains(str, "ssh-rsa ") || !strings.Contains(str, " core@default") {
+		if !strings.Contains(str, "ssh-ed25519 ") || !strings.Contains(str, " core@default") {
 			t.Errorf("ssh public key not found in config %d: %s", i, str)
 			continue
 		}
 	}
 }
+
+func TestIgnition(t *testing.T) {
+	userdata := Ignition(
+		User("tester", "sudo"),
+		AuthorizedKeys("tester", "ssh-ed25519 AAAA tester"),
+		AuthorizedKeys("core", "ssh-ed25519 BBBB core"),
+		File("/etc/hostname", "core1\n", 0644),
+		Unit("hello.service", "[Service]\nExecStart=/bin/echo hello\n[Install]\nWantedBy=multi-user.target\n", true),
+		DropIn("docker.service", "10-debug.conf", "[Service]\nEnvironment=DEBUG=1\n"),
+		MaskUnit("update-engine.service"),
+	)
+
+	conf, err := New(userdata)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", userdata, err)
+	}
+	c := conf.ignitionV2
+	if c == nil {
+		t.Fatalf("not parsed as Ignition v2: %s", userdata)
+	}
+
+	if n := len(c.Passwd.Users); n != 2 {
+		t.Fatalf("got %d users; want 2", n)
+	}
+	tester := c.Passwd.Users[0]
+	if tester.Name != "tester" || tester.Create == nil || len(tester.Create.Groups) != 1 || len(tester.SSHAuthorizedKeys) != 1 {
+		t.Errorf("tester user is %+v", tester)
+	}
+
+	if n := len(c.Storage.Files); n != 1 {
+		t.Fatalf("got %d files; want 1", n)
+	}
+	file := c.Storage.Files[0]
+	data, err := dataurl.DecodeString(file.Contents.Source.String())
+	if err != nil || string(data.Data) != "core1\n" || file.Mode != 0644 || file.Path != "/etc/hostname" {
+		t.Errorf("file is %+v with contents %q, %v", file, data, err)
+	}
+
+	units := make(map[string]v2types.SystemdUnit)
+	for _, u := range c.Systemd.Units {
+		units[string(u.Name)] = u
+	}
+	if u := units["hello.service"]; !u.Enable || u.Contents == "" {
+		t.Errorf("hello.service is %+v", u)
+	}
+	if u := units["docker.service"]; len(u.DropIns) != 1 || u.Contents != "" {
+		t.Errorf("docker.service is %+v", u)
+	}
+	if u := units["update-engine.service"]; !u.Mask {
+		t.Errorf("update-engine.service is %+v", u)
+	}
+}
+
+func TestIgnitionInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("relative file path did not panic")
+		}
+	}()
+	Ignition(File("etc/hostname", "core1", 0644))
+}
+
+func TestConfAddFile(t *testing.T) {
+	tests := []struct {
+		conf string
+		ok   bool
+	}{
+		{`{ "ignition": { "version": "2.0.0" } }`, true},
+		{"#cloud-config", true},
+		{`{ "ignitionVersion": 1 }`, false},
+		{"#!/bin/sh\n", false},
+	}
+
+	for i, tt := range tests {
+		conf, err := New(tt.conf)
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		err = conf.AddFile("/etc/kola/added", "contents", 0644)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("adding a file to config %d succeeded", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("adding a file to config %d: %v", i, err)
+			continue
+		}
+		if str := conf.String(); !strings.Contains(str, "/etc/kola/added") {
+			t.Errorf("file not found in config %d: %s", i, str)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"hash"
+)
+
+// cryptAlphabet is the base64 alphabet of crypt(3), in its own order.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptRounds is the default number of rounds of SHA-512 crypt, which
+// isn't written in the hash.
+const cryptRounds = 5000
+
+// HashPassword hashes a password with SHA-512 crypt ("$6$") and a random
+// salt, as Ignition's passwordHash and /etc/shadow expect.
+func HashPassword(password string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	salt := make([]byte, len(b))
+	for i, c := range b {
+		salt[i] = cryptAlphabet[int(c)%len(cryptAlphabet)]
+	}
+	return sha512Crypt(password, string(salt)), nil
+}
+
+// sha512Crypt implements SHA-512 crypt as specified at
+// https://www.akkadia.org/drepper/SHA-crypt.txt, with the default
+// rounds. The salt is at most 16 characters.
+func sha512Crypt(key, salt string) string {
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	k, s := []byte(key), []byte(salt)
+
+	h := sha512.New()
+	h.Write(k)
+	h.Write(s)
+	h.Write(k)
+	b := h.Sum(nil)
+
+	h.Reset()
+	h.Write(k)
+	h.Write(s)
+	writeRepeated(h, b, len(k))
+	for n := len(k); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(k)
+		}
+	}
+	a := h.Sum(nil)
+
+	h.Reset()
+	for i := 0; i < len(k); i++ {
+		h.Write(k)
+	}
+	p := repeatTo(h.Sum(nil), len(k))
+
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(s)
+	}
+	ds := repeatTo(h.Sum(nil), len(s))
+
+	c := a
+	for r := 0; r < cryptRounds; r++ {
+		h.Reset()
+		if r&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if r%3 != 0 {
+			h.Write(ds)
+		}
+		if r%7 != 0 {
+			h.Write(p)
+		}
+		if r&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	out := []byte("$6$" + salt + "$")
+	for i := 0; i < 21; i++ {
+		// the bytes are shuffled: 0, 21, 42; 22, 43, 1; 44, 2, 23; ...
+		b0, b1, b2 := c[(i*22)%63], c[(i*22+21)%63], c[(i*22+42)%63]
+		out = appendCrypt64(out, uint(b0)<<16|uint(b1)<<8|uint(b2), 4)
+	}
+	out = appendCrypt64(out, uint(c[63]), 2)
+	return string(out)
+}
+
+// writeRepeated writes n bytes of b, repeated as needed, to h.
+func writeRepeated(h hash.Hash, b []byte, n int) {
+	for ; n > len(b); n -= len(b) {
+		h.Write(b)
+	}
+	h.Write(b[:n])
+}
+
+// repeatTo returns n bytes of b, repeated as needed.
+func repeatTo(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		m := n - len(out)
+		if m > len(b) {
+			m = len(b)
+		}
+		out = append(out, b[:m]...)
+	}
+	return out
+}
+
+// appendCrypt64 appends the low 6*n bits of v in crypt's base64, least
+// significant first.
+func appendCrypt64(out []byte, v uint, n int) []byte {
+	for ; n > 0; n-- {
+		out = append(out, cryptAlphabet[v&0x3f])
+		v >>= 6
+	}
+	return out
+}
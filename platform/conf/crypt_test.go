@@ -0,0 +1,83 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// the first from the specification, the rest checked with
+	// "openssl passwd -6 -salt SALT KEY"
+	tests := []struct {
+		key, salt, hash string
+	}{
+		{"Hello world!", "saltstring",
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"a very much longer text to encrypt.  This one even stretches over morethan one line.", "toolongsaltstringwithmorethan16characters",
+			"$6$toolongsaltstrin$d83lI1f8Dmg5G54BIEUCk.d1wzcvMvHiDIygj5z1mZBp8sK1sb1wb5GVvQ7hgyXszzhH1BdryFoyDxA5CIFdb1"},
+		{"we have a short salt string but not a short password", "short",
+			"$6$short$qmfj2meTBr5G2EAGIJ4vjX7RpefsD4JzpEyTAeEUJdzdxlBS6pe8gdMHm5zFftaFSj/2p2bjBwyVS9ZhWpLZt."},
+	}
+	for _, tt := range tests {
+		if got := sha512Crypt(tt.key, tt.salt); got != tt.hash {
+			t.Errorf("sha512Crypt(%q, %q) = %q, want %q", tt.key, tt.salt, got, tt.hash)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[1] != "6" || len(parts[2]) != 16 {
+		t.Fatalf("got malformed hash %q", hash)
+	}
+	if got := sha512Crypt("hunter2", parts[2]); got != hash {
+		t.Errorf("hash %q doesn't match password, want %q", hash, got)
+	}
+}
+
+func TestSetPasswordHash(t *testing.T) {
+	for _, userdata := range []string{
+		`{ "ignition": { "version": "2.0.0" } }`,
+		`{ "ignitionVersion": 1 }`,
+	} {
+		c, err := New(userdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetPasswordHash("core", "$6$salt$hash"); err != nil {
+			t.Errorf("%s: %v", userdata, err)
+		}
+		if !strings.Contains(c.String(), `"passwordHash":"$6$salt$hash"`) {
+			t.Errorf("password hash not set in %s", c.String())
+		}
+		if got := c.PasswordHash("core"); got != "$6$salt$hash" {
+			t.Errorf("got password hash %q", got)
+		}
+	}
+
+	c, err := New("#cloud-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPasswordHash("core", "$6$salt$hash"); err == nil {
+		t.Error("set a password hash in cloud-config")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+
+	v2 "github.com/coreos/ignition/config"
+	v2types "github.com/coreos/ignition/config/types"
+	"github.com/vincent-petithory/dataurl"
+)
+
+// Fragment is part of an Ignition config, such as a file or a systemd
+// unit, which Ignition combines with others into a whole config.
+type Fragment func(c *v2types.Config)
+
+// Ignition returns an Ignition config made of the fragments, applied in
+// order, for use as userdata. It panics if the result isn't valid, so
+// mistakes show up when tests are registered rather than when a
+// machine fails to boot.
+func Ignition(fragments ...Fragment) string {
+	c := v2types.Config{
+		Ignition: v2types.Ignition{
+			Version: v2types.IgnitionVersion(v2types.MaxVersion),
+		},
+	}
+	for _, f := range fragments {
+		f(&c)
+	}
+	buf, err := json.Marshal(c)
+	if err != nil {
+		panic(fmt.Sprintf("conf: marshaling Ignition config: %v", err))
+	}
+	if _, err := v2.Parse(buf); err != nil {
+		panic(fmt.Sprintf("conf: invalid Ignition config: %v", err))
+	}
+	return string(buf)
+}
+
+// user returns the config's entry for the named user, adding one if
+// there is none.
+func user(c *v2types.Config, name string) *v2types.User {
+	for i := range c.Passwd.Users {
+		if c.Passwd.Users[i].Name == name {
+			return &c.Passwd.Users[i]
+		}
+	}
+	c.Passwd.Users = append(c.Passwd.Users, v2types.User{Name: name})
+	return &c.Passwd.Users[len(c.Passwd.Users)-1]
+}
+
+// User creates a user in the given supplementary groups.
+func User(name string, groups ...string) Fragment {
+	return func(c *v2types.Config) {
+		u := user(c, name)
+		if u.Create == nil {
+			u.Create = &v2types.UserCreate{}
+		}
+		u.Create.Groups = append(u.Create.Groups, groups...)
+	}
+}
+
+// AuthorizedKeys adds SSH public keys, in authorized_keys format, to
+// those the user may log in with. The user is created by User if it
+// doesn't already exist, as "core" does.
+func AuthorizedKeys(name string, keys ...string) Fragment {
+	return func(c *v2types.Config) {
+		u := user(c, name)
+		u.SSHAuthorizedKeys = append(u.SSHAuthorizedKeys, keys...)
+	}
+}
+
+// File writes a file with the given contents and mode to the root
+// filesystem.
+func File(path, contents string, mode os.FileMode) Fragment {
+	return func(c *v2types.Config) {
+		source, err := url.Parse(dataurl.EncodeBytes([]byte(contents)))
+		if err != nil {
+			panic(fmt.Sprintf("conf: encoding contents of %s: %v", path, err))
+		}
+		c.Storage.Files = append(c.Storage.Files, v2types.File{
+			Filesystem: "root",
+			Path:       v2types.Path(path),
+			Contents:   v2types.FileContents{Source: v2types.Url(*source)},
+			Mode:       v2types.FileMode(mode),
+		})
+	}
+}
+
+// Unit adds a systemd unit with the given contents, enabling it if
+// enable is set; it then needs an [Install] section.
+func Unit(name, contents string, enable bool) Fragment {
+	return func(c *v2types.Config) {
+		c.Systemd.Units = append(c.Systemd.Units, v2types.SystemdUnit{
+			Name:     v2types.SystemdUnitName(name),
+			Contents: contents,
+			Enable:   enable,
+		})
+	}
+}
+
+// DropIn adds a drop-in with the given name and contents to a systemd
+// unit, which may be one shipped with the OS.
+func DropIn(unit, name, contents string) Fragment {
+	return func(c *v2types.Config) {
+		dropin := v2types.SystemdUnitDropIn{
+			Name:     v2types.SystemdUnitDropInName(name),
+			Contents: contents,
+		}
+		for i := range c.Systemd.Units {
+			if string(c.Systemd.Units[i].Name) == unit {
+				c.Systemd.Units[i].DropIns = append(c.Systemd.Units[i].DropIns, dropin)
+				return
+			}
+		}
+		c.Systemd.Units = append(c.Systemd.Units, v2types.SystemdUnit{
+			Name:    v2types.SystemdUnitName(unit),
+			DropIns: []v2types.SystemdUnitDropIn{dropin},
+		})
+	}
+}
+
+// MaskUnit masks a systemd unit so it can't be started.
+func MaskUnit(name string) Fragment {
+	return func(c *v2types.Config) {
+		c.Systemd.Units = append(c.Systemd.Units, v2types.SystemdUnit{
+			Name: v2types.SystemdUnitName(name),
+			Mask: true,
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"net"
+)
+
+// Firewall rule directions.
+const (
+	FirewallInbound  = "inbound"
+	FirewallOutbound = "outbound"
+)
+
+// FirewallRule allows traffic between a cluster's machines and a range
+// of remote addresses.
+type FirewallRule struct {
+	Direction string // FirewallInbound (the default) or FirewallOutbound
+	Protocol  string // "tcp", "udp" or "icmp"
+	FromPort  int    // first port allowed, ignored for icmp
+	ToPort    int    // last port allowed, 0 means FromPort
+	CIDR      string // remote addresses, empty means anywhere
+}
+
+// FirewallCluster is a Cluster whose platform can filter traffic to and
+// from its machines.
+type FirewallCluster interface {
+	Cluster
+
+	// SetFirewallRules sets the rules for machines created after it is
+	// called. SSH and the rules are allowed in; other new inbound
+	// connections may be dropped. Outbound traffic is only restricted
+	// if there are outbound rules.
+	SetFirewallRules(rules []FirewallRule) error
+}
+
+// Validate checks the rule is well formed.
+func (r FirewallRule) Validate() error {
+	switch r.Direction {
+	case "", FirewallInbound, FirewallOutbound:
+	default:
+		return fmt.Errorf("firewall rule: unknown direction %q", r.Direction)
+	}
+	switch r.Protocol {
+	case "tcp", "udp":
+		from, to := r.Ports()
+		if from < 1 || to > 65535 || from > to {
+			return fmt.Errorf("firewall rule: invalid port range %d-%d", from, to)
+		}
+	case "icmp":
+	default:
+		return fmt.Errorf("firewall rule: unknown protocol %q", r.Protocol)
+	}
+	if r.CIDR != "" {
+		if _, _, err := net.ParseCIDR(r.CIDR); err != nil {
+			return fmt.Errorf("firewall rule: %v", err)
+		}
+	}
+	return nil
+}
+
+// Inbound reports whether the rule allows traffic to the machines.
+func (r FirewallRule) Inbound() bool {
+	return r.Direction != FirewallOutbound
+}
+
+// Ports returns the first and last port of the rule.
+func (r FirewallRule) Ports() (int, int) {
+	if r.ToPort == 0 {
+		return r.FromPort, r.FromPort
+	}
+	return r.FromPort, r.ToPort
+}
+
+// Source returns the rule's remote addresses, defaulting to anywhere.
+func (r FirewallRule) Source() string {
+	if r.CIDR == "" {
+		return "0.0.0.0/0"
+	}
+	return r.CIDR
+}
+
+func (r FirewallRule) String() string {
+	dir := FirewallInbound
+	if !r.Inbound() {
+		dir = FirewallOutbound
+	}
+	if r.Protocol == "icmp" {
+		return fmt.Sprintf("%s icmp %s", dir, r.Source())
+	}
+	from, to := r.Ports()
+	if from == to {
+		return fmt.Sprintf("%s %s/%d %s", dir, r.Protocol, from, r.Source())
+	}
+	return fmt.Sprintf("%s %s/%d-%d %s", dir, r.Protocol, from, to, r.Source())
+}
+
+// ValidateFirewallRules validates each of the rules.
+func ValidateFirewallRules(rules []FirewallRule) error {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
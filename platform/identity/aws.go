@@ -0,0 +1,87 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// awsFetch reads a path from the EC2 instance metadata service, with a
+// session token if IMDSv2 is available.
+const awsFetch = `token=$(curl -sf -X PUT -H 'X-aws-ec2-metadata-token-ttl-seconds: 60' http://169.254.169.254/latest/api/token || true)
+curl -sf ${token:+-H "X-aws-ec2-metadata-token: $token"} http://169.254.169.254/latest/dynamic/instance-identity/%s`
+
+// AWSDocument is an EC2 instance identity document.
+type AWSDocument struct {
+	AccountID        string    `json:"accountId"`
+	Region           string    `json:"region"`
+	AvailabilityZone string    `json:"availabilityZone"`
+	InstanceID       string    `json:"instanceId"`
+	InstanceType     string    `json:"instanceType"`
+	ImageID          string    `json:"imageId"`
+	PrivateIP        string    `json:"privateIp"`
+	PendingTime      time.Time `json:"pendingTime"`
+
+	// Raw is the document as signed and Signature its RSA signature.
+	Raw       []byte `json:"-"`
+	Signature []byte `json:"-"`
+}
+
+// FetchAWS reads the identity document of an EC2 machine and its
+// signature from within the machine.
+func FetchAWS(m platform.Machine) (*AWSDocument, error) {
+	raw, err := fetch(m, fmt.Sprintf(awsFetch, "document"))
+	if err != nil {
+		return nil, fmt.Errorf("fetching identity document: %v", err)
+	}
+	sig, err := fetch(m, fmt.Sprintf(awsFetch, "signature"))
+	if err != nil {
+		return nil, fmt.Errorf("fetching identity signature: %v", err)
+	}
+	return ParseAWS(raw, sig)
+}
+
+// ParseAWS parses an EC2 instance identity document and its base64
+// encoded signature.
+func ParseAWS(raw, sig []byte) (*AWSDocument, error) {
+	var doc AWSDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parsing identity document: %v", err)
+	}
+	doc.Raw = raw
+	var err error
+	// the signature is wrapped over several lines
+	sig = []byte(strings.Join(strings.Fields(string(sig)), ""))
+	if doc.Signature, err = base64.StdEncoding.DecodeString(string(sig)); err != nil {
+		return nil, fmt.Errorf("decoding identity signature: %v", err)
+	}
+	return &doc, nil
+}
+
+// Verify checks the document was signed by the key of cert, the AWS
+// public certificate for the document's region.
+func (d *AWSDocument) Verify(cert *x509.Certificate) error {
+	if err := cert.CheckSignature(x509.SHA256WithRSA, d.Raw, d.Signature); err != nil {
+		return fmt.Errorf("verifying identity document: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// AzureDocument is the attested data of an Azure VM, signed by Azure.
+type AzureDocument struct {
+	Nonce          string `json:"nonce"`
+	VMID           string `json:"vmId"`
+	SubscriptionID string `json:"subscriptionId"`
+	SKU            string `json:"sku"`
+	Plan           struct {
+		Name      string `json:"name"`
+		Product   string `json:"product"`
+		Publisher string `json:"publisher"`
+	} `json:"plan"`
+	TimeStamp struct {
+		CreatedOn string `json:"createdOn"`
+		ExpiresOn string `json:"expiresOn"`
+	} `json:"timeStamp"`
+
+	// Raw is the document as signed and Signature the PKCS#7 signed
+	// data it came in.
+	Raw       []byte `json:"-"`
+	Signature []byte `json:"-"`
+}
+
+// FetchAzure reads the attested data of an Azure VM from within the
+// machine. The nonce, of up to 10 digits, is included in the document
+// so it can't be replayed.
+func FetchAzure(m platform.Machine, nonce string) (*AzureDocument, error) {
+	for _, c := range nonce {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("nonce %q is not numeric", nonce)
+		}
+	}
+	if len(nonce) > 10 {
+		return nil, fmt.Errorf("nonce %q is longer than 10 digits", nonce)
+	}
+
+	cmd := fmt.Sprintf("curl -sf -H Metadata:true 'http://169.254.169.254/metadata/attested/document?api-version=2020-09-01&nonce=%s'", nonce)
+	data, err := fetch(m, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("fetching attested data: %v", err)
+	}
+	var resp struct {
+		Encoding  string `json:"encoding"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("parsing attested data: %v", err)
+	}
+	if resp.Encoding != "pkcs7" {
+		return nil, fmt.Errorf("attested data has unknown encoding %q", resp.Encoding)
+	}
+	sig, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decoding attested data: %v", err)
+	}
+	return ParseAzure(sig)
+}
+
+// ParseAzure parses attested data from its PKCS#7 signed data, without
+// verifying it.
+func ParseAzure(sig []byte) (*AzureDocument, error) {
+	p7, err := parsePKCS7(sig)
+	if err != nil {
+		return nil, fmt.Errorf("parsing attested data: %v", err)
+	}
+	if len(p7.content) == 0 {
+		return nil, errors.New("attested data has no content")
+	}
+	var doc AzureDocument
+	if err := json.Unmarshal(p7.content, &doc); err != nil {
+		return nil, fmt.Errorf("parsing attested data: %v", err)
+	}
+	doc.Raw = p7.content
+	doc.Signature = sig
+	return &doc, nil
+}
+
+// Verify checks the document was signed by a certificate which chains
+// to opts.Roots, by way of any certificates included with the document
+// or already in opts.Intermediates. In Azure's public cloud the
+// certificate is issued for metadata.azure.com, which opts.DNSName can
+// require.
+func (d *AzureDocument) Verify(opts x509.VerifyOptions) error {
+	p7, err := parsePKCS7(d.Signature)
+	if err != nil {
+		return fmt.Errorf("parsing attested data: %v", err)
+	}
+	signer, err := p7.verify()
+	if err != nil {
+		return fmt.Errorf("verifying attested data: %v", err)
+	}
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	for _, cert := range p7.certs {
+		if cert != signer {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	if opts.KeyUsages == nil {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	if _, err := signer.Verify(opts); err != nil {
+		return fmt.Errorf("verifying attested data signer: %v", err)
+	}
+	return nil
+}
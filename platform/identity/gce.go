@@ -0,0 +1,157 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// GoogleCertsURL serves the certificates Google signs identity tokens
+// with, by key ID.
+const GoogleCertsURL = "https://www.googleapis.com/oauth2/v1/certs"
+
+// GCEClaims are the claims of a GCE instance identity token requested
+// in the full format.
+type GCEClaims struct {
+	Issuer   string `json:"iss"`
+	Audience string `json:"aud"`
+	Subject  string `json:"sub"`
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+	Google   struct {
+		ComputeEngine struct {
+			ProjectID     string `json:"project_id"`
+			ProjectNumber int64  `json:"project_number"`
+			Zone          string `json:"zone"`
+			InstanceID    string `json:"instance_id"`
+			InstanceName  string `json:"instance_name"`
+		} `json:"compute_engine"`
+	} `json:"google"`
+}
+
+// FetchGCE requests an identity token for audience from within a GCE
+// machine. The token is a JWT including the instance's details.
+func FetchGCE(m platform.Machine, audience string) (string, error) {
+	cmd := fmt.Sprintf("curl -sf -H 'Metadata-Flavor: Google' 'http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity?audience=%s&format=full'",
+		url.QueryEscape(audience))
+	token, err := fetch(m, cmd)
+	if err != nil {
+		return "", fmt.Errorf("fetching identity token: %v", err)
+	}
+	return string(token), nil
+}
+
+// GoogleCerts downloads the certificates from GoogleCertsURL.
+func GoogleCerts() (map[string]*x509.Certificate, error) {
+	resp, err := http.Get(GoogleCertsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", GoogleCertsURL, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var pems map[string]string
+	if err := json.Unmarshal(data, &pems); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", GoogleCertsURL, err)
+	}
+	certs := make(map[string]*x509.Certificate)
+	for kid, p := range pems {
+		parsed, err := ParseCertificates([]byte(p))
+		if err != nil {
+			return nil, fmt.Errorf("parsing certificate %q: %v", kid, err)
+		}
+		certs[kid] = parsed[0]
+	}
+	return certs, nil
+}
+
+// VerifyGCE checks an identity token was signed by one of certs, by key
+// ID, was issued by Google for audience, and hasn't expired.
+func VerifyGCE(token, audience string, certs map[string]*x509.Certificate) (*GCEClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("identity token has %d parts, not 3", len(parts))
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("parsing identity token header: %v", err)
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("identity token signed with %q, not RS256", header.Algorithm)
+	}
+	cert, ok := certs[header.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("identity token signed with unknown key %q", header.KeyID)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key %q is not an RSA key", header.KeyID)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decoding identity token signature: %v", err)
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, fmt.Errorf("verifying identity token: %v", err)
+	}
+
+	var claims GCEClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("parsing identity token claims: %v", err)
+	}
+	if claims.Issuer != "https://accounts.google.com" && claims.Issuer != "accounts.google.com" {
+		return nil, fmt.Errorf("identity token issued by %q, not Google", claims.Issuer)
+	}
+	if claims.Audience != audience {
+		return nil, fmt.Errorf("identity token is for %q, not %q", claims.Audience, audience)
+	}
+	if exp := time.Unix(claims.Expiry, 0); time.Now().After(exp) {
+		return nil, fmt.Errorf("identity token expired at %v", exp)
+	}
+	return &claims, nil
+}
+
+// decodeJWTPart decodes a base64url encoded JSON part of a JWT into v.
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
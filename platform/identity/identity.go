@@ -0,0 +1,66 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package identity fetches the signed identity documents cloud
+// providers give to their instances and verifies them, so tests can
+// check features which rely on a machine proving who it is, such as
+// cluster join tokens or per-instance credentials.
+package identity
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// fetch runs a shell command on the machine which writes a document to
+// stdout, returning the document's exact bytes.
+func fetch(m platform.Machine, cmd string) ([]byte, error) {
+	// SSH trims its output, which could change a signed document, so
+	// ship it as base64.
+	out, err := m.SSH(fmt.Sprintf("set -o pipefail; (%s) | base64 -w0", cmd))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", out, err)
+	}
+	return base64.StdEncoding.DecodeString(string(out))
+}
+
+// ParseCertificates parses the PEM encoded certificates in data, such
+// as those a provider publishes for checking its signatures.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a CA and a certificate it issued for signing documents.
+type testPKI struct {
+	ca, cert *x509.Certificate
+	key      *rsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "metadata.example.com"},
+		DNSNames:     []string{"metadata.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testPKI{ca: ca, cert: cert, key: key}
+}
+
+func (p *testPKI) sign(t *testing.T, data []byte) []byte {
+	sum := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestParseCertificates(t *testing.T) {
+	p := newTestPKI(t)
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.ca.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.cert.Raw})...)
+	certs, err := ParseCertificates(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(p.ca) || !certs[1].Equal(p.cert) {
+		t.Errorf("got %d certificates, not the CA and signer", len(certs))
+	}
+	if _, err := ParseCertificates([]byte("junk")); err == nil {
+		t.Error("parsed certificates from junk")
+	}
+}
+
+func TestAWS(t *testing.T) {
+	p := newTestPKI(t)
+	raw := []byte(`{
+  "accountId" : "123456789012",
+  "region" : "us-west-2",
+  "instanceId" : "i-0123456789abcdef0",
+  "pendingTime" : "2017-05-01T12:00:00Z"
+}`)
+	// AWS wraps the signature over several lines
+	sig := base64.StdEncoding.EncodeToString(p.sign(t, raw))
+	sig = sig[:64] + "\n" + sig[64:] + "\n"
+
+	doc, err := ParseAWS(raw, []byte(sig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.InstanceID != "i-0123456789abcdef0" || doc.Region != "us-west-2" {
+		t.Errorf("parsed %+v", doc)
+	}
+	if err := doc.Verify(p.cert); err != nil {
+		t.Errorf("verifying: %v", err)
+	}
+	if err := doc.Verify(p.ca); err == nil {
+		t.Error("verified with the wrong certificate")
+	}
+	doc.Raw = []byte(strings.Replace(string(raw), "123456789012", "210987654321", 1))
+	if err := doc.Verify(p.cert); err == nil {
+		t.Error("verified a tampered document")
+	}
+}
+
+func TestVerifyGCE(t *testing.T) {
+	p := newTestPKI(t)
+	certs := map[string]*x509.Certificate{"key1": p.cert}
+	mkToken := func(kid, aud string, exp time.Time) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+		claims, _ := json.Marshal(map[string]interface{}{
+			"iss": "https://accounts.google.com",
+			"aud": aud,
+			"exp": exp.Unix(),
+			"google": map[string]interface{}{
+				"compute_engine": map[string]interface{}{
+					"instance_name": "kola-1",
+					"project_id":    "test",
+				},
+			},
+		})
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+		return signed + "." + base64.RawURLEncoding.EncodeToString(p.sign(t, []byte(signed)))
+	}
+
+	exp := time.Now().Add(time.Hour)
+	claims, err := VerifyGCE(mkToken("key1", "kola", exp), "kola", certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Google.ComputeEngine.InstanceName != "kola-1" {
+		t.Errorf("got instance name %q", claims.Google.ComputeEngine.InstanceName)
+	}
+
+	for name, token := range map[string]string{
+		"wrong audience": mkToken("key1", "other", exp),
+		"unknown key":    mkToken("key2", "kola", exp),
+		"expired":        mkToken("key1", "kola", time.Now().Add(-time.Minute)),
+		"tampered":       mkToken("key1", "kola", exp)[1:],
+		"malformed":      "abc.def",
+	} {
+		if _, err := VerifyGCE(token, "kola", certs); err == nil {
+			t.Errorf("verified a token with %s", name)
+		}
+	}
+}
+
+// mkPKCS7 signs content as Azure does, with authenticated attributes.
+func mkPKCS7(t *testing.T, p *testPKI, content []byte) []byte {
+	mustMarshal := func(v interface{}) []byte {
+		der, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	sum := sha256.Sum256(content)
+	attr := mustMarshal(attribute{
+		Type:   oidMessageDigest,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(sum[:])},
+	})
+	sha256OID := pkix.AlgorithmIdentifier{Algorithm: pkcs7Digests[1].oid}
+	si := signerInfo{
+		Version:                   1,
+		IssuerAndSerial:           issuerAndSerial{Issuer: asn1.RawValue{FullBytes: p.cert.RawIssuer}, Serial: p.cert.SerialNumber},
+		DigestAlgorithm:           sha256OID,
+		AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attr},
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}},
+		EncryptedDigest:           p.sign(t, mustMarshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attr})),
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256OID},
+		ContentInfo: contentInfo{
+			ContentType: oidData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: mustMarshal(content)},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: p.cert.Raw},
+		SignerInfos:  []signerInfo{si},
+	}
+	return mustMarshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: mustMarshal(sd)},
+	})
+}
+
+func TestAzure(t *testing.T) {
+	p := newTestPKI(t)
+	content := []byte(`{"nonce":"1234567890","vmId":"02aab8a4-74ef-476e-8182-f6d2ba4166a6","subscriptionId":"8d10da13-8125-4ba9-a717-bf7490507b3d","sku":"stable"}`)
+	sig := mkPKCS7(t, p, content)
+
+	doc, err := ParseAzure(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Nonce != "1234567890" || doc.VMID != "02aab8a4-74ef-476e-8182-f6d2ba4166a6" {
+		t.Errorf("parsed %+v", doc)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(p.ca)
+	if err := doc.Verify(x509.VerifyOptions{Roots: roots, DNSName: "metadata.example.com"}); err != nil {
+		t.Errorf("verifying: %v", err)
+	}
+	if err := doc.Verify(x509.VerifyOptions{Roots: x509.NewCertPool()}); err == nil {
+		t.Error("verified with an untrusted signer")
+	}
+	if err := doc.Verify(x509.VerifyOptions{Roots: roots, DNSName: "metadata.azure.com"}); err == nil {
+		t.Error("verified with the wrong signer name")
+	}
+
+	// the signature is the last thing in the signed data
+	sig[len(sig)-1] ^= 0xff
+	doc.Signature = sig
+	if err := doc.Verify(x509.VerifyOptions{Roots: roots}); err == nil {
+		t.Error("verified a tampered signature")
+	}
+}
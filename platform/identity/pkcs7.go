@@ -0,0 +1,192 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Just enough of PKCS#7 (RFC 2315) to check the signed data Azure
+// attests VMs with: a single RSA signer, with or without authenticated
+// attributes.
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+// pkcs7Digests maps digest algorithms to the RSA signature algorithm
+// using them.
+var pkcs7Digests = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+	alg  x509.SignatureAlgorithm
+}{
+	{asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1, x509.SHA1WithRSA},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256, x509.SHA256WithRSA},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384, x509.SHA384WithRSA},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512, x509.SHA512WithRSA},
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerial           issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type pkcs7 struct {
+	content []byte
+	certs   []*x509.Certificate
+	signer  signerInfo
+}
+
+func parsePKCS7(der []byte) (*pkcs7, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after PKCS#7 content")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS#7 content type %v is not signed data", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("PKCS#7 signed data has %d signers, not 1", len(sd.SignerInfos))
+	}
+
+	p7 := &pkcs7{signer: sd.SignerInfos[0]}
+	if !sd.ContentInfo.ContentType.Equal(oidData) {
+		return nil, fmt.Errorf("PKCS#7 signed content type %v is not data", sd.ContentInfo.ContentType)
+	}
+	if len(sd.ContentInfo.Content.Bytes) > 0 {
+		if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &p7.content); err != nil {
+			return nil, fmt.Errorf("PKCS#7 content: %v", err)
+		}
+	}
+	if len(sd.Certificates.Bytes) > 0 {
+		var err error
+		if p7.certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	return p7, nil
+}
+
+// verify checks the signature over the content, returning the signing
+// certificate.
+func (p7 *pkcs7) verify() (*x509.Certificate, error) {
+	var signer *x509.Certificate
+	for _, cert := range p7.certs {
+		if cert.SerialNumber.Cmp(p7.signer.IssuerAndSerial.Serial) == 0 &&
+			bytes.Equal(cert.RawIssuer, p7.signer.IssuerAndSerial.Issuer.FullBytes) {
+			signer = cert
+		}
+	}
+	if signer == nil {
+		return nil, errors.New("signing certificate not included")
+	}
+
+	var hash crypto.Hash
+	var alg x509.SignatureAlgorithm
+	for _, d := range pkcs7Digests {
+		if d.oid.Equal(p7.signer.DigestAlgorithm.Algorithm) {
+			hash, alg = d.hash, d.alg
+		}
+	}
+	if alg == x509.UnknownSignatureAlgorithm {
+		return nil, fmt.Errorf("unsupported digest algorithm %v", p7.signer.DigestAlgorithm.Algorithm)
+	}
+
+	signed := p7.content
+	if attrs := p7.signer.AuthenticatedAttributes; len(attrs.FullBytes) > 0 {
+		// The attributes must include the digest of the content, and
+		// are themselves signed as a SET rather than with their
+		// implicit tag.
+		digest, err := messageDigest(attrs.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		h := hash.New()
+		h.Write(p7.content)
+		if !bytes.Equal(digest, h.Sum(nil)) {
+			return nil, errors.New("content does not match its digest")
+		}
+		signed = append([]byte{0x31}, attrs.FullBytes[1:]...)
+	}
+	if err := signer.CheckSignature(alg, signed, p7.signer.EncryptedDigest); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// messageDigest finds the message digest among DER encoded attributes.
+func messageDigest(der []byte) ([]byte, error) {
+	for len(der) > 0 {
+		var attr attribute
+		var err error
+		if der, err = asn1.Unmarshal(der, &attr); err != nil {
+			return nil, err
+		}
+		if !attr.Type.Equal(oidMessageDigest) {
+			continue
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(attr.Values.Bytes, &digest); err != nil {
+			return nil, err
+		}
+		return digest, nil
+	}
+	return nil, errors.New("authenticated attributes have no message digest")
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/platform/conf"
+	"github.com/coreos/mantle/util"
+)
+
+// InfraProxyPort is the port of the HTTP proxy on an InfraServer.
+const InfraProxyPort = 3128
+
+// InfraServer is a machine shared by the clusters of a run that provides
+// NTP, DNS, and an HTTP proxy to their machines, so tests can run in
+// cloud accounts whose machines have no internet access of their own.
+// The server itself needs to reach the internet. Set Options.InfraHost
+// to its IP to point new machines at it.
+type InfraServer interface {
+	// IP returns the private address machines reach the services at.
+	IP() string
+
+	// Destroy terminates the server.
+	Destroy() error
+}
+
+// InfraScript sets up an InfraServer booted from a Debian image. It
+// writes its progress to the serial console, ending with "InfraReady"
+// once the services are running or "InfraFailed" if they aren't.
+const InfraScript = `#!/bin/bash
+exec >/dev/ttyS0 2>&1
+set -e
+trap 'echo "InfraFailed: exit status $?"' ERR
+export DEBIAN_FRONTEND=noninteractive
+apt-get update -q
+apt-get install -q -y chrony dnsmasq squid
+# chrony only serves clients it is told to allow
+echo "allow all" >/etc/chrony/conf.d/kola-infra.conf
+# squid only serves localhost unless told otherwise; conf.d is included
+# ahead of its final "http_access deny all"
+cat >/etc/squid/conf.d/kola-infra.conf <<EOF
+acl kola_infra src 10.0.0.0/8 172.16.0.0/12 192.168.0.0/16 fc00::/7
+http_access allow kola_infra
+EOF
+# dnsmasq forwards to the server's own resolvers
+systemctl restart chrony dnsmasq squid
+echo InfraReady
+`
+
+// InfraTimeout is how long an InfraServer may take to set itself up.
+const InfraTimeout = 10 * time.Minute
+
+// WaitInfraReady waits for an InfraServer's setup to finish by watching
+// its console, as returned by console.
+func WaitInfraReady(console func() (string, error)) error {
+	var result string
+	err := util.Retry(int(InfraTimeout/(10*time.Second)), 10*time.Second, func() error {
+		out, err := console()
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(out, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "InfraReady" || strings.HasPrefix(line, "InfraFailed") {
+				result = line
+				return nil
+			}
+		}
+		return fmt.Errorf("infra server not ready after %v", InfraTimeout)
+	})
+	if err != nil {
+		return err
+	}
+	if result != "InfraReady" {
+		return fmt.Errorf("setting up infra server: %s", result)
+	}
+	return nil
+}
+
+// UseInfra configures a machine to use the NTP, DNS, and HTTP proxy of
+// the InfraServer at host. Internal addresses such as the metadata
+// service are reached directly.
+func UseInfra(c *conf.Conf, host string) error {
+	proxy := fmt.Sprintf("http://%s:%d", host, InfraProxyPort)
+	noProxy := "localhost,127.0.0.1,169.254.169.254,metadata.google.internal"
+	files := []struct {
+		path, contents string
+	}{
+		{"/etc/systemd/timesyncd.conf.d/infra.conf", "[Time]\nNTP=" + host + "\n"},
+		{"/etc/systemd/resolved.conf.d/infra.conf", "[Resolve]\nDNS=" + host + "\n"},
+		{"/etc/systemd/system.conf.d/infra.conf", fmt.Sprintf(
+			"[Manager]\nDefaultEnvironment=HTTP_PROXY=%s HTTPS_PROXY=%s NO_PROXY=%s http_proxy=%s https_proxy=%s no_proxy=%s\n",
+			proxy, proxy, noProxy, proxy, proxy, noProxy)},
+		{"/etc/profile.d/infra.sh", fmt.Sprintf(
+			"export HTTP_PROXY=%s HTTPS_PROXY=%s NO_PROXY=%s\nexport http_proxy=$HTTP_PROXY https_proxy=$HTTPS_PROXY no_proxy=$NO_PROXY\n",
+			proxy, proxy, noProxy)},
+	}
+	for _, f := range files {
+		if err := c.AddFile(f.path, f.contents, 0644); err != nil {
+			return fmt.Errorf("configuring infra server: %v", err)
+		}
+	}
+	return nil
+}
+
+// ConfigureInfra points a new machine's configuration at the
+// InfraServer in Options.InfraHost, if there is one.
+func (bc *BaseCluster) ConfigureInfra(c *conf.Conf) error {
+	if bc.opts.InfraHost == "" {
+		return nil
+	}
+	return UseInfra(c, bc.opts.InfraHost)
+}
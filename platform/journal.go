@@ -17,6 +17,7 @@ package platform
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -26,16 +27,15 @@ import (
 
 // Journal manages recording the journal of a Machine.
 type Journal struct {
-	journal  *os.File
+	journal  io.WriteCloser
 	recorder *journal.Recorder
 	cancel   context.CancelFunc
 }
 
 // NewJournal creates a Journal recorder that will log to "journal.txt"
-// inside the given output directory.
-func NewJournal(dir string) (*Journal, error) {
-	p := filepath.Join(dir, "journal.txt")
-	j, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+// inside the given output directory, capped to maxSize bytes if non-zero.
+func NewJournal(dir string, maxSize int64) (*Journal, error) {
+	j, err := NewLogFile(filepath.Join(dir, "journal.txt"), maxSize)
 	if err != nil {
 		return nil, err
 	}
@@ -85,3 +85,27 @@ func (j *Journal) Destroy() error {
 	}
 	return err
 }
+
+// NewLogFile opens path for appending log output from a machine. If
+// maxSize is non-zero only the first and last maxSize/2 bytes are kept.
+// Until the log is closed the last bytes are kept in path.tail, with
+// the oldest bytes following the newest once it has filled up.
+func NewLogFile(path string, maxSize int64) (io.WriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxSize <= 0 {
+		return f, nil
+	}
+
+	spill, err := os.OpenFile(path+".tail", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := util.NewHeadTailWriter(f, maxSize/2, maxSize-maxSize/2)
+	w.SpillTo(spill)
+	return w, nil
+}
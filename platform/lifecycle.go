@@ -0,0 +1,74 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Metadata keys recording an image's lifecycle.
+const (
+	LifecycleExpires   = "expires"
+	LifecycleRetention = "retention"
+)
+
+// retention labels must be valid as GCS metadata, S3 tags and EC2 tags.
+var retentionRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Lifecycle describes when an uploaded development image may be garbage
+// collected. The zero value keeps images forever.
+type Lifecycle struct {
+	// Expires is when the image may be deleted, if not zero.
+	Expires time.Time
+	// Retention is a label for cloud lifecycle rules to match on,
+	// e.g. "ci" for images only needed by a single test run.
+	Retention string
+}
+
+// NewLifecycle returns a Lifecycle expiring expireAfter from now, or
+// never if expireAfter is zero.
+func NewLifecycle(expireAfter time.Duration, retention string) (Lifecycle, error) {
+	var l Lifecycle
+	if expireAfter < 0 {
+		return l, fmt.Errorf("invalid expiry %v", expireAfter)
+	}
+	if retention != "" && !retentionRegexp.MatchString(retention) {
+		return l, fmt.Errorf("invalid retention label %q", retention)
+	}
+	if expireAfter != 0 {
+		l.Expires = time.Now().UTC().Add(expireAfter).Truncate(time.Second)
+	}
+	l.Retention = retention
+	return l, nil
+}
+
+// Empty reports whether the lifecycle keeps images forever.
+func (l Lifecycle) Empty() bool {
+	return l.Expires.IsZero() && l.Retention == ""
+}
+
+// Tags returns the lifecycle as metadata, with the expiry in RFC 3339.
+func (l Lifecycle) Tags() map[string]string {
+	tags := map[string]string{}
+	if !l.Expires.IsZero() {
+		tags[LifecycleExpires] = l.Expires.Format(time.RFC3339)
+	}
+	if l.Retention != "" {
+		tags[LifecycleRetention] = l.Retention
+	}
+	return tags
+}
@@ -44,7 +44,7 @@ type LocalCluster struct {
 	nshandle    netns.NsHandle
 }
 
-func NewLocalCluster(basename, outputDir string) (*LocalCluster, error) {
+func NewLocalCluster(opts *platform.Options, outputDir string) (*LocalCluster, error) {
 	lc := &LocalCluster{}
 
 	var err error
@@ -55,7 +55,7 @@ func NewLocalCluster(basename, outputDir string) (*LocalCluster, error) {
 	lc.AddCloser(&lc.nshandle)
 
 	nsdialer := network.NewNsDialer(lc.nshandle)
-	lc.BaseCluster, err = platform.NewBaseClusterWithDialer(basename, outputDir, nsdialer)
+	lc.BaseCluster, err = platform.NewBaseClusterWithDialer(opts, outputDir, nsdialer)
 	if err != nil {
 		lc.Destroy()
 		return nil, err
@@ -145,7 +145,15 @@ func (lc *LocalCluster) GetDiscoveryURL(size int) (string, error) {
 }
 
 func (lc *LocalCluster) NewTap(bridge string) (*TunTap, error) {
-	nsExit, err := ns.Enter(lc.nshandle)
+	// the bridges of routed segments live in their router's namespace
+	nshandle := lc.nshandle
+	for _, seg := range lc.Dnsmasq.Segments {
+		if bridge == seg.BridgeName && seg.Router != nil {
+			nshandle = seg.Router.nshandle
+		}
+	}
+
+	nsExit, err := ns.Enter(nshandle)
 	if err != nil {
 		return nil, err
 	}
@@ -38,6 +38,15 @@ type Segment struct {
 	BridgeIf   *Interface
 	Interfaces []*Interface
 	nextIf     int
+
+	// Router is set for segments which are routed to the cluster's
+	// network instead of attached to it directly.
+	Router *Router
+}
+
+// Gateway returns the default gateway of machines on the segment.
+func (seg *Segment) Gateway() net.IP {
+	return seg.BridgeIf.DHCPv4[0].IP
 }
 
 type Dnsmasq struct {
@@ -45,7 +54,9 @@ type Dnsmasq struct {
 	dnsmasq  *exec.ExecCmd
 }
 
-var configTemplate = template.Must(template.New("dnsmasq").Parse(`
+var configTemplate = template.Must(template.New("dnsmasq").Funcs(template.FuncMap{
+	"netmask": func(mask net.IPMask) string { return net.IP(mask).String() },
+}).Parse(`
 keep-in-foreground
 leasefile-ro
 log-facility=-
@@ -65,9 +76,17 @@ dhcp-option=option6:ntp-server,[::]
 {{range .Segments}}
 domain={{.BridgeName}}.local
 
+{{if .Router}}{{$br := .BridgeName}}
+# reached through the relay, which identifies the subnet
+{{range .BridgeIf.DHCPv4}}
+dhcp-range=set:{{$br}},{{.IP}},static,{{netmask .Mask}}
+dhcp-option=tag:{{$br}},option:router,{{.IP}}
+{{end}}
+{{else}}
 {{range .BridgeIf.DHCPv4}}
 dhcp-range={{.IP}},static
 {{end}}
+{{end}}
 
 {{range .BridgeIf.DHCPv6}}
 dhcp-range={{.IP}},ra-names,slaac
@@ -84,6 +103,9 @@ dhcp-host={{.HardwareAddr}}{{template "ips" .DHCPv4}}{{template "ips" .DHCPv6}}
 const (
 	numInterfaces = 16
 	numSegments   = 3
+
+	// routed segments follow the directly attached ones
+	numRoutedSegments = 1
 )
 
 func newInterface(s, i byte) *Interface {
@@ -98,6 +120,14 @@ func newInterface(s, i byte) *Interface {
 	}
 }
 
+// newRoutedInterface is like newInterface but IPv4-only, since the
+// relay only forwards DHCPv4.
+func newRoutedInterface(s, i byte) *Interface {
+	in := newInterface(s, i)
+	in.DHCPv6 = nil
+	return in
+}
+
 func newSegment(s byte) (*Segment, error) {
 	seg := &Segment{
 		BridgeName: fmt.Sprintf("br%d", s),
@@ -108,6 +138,15 @@ func newSegment(s byte) (*Segment, error) {
 		seg.Interfaces = append(seg.Interfaces, newInterface(s, i))
 	}
 
+	if err := addBridge(seg); err != nil {
+		return nil, err
+	}
+
+	return seg, nil
+}
+
+// addBridge creates the segment's bridge in the current namespace.
+func addBridge(seg *Segment) error {
 	br := netlink.Bridge{
 		LinkAttrs: netlink.LinkAttrs{
 			Name:         seg.BridgeName,
@@ -116,28 +155,28 @@ func newSegment(s byte) (*Segment, error) {
 	}
 
 	if err := netlink.LinkAdd(&br); err != nil {
-		return nil, fmt.Errorf("LinkAdd() failed: %v", err)
+		return fmt.Errorf("LinkAdd() failed: %v", err)
 	}
 
 	for _, addr := range seg.BridgeIf.DHCPv4 {
 		nladdr := netlink.Addr{IPNet: &addr}
 		if err := netlink.AddrAdd(&br, &nladdr); err != nil {
-			return nil, fmt.Errorf("DHCPv4 AddrAdd() failed: %v", err)
+			return fmt.Errorf("DHCPv4 AddrAdd() failed: %v", err)
 		}
 	}
 
 	for _, addr := range seg.BridgeIf.DHCPv6 {
 		nladdr := netlink.Addr{IPNet: &addr}
 		if err := netlink.AddrAdd(&br, &nladdr); err != nil {
-			return nil, fmt.Errorf("DHCPv6 AddrAdd() failed: %v", err)
+			return fmt.Errorf("DHCPv6 AddrAdd() failed: %v", err)
 		}
 	}
 
 	if err := netlink.LinkSetUp(&br); err != nil {
-		return nil, fmt.Errorf("LinkSetUp() failed: %v", err)
+		return fmt.Errorf("LinkSetUp() failed: %v", err)
 	}
 
-	return seg, nil
+	return nil
 }
 
 func NewDnsmasq() (*Dnsmasq, error) {
@@ -149,6 +188,18 @@ func NewDnsmasq() (*Dnsmasq, error) {
 		}
 		dm.Segments = append(dm.Segments, seg)
 	}
+	for s := byte(numSegments); s < numSegments+numRoutedSegments; s++ {
+		seg, err := newRoutedSegment(s)
+		if err != nil {
+			return nil, fmt.Errorf("Network setup failed: %v", err)
+		}
+		dm.Segments = append(dm.Segments, seg)
+	}
+
+	// route between the segments
+	if err := enableForwarding(); err != nil {
+		return nil, fmt.Errorf("Network setup failed: %v", err)
+	}
 
 	// setup lo
 	lo, err := netlink.LinkByName("lo")
@@ -202,5 +253,14 @@ func (dm *Dnsmasq) GetInterface(bridge string) (in *Interface) {
 }
 
 func (dm *Dnsmasq) Destroy() error {
-	return dm.dnsmasq.Kill()
+	err := dm.dnsmasq.Kill()
+	for _, seg := range dm.Segments {
+		if seg.Router == nil {
+			continue
+		}
+		if rerr := seg.Router.Destroy(); err == nil {
+			err = rerr
+		}
+	}
+	return err
 }
@@ -0,0 +1,101 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/system/ns"
+)
+
+// SetFirewallRules loads an nftables ruleset into the cluster's network
+// namespace that drops new connections to the machines other than SSH
+// and the inbound rules. If there are outbound rules, new connections
+// from the machines to the namespace are dropped too, other than DHCP,
+// DNS, NTP and the outbound rules. Traffic between machines on the same
+// bridge is not filtered.
+func (lc *LocalCluster) SetFirewallRules(rules []platform.FirewallRule) error {
+	if err := platform.ValidateFirewallRules(rules); err != nil {
+		return err
+	}
+
+	cmd := ns.Command(lc.nshandle, "nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(nftRuleset(rules))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft failed: %v: %s", err, out)
+	}
+	return nil
+}
+
+// nftRuleset returns the ruleset for SetFirewallRules. The machines are
+// only reachable through the bridges, so only traffic on them is filtered.
+func nftRuleset(rules []platform.FirewallRule) string {
+	var out bytes.Buffer
+	var outbound bool
+	fmt.Fprintf(&out, "flush ruleset\n")
+	fmt.Fprintf(&out, "table inet kola {\n")
+
+	fmt.Fprintf(&out, "\tchain output {\n")
+	fmt.Fprintf(&out, "\t\ttype filter hook output priority 0; policy accept;\n")
+	fmt.Fprintf(&out, "\t\toifname != \"br*\" accept\n")
+	fmt.Fprintf(&out, "\t\tct state established,related accept\n")
+	fmt.Fprintf(&out, "\t\tmeta l4proto ipv6-icmp accept\n")
+	fmt.Fprintf(&out, "\t\tudp sport { 53, 67, 123 } accept\n")
+	fmt.Fprintf(&out, "\t\ttcp dport 22 accept\n")
+	for _, r := range rules {
+		if !r.Inbound() {
+			outbound = true
+			continue
+		}
+		fmt.Fprintf(&out, "\t\tip saddr %s %s accept\n", r.Source(), nftMatch(r))
+	}
+	fmt.Fprintf(&out, "\t\tct state new drop\n")
+	fmt.Fprintf(&out, "\t}\n")
+
+	if outbound {
+		fmt.Fprintf(&out, "\tchain input {\n")
+		fmt.Fprintf(&out, "\t\ttype filter hook input priority 0; policy accept;\n")
+		fmt.Fprintf(&out, "\t\tiifname != \"br*\" accept\n")
+		fmt.Fprintf(&out, "\t\tct state established,related accept\n")
+		fmt.Fprintf(&out, "\t\tmeta l4proto ipv6-icmp accept\n")
+		fmt.Fprintf(&out, "\t\tudp dport { 53, 67, 123 } accept\n")
+		for _, r := range rules {
+			if !r.Inbound() {
+				fmt.Fprintf(&out, "\t\tip daddr %s %s accept\n", r.Source(), nftMatch(r))
+			}
+		}
+		fmt.Fprintf(&out, "\t\tct state new drop\n")
+		fmt.Fprintf(&out, "\t}\n")
+	}
+
+	fmt.Fprintf(&out, "}\n")
+	return out.String()
+}
+
+// nftMatch returns the nftables expression matching a rule's protocol
+// and destination ports.
+func nftMatch(r platform.FirewallRule) string {
+	if r.Protocol == "icmp" {
+		return "ip protocol icmp"
+	}
+	from, to := r.Ports()
+	if from == to {
+		return fmt.Sprintf("%s dport %d", r.Protocol, from)
+	}
+	return fmt.Sprintf("%s dport %d-%d", r.Protocol, from, to)
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+
+	"github.com/coreos/mantle/system/exec"
+	"github.com/coreos/mantle/system/ns"
+	"github.com/coreos/mantle/util"
+)
+
+// Router connects a routed segment to the cluster's network namespace.
+// The segment's bridge lives in a namespace of its own, a hop away from
+// the cluster's services, and a dnsmasq DHCP relay running there
+// forwards requests from its machines to the cluster's dnsmasq.
+type Router struct {
+	// Uplink is the router's end of the link to the cluster and
+	// Upstream the cluster's end, which is the router's default
+	// gateway.
+	Uplink   net.IPNet
+	Upstream net.IPNet
+
+	nshandle netns.NsHandle
+	relay    *exec.ExecCmd
+}
+
+// enableForwarding turns on IPv4 forwarding in the current namespace.
+func enableForwarding() error {
+	if err := ioutil.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1\n"), 0644); err != nil {
+		return fmt.Errorf("enabling IP forwarding failed: %v", err)
+	}
+	return nil
+}
+
+// newRoutedSegment creates segment s behind a router. It must be called
+// from the cluster's namespace.
+func newRoutedSegment(s byte) (*Segment, error) {
+	seg := &Segment{
+		BridgeName: fmt.Sprintf("br%d", s),
+		BridgeIf:   newRoutedInterface(s, 1),
+		Router: &Router{
+			Uplink: net.IPNet{
+				IP:   net.IP{10, 255, s, 2},
+				Mask: net.CIDRMask(30, 32)},
+			Upstream: net.IPNet{
+				IP:   net.IP{10, 255, s, 1},
+				Mask: net.CIDRMask(30, 32)},
+		},
+	}
+
+	for i := byte(2); i < 2+numInterfaces; i++ {
+		seg.Interfaces = append(seg.Interfaces, newRoutedInterface(s, i))
+	}
+
+	rt := seg.Router
+	var err error
+	rt.nshandle, err = ns.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: fmt.Sprintf("rt%d", s)},
+		PeerName:  fmt.Sprintf("up%d", s),
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		return nil, fmt.Errorf("veth LinkAdd() failed: %v", err)
+	}
+
+	peer, err := netlink.LinkByName(link.PeerName)
+	if err != nil {
+		return nil, fmt.Errorf("veth peer failed: %v", err)
+	}
+	if err := netlink.LinkSetNsFd(peer, int(rt.nshandle)); err != nil {
+		return nil, fmt.Errorf("LinkSetNsFd() failed: %v", err)
+	}
+
+	if err := netlink.AddrAdd(link, &netlink.Addr{IPNet: &rt.Upstream}); err != nil {
+		return nil, fmt.Errorf("veth AddrAdd() failed: %v", err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return nil, fmt.Errorf("veth LinkSetUp() failed: %v", err)
+	}
+
+	subnet := seg.BridgeIf.DHCPv4[0]
+	subnet.IP = subnet.IP.Mask(subnet.Mask)
+	route := netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       &subnet,
+		Gw:        rt.Uplink.IP,
+	}
+	if err := netlink.RouteAdd(&route); err != nil {
+		return nil, fmt.Errorf("RouteAdd() failed: %v", err)
+	}
+
+	nsExit, err := ns.Enter(rt.nshandle)
+	if err != nil {
+		return nil, err
+	}
+	defer nsExit()
+
+	if err := rt.setup(seg, link.PeerName); err != nil {
+		rt.Destroy()
+		return nil, err
+	}
+
+	return seg, nil
+}
+
+// setup configures the router's namespace, which must be the current
+// one, and starts the relay.
+func (rt *Router) setup(seg *Segment, uplink string) error {
+	for _, name := range []string{"lo", uplink} {
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			return fmt.Errorf("router link %s failed: %v", name, err)
+		}
+		if name == uplink {
+			if err := netlink.AddrAdd(link, &netlink.Addr{IPNet: &rt.Uplink}); err != nil {
+				return fmt.Errorf("uplink AddrAdd() failed: %v", err)
+			}
+		}
+		if err := netlink.LinkSetUp(link); err != nil {
+			return fmt.Errorf("router LinkSetUp() failed: %v", err)
+		}
+	}
+
+	if err := netlink.RouteAdd(&netlink.Route{Gw: rt.Upstream.IP}); err != nil {
+		return fmt.Errorf("default RouteAdd() failed: %v", err)
+	}
+
+	if err := addBridge(seg); err != nil {
+		return err
+	}
+
+	if err := enableForwarding(); err != nil {
+		return err
+	}
+
+	// Requests arriving on the bridge are relayed with the bridge's
+	// address as the gateway, which tells the server which subnet
+	// the client is on.
+	rt.relay = exec.Command("dnsmasq",
+		"--keep-in-foreground",
+		"--log-facility=-",
+		"--pid-file=",
+		"--port=0",
+		"--no-resolv",
+		"--no-hosts",
+		fmt.Sprintf("--dhcp-relay=%s,%s", seg.BridgeIf.DHCPv4[0].IP, rt.Upstream.IP))
+	out, err := rt.relay.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	rt.relay.Stderr = rt.relay.Stdout
+	go util.LogFrom(capnslog.INFO, out)
+
+	return rt.relay.Start()
+}
+
+func (rt *Router) Destroy() error {
+	var err error
+	if rt.relay != nil {
+		err = rt.relay.Kill()
+	}
+	rt.nshandle.Close()
+	return err
+}
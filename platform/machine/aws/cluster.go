@@ -28,7 +28,16 @@ import (
 
 type cluster struct {
 	*platform.BaseCluster
-	api *aws.API
+	api      *aws.API
+	metadata map[string]string
+
+	// localDisks is the number of instance store volumes attached
+	// to new instances.
+	localDisks int
+
+	// securityGroup is the ID of the group created by
+	// SetFirewallRules, if any.
+	securityGroup string
 }
 
 // NewCluster creates an instance of a Cluster suitable for spawning
@@ -43,7 +52,7 @@ func NewCluster(opts *aws.Options, outputDir string) (platform.Cluster, error) {
 		return nil, err
 	}
 
-	bc, err := platform.NewBaseCluster(opts.BaseName, outputDir)
+	bc, err := platform.NewBaseCluster(opts.Options, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -77,18 +86,28 @@ func (ac *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	keys, err := ac.Keys()
-	if err != nil {
+	if err := ac.ConfigureSSH(conf); err != nil {
+		return nil, err
+	}
+	if err := ac.ConfigureInfra(conf); err != nil {
 		return nil, err
 	}
 
-	conf.CopyKeys(keys)
+	timeline := platform.NewTimeline()
+	instances, err := ac.api.CreateInstances(ac.Name(), conf.String(), 1, ac.metadata, ac.securityGroup, ac.localDisks, true)
+	if err != nil {
+		return nil, err
+	}
 
-	instances, err := ac.api.CreateInstances(ac.Name(), conf.String(), 1, true)
+	// CreateInstances waits until the instance is running and has
+	// an IP address.
+	timeline.Record(platform.EventRunning)
+	timeline.Record(platform.EventIP)
 
 	mach := &machine{
-		cluster: ac,
-		mach:    instances[0],
+		cluster:    ac,
+		mach:       instances[0],
+		localDisks: ac.api.LocalDiskPaths(ac.localDisks),
 	}
 
 	dir := filepath.Join(ac.OutputDir(), mach.ID())
@@ -103,34 +122,84 @@ func (ac *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	if mach.journal, err = platform.NewJournal(dir); err != nil {
+	if mach.journal, err = ac.NewJournal(dir); err != nil {
 		mach.Destroy()
 		return nil, err
 	}
 
 	if err := mach.journal.Start(context.TODO(), mach); err != nil {
+		err = mach.provisionError(dir, err)
 		mach.Destroy()
 		return nil, err
 	}
 
 	if err := platform.CheckMachine(mach); err != nil {
-		return nil, fmt.Errorf("machine %q failed basic checks: %v", mach.ID(), err)
+		return nil, fmt.Errorf("machine %q failed basic checks: %v", mach.ID(), mach.provisionError(dir, err))
 	}
+	timeline.Record(platform.EventSSH)
 
 	if err := platform.EnableSelinux(mach); err != nil {
 		mach.Destroy()
 		return nil, err
 	}
 
+	timeline.RecordIgnition(mach)
+	if err := timeline.WriteFile(dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
 	ac.AddMach(mach)
 
 	return mach, nil
 }
 
+// SetMetadata attaches the metadata to new instances as EC2 tags.
+func (ac *cluster) SetMetadata(metadata map[string]string) {
+	ac.metadata = metadata
+}
+
+// SetLocalDisks attaches instance store volumes to new instances. The
+// instance type must have at least n of them.
+func (ac *cluster) SetLocalDisks(n int) error {
+	if n > aws.MaxLocalDisks || !ac.api.HasInstanceStore() {
+		return platform.ErrNotSupported
+	}
+	ac.localDisks = n
+	return nil
+}
+
+// SetFirewallRules launches new instances in a security group of their
+// own, rather than the one in the options, which allows SSH and the
+// rules.
+func (ac *cluster) SetFirewallRules(rules []platform.FirewallRule) error {
+	if err := platform.ValidateFirewallRules(rules); err != nil {
+		return err
+	}
+	if ac.securityGroup != "" {
+		return fmt.Errorf("firewall rules already set")
+	}
+
+	id, err := ac.api.CreateSecurityGroup(ac.Name(), rules)
+	if err != nil {
+		return err
+	}
+	ac.securityGroup = id
+	return nil
+}
+
 func (ac *cluster) Destroy() error {
 	if err := ac.api.DeleteKey(ac.Name()); err != nil {
 		return err
 	}
 
-	return ac.BaseCluster.Destroy()
+	if err := ac.BaseCluster.Destroy(); err != nil {
+		return err
+	}
+
+	// the instances must be gone before their group can be deleted
+	if ac.securityGroup != "" {
+		return ac.api.DeleteSecurityGroup(ac.securityGroup)
+	}
+	return nil
 }
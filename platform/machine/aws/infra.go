@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"errors"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/aws"
+)
+
+type infraServer struct {
+	api *aws.API
+	id  string
+	ip  string
+}
+
+// NewInfraServer creates a platform.InfraServer from opts.InfraAMI,
+// waiting until its services are ready. AWS console output lags, so
+// this takes several minutes.
+func NewInfraServer(opts *aws.Options) (platform.InfraServer, error) {
+	if opts.InfraAMI == "" {
+		return nil, errors.New("an AMI for the infra server is required")
+	}
+
+	api, err := aws.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	inst, err := api.CreateInfraInstance(opts.InfraAMI, platform.InfraScript)
+	if err != nil {
+		return nil, err
+	}
+	s := &infraServer{
+		api: api,
+		id:  *inst.InstanceId,
+	}
+	_, s.ip = aws.InstanceIPs(inst)
+
+	if err := platform.WaitInfraReady(func() (string, error) {
+		return api.GetConsoleOutput(s.id)
+	}); err != nil {
+		s.Destroy()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *infraServer) IP() string {
+	return s.ip
+}
+
+func (s *infraServer) Destroy() error {
+	return s.api.TerminateInstance(s.id)
+}
@@ -16,29 +16,59 @@ package aws
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/aws"
 )
 
 type machine struct {
 	cluster *cluster
 	mach    *ec2.Instance
 	journal *platform.Journal
+
+	localDisks []string
+
+	// mu guards mach, which is replaced by Resize, and detached.
+	mu       sync.Mutex
+	detached map[string]string // interface IDs by device name
 }
 
 func (am *machine) ID() string {
+	am.mu.Lock()
+	defer am.mu.Unlock()
 	return *am.mach.InstanceId
 }
 
+// IP returns the public IP of the instance, its IPv6 address if it is
+// IPv6-only, or its private IP if it has neither and is reached through
+// a bastion.
 func (am *machine) IP() string {
-	return *am.mach.PublicIpAddress
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	ip, _ := aws.InstanceIPs(am.mach)
+	return ip
 }
 
+// PrivateIP returns the private IP of the instance, or its IPv6 address
+// if it is IPv6-only.
 func (am *machine) PrivateIP() string {
-	return *am.mach.PrivateIpAddress
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	_, ip := aws.InstanceIPs(am.mach)
+	return ip
+}
+
+// LocalDisks returns the devices the instance store volumes requested
+// with SetLocalDisks are expected at.
+func (am *machine) LocalDisks() []string {
+	return am.localDisks
 }
 
 func (am *machine) SSHClient() (*ssh.Client, error) {
@@ -69,6 +99,101 @@ func (m *machine) Reboot() error {
 	return nil
 }
 
+// SetLinkDown detaches a secondary network interface, named ethN after
+// its device index. The primary interface eth0 cannot be detached.
+func (am *machine) SetLinkDown(iface string) error {
+	index, err := deviceIndex(iface)
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		return fmt.Errorf("%s: primary interface: %v", iface, platform.ErrNotSupported)
+	}
+
+	instanceID := am.ID()
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	if _, ok := am.detached[iface]; ok {
+		return nil
+	}
+
+	id, err := am.cluster.api.DetachNetworkInterface(instanceID, index)
+	if err != nil {
+		return err
+	}
+	if am.detached == nil {
+		am.detached = make(map[string]string)
+	}
+	am.detached[iface] = id
+	return nil
+}
+
+func (am *machine) SetLinkUp(iface string) error {
+	index, err := deviceIndex(iface)
+	if err != nil {
+		return err
+	}
+
+	instanceID := am.ID()
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	id, ok := am.detached[iface]
+	if !ok {
+		return nil
+	}
+
+	if err := am.cluster.api.AttachNetworkInterface(instanceID, id, index); err != nil {
+		return err
+	}
+	delete(am.detached, iface)
+	return nil
+}
+
+// Resize changes the instance type, which requires stopping the
+// instance. The public IP changes when it is started again.
+func (am *machine) Resize(instanceType string) error {
+	inst, err := am.cluster.api.ResizeInstance(am.ID(), instanceType)
+	if err != nil {
+		return err
+	}
+	am.mu.Lock()
+	am.mach = inst
+	am.mu.Unlock()
+
+	if err := am.journal.Start(context.TODO(), am); err != nil {
+		return err
+	}
+	if err := platform.CheckMachine(am); err != nil {
+		return err
+	}
+	return platform.EnableSelinux(am)
+}
+
+// Pause is not supported since EC2 cannot freeze a running instance.
+func (am *machine) Pause() error {
+	return platform.ErrNotSupported
+}
+
+func (am *machine) Resume() error {
+	return platform.ErrNotSupported
+}
+
+// deviceIndex converts an interface name like eth1 to an EC2 device index.
+func deviceIndex(iface string) (int64, error) {
+	index, err := strconv.ParseInt(strings.TrimPrefix(iface, "eth"), 10, 64)
+	if err != nil || !strings.HasPrefix(iface, "eth") {
+		return 0, fmt.Errorf("invalid interface name %q", iface)
+	}
+	return index, nil
+}
+
+// provisionError classifies a failure to bring up the machine using its
+// console, which EC2 may not have captured yet.
+func (am *machine) provisionError(dir string, err error) error {
+	console, _ := am.cluster.api.GetConsoleOutput(am.ID())
+	return platform.ConsoleFailure(err, dir, console)
+}
+
 func (am *machine) Destroy() error {
 	if err := am.cluster.api.TerminateInstance(am.ID()); err != nil {
 		return err
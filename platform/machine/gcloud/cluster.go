@@ -17,6 +17,7 @@ package gcloud
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -28,7 +29,17 @@ import (
 
 type cluster struct {
 	*platform.BaseCluster
-	api *gcloud.API
+	api      *gcloud.API
+	metadata map[string]string
+
+	// localDisks is the number of local SSDs attached to new
+	// instances.
+	localDisks int
+
+	// firewalls are the names of the firewalls created by
+	// SetFirewallRules, which apply to instances tagged with the
+	// cluster name.
+	firewalls []string
 }
 
 func NewCluster(opts *gcloud.Options, outputDir string) (platform.Cluster, error) {
@@ -37,7 +48,7 @@ func NewCluster(opts *gcloud.Options, outputDir string) (platform.Cluster, error
 		return nil, err
 	}
 
-	bc, err := platform.NewBaseCluster(opts.BaseName, outputDir)
+	bc, err := platform.NewBaseCluster(opts.Options, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +61,40 @@ func NewCluster(opts *gcloud.Options, outputDir string) (platform.Cluster, error
 	return gc, nil
 }
 
+// SetMetadata adds the metadata to new instances' custom metadata
+// attributes.
+func (gc *cluster) SetMetadata(metadata map[string]string) {
+	gc.metadata = metadata
+}
+
+// SetLocalDisks attaches local SSDs to new instances over NVMe.
+func (gc *cluster) SetLocalDisks(n int) error {
+	if n > gcloud.MaxLocalDisks || !gc.api.HasLocalSSDs() {
+		return platform.ErrNotSupported
+	}
+	gc.localDisks = n
+	return nil
+}
+
+// SetFirewallRules opens the inbound rules to new instances, in addition
+// to whatever the network's own firewalls allow. Outbound rules are not
+// supported.
+func (gc *cluster) SetFirewallRules(rules []platform.FirewallRule) error {
+	if err := platform.ValidateFirewallRules(rules); err != nil {
+		return err
+	}
+	if gc.firewalls != nil {
+		return fmt.Errorf("firewall rules already set")
+	}
+
+	names, err := gc.api.CreateFirewalls(gc.Name(), rules)
+	if err != nil {
+		return err
+	}
+	gc.firewalls = names
+	return nil
+}
+
 // Calling in parallel is ok
 func (gc *cluster) NewMachine(userdata string) (platform.Machine, error) {
 	// hacky solution for unified ignition metadata variables
@@ -63,25 +108,46 @@ func (gc *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	keys, err := gc.Keys()
+	keys, err := gc.AuthorizedKeys()
 	if err != nil {
 		return nil, err
 	}
 
-	conf.CopyKeys(keys)
+	if err := gc.ConfigureSSH(conf); err != nil {
+		return nil, err
+	}
+	if err := gc.ConfigureInfra(conf); err != nil {
+		return nil, err
+	}
 
-	instance, err := gc.api.CreateInstance(conf.String(), keys)
+	timeline := platform.NewTimeline()
+	var tags []string
+	if gc.firewalls != nil {
+		tags = []string{gc.Name()}
+	}
+	instance, err := gc.api.CreateInstance(conf.String(), keys, gc.metadata, tags, gc.localDisks)
 	if err != nil {
 		return nil, err
 	}
 
-	intip, extip := gcloud.InstanceIPs(instance)
+	// CreateInstance waits until the instance is running, by which
+	// point it has an IP address.
+	timeline.Record(platform.EventRunning)
+	intip, extip, err := gc.api.InstanceAddrs(instance)
+	if err != nil {
+		gc.api.TerminateZoneInstance(gcloud.InstanceZone(instance), instance.Name)
+		return nil, err
+	}
+	timeline.Record(platform.EventIP)
 
 	gm := &machine{
 		gc:    gc,
 		name:  instance.Name,
+		zone:  gcloud.InstanceZone(instance),
 		intIP: intip,
 		extIP: extip,
+
+		localDisks: gcloud.LocalDiskPaths(gc.localDisks),
 	}
 
 	dir := filepath.Join(gc.OutputDir(), gm.ID())
@@ -96,26 +162,42 @@ func (gc *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	if gm.journal, err = platform.NewJournal(dir); err != nil {
+	if gm.journal, err = gc.NewJournal(dir); err != nil {
 		gm.Destroy()
 		return nil, err
 	}
 
 	if err := gm.journal.Start(context.TODO(), gm); err != nil {
+		err = gm.provisionError(dir, err)
 		gm.Destroy()
 		return nil, err
 	}
 
 	if err := platform.CheckMachine(gm); err != nil {
+		err = gm.provisionError(dir, err)
 		gm.Destroy()
 		return nil, err
 	}
+	timeline.Record(platform.EventSSH)
 
 	if err := platform.EnableSelinux(gm); err != nil {
 		gm.Destroy()
 		return nil, err
 	}
+
+	timeline.RecordIgnition(gm)
+	if err := timeline.WriteFile(dir); err != nil {
+		gm.Destroy()
+		return nil, err
+	}
 	gc.AddMach(gm)
 
 	return gm, nil
 }
+
+func (gc *cluster) Destroy() error {
+	if err := gc.BaseCluster.Destroy(); err != nil {
+		return err
+	}
+	return gc.api.DeleteFirewalls(gc.firewalls)
+}
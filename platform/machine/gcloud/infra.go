@@ -0,0 +1,70 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/gcloud"
+)
+
+type infraServer struct {
+	api  *gcloud.API
+	zone string
+	name string
+	ip   string
+}
+
+// NewInfraServer creates a platform.InfraServer from opts.InfraImage,
+// waiting until its services are ready.
+func NewInfraServer(opts *gcloud.Options) (platform.InfraServer, error) {
+	api, err := gcloud.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	image := opts.InfraImage
+	if image == "" {
+		image = gcloud.DefaultInfraImage
+	}
+	inst, err := api.CreateInfraInstance(image, platform.InfraScript)
+	if err != nil {
+		return nil, err
+	}
+	s := &infraServer{
+		api:  api,
+		zone: gcloud.InstanceZone(inst),
+		name: inst.Name,
+	}
+
+	if s.ip, _, err = api.InstanceAddrs(inst); err != nil {
+		s.Destroy()
+		return nil, err
+	}
+	if err := platform.WaitInfraReady(func() (string, error) {
+		return api.GetConsoleOutput(s.zone, s.name)
+	}); err != nil {
+		s.Destroy()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *infraServer) IP() string {
+	return s.ip
+}
+
+func (s *infraServer) Destroy() error {
+	return s.api.TerminateZoneInstance(s.zone, s.name)
+}
@@ -2,6 +2,7 @@ package gcloud
 
 import (
 	"context"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 
@@ -11,9 +12,14 @@ import (
 type machine struct {
 	gc      *cluster
 	name    string
-	intIP   string
-	extIP   string
+	zone    string
 	journal *platform.Journal
+
+	mu    sync.Mutex // guards the IPs, which change on Resize
+	intIP string
+	extIP string
+
+	localDisks []string
 }
 
 func (gm *machine) ID() string {
@@ -21,13 +27,23 @@ func (gm *machine) ID() string {
 }
 
 func (gm *machine) IP() string {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
 	return gm.extIP
 }
 
 func (gm *machine) PrivateIP() string {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
 	return gm.intIP
 }
 
+// LocalDisks returns the devices the local SSDs requested with
+// SetLocalDisks are expected at.
+func (gm *machine) LocalDisks() []string {
+	return gm.localDisks
+}
+
 func (gm *machine) SSHClient() (*ssh.Client, error) {
 	return gm.gc.SSHClient(gm.IP())
 }
@@ -56,8 +72,58 @@ func (m *machine) Reboot() error {
 	return nil
 }
 
+// SetLinkDown is not supported since GCE cannot detach network interfaces
+// from running instances.
+func (gm *machine) SetLinkDown(iface string) error {
+	return platform.ErrNotSupported
+}
+
+func (gm *machine) SetLinkUp(iface string) error {
+	return platform.ErrNotSupported
+}
+
+// Resize changes the machine type, which requires stopping the instance.
+// The ephemeral external IP changes when it is started again.
+func (gm *machine) Resize(machineType string) error {
+	inst, err := gm.gc.api.ResizeInstance(gm.zone, gm.name, machineType)
+	if err != nil {
+		return err
+	}
+	intIP, extIP, err := gm.gc.api.InstanceAddrs(inst)
+	if err != nil {
+		return err
+	}
+	gm.mu.Lock()
+	gm.intIP, gm.extIP = intIP, extIP
+	gm.mu.Unlock()
+
+	if err := gm.journal.Start(context.TODO(), gm); err != nil {
+		return err
+	}
+	if err := platform.CheckMachine(gm); err != nil {
+		return err
+	}
+	return platform.EnableSelinux(gm)
+}
+
+// Pause is not supported since GCE cannot freeze a running instance.
+func (gm *machine) Pause() error {
+	return platform.ErrNotSupported
+}
+
+func (gm *machine) Resume() error {
+	return platform.ErrNotSupported
+}
+
+// provisionError classifies a failure to bring up the machine using its
+// serial console.
+func (gm *machine) provisionError(dir string, err error) error {
+	console, _ := gm.gc.api.GetConsoleOutput(gm.zone, gm.name)
+	return platform.ConsoleFailure(err, dir, console)
+}
+
 func (gm *machine) Destroy() error {
-	if err := gm.gc.api.TerminateInstance(gm.name); err != nil {
+	if err := gm.gc.api.TerminateZoneInstance(gm.zone, gm.name); err != nil {
 		return err
 	}
 
@@ -16,7 +16,10 @@ package qemu
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -43,6 +46,14 @@ type Options struct {
 	// It can be a plain name, or a full path.
 	BIOSImage string
 
+	// UEFIVars is the path to an OVMF variable store template. If set,
+	// BIOSImage is treated as the UEFI firmware code and each machine
+	// gets a private, writable copy of the variable store.
+	UEFIVars string
+
+	// TPM attaches a TPM 2.0 device emulated by swtpm to each machine.
+	TPM bool
+
 	*platform.Options
 }
 
@@ -53,7 +64,20 @@ type Options struct {
 type Cluster struct {
 	conf *Options
 
-	mu sync.Mutex
+	// Cgroup, if set, is a cgroup v2 directory that QEMU and its helper
+	// processes are moved into.
+	Cgroup string
+
+	// Procs, if set, limits how many QEMU and helper processes run
+	// at once across clusters sharing it.
+	Procs *exec.Limiter
+
+	// Group, if set, kills QEMU and its helper processes, and their
+	// children, once the cluster's user is done with them.
+	Group *exec.Group
+
+	mu        sync.Mutex
+	bootDisks []string
 	*local.LocalCluster
 }
 
@@ -64,7 +88,11 @@ var (
 // NewCluster creates a Cluster instance, suitable for running virtual
 // machines in QEMU.
 func NewCluster(conf *Options, outputDir string) (platform.Cluster, error) {
-	lc, err := local.NewLocalCluster(conf.BaseName, outputDir)
+	if conf.IPv6Only {
+		return nil, fmt.Errorf("IPv6-only networking is not supported on qemu")
+	}
+
+	lc, err := local.NewLocalCluster(conf.Options, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +105,26 @@ func NewCluster(conf *Options, outputDir string) (platform.Cluster, error) {
 	return qc, nil
 }
 
+// SetBootDisks attaches each image as a separate disk to machines
+// created after it is called. Machines boot from the first disk until
+// SetBootDisk is called on them.
+func (qc *Cluster) SetBootDisks(images []string) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	qc.bootDisks = images
+}
+
 func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
+	return qc.NewMachineOnSegment(cfg, "br0")
+}
+
+// NewMachineOnSegment creates a machine attached to the network segment
+// with the given bridge, one of the LocalCluster's Dnsmasq.Segments.
+// br0 through br2 are attached to the cluster's network directly and
+// routed to each other; br3 sits behind a router and gets its addresses
+// through a DHCP relay.
+func (qc *Cluster) NewMachineOnSegment(cfg, bridge string) (platform.Machine, error) {
+	timeline := platform.NewTimeline()
 	id := uuid.NewV4()
 
 	dir := filepath.Join(qc.OutputDir(), id.String())
@@ -88,7 +135,7 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 	// hacky solution for cloud config ip substitution
 	// NOTE: escaping is not supported
 	qc.mu.Lock()
-	netif := qc.Dnsmasq.GetInterface("br0")
+	netif := qc.Dnsmasq.GetInterface(bridge)
 	ip := strings.Split(netif.DHCPv4[0].String(), "/")[0]
 
 	cfg = strings.Replace(cfg, "$public_ipv4", ip, -1)
@@ -100,16 +147,23 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	keys, err := qc.Keys()
-	if err != nil {
+	if err := qc.ConfigureSSH(conf); err != nil {
 		qc.mu.Unlock()
 		return nil, err
 	}
 
-	conf.CopyKeys(keys)
-
 	qc.mu.Unlock()
 
+	// let core log in on the serial console, to find out what went
+	// wrong if SSH doesn't come up
+	var password string
+	if conf.IsIgnition() && conf.PasswordHash("core") == "" {
+		password, err = consolePassword(conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var confPath string
 	if conf.IsIgnition() {
 		confPath = filepath.Join(dir, "ignition.json")
@@ -123,16 +177,25 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 		}
 	}
 
-	journal, err := platform.NewJournal(dir)
+	journal, err := qc.NewJournal(dir)
 	if err != nil {
 		return nil, err
 	}
 
+	qc.mu.Lock()
+	images := qc.bootDisks
+	qc.mu.Unlock()
+	if len(images) == 0 {
+		images = []string{""}
+	}
+
 	qm := &machine{
 		qc:      qc,
 		id:      id.String(),
+		dir:     dir,
 		netif:   netif,
 		journal: journal,
+		disks:   len(images),
 	}
 
 	var qmCmd []string
@@ -153,18 +216,45 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 		panic(qc.conf.Board)
 	}
 
+	if qc.conf.UEFIVars != "" {
+		varsPath := filepath.Join(dir, "uefi-vars.fd")
+		if err := copyFile(qc.conf.UEFIVars, varsPath); err != nil {
+			return nil, err
+		}
+		qmCmd = append(qmCmd,
+			"-drive", "if=pflash,unit=0,format=raw,readonly=on,file="+qc.conf.BIOSImage,
+			"-drive", "if=pflash,unit=1,format=raw,file="+varsPath)
+	} else {
+		qmCmd = append(qmCmd, "-bios", qc.conf.BIOSImage)
+	}
+
+	if qc.conf.TPM {
+		sock, err := qm.startSWTPM(filepath.Join(dir, "tpm"))
+		if err != nil {
+			return nil, err
+		}
+		qmCmd = append(qmCmd,
+			"-chardev", "socket,id=chrtpm,path="+sock,
+			"-tpmdev", "emulator,id=tpm0,chardev=chrtpm",
+			"-device", qc.tpmDevice()+",tpmdev=tpm0")
+	}
+
+	qm.console, err = platform.NewLogFile(filepath.Join(dir, "console.txt"), qc.conf.MaxLogSize)
+	if err != nil {
+		qm.release()
+		return nil, err
+	}
+
 	qmMac := qm.netif.HardwareAddr.String()
 	qmCmd = append(qmCmd,
-		"-bios", qc.conf.BIOSImage,
 		"-smp", "1",
 		"-m", "1024",
 		"-uuid", qm.id,
 		"-display", "none",
-		"-add-fd", "fd=4,set=1",
-		"-drive", "if=none,id=blk,format=raw,file=/dev/fdset/1",
-		"-device", qc.virtio("blk", "drive=blk"),
+		"-serial", "stdio",
 		"-netdev", "tap,id=tap,fd=3",
-		"-device", qc.virtio("net", "netdev=tap,mac="+qmMac),
+		"-device", qc.virtio("net", "netdev=tap,id=eth0,mac="+qmMac),
+		"-qmp", "unix:"+qm.qmpSocket()+",server,nowait",
 	)
 
 	if conf.IsIgnition() {
@@ -176,17 +266,37 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 			"-device", qc.virtio("9p", "fsdev=cfg,mount_tag=config-2"))
 	}
 
-	diskFile, err := setupDisk(qc.conf.DiskImage)
-	if err != nil {
-		return nil, err
+	// disks are passed as fds 4 and up, with the first disk first in
+	// the boot order.
+	var diskFiles []*os.File
+	defer func() {
+		for _, f := range diskFiles {
+			f.Close()
+		}
+	}()
+	for i, image := range images {
+		if image == "" {
+			image = qc.conf.DiskImage
+		}
+		diskFile, err := qc.setupDisk(image)
+		if err != nil {
+			qm.release()
+			return nil, err
+		}
+		diskFiles = append(diskFiles, diskFile)
+
+		qmCmd = append(qmCmd,
+			"-add-fd", fmt.Sprintf("fd=%d,set=%d", 4+i, 1+i),
+			"-drive", fmt.Sprintf("if=none,id=blk%d,format=raw,file=/dev/fdset/%d", i, 1+i),
+			"-device", qc.virtio("blk", fmt.Sprintf("drive=blk%d,id=disk%d,bootindex=%d", i, i, i)))
 	}
-	defer diskFile.Close()
 
 	qc.mu.Lock()
 
-	tap, err := qc.NewTap("br0")
+	tap, err := qc.NewTap(bridge)
 	if err != nil {
 		qc.mu.Unlock()
+		qm.release()
 		return nil, err
 	}
 	defer tap.Close()
@@ -198,35 +308,79 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 	qc.mu.Unlock()
 
 	cmd := qm.qemu.(*ns.Cmd)
+	cmd.Limiter = qc.Procs
+	cmd.Group = qc.Group
+	serialIn, err := cmd.StdinPipe()
+	if err != nil {
+		qm.release()
+		return nil, err
+	}
+	qm.serial = platform.NewSerialConsole(serialIn, password)
+	cmd.Stdout = io.MultiWriter(qm.console, qm.serial)
 	cmd.Stderr = os.Stderr
-	cmd.ExtraFiles = append(cmd.ExtraFiles,
-		tap.File, // fd=3
-		diskFile, // fd=4
-	)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, tap.File) // fd=3
+	for _, f := range diskFiles {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f) // fd=4...
+	}
 
 	if err = qm.qemu.Start(); err != nil {
+		qm.release()
 		return nil, err
 	}
 
-	if err := qm.journal.Start(context.TODO(), qm); err != nil {
+	if err := qc.joinCgroup(cmd.Process.Pid); err != nil {
 		qm.Destroy()
 		return nil, err
 	}
+	timeline.Record(platform.EventRunning)
+
+	if err := qm.journal.Start(context.TODO(), qm); err != nil {
+		qm.Destroy()
+		return nil, qm.provisionError(err)
+	}
 
 	if err := platform.CheckMachine(qm); err != nil {
+		if err := platform.SaveSerialDiagnostics(qm, dir); err != nil {
+			plog.Errorf("saving serial diagnostics: %v", err)
+		}
 		qm.Destroy()
-		return nil, err
+		return nil, qm.provisionError(err)
 	}
+	timeline.Record(platform.EventSSH)
 
 	if err := platform.EnableSelinux(qm); err != nil {
 		qm.Destroy()
 		return nil, err
 	}
+
+	timeline.RecordIgnition(qm)
+	if err := timeline.WriteFile(dir); err != nil {
+		qm.Destroy()
+		return nil, err
+	}
 	qc.AddMach(qm)
 
 	return qm, nil
 }
 
+// consolePassword sets a random password for core in an Ignition
+// config and returns it.
+func consolePassword(c *conf.Conf) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	password := hex.EncodeToString(b)
+	hash, err := conf.HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	if err := c.SetPasswordHash("core", hash); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
 // The virtio device name differs between machine types but otherwise
 // configuration is the same. Use this to help construct device args.
 func (qc *Cluster) virtio(device, args string) string {
@@ -242,9 +396,39 @@ func (qc *Cluster) virtio(device, args string) string {
 	return fmt.Sprintf("virtio-%s-%s,%s", device, suffix, args)
 }
 
+// joinCgroup moves a helper process into the cluster's cgroup, if any.
+func (qc *Cluster) joinCgroup(pid int) error {
+	if qc.Cgroup == "" {
+		return nil
+	}
+	if err := exec.JoinCgroup(qc.Cgroup, pid); err != nil {
+		return fmt.Errorf("moving process %d to cgroup: %v", pid, err)
+	}
+	return nil
+}
+
+// tpmDevice returns the QEMU device name for a TPM on the current board.
+func (qc *Cluster) tpmDevice() string {
+	switch qc.conf.Board {
+	case "amd64-usr":
+		return "tpm-tis"
+	case "arm64-usr":
+		return "tpm-tis-device"
+	default:
+		panic(qc.conf.Board)
+	}
+}
+
+func copyFile(src, dst string) error {
+	cp := exec.Command("cp", "--force", src, dst)
+	cp.Stdout = os.Stdout
+	cp.Stderr = os.Stderr
+	return cp.Run()
+}
+
 // Copy the base image to a new nameless temporary file.
 // cp is used since it supports sparse and reflink.
-func setupDisk(imageFile string) (*os.File, error) {
+func (qc *Cluster) setupDisk(imageFile string) (*os.File, error) {
 	dstFile, err := ioutil.TempFile("", "mantle-qemu")
 	if err != nil {
 		return nil, err
@@ -256,10 +440,19 @@ func setupDisk(imageFile string) (*os.File, error) {
 	cp := exec.Command("cp", "--force",
 		"--sparse=always", "--reflink=auto",
 		imageFile, dstFileName)
+	cp.Limiter = qc.Procs
+	cp.Group = qc.Group
 	cp.Stdout = os.Stdout
 	cp.Stderr = os.Stderr
 
-	if err := cp.Run(); err != nil {
+	if err := cp.Start(); err != nil {
+		return nil, err
+	}
+	if err := qc.joinCgroup(cp.Process.Pid); err != nil {
+		cp.Kill()
+		return nil, err
+	}
+	if err := cp.Wait(); err != nil {
 		return nil, err
 	}
 
@@ -16,6 +16,10 @@ package qemu
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
 
 	"golang.org/x/crypto/ssh"
 
@@ -27,9 +31,18 @@ import (
 type machine struct {
 	qc      *Cluster
 	id      string
+	dir     string
 	qemu    exec.Cmd
+	swtpm   exec.Cmd
+	console io.WriteCloser
+	serial  *platform.SerialConsole
 	netif   *local.Interface
 	journal *platform.Journal
+
+	// disks is the number of boot disks attached, and bootBase the
+	// lowest boot index in use by them.
+	disks    int
+	bootBase int
 }
 
 func (m *machine) ID() string {
@@ -64,6 +77,9 @@ func (m *machine) Reboot() error {
 		return err
 	}
 	if err := platform.CheckMachine(m); err != nil {
+		if err := platform.SaveSerialDiagnostics(m, m.dir); err != nil {
+			plog.Errorf("saving serial diagnostics: %v", err)
+		}
 		return err
 	}
 	if err := platform.EnableSelinux(m); err != nil {
@@ -72,13 +88,96 @@ func (m *machine) Reboot() error {
 	return nil
 }
 
+// SerialExec runs a command on the serial console, logging in as core
+// with the password set in its Ignition config if need be.
+func (m *machine) SerialExec(cmd string) ([]byte, error) {
+	return m.serial.Exec(cmd)
+}
+
+// SetLinkDown disconnects a NIC using the QEMU monitor. The machine's
+// only NIC is named eth0.
+func (m *machine) SetLinkDown(iface string) error {
+	return m.setLink(iface, false)
+}
+
+func (m *machine) SetLinkUp(iface string) error {
+	return m.setLink(iface, true)
+}
+
+// Pause stops the guest CPUs using the QEMU monitor.
+func (m *machine) Pause() error {
+	return m.qmp("stop", nil)
+}
+
+func (m *machine) Resume() error {
+	return m.qmp("cont", nil)
+}
+
+// SetBootDisk changes the disks' boot indexes through the QEMU monitor.
+// QEMU rereads the boot order when the machine resets, so it takes
+// effect on the next Reboot.
+func (m *machine) SetBootDisk(index int) error {
+	if index < 0 || index >= m.disks {
+		return fmt.Errorf("machine %s has no disk %d", m.id, index)
+	}
+	// boot indexes must be unique at all times, so move all the disks
+	// to a range that isn't in use.
+	base := m.bootBase + m.disks
+	next := base + 1
+	for i := 0; i < m.disks; i++ {
+		bootindex := base
+		if i != index {
+			bootindex = next
+			next++
+		}
+		err := m.qmp("qom-set", map[string]interface{}{
+			"path":     fmt.Sprintf("/machine/peripheral/disk%d", i),
+			"property": "bootindex",
+			"value":    bootindex,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	m.bootBase = base
+	return nil
+}
+
+// Resize is not supported; QEMU machines keep the resources they were
+// started with.
+func (m *machine) Resize(machineType string) error {
+	return platform.ErrNotSupported
+}
+
+// provisionError classifies a failure to bring up the machine using its
+// console log. The machine must be destroyed first so the log is flushed.
+func (m *machine) provisionError(err error) error {
+	console, _ := ioutil.ReadFile(filepath.Join(m.dir, "console.txt"))
+	return platform.ClassifyFailure(err, string(console))
+}
+
 func (m *machine) Destroy() error {
 	err := m.qemu.Kill()
 	if err2 := m.journal.Destroy(); err == nil && err2 != nil {
 		err = err2
 	}
+	if err2 := m.release(); err == nil && err2 != nil {
+		err = err2
+	}
 
 	m.qc.DelMach(m)
 
 	return err
 }
+
+// release frees the host resources that support a QEMU process.
+func (m *machine) release() error {
+	err := m.stopSWTPM()
+	if m.console != nil {
+		if err2 := m.console.Close(); err == nil && err2 != nil {
+			err = err2
+		}
+		m.console = nil
+	}
+	return err
+}
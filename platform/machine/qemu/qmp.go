@@ -0,0 +1,98 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+const qmpTimeout = 30 * time.Second
+
+// qmpResponse is a reply or asynchronous event from the QEMU monitor.
+type qmpResponse struct {
+	Return json.RawMessage `json:"return"`
+	Event  string          `json:"event"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+}
+
+func (m *machine) qmpSocket() string {
+	return filepath.Join(m.dir, "qmp.sock")
+}
+
+// qmp runs a single command on the machine's QEMU monitor.
+func (m *machine) qmp(command string, args interface{}) error {
+	conn, err := net.DialTimeout("unix", m.qmpSocket(), qmpTimeout)
+	if err != nil {
+		return fmt.Errorf("connecting to QEMU monitor: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(qmpTimeout))
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+
+	// discard the greeting
+	var greeting json.RawMessage
+	if err := dec.Decode(&greeting); err != nil {
+		return fmt.Errorf("reading QEMU monitor greeting: %v", err)
+	}
+
+	execute := func(command string, args interface{}) error {
+		req := map[string]interface{}{"execute": command}
+		if args != nil {
+			req["arguments"] = args
+		}
+		if err := enc.Encode(req); err != nil {
+			return err
+		}
+		for {
+			var resp qmpResponse
+			if err := dec.Decode(&resp); err != nil {
+				return err
+			}
+			if resp.Event != "" {
+				continue
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("%s: %s", resp.Error.Class, resp.Error.Desc)
+			}
+			return nil
+		}
+	}
+
+	if err := execute("qmp_capabilities", nil); err != nil {
+		return fmt.Errorf("QEMU monitor negotiation: %v", err)
+	}
+	if err := execute(command, args); err != nil {
+		return fmt.Errorf("QEMU monitor %s: %v", command, err)
+	}
+	return nil
+}
+
+// setLink changes the link state of a NIC as seen by the guest.
+func (m *machine) setLink(iface string, up bool) error {
+	return m.qmp("set_link", map[string]interface{}{
+		"name": iface,
+		"up":   up,
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/mantle/system/exec"
+	"github.com/coreos/mantle/util"
+)
+
+// startSWTPM launches a TPM 2.0 emulator keeping its state in dir and
+// returns the path of the control socket QEMU should connect to.
+func (m *machine) startSWTPM(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+
+	sock := filepath.Join(dir, "swtpm-sock")
+	swtpm := exec.Command("swtpm", "socket",
+		"--tpm2",
+		"--tpmstate", "dir="+dir,
+		"--ctrl", "type=unixio,path="+sock,
+		"--log", "file="+filepath.Join(dir, "swtpm.log"),
+		"--terminate")
+	swtpm.Limiter = m.qc.Procs
+	swtpm.Group = m.qc.Group
+	swtpm.Stderr = os.Stderr
+
+	plog.Debugf("Starting swtpm: %q", swtpm.Args)
+
+	if err := swtpm.Start(); err != nil {
+		return "", fmt.Errorf("starting swtpm: %v", err)
+	}
+	m.swtpm = swtpm
+
+	if err := m.qc.joinCgroup(swtpm.Process.Pid); err != nil {
+		m.stopSWTPM()
+		return "", err
+	}
+
+	// wait for the socket so QEMU doesn't race swtpm at startup
+	if err := util.Retry(50, 100*time.Millisecond, func() error {
+		_, err := os.Stat(sock)
+		return err
+	}); err != nil {
+		m.stopSWTPM()
+		return "", fmt.Errorf("swtpm socket never appeared: %v", err)
+	}
+
+	return sock, nil
+}
+
+// stopSWTPM kills the TPM emulator, if one was started.
+func (m *machine) stopSWTPM() error {
+	if m.swtpm == nil {
+		return nil
+	}
+	err := m.swtpm.Kill()
+	m.swtpm = nil
+	return err
+}
@@ -16,6 +16,7 @@ package platform
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -32,6 +33,10 @@ const (
 	sshTimeout = 10 * time.Second
 )
 
+// ErrNotSupported is returned by optional Machine operations that the
+// platform cannot perform.
+var ErrNotSupported = errors.New("operation not supported on this platform")
+
 // Machine represents a CoreOS instance.
 type Machine interface {
 	// ID returns the plaform-specific machine identifier.
@@ -55,6 +60,28 @@ type Machine interface {
 	// Reboot restarts the machine and waits for it to come back.
 	Reboot() error
 
+	// SetLinkDown disconnects the named network interface from the
+	// network, as if the cable was pulled. Platforms that cannot do
+	// this return ErrNotSupported.
+	SetLinkDown(iface string) error
+
+	// SetLinkUp reconnects an interface disconnected by SetLinkDown.
+	SetLinkUp(iface string) error
+
+	// Resize stops the machine, changes it to the given platform
+	// instance type, starts it again, and waits for it to come back.
+	// The machine's IP addresses may change. Platforms that cannot do
+	// this return ErrNotSupported.
+	Resize(machineType string) error
+
+	// Pause freezes the machine in place, as if its host stalled,
+	// until Resume is called. Platforms that cannot do this return
+	// ErrNotSupported.
+	Pause() error
+
+	// Resume continues a machine frozen by Pause.
+	Resume() error
+
 	// Destroy terminates the machine and frees associated resources.
 	Destroy() error
 }
@@ -70,14 +97,105 @@ type Cluster interface {
 	// GetDiscoveryURL returns a new etcd discovery URL.
 	GetDiscoveryURL(size int) (string, error)
 
+	// RotateKey replaces the SSH key used to reach the machines with a
+	// new one. The old key no longer works once it returns.
+	RotateKey() error
+
 	// Destroy terminates each machine in the cluster and frees any other
 	// associated resources.
 	Destroy() error
 }
 
+// MetadataCluster is a Cluster whose platform can attach key/value
+// metadata to machines. Guests can read the metadata back from the
+// platform metadata service.
+type MetadataCluster interface {
+	Cluster
+
+	// SetMetadata sets the metadata attached to machines created
+	// after it is called.
+	SetMetadata(metadata map[string]string)
+}
+
+// BootDiskCluster is a Cluster whose machines can be given several
+// bootable disks, for testing A/B partition updates and boot fallback.
+type BootDiskCluster interface {
+	Cluster
+
+	// SetBootDisks sets the disk images attached to machines created
+	// after it is called, in their initial boot order. An empty name
+	// is the image under test.
+	SetBootDisks(images []string)
+}
+
+// BootDiskMachine is a Machine created by a BootDiskCluster.
+type BootDiskMachine interface {
+	Machine
+
+	// SetBootDisk makes the machine boot from the disk at index, in
+	// the order given to SetBootDisks, the next time it restarts.
+	SetBootDisk(index int) error
+}
+
+// LocalDiskCluster is a Cluster whose machines can be given local disks
+// by the cloud provider, such as GCE local SSDs or AWS instance store
+// volumes, whose contents don't outlive the machine.
+type LocalDiskCluster interface {
+	Cluster
+
+	// SetLocalDisks sets the number of local disks attached to machines
+	// created after it is called. Platforms that cannot attach n local
+	// disks with the configured machine type return ErrNotSupported.
+	SetLocalDisks(n int) error
+}
+
+// LocalDiskMachine is a Machine created by a LocalDiskCluster.
+type LocalDiskMachine interface {
+	Machine
+
+	// LocalDisks returns the device paths the machine's local disks
+	// are expected at, in order.
+	LocalDisks() []string
+}
+
+// SerialMachine is a Machine whose serial console can run commands, to
+// find out why it can't be reached over SSH. See SaveSerialDiagnostics.
+type SerialMachine interface {
+	Machine
+
+	// SerialExec runs a shell command on the machine's serial
+	// console, logging in as core if needed, and returns its output.
+	SerialExec(cmd string) ([]byte, error)
+}
+
 // Options contains the base options for all clusters.
 type Options struct {
 	BaseName string
+
+	// MaxLogSize caps the size of each console and journal log captured
+	// from a machine. The first and last halves of the limit are kept.
+	// 0 means unlimited.
+	MaxLogSize int64
+
+	// Bastion, if set, is an SSH host given as [user@]host[:port] that
+	// machines are reached through, for machines without public IPs.
+	// It is authenticated with the keys in the user's ssh-agent.
+	Bastion string
+
+	// IPv6Only gives cloud machines IPv6 addresses and no IPv4 ones,
+	// so IPv6-only image bugs are caught. Machines are reached over
+	// IPv6, so the host needs IPv6 connectivity too.
+	IPv6Only bool
+
+	// InfraHost, if set, is the address of an InfraServer which cloud
+	// machines are configured to use for NTP, DNS, and HTTP proxying.
+	InfraHost string
+
+	// SSHCertificates has machines trust a certificate authority held
+	// by the cluster's SSH agent, which issues its keys short-lived
+	// certificates, rather than authorizing the keys themselves.
+	// AWS still registers the key as the instances' key pair.
+	SSHCertificates bool
 }
 
 // Wrap a StdoutPipe as a io.ReadCloser
@@ -0,0 +1,65 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resources limited by platform quotas.
+const (
+	QuotaInstances = "instances"
+	QuotaCPUs      = "cpus"
+	QuotaIPs       = "ips"
+)
+
+// Quota is a limit on a platform resource and its current usage.
+type Quota struct {
+	Resource string
+	Scope    string // region or other scope the quota applies to
+	Limit    float64
+	Usage    float64
+}
+
+// Available returns how much of the resource can still be used.
+func (q Quota) Available() float64 {
+	return q.Limit - q.Usage
+}
+
+func (q Quota) String() string {
+	s := q.Resource
+	if q.Scope != "" {
+		s += " in " + q.Scope
+	}
+	return fmt.Sprintf("%s: %g of %g used", s, q.Usage, q.Limit)
+}
+
+// CheckQuotas returns an error naming every quota without room for the
+// additional resources in need. need is keyed by quota scope and then
+// resource; resources without a quota are not checked.
+func CheckQuotas(quotas []Quota, need map[string]map[string]float64) error {
+	var exceeded []string
+	for _, q := range quotas {
+		n := need[q.Scope][q.Resource]
+		if n > q.Available() {
+			exceeded = append(exceeded, fmt.Sprintf("%s, %g more needed", q, n))
+		}
+	}
+	if len(exceeded) > 0 {
+		return fmt.Errorf("insufficient quota: %s", strings.Join(exceeded, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SerialTimeout is how long a command run on a serial console may take.
+const SerialTimeout = time.Minute
+
+// serialLoginWait is how long to wait for a login prompt before assuming
+// the console is logged in already.
+const serialLoginWait = 10 * time.Second
+
+// serialDiagnostics are run by SaveSerialDiagnostics to show the state
+// of the network.
+var serialDiagnostics = []string{
+	"networkctl list --no-pager",
+	"networkctl status --no-pager",
+	"ip address",
+	"ip route",
+	"cat /etc/resolv.conf",
+	"systemctl --no-pager --failed",
+	"sudo journalctl --no-pager -b -u systemd-networkd -u systemd-resolved -u sshd.socket",
+}
+
+// SaveSerialDiagnostics collects the state of the network of a machine
+// which can't be reached over SSH through its serial console, if it has
+// one, and saves it to serial-diagnostics.txt in dir.
+func SaveSerialDiagnostics(m Machine, dir string) error {
+	sm, ok := m.(SerialMachine)
+	if !ok {
+		return nil
+	}
+	f, err := os.Create(filepath.Join(dir, "serial-diagnostics.txt"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, cmd := range serialDiagnostics {
+		fmt.Fprintf(f, "$ %s\n", cmd)
+		out, err := sm.SerialExec(cmd)
+		f.Write(out)
+		if err != nil {
+			fmt.Fprintf(f, "%v\n", err)
+		}
+		// no output at all means the console itself failed
+		if out == nil {
+			break
+		}
+		fmt.Fprintln(f)
+	}
+	return f.Close()
+}
+
+// SerialConsole runs shell commands on a serial console, logging in as
+// core with a password, such as one set with conf.SetPasswordHash. The
+// console's output must be written to the SerialConsole.
+type SerialConsole struct {
+	in       io.Writer
+	password string
+
+	// execMu serializes commands; the fields below it are set up
+	// and used by the command running.
+	execMu   sync.Mutex
+	loggedIn bool
+	seq      int
+
+	// mu protects out, the output captured while a command runs.
+	mu        sync.Mutex
+	capturing bool
+	out       bytes.Buffer
+	notify    chan struct{}
+}
+
+// NewSerialConsole returns a SerialConsole which types into in.
+func NewSerialConsole(in io.Writer, password string) *SerialConsole {
+	return &SerialConsole{
+		in:       in,
+		password: password,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Write captures the console's output while a command runs.
+func (sc *SerialConsole) Write(p []byte) (int, error) {
+	sc.mu.Lock()
+	if sc.capturing {
+		sc.out.Write(bytes.Replace(p, []byte("\r"), nil, -1))
+	}
+	sc.mu.Unlock()
+	select {
+	case sc.notify <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// capture starts capturing output afresh.
+func (sc *SerialConsole) capture(on bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.capturing = on
+	sc.out.Reset()
+}
+
+// wait waits until the output captured matches, and returns it.
+func (sc *SerialConsole) wait(timeout time.Duration, what string, match func(out string) bool) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		sc.mu.Lock()
+		out := sc.out.String()
+		sc.mu.Unlock()
+		if match(out) {
+			return out, nil
+		}
+		select {
+		case <-sc.notify:
+		case <-timer.C:
+			return out, fmt.Errorf("timed out waiting for %s on the serial console", what)
+		}
+	}
+}
+
+// contains matches output containing any of the patterns.
+func contains(patterns ...string) func(string) bool {
+	return func(out string) bool {
+		for _, p := range patterns {
+			if strings.Contains(out, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (sc *SerialConsole) typeLine(line string) error {
+	_, err := io.WriteString(sc.in, line+"\n")
+	return err
+}
+
+// login logs in as core if the console shows a login prompt.
+func (sc *SerialConsole) login() error {
+	sc.capture(true)
+	if err := sc.typeLine(""); err != nil {
+		return err
+	}
+	if _, err := sc.wait(serialLoginWait, "a login prompt", contains("login: ")); err != nil {
+		return nil // already logged in, e.g. with coreos.autologin
+	}
+	if sc.password == "" {
+		return errors.New("serial console wants a login but there is no password")
+	}
+	sc.capture(true)
+	if err := sc.typeLine("core"); err != nil {
+		return err
+	}
+	if _, err := sc.wait(SerialTimeout, "a password prompt", contains("Password: ")); err != nil {
+		return err
+	}
+	sc.capture(true)
+	if err := sc.typeLine(sc.password); err != nil {
+		return err
+	}
+	out, err := sc.wait(SerialTimeout, "a shell prompt", contains("$ ", "Login incorrect"))
+	if err != nil {
+		return err
+	}
+	if strings.Contains(out, "Login incorrect") {
+		return errors.New("serial console login as core failed")
+	}
+	return nil
+}
+
+// Exec runs a shell command on the console and returns its output, which
+// is nil only if the console itself failed. The output is bracketed by
+// markers, which the echo of the typed command doesn't contain, the
+// second followed by the command's exit status.
+func (sc *SerialConsole) Exec(cmd string) ([]byte, error) {
+	sc.execMu.Lock()
+	defer sc.execMu.Unlock()
+	defer sc.capture(false)
+
+	if !sc.loggedIn {
+		if err := sc.login(); err != nil {
+			return nil, err
+		}
+		sc.loggedIn = true
+	}
+
+	sc.seq++
+	begin := fmt.Sprintf("KOLA-BEGIN-%d\n", sc.seq)
+	end := fmt.Sprintf("KOLA-END-%d ", sc.seq)
+	line := fmt.Sprintf("printf 'KOLA%%s\\n' -BEGIN-%d; %s; printf 'KOLA%%s %%d\\n' -END-%d $?",
+		sc.seq, cmd, sc.seq)
+	sc.capture(true)
+	if err := sc.typeLine(line); err != nil {
+		return nil, err
+	}
+	out, err := sc.wait(SerialTimeout, "the command to finish", func(out string) bool {
+		i := strings.Index(out, end)
+		return i >= 0 && strings.Contains(out[i:], "\n")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.Index(out, end)
+	status := out[i+len(end) : i+strings.IndexByte(out[i:], '\n')]
+	out = out[:i]
+	if j := strings.Index(out, begin); j >= 0 {
+		out = out[j+len(begin):]
+	}
+	if status != "0" {
+		return []byte(out), fmt.Errorf("%q on the serial console: exit status %s", cmd, status)
+	}
+	return []byte(out), nil
+}
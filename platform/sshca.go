@@ -0,0 +1,77 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/coreos/mantle/platform/conf"
+)
+
+// sshdConfig is Container Linux's default sshd configuration, which
+// machines get a copy of instead of the symlink to it, with sshd told
+// to trust certificates from the cluster's certificate authority.
+const sshdConfig = `# Use most defaults for sshd configuration.
+UsePrivilegeSeparation sandbox
+Subsystem sftp internal-sftp
+UseDNS no
+
+PermitRootLogin no
+AllowUsers core
+AuthenticationMethods publickey
+TrustedUserCAKeys /etc/ssh/trusted_user_ca_keys
+`
+
+// ConfigureSSH lets the cluster's SSH agent log in to a new machine. By
+// default the agent's keys are added to the machine's authorized keys.
+// With Options.SSHCertificates, sshd is instead told to trust the
+// agent's certificate authority, which issues the keys short-lived
+// certificates.
+func (bc *BaseCluster) ConfigureSSH(c *conf.Conf) error {
+	keys, err := bc.AuthorizedKeys()
+	if err != nil {
+		return err
+	}
+	c.CopyKeys(keys)
+	if bc.sshCA == nil {
+		return nil
+	}
+
+	files := []struct {
+		path, contents string
+	}{
+		{"/etc/ssh/trusted_user_ca_keys", string(ssh.MarshalAuthorizedKey(bc.sshCA))},
+		{"/etc/ssh/sshd_config", sshdConfig},
+	}
+	for _, f := range files {
+		if err := c.AddFile(f.path, f.contents, 0600); err != nil {
+			return fmt.Errorf("configuring SSH certificate authority: %v", err)
+		}
+	}
+	return nil
+}
+
+// AuthorizedKeys returns the keys new machines should authorize, such as
+// through platform metadata: the agent's keys, or none with
+// Options.SSHCertificates.
+func (bc *BaseCluster) AuthorizedKeys() ([]*agent.Key, error) {
+	if bc.sshCA != nil {
+		return nil, nil
+	}
+	return bc.Keys()
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provisioning milestones recorded in machine timelines.
+const (
+	EventRequested = "request-sent"
+	EventRunning   = "instance-running"
+	EventIP        = "ip-assigned"
+	EventSSH       = "ssh-up"
+	EventIgnition  = "ignition-complete"
+)
+
+// TimelineFile is the name of the timeline written to each machine's
+// output directory.
+const TimelineFile = "timeline.json"
+
+// TimelineEvent is a provisioning milestone. Elapsed is measured from the
+// first event of the timeline.
+type TimelineEvent struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Elapsed float64   `json:"elapsed_seconds"`
+}
+
+// Timeline records when a machine reached each provisioning milestone.
+type Timeline struct {
+	mu     sync.Mutex
+	start  time.Time
+	events []TimelineEvent
+}
+
+// NewTimeline starts a timeline with the EventRequested milestone.
+func NewTimeline() *Timeline {
+	t := &Timeline{}
+	t.Record(EventRequested)
+	return t
+}
+
+// Record adds a milestone that happened now.
+func (t *Timeline) Record(event string) {
+	t.RecordAt(event, time.Now())
+}
+
+// RecordAt adds a milestone that happened at the given time.
+func (t *Timeline) RecordAt(event string, when time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.start.IsZero() {
+		t.start = when
+	}
+	t.events = append(t.events, TimelineEvent{
+		Event:   event,
+		Time:    when.UTC(),
+		Elapsed: when.Sub(t.start).Seconds(),
+	})
+}
+
+// RecordIgnition adds the EventIgnition milestone using the time of the
+// last message Ignition logged, if Ignition ran on the machine. The time
+// comes from the guest clock.
+func (t *Timeline) RecordIgnition(m Machine) {
+	out, err := m.SSH("journalctl -b -t ignition -o short-unix -n 1 --no-pager -q")
+	if err != nil || len(out) == 0 {
+		return
+	}
+	fields := strings.Fields(string(out))
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return
+	}
+	sec, frac := math.Modf(secs)
+	t.RecordAt(EventIgnition, time.Unix(int64(sec), int64(frac*1e9)))
+}
+
+// WriteFile saves the timeline as JSON in the directory dir.
+func (t *Timeline) WriteFile(dir string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, err := json.MarshalIndent(t.events, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, TimelineFile), data, 0666)
+}
+
+// TimelineSummary gives percentiles of the time taken to reach a
+// milestone across many machines.
+type TimelineSummary struct {
+	Event    string  `json:"event"`
+	Machines int     `json:"machines"`
+	P50      float64 `json:"p50_seconds"`
+	P90      float64 `json:"p90_seconds"`
+	P99      float64 `json:"p99_seconds"`
+	Max      float64 `json:"max_seconds"`
+}
+
+// SummarizeTimelines aggregates every timeline written under dir.
+func SummarizeTimelines(dir string) ([]TimelineSummary, error) {
+	elapsed := make(map[string][]float64)
+	var order []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != TimelineFile {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var events []TimelineEvent
+		if err := json.Unmarshal(data, &events); err != nil {
+			return err
+		}
+		for _, e := range events {
+			if _, ok := elapsed[e.Event]; !ok {
+				order = append(order, e.Event)
+			}
+			elapsed[e.Event] = append(elapsed[e.Event], e.Elapsed)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []TimelineSummary
+	for _, event := range order {
+		values := elapsed[event]
+		sort.Float64s(values)
+		summaries = append(summaries, TimelineSummary{
+			Event:    event,
+			Machines: len(values),
+			P50:      percentile(values, 50),
+			P90:      percentile(values, 90),
+			P99:      percentile(values, 99),
+			Max:      values[len(values)-1],
+		})
+	}
+	return summaries, nil
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
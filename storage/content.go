@@ -0,0 +1,104 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/storage/v1"
+)
+
+// ContentManifestName is the name of the manifest written in place of
+// the objects of a directory whose contents are kept in a store.
+const ContentManifestName = "manifest.json"
+
+// A content store keeps objects under names derived from their
+// contents, so identical objects published in several places, such as
+// the same image in more than one channel, are stored only once and
+// can be checked against their names.
+
+// ContentName returns the name an object's contents are kept under in a
+// content store: "md5/" followed by the hex MD5 digest computed by GCS.
+// Composite objects have no MD5 digest.
+func ContentName(obj *storage.Object) (string, error) {
+	sum, err := base64.StdEncoding.DecodeString(obj.Md5Hash)
+	if err != nil || len(sum) != 16 {
+		return "", fmt.Errorf("%s has no MD5 digest", obj.Name)
+	}
+	return "md5/" + hex.EncodeToString(sum), nil
+}
+
+// ContentManifest maps the names of objects, relative to the directory
+// they were published to, to their contents in a store.
+type ContentManifest struct {
+	Store   string                  // URL of the store
+	Objects map[string]ContentEntry // by name
+}
+
+// ContentEntry describes an object listed in a ContentManifest.
+type ContentEntry struct {
+	Content string // name in the store, relative to Store
+	Size    uint64
+	Crc32c  string
+}
+
+// StoreContent copies the objects in src starting with prefix into the
+// store, skipping those whose contents are already there, and returns
+// a manifest of them. The store must have been fetched.
+func StoreContent(ctx context.Context, src *Bucket, prefix string, store *Bucket) (*ContentManifest, error) {
+	m := &ContentManifest{
+		Store:   store.URL().String(),
+		Objects: make(map[string]ContentEntry),
+	}
+	for _, obj := range src.Objects() {
+		if !strings.HasPrefix(obj.Name, prefix) {
+			continue
+		}
+		name, err := ContentName(obj)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Copy(ctx, obj, store.Prefix()+name); err != nil {
+			return nil, err
+		}
+		m.Objects[strings.TrimPrefix(obj.Name, prefix)] = ContentEntry{
+			Content: name,
+			Size:    obj.Size,
+			Crc32c:  obj.Crc32c,
+		}
+	}
+	return m, nil
+}
+
+// AuditContent returns a description of each object in the store whose
+// contents don't match its name. The store must have been fetched.
+func AuditContent(store *Bucket) []string {
+	objs := store.Objects()
+	SortObjects(objs)
+	var problems []string
+	for _, obj := range objs {
+		name := strings.TrimPrefix(obj.Name, store.Prefix())
+		if want, err := ContentName(obj); err != nil {
+			problems = append(problems, err.Error())
+		} else if name != want {
+			problems = append(problems, fmt.Sprintf("%s has the contents of %s", obj.Name, want))
+		}
+	}
+	return problems
+}
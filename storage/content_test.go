@@ -0,0 +1,104 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/storage/v1"
+)
+
+const (
+	// MD5 digests of "foo" and "bar"
+	fooMd5 = "rL0Y20zC+Fzt72VPzMSk2A=="
+	barMd5 = "N7UdGUp1E+RbVvZSTy1R8g=="
+)
+
+func TestContentName(t *testing.T) {
+	name, err := ContentName(&storage.Object{Name: "foo", Md5Hash: fooMd5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "md5/acbd18db4cc2f85cedef654fccc4a4d8" {
+		t.Errorf("got %q", name)
+	}
+
+	if _, err := ContentName(&storage.Object{Name: "composite"}); err == nil {
+		t.Errorf("no error for an object without a digest")
+	}
+}
+
+func TestStoreContent(t *testing.T) {
+	src, err := FakeBucket("gs://bucket/release/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []*storage.Object{
+		{Name: "release/a", Md5Hash: fooMd5, Size: 3, Crc32c: "a"},
+		{Name: "release/dir/b", Md5Hash: barMd5, Size: 3, Crc32c: "b"},
+		{Name: "release/dir/c", Md5Hash: fooMd5, Size: 3, Crc32c: "a"},
+		{Name: "other/d", Md5Hash: barMd5, Size: 3, Crc32c: "b"},
+	} {
+		obj.Bucket = "bucket"
+		src.AddObject(obj)
+	}
+
+	store, err := FakeBucket("gs://store/cas/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.WriteDryRun(true)
+
+	m, err := StoreContent(context.Background(), src, "release/", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ContentManifest{
+		Store: "gs://store/cas/",
+		Objects: map[string]ContentEntry{
+			"a":     {"md5/acbd18db4cc2f85cedef654fccc4a4d8", 3, "a"},
+			"dir/b": {"md5/37b51d194a7513e45b56f6524f2d51f2", 3, "b"},
+			"dir/c": {"md5/acbd18db4cc2f85cedef654fccc4a4d8", 3, "a"},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got manifest %+v, want %+v", m, want)
+	}
+}
+
+func TestAuditContent(t *testing.T) {
+	store, err := FakeBucket("gs://store/cas/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []*storage.Object{
+		{Name: "cas/md5/acbd18db4cc2f85cedef654fccc4a4d8", Md5Hash: fooMd5},
+		{Name: "cas/md5/acbd18db4cc2f85cedef654fccc4a4d8x", Md5Hash: barMd5},
+		{Name: "cas/composite"},
+	} {
+		obj.Bucket = "store"
+		store.AddObject(obj)
+	}
+
+	want := []string{
+		"cas/composite has no MD5 digest",
+		"cas/md5/acbd18db4cc2f85cedef654fccc4a4d8x has the contents of md5/37b51d194a7513e45b56f6524f2d51f2",
+	}
+	if got := AuditContent(store); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
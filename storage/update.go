@@ -0,0 +1,144 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/storage/v1"
+)
+
+// updateRetries limits how many times Update retries after losing a race
+// with another writer.
+const updateRetries = 5
+
+// UpdateFunc computes the new contents of an object from its current
+// contents, which are nil if the object does not exist.
+type UpdateFunc func(data []byte) ([]byte, error)
+
+// updateFuncError marks an error returned by an UpdateFunc, which Update
+// returns as is.
+type updateFuncError struct {
+	err error
+}
+
+func (e updateFuncError) Error() string {
+	return e.err.Error()
+}
+
+// Update atomically replaces an object with the result of fn. The object
+// is only written if it has not changed since it was read, otherwise the
+// read-modify-write is repeated with the new contents. Errors from fn
+// are returned unchanged.
+func (b *Bucket) Update(ctx context.Context, objName, contentType string, fn UpdateFunc) error {
+	for i := 0; ; i++ {
+		err := b.update(ctx, objName, contentType, fn)
+		if e, ok := err.(updateFuncError); ok {
+			return e.err
+		} else if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusPreconditionFailed && i < updateRetries {
+			plog.Noticef("Conflicting update to %s, retrying", b.mkURL(objName))
+			continue
+		} else if err != nil {
+			return b.apiErr("storage.objects.insert", objName, err)
+		}
+		return nil
+	}
+}
+
+// Download returns the contents of an object, or nil if it does not
+// exist.
+func (b *Bucket) Download(ctx context.Context, objName string) ([]byte, error) {
+	_, data, err := b.read(ctx, objName)
+	if err != nil {
+		return nil, b.apiErr("storage.objects.get", objName, err)
+	}
+	return data, nil
+}
+
+// read returns the metadata and contents of an object, or nil for both
+// if it does not exist.
+func (b *Bucket) read(ctx context.Context, objName string) (*storage.Object, []byte, error) {
+	obj, err := b.service.Objects.Get(b.name, objName).Context(ctx).Do()
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusNotFound {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	resp, err := b.service.Objects.Get(b.name, objName).Generation(obj.Generation).Context(ctx).Download()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return obj, data, nil
+}
+
+func (b *Bucket) update(ctx context.Context, objName, contentType string, fn UpdateFunc) error {
+	old, data, err := b.read(ctx, objName)
+	if err != nil {
+		return err
+	}
+	var generation int64 // zero requires that the object doesn't exist
+	if old != nil {
+		generation = old.Generation
+	}
+
+	data, err = fn(data)
+	if err != nil {
+		return updateFuncError{err}
+	}
+
+	obj := &storage.Object{
+		Name:        objName,
+		ContentType: contentType,
+	}
+	if old != nil {
+		obj.CacheControl = old.CacheControl
+	}
+	if err := crcSum(obj, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	if b.writeDryRun {
+		plog.Noticef("Would write %s", b.mkURL(obj))
+		return nil
+	}
+
+	req := b.service.Objects.Insert(b.name, obj)
+	req.Media(bytes.NewReader(data), googleapi.ContentType(contentType))
+	req.IfGenerationMatch(generation)
+	req.Context(ctx)
+
+	plog.Noticef("Writing %s (generation %d)", b.mkURL(obj), generation)
+
+	inserted, err := req.Do()
+	if err != nil {
+		return err
+	}
+	if inserted.Crc32c != obj.Crc32c {
+		return fmt.Errorf("checksum mismatch: wrote %s, stored %s", obj.Crc32c, inserted.Crc32c)
+	}
+
+	b.addObject(inserted)
+	return nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/storage/v1"
+)
+
+// fakeGCS serves the parts of the Cloud Storage JSON API Update uses for
+// a single bucket, keeping objects in memory.
+type fakeGCS struct {
+	mu          sync.Mutex
+	objects     map[string]*storage.Object
+	data        map[string][]byte
+	writes      int
+	beforeWrite func() // called once before the next write, to race it
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{
+		objects: make(map[string]*storage.Object),
+		data:    make(map[string][]byte),
+	}
+}
+
+func (f *fakeGCS) put(name string, data []byte) {
+	gen := int64(1)
+	if old, ok := f.objects[name]; ok {
+		gen = old.Generation + 1
+	}
+	obj := &storage.Object{Bucket: "bucket", Name: name, Generation: gen}
+	crcSum(obj, strings.NewReader(string(data)))
+	f.objects[name] = obj
+	f.data[name] = data
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	const (
+		getPath    = "/storage/v1/b/bucket/o/"
+		insertPath = "/upload/storage/v1/b/bucket/o"
+	)
+	switch {
+	case req.Method == "GET" && strings.HasPrefix(req.URL.Path, getPath):
+		name := strings.TrimPrefix(req.URL.Path, getPath)
+		f.mu.Lock()
+		obj, ok := f.objects[name]
+		data := f.data[name]
+		f.mu.Unlock()
+		if !ok {
+			http.Error(w, `{"error": {"code": 404, "message": "Not Found"}}`, http.StatusNotFound)
+		} else if req.URL.Query().Get("alt") == "media" {
+			w.Write(data)
+		} else {
+			json.NewEncoder(w).Encode(obj)
+		}
+	case req.Method == "POST" && req.URL.Path == insertPath:
+		f.insert(w, req)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeGCS) insert(w http.ResponseWriter, req *http.Request) {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mr := multipart.NewReader(req.Body, params["boundary"])
+	var obj storage.Object
+	part, err := mr.NextPart()
+	if err == nil {
+		err = json.NewDecoder(part).Decode(&obj)
+	}
+	var data []byte
+	if err == nil {
+		part, err = mr.NextPart()
+	}
+	if err == nil {
+		data, err = ioutil.ReadAll(part)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.beforeWrite != nil {
+		f.beforeWrite()
+		f.beforeWrite = nil
+	}
+	var gen int64
+	if old, ok := f.objects[obj.Name]; ok {
+		gen = old.Generation
+	}
+	if want := req.URL.Query().Get("ifGenerationMatch"); want != strconv.FormatInt(gen, 10) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		fmt.Fprint(w, `{"error": {"code": 412, "message": "Precondition Failed"}}`)
+		return
+	}
+	f.writes++
+	f.put(obj.Name, data)
+	json.NewEncoder(w).Encode(f.objects[obj.Name])
+}
+
+// redirectTransport sends every request to a test server.
+type redirectTransport struct {
+	host string
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = t.host
+	req.URL = &u
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func fakeGCSBucket(t *testing.T) (*Bucket, *fakeGCS, func()) {
+	f := newFakeGCS()
+	srv := httptest.NewServer(f)
+	srvURL, _ := url.Parse(srv.URL)
+	b, err := NewBucket(&http.Client{Transport: redirectTransport{srvURL.Host}}, "gs://bucket/")
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return b, f, srv.Close
+}
+
+func TestUpdate(t *testing.T) {
+	b, f, done := fakeGCSBucket(t)
+	defer done()
+	ctx := context.Background()
+
+	// creates a missing object
+	err := b.Update(ctx, "counter", "text/plain", func(data []byte) ([]byte, error) {
+		if data != nil {
+			t.Errorf("got %q for a missing object", data)
+		}
+		return []byte("1"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a concurrent write makes the first attempt fail and the second
+	// see the new contents
+	f.beforeWrite = func() { f.put("counter", []byte("5")) }
+	var seen []string
+	err = b.Update(ctx, "counter", "text/plain", func(data []byte) ([]byte, error) {
+		seen = append(seen, string(data))
+		n, err := strconv.Atoi(string(data))
+		return []byte(strconv.Itoa(n + 1)), err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(seen, ",") != "1,5" {
+		t.Errorf("update saw %v, want [1 5]", seen)
+	}
+	got, err := b.Download(ctx, "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "6" {
+		t.Errorf("got %q, want 6", got)
+	}
+
+	// errors from the function are returned as is, writing nothing
+	writes := f.writes
+	errBad := errors.New("bad edit")
+	err = b.Update(ctx, "counter", "text/plain", func(data []byte) ([]byte, error) {
+		return nil, errBad
+	})
+	if err != errBad {
+		t.Errorf("got error %v, want %v", err, errBad)
+	}
+	if f.writes != writes {
+		t.Errorf("failed update wrote the object")
+	}
+
+	if data, err := b.Download(ctx, "missing"); data != nil || err != nil {
+		t.Errorf("Download of a missing object got %q, %v", data, err)
+	}
+}
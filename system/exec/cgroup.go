@@ -0,0 +1,28 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+)
+
+// JoinCgroup moves a started process into the cgroup v2 directory. Any
+// children the process forks afterwards are placed in the same cgroup.
+func JoinCgroup(cgroup string, pid int) error {
+	procs := filepath.Join(cgroup, "cgroup.procs")
+	return ioutil.WriteFile(procs, []byte(strconv.Itoa(pid)), 0644)
+}
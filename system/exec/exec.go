@@ -48,7 +48,18 @@ type Cmd interface {
 // Basic Cmd implementation based on exec.Cmd
 type ExecCmd struct {
 	*exec.Cmd
+	ctx    context.Context
 	cancel context.CancelFunc
+
+	// Limiter, if set, bounds how many commands sharing it may run
+	// at once. Start waits for a free slot, or fails once the
+	// command's context is done.
+	Limiter *Limiter
+	release func()
+
+	// Group, if set, is killed along with the command's process
+	// tree once whoever started it is done with them.
+	Group *Group
 }
 
 func Command(name string, arg ...string) *ExecCmd {
@@ -59,10 +70,75 @@ func CommandContext(ctx context.Context, name string, arg ...string) *ExecCmd {
 	ctx, cancel := context.WithCancel(ctx)
 	return &ExecCmd{
 		Cmd:    exec.CommandContext(ctx, name, arg...),
+		ctx:    ctx,
 		cancel: cancel,
 	}
 }
 
+func (cmd *ExecCmd) Start() error {
+	release, err := cmd.Limiter.AcquireContext(cmd.ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Group.setpgid(cmd)
+	if err := cmd.Cmd.Start(); err != nil {
+		release()
+		return err
+	}
+	cmd.Group.add(cmd.Process.Pid)
+	cmd.release = release
+	return nil
+}
+
+func (cmd *ExecCmd) Wait() error {
+	err := cmd.Cmd.Wait()
+	if cmd.ProcessState != nil {
+		cmd.Group.waited(cmd.Process.Pid)
+	}
+	if cmd.release != nil {
+		cmd.release()
+	}
+	return err
+}
+
+func (cmd *ExecCmd) Run() error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+func (cmd *ExecCmd) Output() ([]byte, error) {
+	release, err := cmd.Limiter.AcquireContext(cmd.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	cmd.Group.setpgid(cmd)
+	defer cmd.addToGroup()
+	return cmd.Cmd.Output()
+}
+
+func (cmd *ExecCmd) CombinedOutput() ([]byte, error) {
+	release, err := cmd.Limiter.AcquireContext(cmd.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	cmd.Group.setpgid(cmd)
+	defer cmd.addToGroup()
+	return cmd.Cmd.CombinedOutput()
+}
+
+// addToGroup records the process group of a command which has already
+// exited, in case it left children behind.
+func (cmd *ExecCmd) addToGroup() {
+	if cmd.Process != nil {
+		cmd.Group.add(cmd.Process.Pid)
+		cmd.Group.waited(cmd.Process.Pid)
+	}
+}
+
 func (cmd *ExecCmd) Kill() error {
 	cmd.cancel()
 	err := cmd.Wait()
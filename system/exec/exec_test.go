@@ -16,9 +16,13 @@ package exec
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os/exec"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
 )
 
 func TestExecCmdKill(t *testing.T) {
@@ -60,3 +64,115 @@ func TestExecCmdCancel(t *testing.T) {
 		t.Errorf("Unexpected error: %v", err)
 	}
 }
+
+func TestExecCmdLimiter(t *testing.T) {
+	l := NewLimiter(1)
+	first := Command("sleep", "3600")
+	first.Limiter = l
+	if err := first.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	second := Command("true")
+	second.Limiter = l
+	done := make(chan error)
+	go func() { done <- second.Run() }()
+
+	select {
+	case <-done:
+		t.Fatalf("second command ran while the first held the only slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := first.Kill(); err != nil {
+		t.Errorf("Kill failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run failed: %v", err)
+	}
+
+	stats := l.Stats()
+	if stats.PeakRunning != 1 || stats.Queued != 1 || stats.Waited <= 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestExecCmdGroup(t *testing.T) {
+	g := NewGroup()
+	cmd := Command("sh", "-c", "sleep 3600 & echo $!; wait")
+	cmd.Group = g
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe failed: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	var child int
+	if _, err := fmt.Fscan(stdout, &child); err != nil {
+		t.Fatalf("reading child pid: %v", err)
+	}
+
+	if n := g.Kill(); n != 1 {
+		t.Errorf("Kill found %d process groups; want 1", n)
+	}
+	cmd.Wait()
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if status.Signal() != syscall.SIGKILL {
+		t.Errorf("Unexpected state: %s", cmd.ProcessState)
+	}
+
+	// the orphaned child is gone, or a zombie waiting to be reaped
+	for i := 0; ; i++ {
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", child))
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("child %d still running: %s", child, stat)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if n := g.Kill(); n != 0 {
+		t.Errorf("second Kill found %d process groups; want 0", n)
+	}
+}
+
+func TestGroupForgetsEmpty(t *testing.T) {
+	g := NewGroup()
+	cmd := Command("true")
+	cmd.Group = g
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	out := Command("true")
+	out.Group = g
+	if _, err := out.Output(); err != nil {
+		t.Fatalf("Output failed: %v", err)
+	}
+	if len(g.pgids) != 0 {
+		t.Errorf("Group still has exited process groups %v", g.pgids)
+	}
+}
+
+func TestGroupReusedID(t *testing.T) {
+	// Stand in for a process, outside the Group, which was given the
+	// ID of a group the Group waited for the leader of.
+	other := Command("sleep", "3600")
+	other.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := other.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer other.Kill()
+
+	g := NewGroup()
+	g.add(other.Process.Pid)
+	g.waited(other.Process.Pid)
+	if n := g.Kill(); n != 0 {
+		t.Errorf("Kill found %d process groups; want 0", n)
+	}
+	if err := syscall.Kill(other.Process.Pid, 0); err != nil {
+		t.Errorf("Kill killed a process group it didn't own: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"sync"
+	"syscall"
+)
+
+// Group kills the process trees of the commands started with it once
+// they are no longer needed, so helpers which were never stopped, and
+// any children they forked, don't linger. Commands with a Group are
+// started in a process group of their own, which keeps them from
+// receiving signals sent to the caller's, such as from the terminal,
+// so they are instead killed if the caller exits. A nil *Group does
+// nothing.
+//
+// Once a group's leader has been waited for, its ID may be reused as
+// soon as the group is empty, so the Group forgets empty groups and
+// doesn't kill one whose ID has been taken by a new process.
+type Group struct {
+	mu    sync.Mutex
+	pgids map[int]bool // whether the leader has been waited for
+}
+
+// NewGroup returns an empty Group.
+func NewGroup() *Group {
+	return &Group{}
+}
+
+// setpgid has cmd start in a process group of its own, and be killed
+// if the caller exits.
+func (g *Group) setpgid(cmd *ExecCmd) {
+	if g == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+}
+
+// add records the process group led by a started command.
+func (g *Group) add(pid int) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pgids == nil {
+		g.pgids = make(map[int]bool)
+	}
+	g.pgids[pid] = false
+}
+
+// waited notes that the leader of the process group pid has been waited
+// for, forgetting the group if nothing is left in it.
+func (g *Group) waited(pid int) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.pgids[pid]; !ok {
+		return
+	}
+	if syscall.Kill(-pid, 0) == syscall.ESRCH {
+		delete(g.pgids, pid)
+	} else {
+		g.pgids[pid] = true
+	}
+}
+
+// Kill sends SIGKILL to every process group started in the Group which
+// may still have processes in it and forgets them, returning how many
+// did.
+func (g *Group) Kill() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	pgids := g.pgids
+	g.pgids = nil
+	g.mu.Unlock()
+
+	var killed int
+	for pgid, waited := range pgids {
+		// An ID can't be reused while a group has it, so if a
+		// process has the ID of a leader which was waited for,
+		// the group is gone and the ID isn't ours any more.
+		if waited && syscall.Kill(pgid, 0) != syscall.ESRCH {
+			continue
+		}
+		if err := syscall.Kill(-pgid, syscall.SIGKILL); err == nil {
+			killed++
+		}
+	}
+	return killed
+}
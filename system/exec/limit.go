@@ -0,0 +1,252 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limiter bounds the number of commands running at once. Commands with a
+// Limiter wait in Start for a running command to exit once the limit is
+// reached, or until their context is done. A nil *Limiter imposes no
+// limit.
+//
+// A user which needs several commands running at once to make progress,
+// such as a test booting a cluster of machines, should Reserve the slots
+// for all of them up front. Two such users each holding some slots while
+// waiting for more would otherwise wait for each other forever.
+//
+// Waiters are served in order, so a large reservation can't be kept
+// waiting by commands taking one slot at a time. Commands beyond a
+// reservation go first, since the slots they hold may be the ones the
+// waiters ahead of them need.
+type Limiter struct {
+	// For a Limiter returned by Reserve, parent is where its slots
+	// came from and where commands beyond them take a slot, waiting
+	// until ctx is done at the latest.
+	parent    *Limiter
+	ctx       context.Context
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	stats   LimiterStats
+	running int            // slots in use
+	waiting []*limitWaiter // in the order they are served
+}
+
+// limitWaiter is a user waiting for n slots of a Limiter.
+type limitWaiter struct {
+	n     int
+	ready chan struct{} // closed once the slots are taken for it
+}
+
+// LimiterStats reports how much a Limiter has queued commands.
+type LimiterStats struct {
+	Limit       int           // Maximum commands running at once.
+	PeakRunning int           // Most commands seen running at once, including reserved slots.
+	Queued      int           // Commands that had to wait to start.
+	PeakQueued  int           // Most commands seen waiting at once.
+	Waited      time.Duration // Total time commands spent waiting.
+
+	queued int
+}
+
+// NewLimiter returns a Limiter allowing n commands to run at once.
+func NewLimiter(n int) *Limiter {
+	return &Limiter{
+		stats: LimiterStats{Limit: n},
+	}
+}
+
+// Acquire waits until fewer than the limit of commands are running and
+// returns a function that must be called once the command has exited.
+func (l *Limiter) Acquire() (release func()) {
+	release, _ = l.AcquireContext(context.Background())
+	return release
+}
+
+// AcquireContext is like Acquire but gives up once ctx is done,
+// returning its error.
+func (l *Limiter) AcquireContext(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if l.parent != nil {
+		if l.tryTake() {
+			return onceFunc(func() { l.put(1) }), nil
+		}
+		// all reserved slots are in use, share the rest
+		if err := l.parent.take(ctx, l.ctx.Done(), 1, true); err != nil {
+			return nil, err
+		}
+		return onceFunc(func() { l.parent.put(1) }), nil
+	}
+
+	if err := l.take(ctx, nil, 1, false); err != nil {
+		return nil, err
+	}
+	return onceFunc(func() { l.put(1) }), nil
+}
+
+// Reserve waits until n slots are free at once and sets them aside for
+// the commands of a single user, returning a Limiter for them. Commands
+// beyond the n reserved take a slot as usual, waiting no longer than
+// ctx. Close returns the slots.
+func (l *Limiter) Reserve(ctx context.Context, n int) (*Limiter, error) {
+	if l == nil {
+		return nil, nil
+	}
+	if l.parent != nil {
+		return nil, fmt.Errorf("exec: can't reserve slots from a reservation")
+	}
+	if n > l.stats.Limit {
+		return nil, fmt.Errorf("exec: can't reserve %d slots of a limit of %d", n, l.stats.Limit)
+	}
+	if err := l.take(ctx, nil, n, false); err != nil {
+		return nil, err
+	}
+	r := NewLimiter(n)
+	r.parent = l
+	r.ctx = ctx
+	return r, nil
+}
+
+// Close returns the slots of a Limiter returned by Reserve, once its
+// commands have exited.
+func (l *Limiter) Close() {
+	if l == nil || l.parent == nil {
+		return
+	}
+	l.closeOnce.Do(func() {
+		l.parent.put(l.stats.Limit)
+	})
+}
+
+// tryTake takes a slot if one is free.
+func (l *Limiter) tryTake() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running >= l.stats.Limit {
+		return false
+	}
+	l.took(1)
+	return true
+}
+
+// take waits its turn for n slots to be free at once, so waiting never
+// holds some of them, until ctx or done is done. With first, it goes
+// ahead of the other waiters.
+func (l *Limiter) take(ctx context.Context, done <-chan struct{}, n int, first bool) error {
+	l.mu.Lock()
+	if (first || len(l.waiting) == 0) && l.running+n <= l.stats.Limit {
+		l.took(n)
+		l.mu.Unlock()
+		return nil
+	}
+
+	w := &limitWaiter{n: n, ready: make(chan struct{})}
+	if first {
+		l.waiting = append([]*limitWaiter{w}, l.waiting...)
+	} else {
+		l.waiting = append(l.waiting, w)
+	}
+	start := time.Now()
+	l.stats.Queued++
+	l.stats.queued++
+	if l.stats.queued > l.stats.PeakQueued {
+		l.stats.PeakQueued = l.stats.queued
+	}
+	l.mu.Unlock()
+
+	var err error
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-done:
+		err = context.Canceled
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.queued--
+	l.stats.Waited += time.Since(start)
+	if err != nil {
+		select {
+		case <-w.ready:
+			// the slots were taken for it as it gave up
+			l.running -= n
+		default:
+			l.remove(w)
+		}
+		// the waiters behind it may fit now
+		l.serve()
+	}
+	return err
+}
+
+// serve takes slots for the waiters in order until the first which
+// doesn't fit. l.mu must be held.
+func (l *Limiter) serve() {
+	for len(l.waiting) > 0 && l.running+l.waiting[0].n <= l.stats.Limit {
+		w := l.waiting[0]
+		l.waiting = l.waiting[1:]
+		l.took(w.n)
+		close(w.ready)
+	}
+}
+
+// remove drops w from the waiters. l.mu must be held.
+func (l *Limiter) remove(w *limitWaiter) {
+	for i, v := range l.waiting {
+		if v == w {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// took records n slots taken. l.mu must be held.
+func (l *Limiter) took(n int) {
+	l.running += n
+	if l.running > l.stats.PeakRunning {
+		l.stats.PeakRunning = l.running
+	}
+}
+
+// put frees n slots.
+func (l *Limiter) put(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running -= n
+	l.serve()
+}
+
+// onceFunc returns a function calling f the first time it is called.
+func onceFunc(f func()) func() {
+	var once sync.Once
+	return func() { once.Do(f) }
+}
+
+// Stats returns the Limiter's statistics so far.
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
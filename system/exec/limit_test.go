@@ -0,0 +1,223 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAcquireContext(t *testing.T) {
+	l := NewLimiter(1)
+	release := l.Acquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.AcquireContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+
+	cmd := CommandContext(ctx, "true")
+	cmd.Limiter = l
+	if err := cmd.Run(); err != context.DeadlineExceeded {
+		t.Errorf("Run got %v, want DeadlineExceeded", err)
+	}
+
+	release()
+	release, err := l.AcquireContext(context.Background())
+	if err != nil {
+		t.Fatalf("AcquireContext after release: %v", err)
+	}
+	release()
+	if stats := l.Stats(); stats.Queued != 2 || stats.PeakRunning != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// Two users each needing 3 of 4 slots would deadlock taking them one at
+// a time; reserving them all at once lets one finish before the other
+// starts.
+func TestLimiterReserve(t *testing.T) {
+	l := NewLimiter(4)
+	ctx := context.Background()
+
+	first, err := l.Reserve(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved := make(chan *Limiter)
+	go func() {
+		second, err := l.Reserve(ctx, 3)
+		if err != nil {
+			t.Error(err)
+		}
+		reserved <- second
+	}()
+
+	var releases []func()
+	for i := 0; i < 3; i++ {
+		release, err := first.AcquireContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+	select {
+	case <-reserved:
+		t.Fatalf("second reservation made while the first held its slots")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a fourth command shares the slot left over
+	release, err := first.AcquireContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases = append(releases, release)
+	for _, release := range releases {
+		release()
+	}
+	first.Close()
+	first.Close() // no effect
+
+	second := <-reserved
+	second.Close()
+	if stats := l.Stats(); l.running != 0 || stats.PeakRunning != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLimiterReserveContext(t *testing.T) {
+	l := NewLimiter(2)
+	if _, err := l.Reserve(context.Background(), 3); err == nil {
+		t.Errorf("reserved more slots than the limit")
+	}
+
+	release := l.Acquire()
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.Reserve(ctx, 2); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+	// the slot taken before giving up was returned
+	if r, err := l.Reserve(context.Background(), 1); err != nil {
+		t.Errorf("Reserve after giving up: %v", err)
+	} else {
+		r.Close()
+	}
+
+	var nilLimiter *Limiter
+	r, err := nilLimiter.Reserve(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := r.AcquireContext(ctx); err != nil {
+		t.Errorf("nil reservation: %v", err)
+	}
+}
+
+// waitQueued waits for n users to be waiting on l.
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	for i := 0; ; i++ {
+		l.mu.Lock()
+		queued := len(l.waiting)
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if i == 500 {
+			t.Fatalf("%d users waiting, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// A reservation waiting for slots keeps later commands from taking them
+// one at a time as they are freed.
+func TestLimiterOrder(t *testing.T) {
+	l := NewLimiter(2)
+	ctx := context.Background()
+	release1 := l.Acquire()
+	release2 := l.Acquire()
+
+	reserved := make(chan *Limiter)
+	go func() {
+		r, err := l.Reserve(ctx, 2)
+		if err != nil {
+			t.Error(err)
+		}
+		reserved <- r
+	}()
+	waitQueued(t, l, 1)
+	acquired := make(chan func())
+	go func() {
+		acquired <- l.Acquire()
+	}()
+	waitQueued(t, l, 2)
+
+	release1()
+	select {
+	case <-acquired:
+		t.Fatalf("command went ahead of the reservation")
+	case <-reserved:
+		t.Fatalf("reservation made with one slot free")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release2()
+	r := <-reserved
+	select {
+	case <-acquired:
+		t.Fatalf("command ran while the reservation held every slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	r.Close()
+	(<-acquired)()
+	if l.running != 0 {
+		t.Errorf("%d slots still in use", l.running)
+	}
+}
+
+// A waiter which gives up lets those behind it go.
+func TestLimiterOrderGiveUp(t *testing.T) {
+	l := NewLimiter(2)
+	release := l.Acquire()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	gaveUp := make(chan error)
+	go func() {
+		_, err := l.Reserve(ctx, 2)
+		gaveUp <- err
+	}()
+	waitQueued(t, l, 1)
+	acquired := make(chan func())
+	go func() {
+		acquired <- l.Acquire()
+	}()
+	waitQueued(t, l, 2)
+
+	cancel()
+	if err := <-gaveUp; err != context.Canceled {
+		t.Errorf("got %v, want Canceled", err)
+	}
+	(<-acquired)()
+	release()
+	if l.running != 0 || len(l.waiting) != 0 {
+		t.Errorf("%d slots in use and %d waiting", l.running, len(l.waiting))
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// HeadTailWriter caps the amount of data written to the underlying
+// io.WriteCloser. The first head bytes are written through immediately,
+// the last tail bytes are buffered and written on Close, and anything in
+// between is dropped and replaced with a note of how much was lost.
+//
+// The tail is buffered in memory, which grows as needed up to the tail
+// size, or in a file given to SpillTo.
+type HeadTailWriter struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	head    int64
+	tail    int64
+	written int64
+	dropped int64
+	ring    []byte   // tail kept in memory
+	spill   *os.File // tail kept in a file instead
+	pos     int64    // next write position in the tail
+	full    bool     // tail has wrapped
+}
+
+// NewHeadTailWriter wraps w. If head and tail are both zero no limit
+// is applied.
+func NewHeadTailWriter(w io.WriteCloser, head, tail int64) *HeadTailWriter {
+	return &HeadTailWriter{
+		w:    w,
+		head: head,
+		tail: tail,
+	}
+}
+
+// SpillTo keeps the tail in the empty file f instead of memory, so it
+// isn't lost if the process dies before Close, which removes f. It must
+// be called before anything is written.
+func (h *HeadTailWriter) SpillTo(f *os.File) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.spill = f
+}
+
+func (h *HeadTailWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := len(p)
+	if h.head == 0 && h.tail == 0 {
+		return h.w.Write(p)
+	}
+
+	if h.written < h.head {
+		room := h.head - h.written
+		if int64(len(p)) < room {
+			room = int64(len(p))
+		}
+		if _, err := h.w.Write(p[:room]); err != nil {
+			return 0, err
+		}
+		h.written += room
+		p = p[room:]
+	}
+
+	for len(p) > 0 {
+		if h.tail == 0 {
+			h.dropped += int64(len(p))
+			break
+		}
+		c := h.tail - h.pos
+		if c > int64(len(p)) {
+			c = int64(len(p))
+		}
+		if h.full {
+			// the oldest buffered bytes are about to be overwritten
+			h.dropped += c
+		}
+		if err := h.writeTail(p[:c]); err != nil {
+			return n - len(p), err
+		}
+		p = p[c:]
+		h.pos += c
+		if h.pos == h.tail {
+			h.pos = 0
+			h.full = true
+		}
+	}
+
+	return n, nil
+}
+
+// writeTail stores p at the current position in the tail.
+func (h *HeadTailWriter) writeTail(p []byte) error {
+	if h.spill != nil {
+		_, err := h.spill.WriteAt(p, h.pos)
+		return err
+	}
+	if h.full {
+		copy(h.ring[h.pos:], p)
+		return nil
+	}
+	// still filling, so pos is the end of the ring
+	if need := int64(len(h.ring) + len(p)); need > int64(cap(h.ring)) {
+		size := 2 * int64(cap(h.ring))
+		if size < need {
+			size = need
+		}
+		if size > h.tail {
+			size = h.tail
+		}
+		ring := make([]byte, len(h.ring), size)
+		copy(ring, h.ring)
+		h.ring = ring
+	}
+	h.ring = append(h.ring, p...)
+	return nil
+}
+
+// tailReader returns the buffered tail in order.
+func (h *HeadTailWriter) tailReader() io.Reader {
+	if h.spill != nil {
+		if !h.full {
+			return io.NewSectionReader(h.spill, 0, h.pos)
+		}
+		return io.MultiReader(
+			io.NewSectionReader(h.spill, h.pos, h.tail-h.pos),
+			io.NewSectionReader(h.spill, 0, h.pos))
+	}
+	if !h.full {
+		return bytes.NewReader(h.ring)
+	}
+	return io.MultiReader(bytes.NewReader(h.ring[h.pos:]), bytes.NewReader(h.ring[:h.pos]))
+}
+
+// Close writes out the buffered tail and closes the underlying writer.
+func (h *HeadTailWriter) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var err error
+	if h.dropped > 0 {
+		_, err = fmt.Fprintf(h.w, "\n[... %d bytes omitted ...]\n", h.dropped)
+	}
+	if err == nil {
+		_, err = io.Copy(h.w, h.tailReader())
+	}
+	if h.spill != nil {
+		h.spill.Close()
+		if err2 := os.Remove(h.spill.Name()); err == nil {
+			err = err2
+		}
+		h.spill = nil
+	}
+	h.ring = nil
+	h.pos = 0
+	h.full = false
+
+	if err2 := h.w.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
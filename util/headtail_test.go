@@ -0,0 +1,124 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestHeadTailWriter(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		head, tail int64
+		writes     []string
+		want       string
+	}{
+		{"unlimited", 0, 0, []string{"abc", "def"}, "abcdef"},
+		{"fits", 4, 4, []string{"abc", "def"}, "abcdef"},
+		{"head only", 3, 0, []string{"abcd", "efg"}, "abc\n[... 4 bytes omitted ...]\n"},
+		{"tail only", 0, 3, []string{"abcd", "efg"}, "\n[... 4 bytes omitted ...]\nefg"},
+		{"exact", 3, 3, []string{"abcdef"}, "abcdef"},
+		{"wrap around", 2, 4, []string{"ab", "cdefg", "hij"}, "ab\n[... 4 bytes omitted ...]\nghij"},
+		{"many small writes", 1, 3, strings.Split("abcdefghij", ""), "a\n[... 6 bytes omitted ...]\nhij"},
+		{"large write", 2, 2, []string{"abcdefghij"}, "ab\n[... 6 bytes omitted ...]\nij"},
+	} {
+		for _, spill := range []bool{false, true} {
+			var out closeBuffer
+			w := NewHeadTailWriter(&out, tc.head, tc.tail)
+			var spillName string
+			if spill {
+				f, err := ioutil.TempFile("", "headtail")
+				if err != nil {
+					t.Fatal(err)
+				}
+				spillName = f.Name()
+				defer os.Remove(spillName)
+				w.SpillTo(f)
+			}
+			for _, s := range tc.writes {
+				if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("%s: Write(%q) = %d, %v", tc.desc, s, n, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("%s: Close: %v", tc.desc, err)
+			}
+			if got := out.String(); got != tc.want {
+				t.Errorf("%s (spill %v): got %q, want %q", tc.desc, spill, got, tc.want)
+			}
+			if !out.closed {
+				t.Errorf("%s: underlying writer not closed", tc.desc)
+			}
+			if spill {
+				if _, err := os.Stat(spillName); !os.IsNotExist(err) {
+					t.Errorf("%s: spill file not removed: %v", tc.desc, err)
+				}
+			}
+		}
+	}
+}
+
+func TestHeadTailWriterGrowsLazily(t *testing.T) {
+	var out closeBuffer
+	w := NewHeadTailWriter(&out, 4, 1<<20)
+	w.Write([]byte("head and a little tail"))
+	if n := cap(w.ring); n > 1024 {
+		t.Errorf("buffered %d bytes for an 18 byte tail", n)
+	}
+	w.Write(bytes.Repeat([]byte("x"), 2<<20))
+	if n := cap(w.ring); n != 1<<20 {
+		t.Errorf("ring grew to %d bytes, want %d", n, 1<<20)
+	}
+}
+
+func TestHeadTailWriterSpill(t *testing.T) {
+	f, err := ioutil.TempFile("", "headtail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	var out closeBuffer
+	w := NewHeadTailWriter(&out, 2, 4)
+	w.SpillTo(f)
+	w.Write([]byte("abcdefgh"))
+	// the tail is on disk before Close, with the newest bytes first
+	// once it wraps
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ghef" {
+		t.Errorf("spilled %q, want %q", data, "ghef")
+	}
+	if w.ring != nil {
+		t.Errorf("buffered %d bytes in memory", len(w.ring))
+	}
+	w.Close()
+}
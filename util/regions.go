@@ -0,0 +1,175 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// RegionErrors maps each region in which an operation failed to its
+// last error.
+type RegionErrors map[string]error
+
+// Regions returns the failed regions, sorted.
+func (e RegionErrors) Regions() []string {
+	regions := make([]string, 0, len(e))
+	for region := range e {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+func (e RegionErrors) Error() string {
+	var msgs []string
+	for _, region := range e.Regions() {
+		msgs = append(msgs, fmt.Sprintf("%v: %v", region, e[region]))
+	}
+	return fmt.Sprintf("failed in %d region(s): %s", len(e), strings.Join(msgs, "; "))
+}
+
+type regionState struct {
+	region  string
+	state   string
+	attempt int
+	start   time.Time
+	elapsed time.Duration
+}
+
+// regionTable writes the state of each region to w. On a terminal the
+// whole table is redrawn in place, otherwise each change is written as
+// a single line.
+type regionTable struct {
+	mu    sync.Mutex
+	w     io.Writer
+	tty   bool
+	rows  []*regionState
+	drawn int
+}
+
+func newRegionTable(w io.Writer, regions []string) *regionTable {
+	t := &regionTable{w: w}
+	if f, ok := w.(*os.File); ok {
+		t.tty = terminal.IsTerminal(int(f.Fd()))
+	}
+	for _, region := range regions {
+		t.rows = append(t.rows, &regionState{region: region, state: "pending"})
+	}
+	return t
+}
+
+func (t *regionTable) set(i int, attempt int, state string) {
+	if t.w == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	row := t.rows[i]
+	if attempt != row.attempt {
+		row.attempt = attempt
+		row.start = time.Now()
+	}
+	row.state = state
+	row.elapsed = time.Since(row.start).Truncate(time.Second)
+
+	if !t.tty {
+		fmt.Fprintf(t.w, "%v: %v (attempt %d, %v)\n", row.region, row.state, row.attempt, row.elapsed)
+		return
+	}
+
+	var buf bytes.Buffer
+	if t.drawn > 0 {
+		// move to the start of the table and clear it
+		fmt.Fprintf(&buf, "\x1b[%dA\x1b[J", t.drawn)
+	}
+	tw := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tATTEMPT\tTIME\tSTATE")
+	for _, r := range t.rows {
+		fmt.Fprintf(tw, "%v\t%d\t%v\t%v\n", r.region, r.attempt, r.elapsed, r.state)
+	}
+	tw.Flush()
+	t.drawn = len(t.rows) + 1
+	t.w.Write(buf.Bytes())
+}
+
+// ForEachRegion calls f concurrently for every region. The regions that
+// fail are retried, again concurrently, until f has been called attempts
+// times for them, waiting delay before the first retry and twice as long
+// before each one after it. f must therefore be safe to call again after
+// a partial failure. A status table is written to w as regions change
+// state; w may be nil. If any region still fails, a RegionErrors is
+// returned.
+func ForEachRegion(w io.Writer, regions []string, attempts int, delay time.Duration, f func(region string) error) error {
+	table := newRegionTable(w, regions)
+	errs := make(RegionErrors)
+
+	pending := make([]int, len(regions))
+	for i := range regions {
+		pending[i] = i
+	}
+
+	for attempt := 1; attempt <= attempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			failed []int
+		)
+		for _, i := range pending {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				region := regions[i]
+				table.set(i, attempt, "running")
+				err := f(region)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs[region] = err
+					failed = append(failed, i)
+					table.set(i, attempt, fmt.Sprintf("failed: %v", err))
+				} else {
+					delete(errs, region)
+					table.set(i, attempt, "done")
+				}
+			}(i)
+		}
+		wg.Wait()
+		sort.Ints(failed)
+		pending = failed
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
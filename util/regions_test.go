@@ -0,0 +1,98 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForEachRegionRetriesFailed(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls = make(map[string][]time.Time)
+	)
+	// us-east-1 always fails, eu-west-1 fails once, the rest succeed.
+	f := func(region string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[region] = append(calls[region], time.Now())
+		switch {
+		case region == "us-east-1":
+			return errors.New("always")
+		case region == "eu-west-1" && len(calls[region]) == 1:
+			return errors.New("once")
+		}
+		return nil
+	}
+
+	regions := []string{"ap-south-1", "eu-west-1", "us-east-1", "us-west-2"}
+	delay := 20 * time.Millisecond
+	err := ForEachRegion(nil, regions, 3, delay, f)
+
+	errs, ok := err.(RegionErrors)
+	if !ok {
+		t.Fatalf("got error %v, expected RegionErrors", err)
+	}
+	if got := errs.Regions(); !reflect.DeepEqual(got, []string{"us-east-1"}) {
+		t.Errorf("failed regions %v, expected [us-east-1]", got)
+	}
+
+	counts := make(map[string]int)
+	for region, times := range calls {
+		counts[region] = len(times)
+	}
+	want := map[string]int{
+		"ap-south-1": 1,
+		"eu-west-1":  2,
+		"us-east-1":  3,
+		"us-west-2":  1,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("called f %v times, expected %v", counts, want)
+	}
+
+	// The retries of us-east-1 wait delay and then twice delay.
+	times := calls["us-east-1"]
+	for i, min := range []time.Duration{delay, 2 * delay} {
+		if gap := times[i+1].Sub(times[i]); gap < min {
+			t.Errorf("retry %d came %v after the previous attempt, expected at least %v", i+1, gap, min)
+		}
+	}
+}
+
+func TestForEachRegionSuccess(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	err := ForEachRegion(nil, []string{"a", "b"}, 3, time.Hour, func(region string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, region)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(calls)
+	if !reflect.DeepEqual(calls, []string{"a", "b"}) {
+		t.Errorf("called f for %v, expected each region once", calls)
+	}
+}